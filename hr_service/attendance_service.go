@@ -1,23 +1,69 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"time"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-// // The character encoding for the email.
-// CharSet = "UTF-8"
+	// // The character encoding for the email.
+	// CharSet = "UTF-8"
+
+	// Attendance Worked-Hours Fields, computed on Clock-Out
+	FLD_WORKED_HOURS    = "worked_hours"
+	FLD_BREAK_HOURS     = "break_hours"
+	FLD_NET_HOURS       = "net_hours"
+	FLD_SCHEDULED_HOURS = "scheduled_hours"
+	FLD_IS_LATE_IN      = "is_late_in"
+	FLD_LATE_IN_MINS    = "late_in_mins"
+	FLD_IS_EARLY_OUT    = "is_early_out"
+	FLD_EARLY_OUT_MINS  = "early_out_mins"
+
+	// Date of the shift the attendance is attributed to, differs from the
+	// Clock-In date for the punches after midnight of a cross-midnight shift
+	FLD_SHIFT_DATE = "shift_date"
+
+	// Attendance Session Status
+	FLD_ATTENDANCE_STATUS         = "attendance_status"
+	ATTENDANCE_STATUS_OPEN        = "open"
+	ATTENDANCE_STATUS_CLOSED      = "closed"
+	ATTENDANCE_STATUS_AUTO_CLOSED = "auto_closed"
+
+	// Attendance Session Error Codes
+	ERRCODE_ALREADY_CLOCKED_IN      = "S30111"
+	ERRCODE_ALREADY_CLOCKED_OUT     = "S30112"
+	ERRCODE_CLOCKOUT_BEFORE_CLOCKIN = "S30113"
+
+	// Sequence of the staff's attendance sessions kept in the staff record, the document id of
+	// the open session is derived from it so concurrent Clock-Ins can't both be inserted
+	FLD_ATTENDANCE_SEQ    = "attendance_seq"
+	MAX_CLOCK_IN_ATTEMPTS = 3
+
+	// Auto-Close of forgotten Clock-Ins
+	FLD_AUTO_CLOSED               = "auto_closed"
+	FLD_AUTO_CLOSE_GRACE_MINS     = "auto_close_grace_mins"
+	DEFAULT_AUTO_CLOSE_GRACE_MINS = 120
+	FLD_AUTO_CLOSED_COUNT         = "auto_closed_count"
+
+	// Geofence validation of Clock-In
+	FLD_GEOFENCE_MODE        = "geofence_mode"
+	FLD_GEOFENCE_DISTANCE    = "geofence_distance"
+	FLD_IS_OUTSIDE_GEOFENCE  = "is_outside_geofence"
+	GEOFENCE_MODE_FLAG       = "flag"
+	GEOFENCE_MODE_REJECT     = "reject"
+	DEFAULT_GEOFENCE_RADIUS  = 200 // in meters
+	ERRCODE_OUTSIDE_GEOFENCE = "S30114"
 )
 
 // AttendanceService - Attendances Service structure
@@ -32,6 +78,7 @@ type AttendanceService interface {
 	ClockInMany(indata utils.Map) (utils.Map, error)
 	ClockOut(attendance_id string, indata utils.Map) (utils.Map, error)
 	ClockOutMany(indata utils.Map) (utils.Map, error)
+	AutoCloseOpenSessions(asOf time.Time) (utils.Map, error)
 	Update(attendance_id string, indata utils.Map) (utils.Map, error)
 	Delete(attendance_id string, delete_permanent bool) error
 	DeleteAll(delete_permanent bool) error
@@ -45,16 +92,21 @@ type AttendanceService interface {
 
 // AttendanceBaseService - Attendances Service structure
 type attendanceBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoAttendance       hr_repository.AttendanceDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	daoPlatformAppUser  platform_repository.AppUserDao
 	daoStaff            hr_repository.StaffDao
+	daoShift            hr_repository.ShiftDao
+	daoWorkLocation     hr_repository.WorkLocationDao
 
 	child      AttendanceService
 	businessId string
 	staffId    string
+
+	autoCloseGraceMins int
+	geofenceMode       string
+	geofenceRadius     float64
 }
 
 func init() {
@@ -72,16 +124,9 @@ func NewAttendanceService(props utils.Map) (AttendanceService, error) {
 	}
 
 	p := attendanceBaseService{}
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -92,11 +137,29 @@ func NewAttendanceService(props utils.Map) (AttendanceService, error) {
 	p.businessId = businessId
 	p.staffId = staffId
 
+	// Grace window to auto-close forgotten Clock-Ins, this is optional parameter
+	p.autoCloseGraceMins, err = utils.GetMemberDataInt(props, FLD_AUTO_CLOSE_GRACE_MINS, true)
+	if err != nil {
+		p.autoCloseGraceMins = DEFAULT_AUTO_CLOSE_GRACE_MINS
+	}
+
+	// Geofence mode (flag/reject) and default radius for Clock-In, these are optional parameters
+	p.geofenceMode, err = utils.GetMemberDataStr(props, FLD_GEOFENCE_MODE)
+	if err != nil || p.geofenceMode != GEOFENCE_MODE_REJECT {
+		p.geofenceMode = GEOFENCE_MODE_FLAG
+	}
+	p.geofenceRadius, err = getMemberDataFloat(props, FLD_GEOFENCE_RADIUS)
+	if err != nil || p.geofenceRadius <= 0 {
+		p.geofenceRadius = DEFAULT_GEOFENCE_RADIUS
+	}
+
 	// Initialize services
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
-	p.daoPlatformAppUser = platform_repository.NewAppUserDao(p.GetClient())
-	p.daoAttendance = hr_repository.NewAttendanceDao(p.dbRegion.GetClient(), p.businessId, p.staffId)
-	p.daoStaff = hr_repository.NewStaffDao(p.dbRegion.GetClient(), p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
+	p.daoAttendance = p.NewAttendanceDao(p.businessId, p.staffId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoShift = p.NewShiftDao(p.businessId)
+	p.daoWorkLocation = p.NewWorkLocationDao(p.businessId)
 
 	// Verify the BusinessId is exist
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
@@ -126,8 +189,7 @@ func NewAttendanceService(props utils.Map) (AttendanceService, error) {
 }
 
 func (p *attendanceBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // ************************
@@ -204,7 +266,7 @@ func (p *attendanceBaseService) Find(filter string) (utils.Map, error) {
 // 	log.Println("AttendanceService::Create - Begin")
 
 // 	// Create AttendanceId
-// 	attendanceId := utils.GenerateUniqueId("atten")
+// 	attendanceId := utils.GenerateUniqueId(ID_PREFIX_ATTENDANCE)
 
 // 	if utils.IsEmpty(p.staffId) {
 // 		err := &utils.AppError{
@@ -238,7 +300,7 @@ func (p *attendanceBaseService) Find(filter string) (utils.Map, error) {
 // 	log.Println("AttendanceService::CreateMany - Begin")
 
 // 	// Create AttendanceId
-// 	attendanceId := utils.GenerateUniqueId("atten")
+// 	attendanceId := utils.GenerateUniqueId(ID_PREFIX_ATTENDANCE)
 
 // 	// Check staffId received in indata
 // 	staffId, _ := utils.GetMemberDataStr(indata, hr_common.FLD_STAFF_ID)
@@ -279,8 +341,14 @@ func (p *attendanceBaseService) ClockIn(indata utils.Map) (utils.Map, error) {
 		return indata, err
 	}
 
+	// Validate the punch location against staff's work location
+	err = p.validateGeofence(p.staffId, indata)
+	if err != nil {
+		return indata, err
+	}
+
 	// Create AttendanceId
-	attendanceId := utils.GenerateUniqueId("atten")
+	attendanceId := utils.GenerateUniqueId(ID_PREFIX_ATTENDANCE)
 
 	// Add Current DateTime
 	// indata[hr_common.FLD_DATETIME] = time.Now().UTC()
@@ -292,11 +360,19 @@ func (p *attendanceBaseService) ClockIn(indata utils.Map) (utils.Map, error) {
 	clockIn[hr_common.FLD_ATTENDANCE_ID] = attendanceId
 	clockIn[hr_common.FLD_BUSINESS_ID] = p.businessId
 	clockIn[hr_common.FLD_STAFF_ID] = p.staffId
+	clockIn[FLD_ATTENDANCE_STATUS] = ATTENDANCE_STATUS_OPEN
 
 	// Update Clock-In Interface back
 	clockIn[hr_common.FLD_CLOCK_IN] = indata
 
-	_, err = p.daoAttendance.Create(clockIn)
+	// Attribute to the shift date
+	p.assignShiftDate(clockIn)
+
+	// Reject when the staff already has an open session
+	err = p.createOpenSession(p.staffId, clockIn)
+	if err != nil {
+		return indata, err
+	}
 
 	log.Println("AttendanceService::ClockIn - End")
 	return clockIn, err
@@ -312,7 +388,7 @@ func (p *attendanceBaseService) ClockInMany(indata utils.Map) (utils.Map, error)
 	log.Println("AttendanceService::ClockInMany - Begin")
 
 	// Create AttendanceId
-	attendanceId := utils.GenerateUniqueId("atten")
+	attendanceId := utils.GenerateUniqueId(ID_PREFIX_ATTENDANCE)
 
 	// Check staffId received in indata
 	staffId, _ := utils.GetMemberDataStr(indata, hr_common.FLD_STAFF_ID)
@@ -327,6 +403,19 @@ func (p *attendanceBaseService) ClockInMany(indata utils.Map) (utils.Map, error)
 		return nil, err
 	}
 
+	// Reject when the time falls in a closed session
+	dateTime, _ := utils.GetMemberDataStr(indata, hr_common.FLD_DATETIME)
+	err = p.validateNoOverlapSession(staffId, dateTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the punch location against staff's work location
+	err = p.validateGeofence(staffId, indata)
+	if err != nil {
+		return nil, err
+	}
+
 	// Remove StaffId from indata
 	delete(indata, hr_common.FLD_STAFF_ID)
 
@@ -335,14 +424,22 @@ func (p *attendanceBaseService) ClockInMany(indata utils.Map) (utils.Map, error)
 	clockIn[hr_common.FLD_ATTENDANCE_ID] = attendanceId
 	clockIn[hr_common.FLD_BUSINESS_ID] = p.businessId
 	clockIn[hr_common.FLD_STAFF_ID] = staffId
+	clockIn[FLD_ATTENDANCE_STATUS] = ATTENDANCE_STATUS_OPEN
 
 	// Update Clock-In Interface back
 	clockIn[hr_common.FLD_CLOCK_IN] = indata
 
-	insertResult, err := p.daoAttendance.Create(clockIn)
+	// Attribute to the shift date
+	p.assignShiftDate(clockIn)
 
-	log.Println("AttendanceService::ClockInMany - End ", insertResult)
-	return clockIn, err
+	// Reject when the staff already has an open session
+	err = p.createOpenSession(staffId, clockIn)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AttendanceService::ClockInMany - End ", attendanceId)
+	return clockIn, nil
 
 }
 
@@ -360,6 +457,12 @@ func (p *attendanceBaseService) ClockOut(attendance_id string, indata utils.Map)
 		return indata, err
 	}
 
+	// Verify the session is still open
+	err = p.validateSessionOpen(data)
+	if err != nil {
+		return indata, err
+	}
+
 	// Get Timezone Location
 	loc, err := p.getTimezoneLocation(indata)
 	if err != nil {
@@ -372,6 +475,19 @@ func (p *attendanceBaseService) ClockOut(attendance_id string, indata utils.Map)
 
 	// Update Clock-In Interface back
 	data[hr_common.FLD_CLOCK_OUT] = indata
+	data[FLD_ATTENDANCE_STATUS] = ATTENDANCE_STATUS_CLOSED
+
+	// Verify Clock-Out is not before Clock-In
+	err = p.validateClockOutTime(data)
+	if err != nil {
+		return indata, err
+	}
+
+	// Compute the Worked Hours
+	err = p.computeWorkedHours(data)
+	if err != nil {
+		return indata, err
+	}
 
 	_, err = p.daoAttendance.Update(attendance_id, data)
 
@@ -400,11 +516,30 @@ func (p *attendanceBaseService) ClockOutMany(indata utils.Map) (utils.Map, error
 		return nil, err
 	}
 
+	// Verify the session is still open
+	err = p.validateSessionOpen(data)
+	if err != nil {
+		return nil, err
+	}
+
 	// Remove StaffId from indata
 	delete(indata, hr_common.FLD_ATTENDANCE_ID)
 
 	// Update Clock-In Interface back
 	data[hr_common.FLD_CLOCK_OUT] = indata
+	data[FLD_ATTENDANCE_STATUS] = ATTENDANCE_STATUS_CLOSED
+
+	// Verify Clock-Out is not before Clock-In
+	err = p.validateClockOutTime(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compute the Worked Hours
+	err = p.computeWorkedHours(data)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = p.daoAttendance.Update(attendanceId, data)
 
@@ -413,6 +548,74 @@ func (p *attendanceBaseService) ClockOutMany(indata utils.Map) (utils.Map, error
 
 }
 
+// **********************************************************************
+// AutoCloseOpenSessions - Close the sessions which are not clocked-out
+// till the shift end plus grace window, as of the given time
+//
+// **********************************************************************
+func (p *attendanceBaseService) AutoCloseOpenSessions(asOf time.Time) (utils.Map, error) {
+
+	log.Println("AttendanceService::AutoCloseOpenSessions - Begin", asOf)
+
+	// Attendance date_time values are stored in business local time
+	asOfTime, _ := time.Parse(time.DateTime, asOf.Format(time.DateTime))
+	graceDuration := time.Duration(p.autoCloseGraceMins) * time.Minute
+
+	filter := fmt.Sprintf(`{"%s":{"$exists":false},"%s.%s":{"$lt":"%s"},"%s":false}`,
+		hr_common.FLD_CLOCK_OUT,
+		hr_common.FLD_CLOCK_IN, hr_common.FLD_DATETIME, asOfTime.Format(time.DateTime),
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoAttendance.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	closedList := []utils.Map{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		for _, data := range dataList.([]utils.Map) {
+			attendanceId, _ := utils.GetMemberDataStr(data, hr_common.FLD_ATTENDANCE_ID)
+
+			clockInTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_IN)
+			if err != nil {
+				log.Println("AttendanceService::AutoCloseOpenSessions - Skipped ", attendanceId, err)
+				continue
+			}
+
+			closeTime := p.getAutoCloseTime(data, clockInTime)
+			if !asOfTime.After(closeTime.Add(graceDuration)) {
+				// Still within the shift or grace window
+				continue
+			}
+
+			data[hr_common.FLD_CLOCK_OUT] = utils.Map{
+				hr_common.FLD_DATETIME: closeTime.Format(time.DateTime),
+				FLD_AUTO_CLOSED:        true,
+			}
+			data[FLD_ATTENDANCE_STATUS] = ATTENDANCE_STATUS_AUTO_CLOSED
+
+			// Compute the Worked Hours
+			err = p.computeWorkedHours(data)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = p.daoAttendance.Update(attendanceId, data)
+			if err != nil {
+				return nil, err
+			}
+			closedList = append(closedList, data)
+		}
+	}
+
+	log.Println("AttendanceService::AutoCloseOpenSessions - End ", len(closedList))
+	return utils.Map{
+		FLD_AUTO_CLOSED_COUNT: len(closedList),
+		db_common.LIST_RESULT: closedList,
+	}, nil
+}
+
 // ************************
 // Update - Update Service
 //
@@ -421,6 +624,12 @@ func (p *attendanceBaseService) Update(attendance_id string, indata utils.Map) (
 
 	log.Println("AttendanceService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Attendance](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoAttendance.Get(attendance_id)
 	if err != nil {
 		return data, err
@@ -556,6 +765,408 @@ func (p *attendanceBaseService) validateDateTime(indata utils.Map) error {
 	return err
 }
 
+// validateNoOpenSession - Verify the staff does not have an open attendance session
+func (p *attendanceBaseService) validateNoOpenSession(staffId string) error {
+
+	filter := fmt.Sprintf(`{"%s":"%s","%s":"%s","%s":false}`,
+		hr_common.FLD_STAFF_ID, staffId,
+		FLD_ATTENDANCE_STATUS, ATTENDANCE_STATUS_OPEN,
+		db_common.FLD_IS_DELETED)
+
+	data, err := p.daoAttendance.Find(filter)
+	if err == nil && len(data) > 0 {
+		attendanceId, _ := utils.GetMemberDataStr(data, hr_common.FLD_ATTENDANCE_ID)
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_ALREADY_CLOCKED_IN,
+			ErrorMsg:    "Already Clocked In",
+			ErrorDetail: "Staff already has an open attendance session " + attendanceId}
+		return err
+	}
+	return nil
+}
+
+// createOpenSession - Insert the open session with the document id of the staff's next session,
+// concurrent Clock-Ins claim the same id and only one of them is inserted
+func (p *attendanceBaseService) createOpenSession(staffId string, clockIn utils.Map) error {
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return err
+	}
+	seq, _ := utils.GetMemberDataInt(staffInfo, FLD_ATTENDANCE_SEQ, true)
+
+	for attempt := 1; attempt <= MAX_CLOCK_IN_ATTEMPTS; attempt++ {
+		err = p.validateNoOpenSession(staffId)
+		if err != nil {
+			return err
+		}
+
+		seq++
+		clockIn[db_common.FLD_DEFAULT_ID] = fmt.Sprintf("%s_%s_%d", p.businessId, staffId, seq)
+		clockIn[FLD_ATTENDANCE_SEQ] = seq
+
+		_, err = p.daoAttendance.Create(clockIn)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+		// Id is taken by a concurrent Clock-In, or by the sessions the staff's sequence missed
+		log.Println("AttendanceService::createOpenSession - Session id taken ", clockIn[db_common.FLD_DEFAULT_ID])
+
+		lastSeq, errSeq := p.getLastSessionSeq(staffId)
+		if errSeq != nil {
+			return errSeq
+		}
+		if lastSeq > seq {
+			seq = lastSeq
+		}
+	}
+	delete(clockIn, db_common.FLD_DEFAULT_ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.daoStaff.Update(staffId, utils.Map{FLD_ATTENDANCE_SEQ: seq})
+	return err
+}
+
+// getLastSessionSeq - Get the highest session sequence recorded for the staff, including the
+// deleted sessions as their ids are still taken
+func (p *attendanceBaseService) getLastSessionSeq(staffId string) (int, error) {
+
+	filter := fmt.Sprintf(`{"%s":"%s"}`, hr_common.FLD_STAFF_ID, staffId)
+	sort := fmt.Sprintf(`{"%s":-1}`, FLD_ATTENDANCE_SEQ)
+
+	response, err := p.daoAttendance.List(filter, sort, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return 0, nil
+	}
+	sessions := dataList.([]utils.Map)
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	seq, _ := utils.GetMemberDataInt(sessions[0], FLD_ATTENDANCE_SEQ, true)
+	return seq, nil
+}
+
+// validateNoOverlapSession - Verify the given date_time does not fall within a closed session of the staff
+func (p *attendanceBaseService) validateNoOverlapSession(staffId string, dateTime string) error {
+
+	filter := fmt.Sprintf(`{"%s":"%s","%s.%s":{"$lte":"%s"},"%s.%s":{"$gte":"%s"},"%s":false}`,
+		hr_common.FLD_STAFF_ID, staffId,
+		hr_common.FLD_CLOCK_IN, hr_common.FLD_DATETIME, dateTime,
+		hr_common.FLD_CLOCK_OUT, hr_common.FLD_DATETIME, dateTime,
+		db_common.FLD_IS_DELETED)
+
+	data, err := p.daoAttendance.Find(filter)
+	if err == nil && len(data) > 0 {
+		attendanceId, _ := utils.GetMemberDataStr(data, hr_common.FLD_ATTENDANCE_ID)
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_ALREADY_CLOCKED_IN,
+			ErrorMsg:    "Already Clocked In",
+			ErrorDetail: "Given date_time overlaps the attendance session " + attendanceId}
+		return err
+	}
+	return nil
+}
+
+// validateSessionOpen - Verify the attendance session is clocked-in and not yet clocked-out
+func (p *attendanceBaseService) validateSessionOpen(data utils.Map) error {
+
+	status, _ := utils.GetMemberDataStr(data, FLD_ATTENDANCE_STATUS)
+	_, errClockOut := utils.GetMemberData(data, hr_common.FLD_CLOCK_OUT)
+	if errClockOut == nil || status == ATTENDANCE_STATUS_CLOSED || status == ATTENDANCE_STATUS_AUTO_CLOSED {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_ALREADY_CLOCKED_OUT,
+			ErrorMsg:    "Already Clocked Out",
+			ErrorDetail: "Given attendance session is already clocked out"}
+		return err
+	}
+
+	_, errClockIn := utils.GetMemberData(data, hr_common.FLD_CLOCK_IN)
+	if errClockIn != nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_CLOCKOUT_BEFORE_CLOCKIN,
+			ErrorMsg:    "Not Clocked In",
+			ErrorDetail: "Clock-Out is not allowed before Clock-In"}
+		return err
+	}
+	return nil
+}
+
+// validateClockOutTime - Verify the clock_out date_time is not earlier than clock_in date_time
+func (p *attendanceBaseService) validateClockOutTime(data utils.Map) error {
+
+	clockInTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_IN)
+	if err != nil {
+		// Nothing to compare with
+		return nil
+	}
+
+	clockOutTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_OUT)
+	if err == nil && clockOutTime.Before(clockInTime) {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_CLOCKOUT_BEFORE_CLOCKIN,
+			ErrorMsg:    "Invalid Clock-Out Time",
+			ErrorDetail: "clock_out date_time is earlier than clock_in date_time"}
+		return err
+	}
+	return nil
+}
+
+// validateGeofence - Validate the Clock-In latitude/longitude against the staff's assigned
+// work location, punches outside are rejected or flagged with the distance for review
+func (p *attendanceBaseService) validateGeofence(staffId string, indata utils.Map) error {
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil
+	}
+
+	// No work location assigned to the staff
+	workLocId, err := getStaffDataStr(staffInfo, hr_common.FLD_WORKLOCATION_ID)
+	if err != nil {
+		return nil
+	}
+
+	workLocInfo, err := p.daoWorkLocation.Get(workLocId)
+	if err != nil {
+		log.Println("AttendanceService::validateGeofence - Invalid work location ", workLocId, err)
+		return nil
+	}
+
+	// Work location doesn't have the coordinates, there is no geofence to check
+	if !hasGeofence(workLocInfo) {
+		return nil
+	}
+
+	latitude, errLat := getMemberDataFloat(indata, FLD_LATITUDE)
+	longitude, errLon := getMemberDataFloat(indata, FLD_LONGITUDE)
+	if errLat != nil || errLon != nil {
+		if p.geofenceMode == GEOFENCE_MODE_REJECT {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_OUTSIDE_GEOFENCE,
+				ErrorMsg:    "No Location",
+				ErrorDetail: "latitude and longitude should be sent"}
+			return err
+		}
+		indata[FLD_IS_OUTSIDE_GEOFENCE] = true
+		return nil
+	}
+
+	distance, inside, err := getGeofenceDistance(workLocInfo, latitude, longitude, p.geofenceRadius)
+	if err != nil {
+		return nil
+	}
+
+	indata[FLD_LATITUDE] = latitude
+	indata[FLD_LONGITUDE] = longitude
+	indata[hr_common.FLD_WORKLOCATION_ID] = workLocId
+	indata[FLD_GEOFENCE_DISTANCE] = math.Round(distance)
+	indata[FLD_IS_OUTSIDE_GEOFENCE] = !inside
+
+	if !inside && p.geofenceMode == GEOFENCE_MODE_REJECT {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_OUTSIDE_GEOFENCE,
+			ErrorMsg:    "Outside Work Location",
+			ErrorDetail: fmt.Sprintf("Clock-In is %.0f meters away from the work location", distance)}
+		return err
+	}
+	return nil
+}
+
+// getAutoCloseTime - Get the Clock-Out time for auto-close, which is the end of staff's shift
+// or the end of the Clock-In day when no shift is assigned
+func (p *attendanceBaseService) getAutoCloseTime(data utils.Map, clockInTime time.Time) time.Time {
+
+	closeTime := time.Date(clockInTime.Year(), clockInTime.Month(), clockInTime.Day(), 23, 59, 59, 0, clockInTime.Location())
+
+	shiftInfo, shiftDate, err := p.getAttendanceShift(data, clockInTime)
+	if err == nil {
+		_, shiftEnd, err := getShiftWindow(shiftInfo, shiftDate)
+		if err == nil {
+			closeTime = shiftEnd
+		}
+	}
+
+	// Clocked-In after the shift end
+	if closeTime.Before(clockInTime) {
+		closeTime = clockInTime
+	}
+	return closeTime
+}
+
+// computeWorkedHours - Compute the Worked, Break & Net hours and the Late/Early flags
+// by comparing the Clock-In & Clock-Out time against the staff's assigned shift
+func (p *attendanceBaseService) computeWorkedHours(data utils.Map) error {
+
+	clockInTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_IN)
+	if err != nil {
+		log.Println("AttendanceService::computeWorkedHours - Invalid clock_in->date_time ", err)
+		return nil
+	}
+
+	clockOutTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_OUT)
+	if err != nil {
+		return err
+	}
+
+	workedDuration := clockOutTime.Sub(clockInTime)
+	if workedDuration < 0 {
+		workedDuration = 0
+	}
+	breakDuration := time.Duration(0)
+
+	// Defaults when the staff has no shift assigned
+	data[FLD_IS_LATE_IN] = false
+	data[FLD_LATE_IN_MINS] = 0
+	data[FLD_IS_EARLY_OUT] = false
+	data[FLD_EARLY_OUT_MINS] = 0
+
+	shiftInfo, shiftDate, err := p.getAttendanceShift(data, clockInTime)
+	data[FLD_SHIFT_DATE] = shiftDate.Format(time.DateOnly)
+	if err == nil {
+		shiftStart, shiftEnd, err := getShiftWindow(shiftInfo, shiftDate)
+		if err == nil {
+			scheduledDuration := shiftEnd.Sub(shiftStart)
+
+			breakStart, breakEnd, err := getBreakWindow(shiftInfo, shiftStart)
+			if err == nil {
+				breakDuration = getOverlapDuration(clockInTime, clockOutTime, breakStart, breakEnd)
+				scheduledDuration -= breakEnd.Sub(breakStart)
+			}
+			data[FLD_SCHEDULED_HOURS] = roundTo2Decimals(scheduledDuration.Hours())
+
+			// Check Late-In with grace period
+			lateGrace, _ := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_LATE_GRACE_MINS, true)
+			if clockInTime.After(shiftStart.Add(time.Duration(lateGrace) * time.Minute)) {
+				data[FLD_IS_LATE_IN] = true
+				data[FLD_LATE_IN_MINS] = int(clockInTime.Sub(shiftStart).Minutes())
+			}
+
+			// Check Early-Out with grace period
+			earlyGrace, _ := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_EARLY_GRACE_MINS, true)
+			if clockOutTime.Before(shiftEnd.Add(-time.Duration(earlyGrace) * time.Minute)) {
+				data[FLD_IS_EARLY_OUT] = true
+				data[FLD_EARLY_OUT_MINS] = int(shiftEnd.Sub(clockOutTime).Minutes())
+			}
+		} else {
+			log.Println("AttendanceService::computeWorkedHours - Invalid shift timings ", err)
+		}
+	}
+
+	data[FLD_WORKED_HOURS] = roundTo2Decimals(workedDuration.Hours())
+	data[FLD_BREAK_HOURS] = roundTo2Decimals(breakDuration.Hours())
+	data[FLD_NET_HOURS] = roundTo2Decimals((workedDuration - breakDuration).Hours())
+
+	return nil
+}
+
+// getPunchDateTime - Get the date_time of clock_in/clock_out sub-document
+func (p *attendanceBaseService) getPunchDateTime(data utils.Map, punchField string) (time.Time, error) {
+
+	punchData, err := getMemberDataMap(data, punchField)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dateTime, err := utils.GetMemberDataStr(punchData, hr_common.FLD_DATETIME)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.DateTime, dateTime)
+}
+
+// assignShiftDate - Set the shift date of the Clock-In attendance
+func (p *attendanceBaseService) assignShiftDate(data utils.Map) {
+
+	clockInTime, err := p.getPunchDateTime(data, hr_common.FLD_CLOCK_IN)
+	if err != nil {
+		return
+	}
+
+	_, shiftDate, _ := p.getAttendanceShift(data, clockInTime)
+	data[FLD_SHIFT_DATE] = shiftDate.Format(time.DateOnly)
+}
+
+// getAttendanceShift - Get the Shift & shift date of the attendance. When the shift date is
+// not yet assigned, a Clock-In before the end of previous day's shift (e.g. 02:00 for a
+// 22:00 - 06:00 shift) is attributed to the previous day, else to the Clock-In date
+func (p *attendanceBaseService) getAttendanceShift(data utils.Map, clockInTime time.Time) (utils.Map, time.Time, error) {
+
+	staffId, _ := utils.GetMemberDataStr(data, hr_common.FLD_STAFF_ID)
+
+	shiftDateStr, err := utils.GetMemberDataStr(data, FLD_SHIFT_DATE)
+	if err == nil {
+		shiftDate, err := time.ParseInLocation(time.DateOnly, shiftDateStr, clockInTime.Location())
+		if err == nil {
+			shiftInfo, err := p.getStaffShift(staffId, shiftDate)
+			return shiftInfo, shiftDate, err
+		}
+	}
+
+	clockInDate := truncateToDate(clockInTime)
+
+	prevDate := clockInDate.AddDate(0, 0, -1)
+	prevShiftInfo, err := p.getStaffShift(staffId, prevDate)
+	if err == nil {
+		_, prevShiftEnd, err := getShiftWindow(prevShiftInfo, prevDate)
+		if err == nil && clockInTime.Before(prevShiftEnd) {
+			return prevShiftInfo, prevDate, nil
+		}
+	}
+
+	shiftInfo, err := p.getStaffShift(staffId, clockInDate)
+	return shiftInfo, clockInDate, err
+}
+
+// getStaffShift - Get the Shift of the staff on the given date, the roster assignment
+// of the date takes precedence over the Shift assigned to the staff
+func (p *attendanceBaseService) getStaffShift(staffId string, date time.Time) (utils.Map, error) {
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	var shiftId string
+	assignment, ok := getRosterAssignment(staffInfo, date.Format(time.DateOnly))
+	if ok {
+		shiftId, err = utils.GetMemberDataStr(assignment, hr_common.FLD_SHIFT_ID)
+	} else {
+		shiftId, err = getStaffDataStr(staffInfo, hr_common.FLD_SHIFT_ID)
+	}
+	if err != nil {
+		// No shift or a week-off in the roster
+		return nil, err
+	}
+
+	return p.daoShift.Get(shiftId)
+}
+
+// getOverlapDuration - Get the overlapping duration of two time ranges
+func getOverlapDuration(fromA time.Time, toA time.Time, fromB time.Time, toB time.Time) time.Duration {
+	start := fromA
+	if fromB.After(start) {
+		start = fromB
+	}
+
+	end := toA
+	if toB.Before(end) {
+		end = toB
+	}
+
+	if end.After(start) {
+		return end.Sub(start)
+	}
+	return 0
+}
+
 func (p *attendanceBaseService) lookupAppuser(response utils.Map) {
 
 	// Enumerate All staffs and lookup platform_app_user table
@@ -0,0 +1,201 @@
+package hr_service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestGeofence(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_office",
+			hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_WORKLOCATION_ID: "loc_office"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_field",
+			hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_WORKLOCATION_ID: "loc_field"}})
+	provider.Seed(MEMORY_COLLECTION_WORK_LOCATIONS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_WORKLOCATION_ID: "loc_office",
+			FLD_LATITUDE: 13.0827, FLD_LONGITUDE: 80.2707, FLD_GEOFENCE_RADIUS: 100},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_WORKLOCATION_ID: "loc_field"})
+
+	props[FLD_GEOFENCE_MODE] = GEOFENCE_MODE_REJECT
+	attendanceService, err := NewAttendanceService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attendanceService.EndService()
+	p := attendanceService.(*attendanceBaseService)
+
+	tests := []struct {
+		name      string
+		staffId   string
+		indata    utils.Map
+		errorCode string
+	}{
+		{"no geofence without location", "staff_field", utils.Map{}, ""},
+		{"no geofence with location", "staff_field", utils.Map{FLD_LATITUDE: 12.0, FLD_LONGITUDE: 79.0}, ""},
+		{"geofence without location", "staff_office", utils.Map{}, ERRCODE_OUTSIDE_GEOFENCE},
+		{"inside geofence", "staff_office", utils.Map{FLD_LATITUDE: 13.0828, FLD_LONGITUDE: 80.2707}, ""},
+		{"outside geofence", "staff_office", utils.Map{FLD_LATITUDE: 13.0927, FLD_LONGITUDE: 80.2707}, ERRCODE_OUTSIDE_GEOFENCE},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := p.validateGeofence(test.staffId, test.indata)
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCreateOpenSession(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", FLD_ATTENDANCE_SEQ: 1})
+
+	// Sessions recorded without updating the staff's sequence
+	for seq := 1; seq <= MAX_CLOCK_IN_ATTEMPTS+2; seq++ {
+		provider.Seed(MEMORY_COLLECTION_ATTENDANCES, utils.Map{
+			db_common.FLD_DEFAULT_ID:    fmt.Sprintf("%s_staff_1_%d", testBusinessId, seq),
+			hr_common.FLD_BUSINESS_ID:   testBusinessId,
+			hr_common.FLD_STAFF_ID:      "staff_1",
+			hr_common.FLD_ATTENDANCE_ID: fmt.Sprintf("attendance_%d", seq),
+			FLD_ATTENDANCE_SEQ:          seq,
+			FLD_ATTENDANCE_STATUS:       ATTENDANCE_STATUS_CLOSED,
+			db_common.FLD_IS_DELETED:    seq == 2,
+		})
+	}
+
+	props[hr_common.FLD_STAFF_ID] = "staff_1"
+	attendanceService, err := NewAttendanceService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attendanceService.EndService()
+	p := attendanceService.(*attendanceBaseService)
+
+	err = p.createOpenSession("staff_1", utils.Map{
+		hr_common.FLD_STAFF_ID:      "staff_1",
+		hr_common.FLD_ATTENDANCE_ID: "attendance_open",
+		FLD_ATTENDANCE_STATUS:       ATTENDANCE_STATUS_OPEN})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSeq := MAX_CLOCK_IN_ATTEMPTS + 3
+	sessionInfo, err := p.daoAttendance.Get("attendance_open")
+	if err != nil || sessionInfo[FLD_ATTENDANCE_SEQ] != expectedSeq {
+		t.Errorf("Expected session %d, got %v %v", expectedSeq, sessionInfo, err)
+	}
+	staffInfo, _ := p.daoStaff.Get("staff_1")
+	if staffInfo[FLD_ATTENDANCE_SEQ] != expectedSeq {
+		t.Errorf("Expected staff sequence %d, got %v", expectedSeq, staffInfo[FLD_ATTENDANCE_SEQ])
+	}
+
+	// Open session is kept as the only one
+	err = p.createOpenSession("staff_1", utils.Map{hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_ATTENDANCE_ID: "attendance_other"})
+	assertErrorCode(t, err, ERRCODE_ALREADY_CLOCKED_IN)
+}
+
+func TestComputeWorkedHours(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_SHIFTS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_ID: "shift_day",
+			hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00",
+			FLD_SHIFT_BREAK_FROM: "13:00:00", FLD_SHIFT_BREAK_TO: "14:00:00",
+			FLD_SHIFT_LATE_GRACE_MINS: 10, FLD_SHIFT_EARLY_GRACE_MINS: 10},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_ID: "shift_night",
+			hr_common.FLD_SHIFT_FROM: "22:00:00", hr_common.FLD_SHIFT_TO: "06:00:00",
+			FLD_SHIFT_BREAK_FROM: "02:00:00", FLD_SHIFT_BREAK_TO: "02:30:00"})
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_SHIFT_ID: "shift_day"},
+			FLD_ROSTER:               []utils.Map{{FLD_ROSTER_DATE: "2030-01-08", hr_common.FLD_SHIFT_ID: "shift_night"}}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2"})
+
+	attendanceService, err := NewAttendanceService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attendanceService.EndService()
+	p := attendanceService.(*attendanceBaseService)
+
+	type workedHours struct {
+		shiftDate    string
+		worked       float64
+		breakHours   float64
+		net          float64
+		scheduled    float64
+		lateInMins   int
+		earlyOutMins int
+	}
+
+	tests := []struct {
+		name      string
+		staffId   string
+		clockIn   string
+		clockOut  string
+		shiftDate string
+		expected  workedHours
+	}{
+		{"on time", "staff_1", "2030-01-07 09:00:00", "2030-01-07 18:00:00", "",
+			workedHours{"2030-01-07", 9, 1, 8, 8, 0, 0}},
+		{"within grace", "staff_1", "2030-01-07 09:08:00", "2030-01-07 17:55:00", "",
+			workedHours{"2030-01-07", 8.78, 1, 7.78, 8, 0, 0}},
+		{"late in and early out", "staff_1", "2030-01-07 09:30:00", "2030-01-07 17:00:00", "",
+			workedHours{"2030-01-07", 7.5, 1, 6.5, 8, 30, 60}},
+		{"part of the break", "staff_1", "2030-01-07 09:00:00", "2030-01-07 13:30:00", "",
+			workedHours{"2030-01-07", 4.5, 0.5, 4, 8, 0, 270}},
+		{"rostered night shift across midnight", "staff_1", "2030-01-08 22:00:00", "2030-01-09 06:00:00", "",
+			workedHours{"2030-01-08", 8, 0.5, 7.5, 7.5, 0, 0}},
+		{"clock-in after midnight attributed to previous day", "staff_1", "2030-01-09 00:30:00", "2030-01-09 06:00:00", "",
+			workedHours{"2030-01-08", 5.5, 0.5, 5, 7.5, 150, 0}},
+		{"next day shift after the night shift", "staff_1", "2030-01-09 09:00:00", "2030-01-09 18:00:00", "",
+			workedHours{"2030-01-09", 9, 1, 8, 8, 0, 0}},
+		{"assigned shift date kept", "staff_1", "2030-01-09 05:00:00", "2030-01-09 18:00:00", "2030-01-09",
+			workedHours{"2030-01-09", 13, 1, 12, 8, 0, 0}},
+		{"clock-out before clock-in", "staff_1", "2030-01-07 09:00:00", "2030-01-07 08:00:00", "",
+			workedHours{"2030-01-07", 0, 0, 0, 8, 0, 600}},
+		{"staff without shift", "staff_2", "2030-01-07 10:00:00", "2030-01-07 12:00:00", "",
+			workedHours{"2030-01-07", 2, 0, 2, 0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := utils.Map{
+				hr_common.FLD_STAFF_ID:  test.staffId,
+				hr_common.FLD_CLOCK_IN:  utils.Map{hr_common.FLD_DATETIME: test.clockIn},
+				hr_common.FLD_CLOCK_OUT: utils.Map{hr_common.FLD_DATETIME: test.clockOut},
+			}
+			if test.shiftDate != "" {
+				data[FLD_SHIFT_DATE] = test.shiftDate
+			}
+
+			err := p.computeWorkedHours(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scheduled, _ := data[FLD_SCHEDULED_HOURS].(float64)
+			result := workedHours{data[FLD_SHIFT_DATE].(string), data[FLD_WORKED_HOURS].(float64), data[FLD_BREAK_HOURS].(float64),
+				data[FLD_NET_HOURS].(float64), scheduled, data[FLD_LATE_IN_MINS].(int), data[FLD_EARLY_OUT_MINS].(int)}
+			if result != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, result)
+			}
+			if data[FLD_IS_LATE_IN] != (test.expected.lateInMins > 0) || data[FLD_IS_EARLY_OUT] != (test.expected.earlyOutMins > 0) {
+				t.Errorf("Expected late-in %d & early-out %d flags, got %v", test.expected.lateInMins, test.expected.earlyOutMins, data)
+			}
+		})
+	}
+}
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type ClientService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(clientId string, indata utils.Map) (utils.Map, error)
 	Delete(clientId string, delete_permanent bool) error
+	DeleteAndReassign(clientId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +29,9 @@ type ClientService interface {
 
 // ClientBaseService - Clients Service structure
 type clientBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoClient           hr_repository.ClientDao
+	daoProject          hr_repository.ProjectDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               ClientService
 	businessID          string
@@ -55,25 +53,19 @@ func NewClientService(props utils.Map) (ClientService, error) {
 	}
 
 	p := clientBaseService{}
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoClient = hr_repository.NewClientDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoClient = p.NewClientDao(p.businessID)
+	p.daoProject = p.NewProjectDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -90,8 +82,7 @@ func NewClientService(props utils.Map) (ClientService, error) {
 }
 
 func (p *clientBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -130,20 +121,20 @@ func (p *clientBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var clientId string
+	// Validate the payload fields
+	err := normalizePayload[Client](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_CLIENT_ID]
-	if dataok {
-		clientId = strings.ToLower(dataval.(string))
-	} else {
-		clientId = utils.GenerateUniqueId("clnt")
-		log.Println("Unique Client ID", clientId)
+	clientId, err := getPayloadId(indata, hr_common.FLD_CLIENT_ID, ID_PREFIX_CLIENT)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_CLIENT_ID] = clientId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Client ID:", clientId)
 
-	_, err := p.daoClient.Get(clientId)
+	_, err = p.daoClient.Get(clientId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Client ID !", ErrorDetail: "Given Client ID already exist"}
 		return indata, err
@@ -162,6 +153,12 @@ func (p *clientBaseService) Update(clientId string, indata utils.Map) (utils.Map
 
 	log.Println("ClientService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Client](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoClient.Get(clientId)
 	if err != nil {
 		return data, err
@@ -187,6 +184,12 @@ func (p *clientBaseService) Delete(clientId string, delete_permanent bool) error
 		return err
 	}
 
+	// Records still referring the client can't be deleted
+	err = checkReferences(p.getReferences(), "Client", clientId)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoClient.Delete(clientId)
 		if err != nil {
@@ -206,6 +209,34 @@ func (p *clientBaseService) Delete(clientId string, delete_permanent bool) error
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the client to another client
+// and delete the client
+//
+// ************************************************************************
+func (p *clientBaseService) DeleteAndReassign(clientId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("ClientService::DeleteAndReassign - Begin", clientId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Client", p.daoClient, p.getReferences(), clientId, reassign_id, func() error {
+		return p.Delete(clientId, delete_permanent)
+	})
+	log.Println("ClientService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the client
+func (p *clientBaseService) getReferences() []recordReference {
+	return []recordReference{
+		{
+			referenceType: REFERENCE_TYPE_PROJECT,
+			idField:       hr_common.FLD_PROJECT_ID,
+			fields:        []string{hr_common.FLD_CLIENT_ID},
+			dao:           p.daoProject,
+		},
+	}
+}
+
 func (p *clientBaseService) errorReturn(err error) (ClientService, error) {
 	// Close the Database Connection
 	p.EndService()
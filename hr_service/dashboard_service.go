@@ -3,11 +3,9 @@ package hr_service
 import (
 	"log"
 
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -23,8 +21,7 @@ type DashboardService interface {
 }
 
 type dashboardBaseService struct {
-	db_utils.DatabaseService
-	dbRegion     db_utils.DatabaseService
+	DaoProvider
 	daoDashboard hr_repository.DashboardDao
 	daoBusiness  platform_repository.BusinessDao
 	child        DashboardService
@@ -49,19 +46,12 @@ func NewDashboardService(props utils.Map) (DashboardService, error) {
 
 	p := dashboardBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Verify whether the User id data passed, this is optional parameter
 	staffID, _ := utils.GetMemberDataStr(props, hr_common.FLD_STAFF_ID)
 
@@ -70,8 +60,8 @@ func NewDashboardService(props utils.Map) (DashboardService, error) {
 	p.staffID = staffID
 
 	// Instantiate other services
-	p.daoDashboard = hr_repository.NewDashboardDao(p.dbRegion.GetClient(), p.businessID, p.staffID)
-	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoDashboard = p.NewDashboardDao(p.businessID, p.staffID)
+	p.daoBusiness = p.NewBusinessDao()
 
 	_, err = p.daoBusiness.Get(businessId)
 	if err != nil {
@@ -98,8 +88,7 @@ func NewDashboardService(props utils.Map) (DashboardService, error) {
 
 func (p *dashboardBaseService) EndService() {
 	log.Printf("EndDashboardMongoService ")
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // GetDashboardData retrieves dashboard data
@@ -1,18 +1,35 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
 	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Department Hierarchy Fields
+	FLD_DEPARTMENT_PARENT_ID       = "parent_department_id"
+	FLD_DEPARTMENT_HEAD_ID         = "head_staff_id"
+	FLD_DEPARTMENT_COST_CENTRE     = "cost_centre_code"
+	FLD_DEPARTMENT_HEADCOUNT       = "headcount"
+	FLD_DEPARTMENT_TOTAL_HEADCOUNT = "total_headcount"
+	MAX_DEPARTMENT_DEPTH           = 100
+
+	// Referring record type for the child departments
+	REFERENCE_TYPE_DEPARTMENT = "department"
+
+	// Department Hierarchy Error Codes
+	ERRCODE_INVALID_PARENT_DEPARTMENT = "S30181"
+	ERRCODE_DEPARTMENT_CYCLE          = "S30182"
+	ERRCODE_INVALID_DEPARTMENT_HEAD   = "S30183"
+)
+
 // DepartmentService - Departments Service structure
 type DepartmentService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -23,6 +40,10 @@ type DepartmentService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(departmentid string, indata utils.Map) (utils.Map, error)
 	Delete(departmentid string, delete_permanent bool) error
+	DeleteAndReassign(department_id string, reassign_id string, delete_permanent bool) error
+
+	GetSubtree(department_id string) (utils.Map, error)
+	GetHeadcount(department_id string) (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -32,9 +53,10 @@ type DepartmentService interface {
 }
 
 type departmentBaseService struct {
-	db_utils.DatabaseService
-	dbRegion      db_utils.DatabaseService
+	DaoProvider
 	daoDepartment hr_repository.DepartmentDao
+	daoStaff      hr_repository.StaffDao
+	daoHoliday    hr_repository.HolidayDao
 	daoBusiness   platform_repository.BusinessDao
 	child         DepartmentService
 	businessID    string
@@ -55,15 +77,10 @@ func NewDepartmentService(props utils.Map) (DepartmentService, error) {
 	}
 
 	p := departmentBaseService{}
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -87,14 +104,15 @@ func NewDepartmentService(props utils.Map) (DepartmentService, error) {
 
 func (p *departmentBaseService) EndService() {
 	log.Printf("EndDepartmentMongoService ")
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 func (p *departmentBaseService) initializeService() {
 	log.Printf("DepartmentMongoService:: GetBusinessDao ")
-	p.daoDepartment = hr_repository.NewDepartmentDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoDepartment = p.NewDepartmentDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoHoliday = p.NewHolidayDao(p.businessID)
+	p.daoBusiness = p.NewBusinessDao()
 }
 
 // List - List All records
@@ -141,26 +159,32 @@ func (p *departmentBaseService) Find(filter string) (utils.Map, error) {
 func (p *departmentBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var deptId string
 
-	dataval, dataok := indata[hr_common.FLD_DEPARTMENT_ID]
-	if dataok {
-		deptId = strings.ToLower(dataval.(string))
-	} else {
-		deptId = utils.GenerateUniqueId("dept")
-		log.Println("Unique Department ID", deptId)
+	// Validate the payload fields
+	err := normalizePayload[Department](indata, false)
+	if err != nil {
+		return indata, err
 	}
 
-	indata[hr_common.FLD_DEPARTMENT_ID] = deptId
+	deptId, err := getPayloadId(indata, hr_common.FLD_DEPARTMENT_ID, ID_PREFIX_DEPARTMENT)
+	if err != nil {
+		return indata, err
+	}
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
-	log.Println("Provided Department ID:", dataval)
+	log.Println("Provided Department ID:", deptId)
 
-	_, err := p.daoDepartment.Get(deptId)
+	_, err = p.daoDepartment.Get(deptId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Department ID !", ErrorDetail: "Given Department ID already exist"}
 		return indata, err
 	}
 
+	// Parent department shouldn't create a cycle in the hierarchy
+	err = p.validateDepartment(deptId, indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoDepartment.Create(indata)
 	if err != nil {
 		return indata, err
@@ -174,6 +198,12 @@ func (p *departmentBaseService) Update(department_id string, indata utils.Map) (
 
 	log.Println("DepartmentService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Department](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoDepartment.Get(department_id)
 	if err != nil {
 		return data, err
@@ -182,6 +212,12 @@ func (p *departmentBaseService) Update(department_id string, indata utils.Map) (
 	delete(indata, hr_common.FLD_BUSINESS_ID)
 	delete(indata, hr_common.FLD_DEPARTMENT_ID)
 
+	// Parent department shouldn't create a cycle in the hierarchy
+	err = p.validateDepartment(department_id, indata)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err = p.daoDepartment.Update(department_id, indata)
 	log.Println("DepartmentService::Update - End ")
 	return data, err
@@ -198,6 +234,12 @@ func (p *departmentBaseService) Delete(department_id string, delete_permanent bo
 		return err
 	}
 
+	// Records still referring the department can't be deleted
+	err = checkReferences(p.getReferences(), "Department", department_id)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoDepartment.Delete(department_id)
 		if err != nil {
@@ -217,8 +259,266 @@ func (p *departmentBaseService) Delete(department_id string, delete_permanent bo
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the department to another department
+// and delete the department
+//
+// ************************************************************************
+func (p *departmentBaseService) DeleteAndReassign(department_id string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("DepartmentService::DeleteAndReassign - Begin", department_id, reassign_id)
+
+	// Child departments moved under a department of their own subtree would form a cycle
+	subtree, err := p.getSubtree(department_id)
+	if err != nil {
+		return err
+	}
+	for _, deptInfo := range subtree[1:] {
+		deptId, _ := utils.GetMemberDataStr(deptInfo, hr_common.FLD_DEPARTMENT_ID)
+		if deptId == reassign_id {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_DEPARTMENT_CYCLE,
+				ErrorMsg:    "Department Cycle",
+				ErrorDetail: "Department " + department_id + " can't be reassigned to " + reassign_id + " which is under the department"}
+			return err
+		}
+	}
+
+	err = deleteAndReassign(p.DaoProvider, "Department", p.daoDepartment, p.getReferences(), department_id, reassign_id, func() error {
+		return p.Delete(department_id, delete_permanent)
+	})
+	log.Println("DepartmentService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the department
+func (p *departmentBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_DEPARTMENT_ID),
+		{
+			referenceType: REFERENCE_TYPE_HOLIDAY,
+			idField:       hr_common.FLD_HOLIDAY_ID,
+			fields:        []string{FLD_HOLIDAY_DEPARTMENT_IDS},
+			dao:           p.daoHoliday,
+		},
+		{
+			referenceType: REFERENCE_TYPE_DEPARTMENT,
+			idField:       hr_common.FLD_DEPARTMENT_ID,
+			fields:        []string{FLD_DEPARTMENT_PARENT_ID},
+			dao:           p.daoDepartment,
+		},
+	}
+}
+
+// ************************************************************************
+// GetSubtree - Get the department and its child departments level by level
+//
+// ************************************************************************
+func (p *departmentBaseService) GetSubtree(department_id string) (utils.Map, error) {
+
+	log.Println("DepartmentService::GetSubtree - Begin", department_id)
+
+	departments, err := p.getSubtree(department_id)
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		hr_common.FLD_DEPARTMENT_ID: department_id,
+		db_common.LIST_RESULTSIZE:   len(departments),
+		db_common.LIST_RESULT:       departments,
+	}
+
+	log.Println("DepartmentService::GetSubtree - End", len(departments))
+	return response, nil
+}
+
+// ************************************************************************
+// GetHeadcount - Get the headcount of each department in the subtree, the
+// total headcount rolls up the headcount of the child departments
+//
+// ************************************************************************
+func (p *departmentBaseService) GetHeadcount(department_id string) (utils.Map, error) {
+
+	log.Println("DepartmentService::GetHeadcount - Begin", department_id)
+
+	departments, err := p.getSubtree(department_id)
+	if err != nil {
+		return nil, err
+	}
+
+	deptIds := []string{}
+	for _, deptInfo := range departments {
+		deptId, _ := utils.GetMemberDataStr(deptInfo, hr_common.FLD_DEPARTMENT_ID)
+		deptIds = append(deptIds, deptId)
+	}
+
+	headcounts, err := p.getHeadcounts(deptIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Departments are in level order, roll up from the deepest level
+	totals := map[string]int{}
+	for i := len(departments) - 1; i >= 0; i-- {
+		deptId := deptIds[i]
+		totals[deptId] += headcounts[deptId]
+		departments[i][FLD_DEPARTMENT_HEADCOUNT] = headcounts[deptId]
+		departments[i][FLD_DEPARTMENT_TOTAL_HEADCOUNT] = totals[deptId]
+
+		if i > 0 {
+			parentId, _ := utils.GetMemberDataStr(departments[i], FLD_DEPARTMENT_PARENT_ID)
+			totals[parentId] += totals[deptId]
+		}
+	}
+
+	response := utils.Map{
+		hr_common.FLD_DEPARTMENT_ID:    department_id,
+		FLD_DEPARTMENT_HEADCOUNT:       headcounts[department_id],
+		FLD_DEPARTMENT_TOTAL_HEADCOUNT: totals[department_id],
+		db_common.LIST_RESULTSIZE:      len(departments),
+		db_common.LIST_RESULT:          departments,
+	}
+
+	log.Println("DepartmentService::GetHeadcount - End", totals[department_id])
+	return response, nil
+}
+
 func (p *departmentBaseService) errorReturn(err error) (DepartmentService, error) {
 	// Close the Database Connection
 	p.EndService()
 	return nil, err
 }
+
+// getSubtree - Get the department along with the child departments in level order
+func (p *departmentBaseService) getSubtree(departmentId string) ([]utils.Map, error) {
+
+	deptInfo, err := p.daoDepartment.Get(departmentId)
+	if err != nil {
+		return nil, err
+	}
+	deptInfo[FLD_ORG_LEVEL] = 0
+
+	departments := []utils.Map{deptInfo}
+	visited := map[string]bool{departmentId: true}
+	parentIds := []string{departmentId}
+	for level := 1; len(parentIds) > 0 && level <= MAX_DEPARTMENT_DEPTH; level++ {
+		nextParentIds := []string{}
+		for _, parentId := range parentIds {
+			filter := fmt.Sprintf(`{"%s":"%s","%s":false}`, FLD_DEPARTMENT_PARENT_ID, parentId, db_common.FLD_IS_DELETED)
+			response, err := p.daoDepartment.List(filter, "", 0, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+			if err != nil {
+				continue
+			}
+
+			for _, childInfo := range dataList.([]utils.Map) {
+				childId, _ := utils.GetMemberDataStr(childInfo, hr_common.FLD_DEPARTMENT_ID)
+				if visited[childId] {
+					continue
+				}
+				visited[childId] = true
+
+				childInfo[FLD_ORG_LEVEL] = level
+				departments = append(departments, childInfo)
+				nextParentIds = append(nextParentIds, childId)
+			}
+		}
+		parentIds = nextParentIds
+	}
+	return departments, nil
+}
+
+// getHeadcounts - Count the staffs of each department, staffs exited are not counted
+func (p *departmentBaseService) getHeadcounts(deptIds []string) (map[string]int, error) {
+
+	headcounts := map[string]int{}
+	if len(deptIds) == 0 {
+		return headcounts, nil
+	}
+
+	deptIdList := `"` + strings.Join(deptIds, `","`) + `"`
+	filter := fmt.Sprintf(`{"$or":[{"%s":{"$in":[%s]}},{"%s.%s":{"$in":[%s]}}],"%s":false}`,
+		hr_common.FLD_DEPARTMENT_ID, deptIdList,
+		hr_common.FLD_STAFF_DATA, hr_common.FLD_DEPARTMENT_ID, deptIdList,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoStaff.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return headcounts, nil
+	}
+
+	for _, staffInfo := range dataList.([]utils.Map) {
+		status, _ := getStaffDataStr(staffInfo, FLD_EMPLOYMENT_STATUS)
+		if status == EMPLOYMENT_STATUS_RESIGNED || status == EMPLOYMENT_STATUS_TERMINATED {
+			continue
+		}
+
+		deptId, _ := getStaffDataStr(staffInfo, hr_common.FLD_DEPARTMENT_ID)
+		headcounts[deptId]++
+	}
+	return headcounts, nil
+}
+
+// validateDepartment - Verify the parent department & head staff given in the data exist and the
+// department doesn't end up as a parent of itself directly or through the parent departments
+func (p *departmentBaseService) validateDepartment(departmentId string, indata utils.Map) error {
+
+	parentId, err := utils.GetMemberDataStr(indata, FLD_DEPARTMENT_PARENT_ID)
+	if err == nil && parentId != "" {
+		departmentCycle := &utils.AppError{
+			ErrorCode:   ERRCODE_DEPARTMENT_CYCLE,
+			ErrorMsg:    "Department Cycle",
+			ErrorDetail: "Department " + departmentId + " can't be under " + parentId + " which is under the department"}
+
+		if parentId == departmentId {
+			return departmentCycle
+		}
+
+		_, err = p.daoDepartment.Get(parentId)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_PARENT_DEPARTMENT,
+				ErrorMsg:    "Invalid Parent Department",
+				ErrorDetail: "Given parent department " + parentId + " is not exist"}
+			return err
+		}
+
+		// Walk up the parents of the new parent department
+		visited := map[string]bool{}
+		for deptId := parentId; deptId != "" && !visited[deptId]; {
+			if deptId == departmentId {
+				return departmentCycle
+			}
+			visited[deptId] = true
+
+			deptInfo, err := p.daoDepartment.Get(deptId)
+			if err != nil {
+				break
+			}
+			deptId, _ = utils.GetMemberDataStr(deptInfo, FLD_DEPARTMENT_PARENT_ID)
+		}
+	}
+
+	headStaffId, err := utils.GetMemberDataStr(indata, FLD_DEPARTMENT_HEAD_ID)
+	if err == nil && headStaffId != "" {
+		_, err = p.daoStaff.Get(headStaffId)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_DEPARTMENT_HEAD,
+				ErrorMsg:    "Invalid Department Head",
+				ErrorDetail: "Given head staff " + headStaffId + " is not exist"}
+			return err
+		}
+	}
+	return nil
+}
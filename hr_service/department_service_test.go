@@ -0,0 +1,108 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestDepartmentCycle(t *testing.T) {
+
+	_, props := newTestProvider()
+	departmentService, err := NewDepartmentService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer departmentService.EndService()
+
+	// dept_root <- dept_child <- dept_grand
+	for _, indata := range []utils.Map{
+		{hr_common.FLD_DEPARTMENT_ID: "dept_root"},
+		{hr_common.FLD_DEPARTMENT_ID: "dept_child", FLD_DEPARTMENT_PARENT_ID: "dept_root"},
+		{hr_common.FLD_DEPARTMENT_ID: "dept_grand", FLD_DEPARTMENT_PARENT_ID: "dept_child"},
+		{hr_common.FLD_DEPARTMENT_ID: "dept_other"},
+	} {
+		_, err := departmentService.Create(indata)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		departmentId string
+		parentId     string
+		errorCode    string
+	}{
+		{"self", "dept_root", "dept_root", ERRCODE_DEPARTMENT_CYCLE},
+		{"under own child", "dept_root", "dept_child", ERRCODE_DEPARTMENT_CYCLE},
+		{"under own grand child", "dept_root", "dept_grand", ERRCODE_DEPARTMENT_CYCLE},
+		{"unknown parent", "dept_root", "dept_unknown", ERRCODE_INVALID_PARENT_DEPARTMENT},
+		{"under other department", "dept_child", "dept_other", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := departmentService.Update(test.departmentId, utils.Map{FLD_DEPARTMENT_PARENT_ID: test.parentId})
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	staffService, err := NewStaffService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer staffService.EndService()
+	createTestStaff(t, staffService, "staff_other", utils.Map{
+		FLD_STAFF_DATE_OF_JOIN:      "2020-01-06",
+		hr_common.FLD_DEPARTMENT_ID: "dept_other"})
+
+	// dept_other <- dept_child <- dept_grand, sub-departments of dept_other can't take its place
+	err = departmentService.DeleteAndReassign("dept_other", "dept_grand", false)
+	assertErrorCode(t, err, ERRCODE_DEPARTMENT_CYCLE)
+
+	err = departmentService.DeleteAndReassign("dept_other", "dept_root", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deptInfo, err := departmentService.Get("dept_child")
+	if err != nil || deptInfo[FLD_DEPARTMENT_PARENT_ID] != "dept_root" {
+		t.Errorf("Sub-department should be moved to dept_root, got %v %v", deptInfo, err)
+	}
+
+	// Staff is transferred from today, the join event still has the department of that time
+	response, err := staffService.GetEmploymentHistory("staff_other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	departments := []interface{}{}
+	items, _ := toSlice(response[db_common.LIST_RESULT])
+	for _, item := range items {
+		event, _ := toMap(item)
+		changes, _ := getMemberDataMap(event, FLD_EMPLOYMENT_CHANGES)
+		departments = append(departments, event[FLD_EMPLOYMENT_EVENT_TYPE], changes[hr_common.FLD_DEPARTMENT_ID])
+	}
+	expected := []interface{}{EMPLOYMENT_EVENT_JOIN, "dept_other", EMPLOYMENT_EVENT_TRANSFER, "dept_root"}
+	if !reflect.DeepEqual(departments, expected) {
+		t.Errorf("Expected employment history %v, got %v", expected, departments)
+	}
+
+	staffInfo, err := staffService.Get("staff_other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staffData, _ := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if staffData[hr_common.FLD_DEPARTMENT_ID] != "dept_root" {
+		t.Errorf("Expected staff_other in dept_root, got %v", staffData)
+	}
+}
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type DesignationService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(designation_id string, indata utils.Map) (utils.Map, error)
 	Delete(designation_id string, delete_permanent bool) error
+	DeleteAndReassign(designation_id string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +29,9 @@ type DesignationService interface {
 
 // DesignationBaseService - Designations Service structure
 type designationBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoDesignation      hr_repository.DesignationDao
+	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               DesignationService
 	businessID          string
@@ -55,25 +53,19 @@ func NewDesignationService(props utils.Map) (DesignationService, error) {
 
 	p := designationBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoDesignation = hr_repository.NewDesignationDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoDesignation = p.NewDesignationDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -90,8 +82,7 @@ func NewDesignationService(props utils.Map) (DesignationService, error) {
 }
 
 func (p *designationBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // ************************
@@ -143,20 +134,20 @@ func (p *designationBaseService) Find(filter string) (utils.Map, error) {
 func (p *designationBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var desigId string
 
-	dataval, dataok := indata[hr_common.FLD_DESIGNATION_ID]
-	if dataok {
-		desigId = strings.ToLower(dataval.(string))
-	} else {
-		desigId = utils.GenerateUniqueId("desig")
-		log.Println("Unique Designation ID", desigId)
+	// Validate the payload fields
+	err := normalizePayload[Designation](indata, false)
+	if err != nil {
+		return indata, err
+	}
+	desigId, err := getPayloadId(indata, hr_common.FLD_DESIGNATION_ID, ID_PREFIX_DESIGNATION)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_DESIGNATION_ID] = desigId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Designation ID:", desigId)
 
-	_, err := p.daoDesignation.Get(desigId)
+	_, err = p.daoDesignation.Get(desigId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Designation ID !", ErrorDetail: "Given Designation ID already exist"}
 		return indata, err
@@ -178,6 +169,12 @@ func (p *designationBaseService) Update(designation_id string, indata utils.Map)
 
 	log.Println("DesignationService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Designation](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoDesignation.Get(designation_id)
 	if err != nil {
 		return data, err
@@ -206,6 +203,12 @@ func (p *designationBaseService) Delete(designation_id string, delete_permanent
 		return err
 	}
 
+	// Records still referring the designation can't be deleted
+	err = checkReferences(p.getReferences(), "Designation", designation_id)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoDesignation.Delete(designation_id)
 		if err != nil {
@@ -226,6 +229,29 @@ func (p *designationBaseService) Delete(designation_id string, delete_permanent
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the designation to another designation
+// and delete the designation
+//
+// ************************************************************************
+func (p *designationBaseService) DeleteAndReassign(designation_id string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("DesignationService::DeleteAndReassign - Begin", designation_id, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Designation", p.daoDesignation, p.getReferences(), designation_id, reassign_id, func() error {
+		return p.Delete(designation_id, delete_permanent)
+	})
+	log.Println("DesignationService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the designation
+func (p *designationBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_DESIGNATION_ID),
+	}
+}
+
 func (p *designationBaseService) errorReturn(err error) (DesignationService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -31,8 +28,7 @@ type FeedbackService interface {
 }
 
 type feedbackBaseService struct {
-	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
+	DaoProvider
 	daoFeedback hr_repository.FeedbackDao
 	daoBusiness platform_repository.BusinessDao
 	child       FeedbackService
@@ -54,15 +50,10 @@ func NewFeedbackService(props utils.Map) (FeedbackService, error) {
 	}
 
 	p := feedbackBaseService{}
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -86,14 +77,13 @@ func NewFeedbackService(props utils.Map) (FeedbackService, error) {
 
 func (p *feedbackBaseService) EndService() {
 	log.Printf("EndFeedbackMongoService ")
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 func (p *feedbackBaseService) initializeService() {
 	log.Printf("FeedbackMongoService:: GetBusinessDao ")
-	p.daoFeedback = hr_repository.NewFeedbackDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoFeedback = p.NewFeedbackDao(p.businessID)
+	p.daoBusiness = p.NewBusinessDao()
 }
 
 // List - List All records
@@ -131,21 +121,21 @@ func (p *feedbackBaseService) Find(filter string) (utils.Map, error) {
 func (p *feedbackBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var deptId string
 
-	dataval, dataok := indata[hr_common.FLD_FEEDBACK_ID]
-	if dataok {
-		deptId = strings.ToLower(dataval.(string))
-	} else {
-		deptId = utils.GenerateUniqueId("fedback")
-		log.Println("Unique Feedback ID", deptId)
+	// Validate the payload fields
+	err := normalizePayload[Feedback](indata, false)
+	if err != nil {
+		return indata, err
 	}
 
-	indata[hr_common.FLD_FEEDBACK_ID] = deptId
+	deptId, err := getPayloadId(indata, hr_common.FLD_FEEDBACK_ID, ID_PREFIX_FEEDBACK)
+	if err != nil {
+		return indata, err
+	}
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
-	log.Println("Provided Feedback ID:", dataval)
+	log.Println("Provided Feedback ID:", deptId)
 
-	_, err := p.daoFeedback.Get(deptId)
+	_, err = p.daoFeedback.Get(deptId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Feedback ID !", ErrorDetail: "Given Feedback ID already exist"}
 		return indata, err
@@ -164,6 +154,12 @@ func (p *feedbackBaseService) Update(feedback_id string, indata utils.Map) (util
 
 	log.Println("FeedbackService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Feedback](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoFeedback.Get(feedback_id)
 	if err != nil {
 		return data, err
@@ -1,18 +1,63 @@
 package hr_service
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
 	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Holiday Date Field, in "2006-01-02" format
+	FLD_HOLIDAY_DATE = "holiday_date"
+
+	// Holiday Fields filled from iCalendar events
+	FLD_HOLIDAY_NAME    = "holiday_name"
+	FLD_HOLIDAY_DESC    = "holiday_desc"
+	FLD_HOLIDAY_ICS_UID = "ics_uid"
+
+	// ImportICS Options & Result Fields
+	FLD_ICS_OVERWRITE = "overwrite"
+	FLD_ICS_CREATED   = "created"
+	FLD_ICS_UPDATED   = "updated"
+	FLD_ICS_SKIPPED   = "skipped"
+
+	// iCalendar date formats
+	ICS_DATE_FORMAT     = "20060102"
+	ICS_DATETIME_FORMAT = "20060102T150405"
+
+	// Maximum octets in an iCalendar content line before folding
+	ICS_LINE_OCTETS = 75
+
+	// Holiday Scope Fields, holiday applies to all when not given
+	FLD_HOLIDAY_WORKLOCATION_IDS = "worklocation_ids"
+	FLD_HOLIDAY_DEPARTMENT_IDS   = "department_ids"
+
+	// Holiday Recurrence, occurs every year from the year of holiday_date
+	FLD_HOLIDAY_RECURRENCE = "recurrence"
+	FLD_RECURRENCE_TYPE    = "type"
+	FLD_RECURRENCE_MONTH   = "month"
+	FLD_RECURRENCE_DAY     = "day"
+	FLD_RECURRENCE_WEEK    = "week"    // 1 to 5, -1 for the last week
+	FLD_RECURRENCE_WEEKDAY = "weekday" // name or number (0 - Sunday)
+
+	RECURRENCE_ANNUAL      = "annual"
+	RECURRENCE_NTH_WEEKDAY = "nth_weekday"
+
+	ERRCODE_INVALID_HOLIDAY = "S30151"
+)
+
 // HolidayService - Accounts Service structure
 type HolidayService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -22,6 +67,10 @@ type HolidayService interface {
 	Update(holiday_id string, indata utils.Map) (utils.Map, error)
 	Delete(holiday_id string, delete_permanent bool) error
 
+	ImportICS(reader io.Reader, options utils.Map) (utils.Map, error)
+	ExportICS(writer io.Writer, fromDate string, toDate string, staffId string) error
+	HolidaysBetween(fromDate string, toDate string, staffId string) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -31,9 +80,11 @@ type HolidayService interface {
 
 // holidayBaseService - Accounts Service structure
 type holidayBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoHoliday          hr_repository.HolidayDao
+	daoStaff            hr_repository.StaffDao
+	daoWorkLocation     hr_repository.WorkLocationDao
+	daoDepartment       hr_repository.DepartmentDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               HolidayService
 	businessID          string
@@ -56,16 +107,9 @@ func NewHolidayService(props utils.Map) (HolidayService, error) {
 
 	p := holidayBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -73,8 +117,11 @@ func NewHolidayService(props utils.Map) (HolidayService, error) {
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoHoliday = hr_repository.NewHolidayDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoHoliday = p.NewHolidayDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoWorkLocation = p.NewWorkLocationDao(p.businessID)
+	p.daoDepartment = p.NewDepartmentDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -91,8 +138,7 @@ func NewHolidayService(props utils.Map) (HolidayService, error) {
 }
 
 func (p *holidayBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -131,25 +177,31 @@ func (p *holidayBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var holidayId string
+	// Validate the payload fields
+	err := normalizePayload[Holiday](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_HOLIDAY_ID]
-	if dataok {
-		holidayId = strings.ToLower(dataval.(string))
-	} else {
-		holidayId = utils.GenerateUniqueId("holi")
-		log.Println("Unique Account ID", holidayId)
+	holidayId, err := getPayloadId(indata, hr_common.FLD_HOLIDAY_ID, ID_PREFIX_HOLIDAY)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_HOLIDAY_ID] = holidayId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Account ID:", holidayId)
 
-	_, err := p.daoHoliday.Get(holidayId)
+	_, err = p.daoHoliday.Get(holidayId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
 	}
 
+	// Validate the date, recurrence & scope
+	err = p.validateHoliday(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoHoliday.Create(indata)
 	if err != nil {
 		return indata, err
@@ -163,6 +215,12 @@ func (p *holidayBaseService) Update(holiday_id string, indata utils.Map) (utils.
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Holiday](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoHoliday.Get(holiday_id)
 	if err != nil {
 		return data, err
@@ -172,6 +230,18 @@ func (p *holidayBaseService) Update(holiday_id string, indata utils.Map) (utils.
 	delete(indata, hr_common.FLD_HOLIDAY_ID)
 	delete(indata, hr_common.FLD_BUSINESS_ID)
 
+	// Validate the date, recurrence & scope
+	_, errDate := utils.GetMemberData(indata, FLD_HOLIDAY_DATE)
+	_, errRecurrence := utils.GetMemberData(indata, FLD_HOLIDAY_RECURRENCE)
+	_, errLocations := utils.GetMemberData(indata, FLD_HOLIDAY_WORKLOCATION_IDS)
+	_, errDepartments := utils.GetMemberData(indata, FLD_HOLIDAY_DEPARTMENT_IDS)
+	if errDate == nil || errRecurrence == nil || errLocations == nil || errDepartments == nil {
+		err = p.validateHoliday(utils.MergeMap(utils.CopyMap(data), indata, true))
+		if err != nil {
+			return indata, err
+		}
+	}
+
 	data, err = p.daoHoliday.Update(holiday_id, indata)
 	log.Println("AccountService::Update - End ")
 	return data, err
@@ -207,8 +277,802 @@ func (p *holidayBaseService) Delete(holiday_id string, delete_permanent bool) er
 	return nil
 }
 
+// ************************************************************************
+// ImportICS - Import the all-day events (VEVENT) of the iCalendar as
+// holidays, a multi-day event is imported as a holiday for each day and a
+// yearly RRULE as the recurrence. Dates already having a company-wide
+// holiday, including the dates of recurring holidays, are skipped or
+// updated when overwrite option set
+//
+// ************************************************************************
+func (p *holidayBaseService) ImportICS(reader io.Reader, options utils.Map) (utils.Map, error) {
+
+	log.Println("HolidayService::ImportICS - Begin")
+
+	overwrite, _ := utils.GetMemberDataBool(options, FLD_ICS_OVERWRITE)
+
+	holidays, err := parseICSHolidays(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	existingHolidays, err := p.getCompanyHolidays(holidays)
+	if err != nil {
+		return nil, err
+	}
+
+	created, updated, skipped := []utils.Map{}, []utils.Map{}, []utils.Map{}
+	for _, holiday := range holidays {
+		holidayDate, _ := utils.GetMemberDataStr(holiday, FLD_HOLIDAY_DATE)
+
+		existing, found := existingHolidays[holidayDate]
+		if found {
+			holidayId, _ := utils.GetMemberDataStr(existing, hr_common.FLD_HOLIDAY_ID)
+			if !overwrite {
+				skipped = append(skipped, utils.Map{hr_common.FLD_HOLIDAY_ID: holidayId, FLD_HOLIDAY_DATE: holidayDate})
+				continue
+			}
+
+			// Recurring holiday keeps the date it recurs from
+			if existing[FLD_HOLIDAY_RECURRENCE] != nil && holiday[FLD_HOLIDAY_RECURRENCE] == nil {
+				delete(holiday, FLD_HOLIDAY_DATE)
+			}
+
+			data, err := p.Update(holidayId, holiday)
+			if err != nil {
+				return nil, err
+			}
+			updated = append(updated, data)
+			continue
+		}
+
+		data, err := p.Create(holiday)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, data)
+	}
+
+	response := utils.Map{
+		FLD_ICS_CREATED: created,
+		FLD_ICS_UPDATED: updated,
+		FLD_ICS_SKIPPED: skipped,
+	}
+
+	log.Println("HolidayService::ImportICS - End", len(created), len(updated), len(skipped))
+	return response, nil
+}
+
+// ************************************************************************
+// ExportICS - Export the holidays between the given dates (yyyy-mm-dd) as
+// iCalendar all-day events for subscribing in the mail clients, recurring
+// holidays are exported for each of their dates. Holidays scoped to work
+// locations or departments are filtered for the given staff, when the staff
+// id is empty holidays of all the scopes are exported
+//
+// ************************************************************************
+func (p *holidayBaseService) ExportICS(writer io.Writer, fromDate string, toDate string, staffId string) error {
+
+	log.Println("HolidayService::ExportICS - Begin", fromDate, toDate, staffId)
+
+	from, err := time.Parse(time.DateOnly, fromDate)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid from date", ErrorDetail: "from date should be in yyyy-mm-dd format"}
+		return err
+	}
+
+	to, err := time.Parse(time.DateOnly, toDate)
+	if err != nil || to.Before(from) {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid to date", ErrorDetail: "to date should be in yyyy-mm-dd format and not before from date"}
+		return err
+	}
+
+	holidays, err := expandHolidays(p.daoHoliday, from, to)
+	if err != nil {
+		return err
+	}
+
+	holidays, err = p.filterStaffHolidays(holidays, staffId)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//zapscloud//golib-hr-service//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+
+	dtStamp := time.Now().UTC().Format(ICS_DATETIME_FORMAT) + "Z"
+	for _, holidayInfo := range holidays {
+		holidayDate, err := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+		if err != nil {
+			continue
+		}
+		dateVal, err := time.Parse(time.DateOnly, holidayDate)
+		if err != nil {
+			continue
+		}
+
+		holidayId, _ := utils.GetMemberDataStr(holidayInfo, hr_common.FLD_HOLIDAY_ID)
+		name, _ := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_NAME)
+		desc, _ := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DESC)
+
+		// Each date of the recurring holiday is an event of its own
+		uid := holidayId + "@" + p.businessID
+		if _, err := getMemberDataMap(holidayInfo, FLD_HOLIDAY_RECURRENCE); err == nil {
+			uid = holidayId + "-" + dateVal.Format(ICS_DATE_FORMAT) + "@" + p.businessID
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+uid,
+			"DTSTAMP:"+dtStamp,
+			"DTSTART;VALUE=DATE:"+dateVal.Format(ICS_DATE_FORMAT),
+			"DTEND;VALUE=DATE:"+dateVal.AddDate(0, 0, 1).Format(ICS_DATE_FORMAT),
+			"SUMMARY:"+escapeICSText(name),
+			"TRANSP:TRANSPARENT")
+		if desc != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeICSText(desc))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		_, err = io.WriteString(writer, foldICSLine(line)+"\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Println("HolidayService::ExportICS - End")
+	return nil
+}
+
+// ************************************************************************
+// HolidaysBetween - Get the holidays between the given dates (yyyy-mm-dd)
+// with the recurring holidays expanded into their dates. Holidays scoped to
+// work locations or departments are filtered for the given staff, when the
+// staff id is empty holidays of all the scopes are listed
+//
+// ************************************************************************
+func (p *holidayBaseService) HolidaysBetween(fromDate string, toDate string, staffId string) (utils.Map, error) {
+
+	log.Println("HolidayService::HolidaysBetween - Begin", fromDate, toDate, staffId)
+
+	from, err := time.Parse(time.DateOnly, fromDate)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid from date", ErrorDetail: "from date should be in yyyy-mm-dd format"}
+		return nil, err
+	}
+
+	to, err := time.Parse(time.DateOnly, toDate)
+	if err != nil || to.Before(from) {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid to date", ErrorDetail: "to date should be in yyyy-mm-dd format and not before from date"}
+		return nil, err
+	}
+
+	holidays, err := expandHolidays(p.daoHoliday, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err = p.filterStaffHolidays(holidays, staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		db_common.LIST_RESULTSIZE: len(holidays),
+		db_common.LIST_RESULT:     holidays,
+	}
+
+	log.Println("HolidayService::HolidaysBetween - End", len(holidays))
+	return response, nil
+}
+
 func (p *holidayBaseService) errorReturn(err error) (HolidayService, error) {
 	// Close the Database Connection
 	p.EndService()
 	return nil, err
 }
+
+// filterStaffHolidays - Filter the holidays applying to the staff, all the holidays are kept
+// when the staff id is empty
+func (p *holidayBaseService) filterStaffHolidays(holidays []utils.Map, staffId string) ([]utils.Map, error) {
+
+	if staffId == "" {
+		return holidays, nil
+	}
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	staffHolidays := []utils.Map{}
+	for _, holiday := range holidays {
+		if isStaffHoliday(holiday, staffInfo) {
+			staffHolidays = append(staffHolidays, holiday)
+		}
+	}
+	return staffHolidays, nil
+}
+
+// getCompanyHolidays - Get the company-wide holidays by date between the first & last dates of
+// the given holidays, recurring holidays are mapped on each of their dates. Holidays scoped to
+// work locations or departments are left out, they don't stand for the company-wide holiday
+func (p *holidayBaseService) getCompanyHolidays(holidays []utils.Map) (map[string]utils.Map, error) {
+
+	companyHolidays := map[string]utils.Map{}
+	if len(holidays) == 0 {
+		return companyHolidays, nil
+	}
+
+	fromDate, _ := utils.GetMemberDataStr(holidays[0], FLD_HOLIDAY_DATE)
+	toDate := fromDate
+	for _, holiday := range holidays {
+		holidayDate, _ := utils.GetMemberDataStr(holiday, FLD_HOLIDAY_DATE)
+		if holidayDate < fromDate {
+			fromDate = holidayDate
+		}
+		if holidayDate > toDate {
+			toDate = holidayDate
+		}
+	}
+
+	from, _ := time.Parse(time.DateOnly, fromDate)
+	to, _ := time.Parse(time.DateOnly, toDate)
+	existing, err := expandHolidays(p.daoHoliday, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, holidayInfo := range existing {
+		holidayDate, _ := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+		if _, found := companyHolidays[holidayDate]; !found && isStaffHoliday(holidayInfo, nil) {
+			companyHolidays[holidayDate] = holidayInfo
+		}
+	}
+	return companyHolidays, nil
+}
+
+// getHolidayDates - Get the holiday dates of the staff between the given dates (both inclusive)
+func getHolidayDates(daoHoliday hr_repository.HolidayDao, fromDate time.Time, toDate time.Time, staffInfo utils.Map) (map[string]bool, error) {
+
+	holidays, err := expandHolidays(daoHoliday, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return getStaffHolidayDates(holidays, staffInfo), nil
+}
+
+// getStaffHolidayDates - Get the dates of the holidays applying to the staff
+func getStaffHolidayDates(holidays []utils.Map, staffInfo utils.Map) map[string]bool {
+
+	holidayDates := map[string]bool{}
+	for _, holidayInfo := range holidays {
+		holidayDate, err := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+		if err == nil && isStaffHoliday(holidayInfo, staffInfo) {
+			holidayDates[holidayDate] = true
+		}
+	}
+	return holidayDates
+}
+
+// validateHoliday - Validate the holiday has a valid date or recurrence and the scoped work
+// locations & departments exist
+func (p *holidayBaseService) validateHoliday(holidayInfo utils.Map) error {
+
+	invalidHoliday := func(detail string) error {
+		return &utils.AppError{ErrorCode: ERRCODE_INVALID_HOLIDAY, ErrorMsg: "Invalid Holiday", ErrorDetail: detail}
+	}
+
+	holidayDate, errDate := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+	if errDate == nil {
+		_, err := time.Parse(time.DateOnly, holidayDate)
+		if err != nil {
+			return invalidHoliday(FLD_HOLIDAY_DATE + " should be in yyyy-mm-dd format")
+		}
+	}
+
+	// Null recurrence removes the recurrence of the holiday
+	recurrence, errRecurrence := getMemberDataMap(holidayInfo, FLD_HOLIDAY_RECURRENCE)
+	if holidayInfo[FLD_HOLIDAY_RECURRENCE] != nil && errRecurrence != nil {
+		return invalidHoliday(FLD_HOLIDAY_RECURRENCE + " should be an object")
+	}
+	if errDate != nil && errRecurrence != nil {
+		return invalidHoliday(FLD_HOLIDAY_DATE + " or " + FLD_HOLIDAY_RECURRENCE + " should be given")
+	}
+
+	if errRecurrence == nil {
+		// Validate with a leap year, so 29th February is allowed
+		_, err := getRecurrenceDate(holidayInfo, recurrence, 2000)
+		if err != nil {
+			return err
+		}
+	}
+
+	scopes := []struct {
+		field string
+		dao   db_utils.CommonSvc
+	}{
+		{FLD_HOLIDAY_WORKLOCATION_IDS, p.daoWorkLocation},
+		{FLD_HOLIDAY_DEPARTMENT_IDS, p.daoDepartment},
+	}
+	for _, scope := range scopes {
+		dataVal, err := utils.GetMemberData(holidayInfo, scope.field)
+		if err != nil {
+			continue
+		}
+
+		scopeIds, ok := getHolidayScopeIds(dataVal)
+		if !ok {
+			return invalidHoliday(scope.field + " should be a list of ids")
+		}
+		for _, scopeId := range scopeIds {
+			_, err = scope.dao.Get(scopeId)
+			if err != nil {
+				return invalidHoliday(scope.field + " has invalid id " + scopeId)
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandHolidays - Get the holidays between the given dates (both inclusive), recurring
+// holidays are listed for each of their dates
+func expandHolidays(daoHoliday hr_repository.HolidayDao, fromDate time.Time, toDate time.Time) ([]utils.Map, error) {
+
+	filter := fmt.Sprintf(`{"$or":[{"%s":{"$gte":"%s","$lte":"%s"}},{"%s":{"$ne":null}}],"%s":false}`,
+		FLD_HOLIDAY_DATE, fromDate.Format(time.DateOnly), toDate.Format(time.DateOnly),
+		FLD_HOLIDAY_RECURRENCE,
+		db_common.FLD_IS_DELETED)
+
+	response, err := daoHoliday.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := fromDate.Format(time.DateOnly), toDate.Format(time.DateOnly)
+
+	holidays := []utils.Map{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		for _, holidayInfo := range dataList.([]utils.Map) {
+			holidayDate, _ := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+
+			recurrence, err := getMemberDataMap(holidayInfo, FLD_HOLIDAY_RECURRENCE)
+			if err != nil {
+				if holidayDate >= from && holidayDate <= to {
+					holidays = append(holidays, holidayInfo)
+				}
+				continue
+			}
+
+			// Recurs from the year of holiday_date
+			firstYear := fromDate.Year()
+			if firstDate, err := time.Parse(time.DateOnly, holidayDate); err == nil && firstDate.Year() > firstYear {
+				firstYear = firstDate.Year()
+			}
+
+			for year := firstYear; year <= toDate.Year(); year++ {
+				occurrence, err := getRecurrenceDate(holidayInfo, recurrence, year)
+				if err != nil {
+					log.Println("expandHolidays - Invalid recurrence ", holidayInfo[hr_common.FLD_HOLIDAY_ID], err)
+					break
+				}
+
+				// Not all the years have 29th February or 5th weekday
+				occurrenceDate := occurrence.Format(time.DateOnly)
+				if occurrence.IsZero() || occurrenceDate < from || occurrenceDate > to {
+					continue
+				}
+
+				holiday := utils.CopyMap(holidayInfo)
+				holiday[FLD_HOLIDAY_DATE] = occurrenceDate
+				holidays = append(holidays, holiday)
+			}
+		}
+	}
+
+	sort.SliceStable(holidays, func(i, j int) bool {
+		dateI, _ := utils.GetMemberDataStr(holidays[i], FLD_HOLIDAY_DATE)
+		dateJ, _ := utils.GetMemberDataStr(holidays[j], FLD_HOLIDAY_DATE)
+		return dateI < dateJ
+	})
+	return holidays, nil
+}
+
+// getRecurrenceDate - Get the date of the recurring holiday in the given year, zero time
+// when the date doesn't occur in the year
+func getRecurrenceDate(holidayInfo utils.Map, recurrence utils.Map, year int) (time.Time, error) {
+
+	invalidRecurrence := func(detail string) (time.Time, error) {
+		return time.Time{}, &utils.AppError{ErrorCode: ERRCODE_INVALID_HOLIDAY, ErrorMsg: "Invalid Recurrence", ErrorDetail: detail}
+	}
+
+	// Month & day default to the holiday_date
+	holidayDate, _ := utils.GetMemberDataStr(holidayInfo, FLD_HOLIDAY_DATE)
+	firstDate, errDate := time.Parse(time.DateOnly, holidayDate)
+
+	month, err := utils.GetMemberDataInt(recurrence, FLD_RECURRENCE_MONTH, true)
+	if err != nil && errDate == nil {
+		month, err = int(firstDate.Month()), nil
+	}
+	if err != nil || month < 1 || month > 12 {
+		return invalidRecurrence(FLD_RECURRENCE_MONTH + " should be 1 to 12")
+	}
+
+	recurrenceType, _ := utils.GetMemberDataStr(recurrence, FLD_RECURRENCE_TYPE)
+	switch recurrenceType {
+	case RECURRENCE_ANNUAL:
+		day, err := utils.GetMemberDataInt(recurrence, FLD_RECURRENCE_DAY, true)
+		if err != nil && errDate == nil {
+			day, err = firstDate.Day(), nil
+		}
+		if err != nil || day < 1 || day > 31 {
+			return invalidRecurrence(FLD_RECURRENCE_DAY + " should be 1 to 31")
+		}
+
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if date.Month() != time.Month(month) {
+			if day > 29 || month != int(time.February) {
+				return invalidRecurrence(fmt.Sprintf("Month %d doesn't have day %d", month, day))
+			}
+			// 29th February in a non-leap year
+			return time.Time{}, nil
+		}
+		return date, nil
+
+	case RECURRENCE_NTH_WEEKDAY:
+		week, err := utils.GetMemberDataInt(recurrence, FLD_RECURRENCE_WEEK, true)
+		if err != nil || week == 0 || week < -1 || week > 5 {
+			return invalidRecurrence(FLD_RECURRENCE_WEEK + " should be 1 to 5 or -1 for last")
+		}
+
+		weekday, ok := parseWeekday(recurrence[FLD_RECURRENCE_WEEKDAY])
+		if !ok {
+			return invalidRecurrence(FLD_RECURRENCE_WEEKDAY + " should be a weekday name or 0 to 6")
+		}
+
+		var date time.Time
+		if week > 0 {
+			firstDay := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			date = firstDay.AddDate(0, 0, (int(weekday)-int(firstDay.Weekday())+7)%7+(week-1)*7)
+		} else {
+			lastDay := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC)
+			date = lastDay.AddDate(0, 0, -((int(lastDay.Weekday()) - int(weekday) + 7) % 7))
+		}
+
+		// 5th weekday doesn't occur in all the months
+		if date.Month() != time.Month(month) {
+			return time.Time{}, nil
+		}
+		return date, nil
+	}
+
+	return invalidRecurrence(FLD_RECURRENCE_TYPE + " should be " + RECURRENCE_ANNUAL + " or " + RECURRENCE_NTH_WEEKDAY)
+}
+
+// getHolidayScopeIds - Get the work location / department ids the holiday is scoped to
+func getHolidayScopeIds(dataVal interface{}) ([]string, bool) {
+
+	items, ok := toSlice(dataVal)
+	if !ok {
+		return nil, false
+	}
+
+	scopeIds := []string{}
+	for _, item := range items {
+		scopeId, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		scopeIds = append(scopeIds, scopeId)
+	}
+	return scopeIds, true
+}
+
+// isStaffHoliday - Check whether the holiday applies to the staff's work location & department,
+// only the holidays without scope apply when the staff is not known
+func isStaffHoliday(holidayInfo utils.Map, staffInfo utils.Map) bool {
+
+	scopes := map[string]string{
+		FLD_HOLIDAY_WORKLOCATION_IDS: hr_common.FLD_WORKLOCATION_ID,
+		FLD_HOLIDAY_DEPARTMENT_IDS:   hr_common.FLD_DEPARTMENT_ID,
+	}
+	for scopeField, staffField := range scopes {
+		scopeIds, ok := getHolidayScopeIds(holidayInfo[scopeField])
+		if !ok || len(scopeIds) == 0 {
+			continue
+		}
+
+		staffScopeId, err := getStaffDataStr(staffInfo, staffField)
+		if err != nil {
+			return false
+		}
+
+		found := false
+		for _, scopeId := range scopeIds {
+			if scopeId == staffScopeId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseICSHolidays - Parse the VEVENTs of the iCalendar (RFC 5545) into holiday records
+func parseICSHolidays(reader io.Reader) ([]utils.Map, error) {
+
+	invalidICS := func(detail string) error {
+		return &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid iCalendar", ErrorDetail: detail}
+	}
+
+	// Unfold the content lines, continuation lines start with a space or tab
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, invalidICS(err.Error())
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, invalidICS("BEGIN:VCALENDAR is not found")
+	}
+
+	holidays := []utils.Map{}
+	holidayDates := map[string]bool{}
+
+	var event map[string]string
+	for _, line := range lines {
+		name, params, value := parseICSLine(line)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = map[string]string{}
+
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, invalidICS("END:VEVENT without BEGIN:VEVENT")
+			}
+
+			startDate, err := parseICSDate(event["DTSTART"], event["DTSTART;TZID"])
+			if err != nil {
+				return nil, invalidICS("Invalid DTSTART " + event["DTSTART"])
+			}
+
+			// DTEND of the DATE value is exclusive, the date of the DATE-TIME value is the
+			// last day of the event, a single day when not given
+			endDate := startDate
+			if event["DTEND"] != "" {
+				endDate, err = parseICSDate(event["DTEND"], event["DTEND;TZID"])
+				if err != nil {
+					return nil, invalidICS("Invalid DTEND " + event["DTEND"])
+				}
+				if isICSDateValue(event["DTEND"]) && endDate.After(startDate) {
+					endDate = endDate.AddDate(0, 0, -1)
+				}
+			}
+
+			// Yearly RRULE is the recurrence of the holiday on each day of the event
+			var recurrence utils.Map
+			if event["RRULE"] != "" {
+				recurrence, err = parseICSRecurrence(event["RRULE"])
+				if err != nil {
+					return nil, err
+				}
+				if endDate.After(startDate) && len(recurrence) > 1 {
+					return nil, invalidICS("Unsupported RRULE " + event["RRULE"] + " of the multi-day event " + event["UID"])
+				}
+			}
+
+			for day := startDate; !day.After(endDate); day = day.AddDate(0, 0, 1) {
+				holidayDate := day.Format(time.DateOnly)
+
+				// Duplicate dates within the calendar
+				if holidayDates[holidayDate] {
+					continue
+				}
+				holidayDates[holidayDate] = true
+
+				holiday := utils.Map{
+					FLD_HOLIDAY_DATE:    holidayDate,
+					FLD_HOLIDAY_NAME:    unescapeICSText(event["SUMMARY"]),
+					FLD_HOLIDAY_ICS_UID: event["UID"],
+				}
+				if event["DESCRIPTION"] != "" {
+					holiday[FLD_HOLIDAY_DESC] = unescapeICSText(event["DESCRIPTION"])
+				}
+				if recurrence != nil {
+					holiday[FLD_HOLIDAY_RECURRENCE] = utils.CopyMap(recurrence)
+				}
+				holidays = append(holidays, holiday)
+			}
+			event = nil
+
+		case event != nil:
+			event[name] = value
+			// Keep the time zone of the date values
+			if tzid := params["TZID"]; tzid != "" {
+				event[name+";TZID"] = tzid
+			}
+		}
+	}
+
+	return holidays, nil
+}
+
+// parseICSRecurrence - Convert the RRULE into the holiday recurrence, only the rules repeating
+// every year on a day of the month or an nth weekday, without an end, are supported
+func parseICSRecurrence(rrule string) (utils.Map, error) {
+
+	unsupported := func(detail string) (utils.Map, error) {
+		return nil, &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid iCalendar", ErrorDetail: "Unsupported RRULE " + rrule + ", " + detail}
+	}
+
+	parts := map[string]string{}
+	for _, part := range strings.Split(rrule, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		parts[strings.ToUpper(key)] = strings.ToUpper(val)
+	}
+
+	for key, val := range parts {
+		switch key {
+		case "FREQ":
+			if val != "YEARLY" {
+				return unsupported("only FREQ=YEARLY is supported")
+			}
+		case "INTERVAL":
+			if val != "1" {
+				return unsupported("only INTERVAL=1 is supported")
+			}
+		case "BYMONTH", "BYMONTHDAY", "BYDAY", "WKST":
+		default:
+			return unsupported(key + " is not supported")
+		}
+	}
+	if parts["FREQ"] == "" {
+		return unsupported("FREQ is not given")
+	}
+
+	recurrence := utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}
+	if byMonth := parts["BYMONTH"]; byMonth != "" {
+		month, err := strconv.Atoi(byMonth)
+		if err != nil || month < 1 || month > 12 {
+			return unsupported("BYMONTH should be a single month")
+		}
+		recurrence[FLD_RECURRENCE_MONTH] = month
+	}
+
+	byMonthDay, byDay := parts["BYMONTHDAY"], parts["BYDAY"]
+	switch {
+	case byMonthDay != "" && byDay != "":
+		return unsupported("BYMONTHDAY with BYDAY is not supported")
+
+	case byMonthDay != "":
+		day, err := strconv.Atoi(byMonthDay)
+		if err != nil || day < 1 || day > 31 {
+			return unsupported("BYMONTHDAY should be a single day")
+		}
+		recurrence[FLD_RECURRENCE_DAY] = day
+
+	case byDay != "":
+		// nth weekday like 4TH or -1MO
+		weekdays := []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+		weekday, week, err := -1, 0, error(nil)
+		for idx, code := range weekdays {
+			if len(byDay) > len(code) && strings.HasSuffix(byDay, code) {
+				weekday = idx
+				week, err = strconv.Atoi(strings.TrimSuffix(byDay, code))
+			}
+		}
+		if weekday < 0 || err != nil || week == 0 || week < -1 || week > 5 {
+			return unsupported("BYDAY should be a single nth weekday")
+		}
+		recurrence[FLD_RECURRENCE_TYPE] = RECURRENCE_NTH_WEEKDAY
+		recurrence[FLD_RECURRENCE_WEEK] = week
+		recurrence[FLD_RECURRENCE_WEEKDAY] = weekday
+	}
+
+	return recurrence, nil
+}
+
+// parseICSLine - Split the content line into name, parameters and value
+func parseICSLine(line string) (string, map[string]string, string) {
+
+	params := map[string]string{}
+
+	// Value starts after the first colon outside the quoted parameter values
+	inQuote, colonIdx := false, -1
+	for idx, ch := range line {
+		if ch == '"' {
+			inQuote = !inQuote
+		} else if ch == ':' && !inQuote {
+			colonIdx = idx
+			break
+		}
+	}
+	if colonIdx < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+
+	nameParts := strings.Split(line[:colonIdx], ";")
+	for _, param := range nameParts[1:] {
+		if key, val, ok := strings.Cut(param, "="); ok {
+			params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+		}
+	}
+	return strings.ToUpper(nameParts[0]), params, line[colonIdx+1:]
+}
+
+// parseICSDate - Parse the DATE or DATE-TIME value into the date, UTC date-time is
+// converted to the given time zone
+func parseICSDate(value string, tzid string) (time.Time, error) {
+
+	if isICSDateValue(value) {
+		return time.Parse(ICS_DATE_FORMAT, value)
+	}
+
+	dateTime, err := time.Parse(ICS_DATETIME_FORMAT, strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return dateTime, err
+	}
+
+	if strings.HasSuffix(value, "Z") && tzid != "" {
+		loc, err := time.LoadLocation(tzid)
+		if err == nil {
+			dateTime = dateTime.In(loc)
+		}
+	}
+	return time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// isICSDateValue - Check whether the value is a DATE (VALUE=DATE) rather than a DATE-TIME
+func isICSDateValue(value string) bool {
+	return len(value) == len(ICS_DATE_FORMAT)
+}
+
+// escapeICSText - Escape the TEXT value of iCalendar
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// unescapeICSText - Unescape the TEXT value of iCalendar
+func unescapeICSText(text string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(text)
+}
+
+// foldICSLine - Fold the content line longer than 75 octets, without splitting a UTF-8 character
+func foldICSLine(line string) string {
+
+	var sb strings.Builder
+	octets := 0
+	for _, ch := range line {
+		chLen := len(string(ch))
+		if octets+chLen > ICS_LINE_OCTETS {
+			sb.WriteString("\r\n ")
+			octets = 1
+		}
+		sb.WriteRune(ch)
+		octets += chLen
+	}
+	return sb.String()
+}
@@ -0,0 +1,290 @@
+package hr_service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestHolidayExpansion(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_HOLIDAYS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "new_year", FLD_HOLIDAY_DATE: "2030-01-01"},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "old_new_year", FLD_HOLIDAY_DATE: "2029-01-01",
+			FLD_HOLIDAY_RECURRENCE: nil},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "independence", FLD_HOLIDAY_DATE: "2025-08-15",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "thanksgiving",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_NTH_WEEKDAY, FLD_RECURRENCE_MONTH: 11,
+				FLD_RECURRENCE_WEEK: 4, FLD_RECURRENCE_WEEKDAY: "thursday"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "memorial",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_NTH_WEEKDAY, FLD_RECURRENCE_MONTH: 5,
+				FLD_RECURRENCE_WEEK: -1, FLD_RECURRENCE_WEEKDAY: 1}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "leap_day", FLD_HOLIDAY_DATE: "2024-02-29",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "founders_day", FLD_HOLIDAY_DATE: "2031-06-01",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "removed", FLD_HOLIDAY_DATE: "2030-03-01",
+			db_common.FLD_IS_DELETED: true},
+	)
+
+	holidayService, err := NewHolidayService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holidayService.EndService()
+
+	tests := []struct {
+		name     string
+		fromDate string
+		toDate   string
+		holidays []string
+	}{
+		{"year", "2030-01-01", "2030-12-31",
+			[]string{"new_year 2030-01-01", "memorial 2030-05-27", "independence 2030-08-15", "thanksgiving 2030-11-28"}},
+		{"leap year", "2028-02-01", "2028-03-31", []string{"leap_day 2028-02-29"}},
+		{"across years", "2031-05-01", "2032-06-01",
+			[]string{"memorial 2031-05-26", "founders_day 2031-06-01", "independence 2031-08-15", "thanksgiving 2031-11-27",
+				"leap_day 2032-02-29", "memorial 2032-05-31", "founders_day 2032-06-01"}},
+		{"before recurrence starts", "2024-08-01", "2024-08-31", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := holidayService.HolidaysBetween(test.fromDate, test.toDate, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			holidays := []string{}
+			items, _ := toSlice(response[db_common.LIST_RESULT])
+			for _, item := range items {
+				holidayInfo, _ := toMap(item)
+				holidays = append(holidays, holidayInfo[hr_common.FLD_HOLIDAY_ID].(string)+" "+holidayInfo[FLD_HOLIDAY_DATE].(string))
+			}
+			if !reflect.DeepEqual(holidays, test.holidays) {
+				t.Errorf("Expected %v, got %v", test.holidays, holidays)
+			}
+		})
+	}
+
+	_, err = holidayService.HolidaysBetween("2030-12-31", "2030-01-01", "")
+	assertErrorCode(t, err, "S30102")
+}
+
+func TestImportExportICS(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_HOLIDAYS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "independence", FLD_HOLIDAY_DATE: "2025-08-15",
+			FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "local_festival", FLD_HOLIDAY_DATE: "2030-01-26",
+			FLD_HOLIDAY_WORKLOCATION_IDS: []string{"loc_1"}},
+	)
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_WORKLOCATION_ID: "loc_1"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2",
+			hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_WORKLOCATION_ID: "loc_2"}},
+	)
+
+	holidayService, err := NewHolidayService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holidayService.EndService()
+
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT", "UID:republic", "DTSTART;VALUE=DATE:20300126", "SUMMARY:Republic Day", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:independence", "DTSTART;VALUE=DATE:20300815", "SUMMARY:Independence Day", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:thanksgiving", "DTSTART;VALUE=DATE:20301128", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+		"SUMMARY:Thanksgiving", "END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	getImported := func(response utils.Map, field string) []string {
+		dates := []string{}
+		items, _ := toSlice(response[field])
+		for _, item := range items {
+			holidayInfo, _ := toMap(item)
+			dates = append(dates, holidayInfo[FLD_HOLIDAY_DATE].(string))
+		}
+		return dates
+	}
+
+	// Scoped holiday doesn't stand for the company-wide event on its date
+	response, err := holidayService.ImportICS(strings.NewReader(calendar), utils.Map{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created, skipped := getImported(response, FLD_ICS_CREATED), getImported(response, FLD_ICS_SKIPPED); !reflect.DeepEqual(created, []string{"2030-01-26", "2030-11-28"}) ||
+		!reflect.DeepEqual(skipped, []string{"2030-08-15"}) {
+		t.Errorf("Unexpected import %v", response)
+	}
+
+	// Re-import skips the holidays created, recurring ones on the dates of the later years too
+	for _, reimport := range []string{calendar, strings.Replace(calendar, "20301128", "20311127", 1)} {
+		response, err = holidayService.ImportICS(strings.NewReader(reimport), utils.Map{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created := getImported(response, FLD_ICS_CREATED); len(created) != 0 {
+			t.Errorf("Expected the holidays skipped, got %v", response)
+		}
+	}
+
+	response, err = holidayService.HolidaysBetween("2032-11-01", "2032-11-30", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ := toSlice(response[db_common.LIST_RESULT])
+	if holidayInfo, _ := toMap(items[0]); len(items) != 1 || holidayInfo[FLD_HOLIDAY_DATE] != "2032-11-25" {
+		t.Errorf("Expected Thanksgiving on 2032-11-25, got %v", response)
+	}
+
+	for _, rrule := range []string{"FREQ=WEEKLY", "FREQ=YEARLY;COUNT=3", "FREQ=YEARLY;BYDAY=MO", "FREQ=YEARLY;INTERVAL=2"} {
+		_, err = holidayService.ImportICS(strings.NewReader(strings.Replace(calendar, "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", rrule, 1)), utils.Map{})
+		assertErrorCode(t, err, "S30102")
+	}
+
+	tests := []struct {
+		staffId string
+		uids    []string
+	}{
+		{"", []string{"republic", "local_festival"}},
+		{"staff_1", []string{"republic", "local_festival"}},
+		{"staff_2", []string{"republic"}},
+	}
+	for _, test := range tests {
+		t.Run("export "+test.staffId, func(t *testing.T) {
+			var sb strings.Builder
+			err := holidayService.ExportICS(&sb, "2030-01-26", "2030-01-26", test.staffId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summaries := strings.Count(sb.String(), "BEGIN:VEVENT")
+			if summaries != len(test.uids) || !strings.Contains(sb.String(), "@"+testBusinessId) {
+				t.Errorf("Expected %v exported, got %s", test.uids, sb.String())
+			}
+			if len(test.uids) == 1 && strings.Contains(sb.String(), "UID:local_festival") {
+				t.Errorf("Scoped holiday exported for %s", test.staffId)
+			}
+		})
+	}
+}
+
+func TestParseICSHolidays(t *testing.T) {
+
+	calendar := func(lines ...string) string {
+		return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n")
+	}
+	event := func(lines ...string) []string {
+		return append(append([]string{"BEGIN:VEVENT"}, lines...), "END:VEVENT")
+	}
+	holiday := func(date string, name string, uid string) utils.Map {
+		return utils.Map{FLD_HOLIDAY_DATE: date, FLD_HOLIDAY_NAME: name, FLD_HOLIDAY_ICS_UID: uid}
+	}
+
+	tests := []struct {
+		name      string
+		ics       string
+		expected  []utils.Map
+		errorCode string
+	}{
+		{"single day",
+			calendar(event("UID:new_year", "DTSTART;VALUE=DATE:20300101", "DTEND;VALUE=DATE:20300102", "SUMMARY:New Year")...),
+			[]utils.Map{holiday("2030-01-01", "New Year", "new_year")}, ""},
+		{"without DTEND",
+			calendar(event("UID:pongal", "DTSTART;VALUE=DATE:20300114", "SUMMARY:Pongal")...),
+			[]utils.Map{holiday("2030-01-14", "Pongal", "pongal")}, ""},
+		{"multi-day with exclusive DTEND",
+			calendar(event("UID:diwali", "DTSTART;VALUE=DATE:20301025", "DTEND;VALUE=DATE:20301027", "SUMMARY:Diwali")...),
+			[]utils.Map{holiday("2030-10-25", "Diwali", "diwali"), holiday("2030-10-26", "Diwali", "diwali")}, ""},
+		{"date-time with inclusive DTEND",
+			calendar(event("UID:retreat", "DTSTART:20300301T090000", "DTEND:20300302T180000", "SUMMARY:Retreat")...),
+			[]utils.Map{holiday("2030-03-01", "Retreat", "retreat"), holiday("2030-03-02", "Retreat", "retreat")}, ""},
+		{"UTC date-time in time zone",
+			calendar(event("UID:onam", "DTSTART;TZID=Asia/Kolkata:20300904T200000Z", "SUMMARY:Onam")...),
+			[]utils.Map{holiday("2030-09-05", "Onam", "onam")}, ""},
+		{"folded and escaped text",
+			calendar(event("UID:labour", "DTSTART;VALUE=DATE:20300501", "SUMMARY:Labour\\, May", "  Day", "DESCRIPTION:Line 1\\nLine 2")...),
+			[]utils.Map{utils.MergeMap(holiday("2030-05-01", "Labour, May Day", "labour"), utils.Map{FLD_HOLIDAY_DESC: "Line 1\nLine 2"}, false)}, ""},
+		{"duplicate date within calendar",
+			calendar(append(event("UID:first", "DTSTART;VALUE=DATE:20300815", "SUMMARY:First"),
+				event("UID:second", "DTSTART;VALUE=DATE:20300815", "SUMMARY:Second")...)...),
+			[]utils.Map{holiday("2030-08-15", "First", "first")}, ""},
+		{"yearly on the date",
+			calendar(event("UID:independence", "DTSTART;VALUE=DATE:20300815", "RRULE:FREQ=YEARLY", "SUMMARY:Independence")...),
+			[]utils.Map{utils.MergeMap(holiday("2030-08-15", "Independence", "independence"),
+				utils.Map{FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_ANNUAL}}, false)}, ""},
+		{"yearly on the nth weekday",
+			calendar(event("UID:thanksgiving", "DTSTART;VALUE=DATE:20301128", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "SUMMARY:Thanksgiving")...),
+			[]utils.Map{utils.MergeMap(holiday("2030-11-28", "Thanksgiving", "thanksgiving"),
+				utils.Map{FLD_HOLIDAY_RECURRENCE: utils.Map{FLD_RECURRENCE_TYPE: RECURRENCE_NTH_WEEKDAY, FLD_RECURRENCE_MONTH: 11,
+					FLD_RECURRENCE_WEEK: 4, FLD_RECURRENCE_WEEKDAY: 4}}, false)}, ""},
+		{"no events", calendar(), []utils.Map{}, ""},
+		{"not a calendar", "BEGIN:VEVENT\r\nEND:VEVENT", nil, "S30102"},
+		{"END without BEGIN", calendar("END:VEVENT"), nil, "S30102"},
+		{"invalid DTSTART", calendar(event("UID:bad", "DTSTART;VALUE=DATE:2030-01-01")...), nil, "S30102"},
+		{"monthly RRULE", calendar(event("UID:monthly", "DTSTART;VALUE=DATE:20300101", "RRULE:FREQ=MONTHLY")...), nil, "S30102"},
+		{"RRULE with COUNT", calendar(event("UID:count", "DTSTART;VALUE=DATE:20300101", "RRULE:FREQ=YEARLY;COUNT=2")...), nil, "S30102"},
+		{"invalid BYDAY", calendar(event("UID:byday", "DTSTART;VALUE=DATE:20300101", "RRULE:FREQ=YEARLY;BYMONTH=1;BYDAY=MO")...), nil, "S30102"},
+		{"multi-day nth weekday",
+			calendar(event("UID:multi", "DTSTART;VALUE=DATE:20301128", "DTEND;VALUE=DATE:20301130", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH")...),
+			nil, "S30102"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			holidays, err := parseICSHolidays(strings.NewReader(test.ics))
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(holidays, test.expected) {
+				t.Errorf("Expected holidays %v, got %v", test.expected, holidays)
+			}
+		})
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"short line", "SUMMARY:New Year", "SUMMARY:New Year"},
+		{"exactly 75 octets", strings.Repeat("a", 75), strings.Repeat("a", 75)},
+		{"longer than 75 octets", strings.Repeat("a", 150),
+			strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n " + "a"},
+		{"multi-byte character not split", strings.Repeat("a", 74) + "éb",
+			strings.Repeat("a", 74) + "\r\n éb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folded := foldICSLine(test.line)
+			if folded != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, folded)
+			}
+
+			// Folded line is unfolded back by the parser
+			holidays, err := parseICSHolidays(strings.NewReader(
+				"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20300101\r\n" + foldICSLine("SUMMARY:"+test.line) + "\r\nEND:VEVENT\r\nEND:VCALENDAR"))
+			if err != nil || len(holidays) != 1 || holidays[0][FLD_HOLIDAY_NAME] != test.line {
+				t.Errorf("Expected unfolded name %q, got %v %v", test.line, holidays, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,630 @@
+package hr_service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	// Leave Ledger entries are kept in the Staff record
+	FLD_LEAVE_LEDGER        = "leave_ledger"
+	FLD_LEDGER_ID           = "ledger_id"
+	FLD_LEDGER_ENTRY_TYPE   = "entry_type"
+	FLD_LEDGER_ENTRY_DATE   = "entry_date"
+	FLD_LEDGER_DAYS         = "days"
+	FLD_LEDGER_BALANCE      = "balance"
+	FLD_LEDGER_REFERENCE    = "reference_id"
+	FLD_LEDGER_REMARKS      = "remarks"
+	FLD_LEAVE_BALANCE_AS_OF = "as_of"
+
+	// Leave Ledger entry types
+	LEDGER_ENTRY_OPENING       = "opening"
+	LEDGER_ENTRY_ACCRUAL       = "accrual"
+	LEDGER_ENTRY_CONSUMPTION   = "consumption"
+	LEDGER_ENTRY_CARRY_FORWARD = "carry_forward"
+	LEDGER_ENTRY_ENCASHMENT    = "encashment"
+	LEDGER_ENTRY_ADJUSTMENT    = "adjustment"
+
+	// Leave Balance Summary fields
+	FLD_BALANCE_OPENING  = "opening"
+	FLD_BALANCE_ACCRUED  = "accrued"
+	FLD_BALANCE_CONSUMED = "consumed"
+	FLD_BALANCE_LAPSED   = "lapsed"
+	FLD_BALANCE_ENCASHED = "encashed"
+	FLD_BALANCE_ADJUSTED = "adjusted"
+)
+
+// LeaveBalanceService - Leave Balance Service structure
+type LeaveBalanceService interface {
+	GetLeaveBalance(staffId string, leaveTypeId string, asOf time.Time) (utils.Map, error)
+	ListLeaveLedger(staffId string, leaveTypeId string, asOf time.Time) (utils.Map, error)
+	AddLedgerEntry(staffId string, indata utils.Map) (utils.Map, error)
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// leaveBalanceBaseService - Leave Balance Service structure
+type leaveBalanceBaseService struct {
+	DaoProvider
+	daoLeave            hr_repository.LeaveDao
+	daoLeaveType        hr_repository.LeaveTypeDao
+	daoStaff            hr_repository.StaffDao
+	daoPlatformBusiness platform_repository.BusinessDao
+
+	child      LeaveBalanceService
+	businessId string
+}
+
+// ledgerEntry - Leave Ledger entry before computing the running balance
+type ledgerEntry struct {
+	entryDate   time.Time
+	entryType   string
+	days        float64
+	referenceId string
+	remarks     string
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewLeaveBalanceService(props utils.Map) (LeaveBalanceService, error) {
+	funcode := hr_common.GetServiceModuleCode() + "M" + "01"
+
+	log.Printf("LeaveBalanceService::Start")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, hr_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := leaveBalanceBaseService{}
+
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessId = businessId
+
+	// Instantiate other services, Leaves are looked up for any staff
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoLeave = p.NewLeaveDao(p.businessId, "")
+	p.daoLeaveType = p.NewLeaveTypeDao(p.businessId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+
+	_, err = p.daoPlatformBusiness.Get(p.businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business id",
+			ErrorDetail: "Given business id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, nil
+}
+
+func (p *leaveBalanceBaseService) EndService() {
+	p.Close()
+}
+
+// *********************************************************************
+// GetLeaveBalance - Get the balance of the leave type as of given date
+//
+// *********************************************************************
+func (p *leaveBalanceBaseService) GetLeaveBalance(staffId string, leaveTypeId string, asOf time.Time) (utils.Map, error) {
+
+	log.Println("LeaveBalanceService::GetLeaveBalance - Begin", staffId, leaveTypeId, asOf)
+
+	ledger, err := p.buildLedger(staffId, leaveTypeId, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := utils.Map{
+		hr_common.FLD_STAFF_ID:     staffId,
+		hr_common.FLD_LEAVETYPE_ID: leaveTypeId,
+		FLD_LEAVE_BALANCE_AS_OF:    asOf.Format(time.DateOnly),
+		FLD_BALANCE_OPENING:        0.0,
+		FLD_BALANCE_ACCRUED:        0.0,
+		FLD_BALANCE_CONSUMED:       0.0,
+		FLD_BALANCE_LAPSED:         0.0,
+		FLD_BALANCE_ENCASHED:       0.0,
+		FLD_BALANCE_ADJUSTED:       0.0,
+		FLD_LEDGER_BALANCE:         0.0,
+	}
+
+	summaryFields := map[string]string{
+		LEDGER_ENTRY_OPENING:       FLD_BALANCE_OPENING,
+		LEDGER_ENTRY_ACCRUAL:       FLD_BALANCE_ACCRUED,
+		LEDGER_ENTRY_CONSUMPTION:   FLD_BALANCE_CONSUMED,
+		LEDGER_ENTRY_CARRY_FORWARD: FLD_BALANCE_LAPSED,
+		LEDGER_ENTRY_ENCASHMENT:    FLD_BALANCE_ENCASHED,
+		LEDGER_ENTRY_ADJUSTMENT:    FLD_BALANCE_ADJUSTED,
+	}
+
+	for _, entry := range ledger {
+		entryType := entry[FLD_LEDGER_ENTRY_TYPE].(string)
+		days := entry[FLD_LEDGER_DAYS].(float64)
+
+		// Consumed, Lapsed & Encashed days are reported as positive values
+		if entryType != LEDGER_ENTRY_OPENING && entryType != LEDGER_ENTRY_ACCRUAL && entryType != LEDGER_ENTRY_ADJUSTMENT {
+			days = -days
+		}
+		fieldName, ok := summaryFields[entryType]
+		if !ok {
+			continue
+		}
+		summary[fieldName] = roundTo2Decimals(summary[fieldName].(float64) + days)
+		summary[FLD_LEDGER_BALANCE] = entry[FLD_LEDGER_BALANCE]
+	}
+
+	log.Println("LeaveBalanceService::GetLeaveBalance - End", summary)
+	return summary, nil
+}
+
+// ***************************************************************
+// ListLeaveLedger - List the ledger entries with running balance
+//
+// ***************************************************************
+func (p *leaveBalanceBaseService) ListLeaveLedger(staffId string, leaveTypeId string, asOf time.Time) (utils.Map, error) {
+
+	log.Println("LeaveBalanceService::ListLeaveLedger - Begin", staffId, leaveTypeId, asOf)
+
+	ledger, err := p.buildLedger(staffId, leaveTypeId, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		db_common.LIST_RESULTSIZE: len(ledger),
+		db_common.LIST_RESULT:     ledger,
+	}
+
+	log.Println("LeaveBalanceService::ListLeaveLedger - End", len(ledger))
+	return response, nil
+}
+
+// **********************************************************************
+// AddLedgerEntry - Add opening balance, encashment or manual adjustment,
+// encashment is checked against the balance in the same transaction
+//
+// **********************************************************************
+func (p *leaveBalanceBaseService) AddLedgerEntry(staffId string, indata utils.Map) (utils.Map, error) {
+
+	log.Println("LeaveBalanceService::AddLedgerEntry - Begin", staffId)
+
+	_, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	leaveTypeId, err := utils.GetMemberDataStr(indata, hr_common.FLD_LEAVETYPE_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.daoLeaveType.Get(leaveTypeId)
+	if err != nil {
+		return nil, err
+	}
+
+	entryType, err := utils.GetMemberDataStr(indata, FLD_LEDGER_ENTRY_TYPE)
+	if err != nil || (entryType != LEDGER_ENTRY_OPENING && entryType != LEDGER_ENTRY_ENCASHMENT && entryType != LEDGER_ENTRY_ADJUSTMENT) {
+		err := &utils.AppError{
+			ErrorCode:   "S30102",
+			ErrorMsg:    "Invalid entry_type",
+			ErrorDetail: "entry_type should be one of opening, encashment or adjustment"}
+		return nil, err
+	}
+
+	days, err := getMemberDataFloat(indata, FLD_LEDGER_DAYS)
+	if err != nil {
+		return nil, err
+	}
+
+	entryDate := time.Now()
+	entryDateStr, err := utils.GetMemberDataStr(indata, FLD_LEDGER_ENTRY_DATE)
+	if err == nil {
+		entryDate, err = parseDateValue(entryDateStr)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   "S30102",
+				ErrorMsg:    "Invalid entry_date",
+				ErrorDetail: "entry_date value is invalid"}
+			return nil, err
+		}
+	}
+
+	if entryType == LEDGER_ENTRY_ENCASHMENT {
+		if days <= 0 {
+			err := &utils.AppError{
+				ErrorCode:   "S30102",
+				ErrorMsg:    "Invalid days",
+				ErrorDetail: "Encashment days should be greater than zero"}
+			return nil, err
+		}
+		days = -days
+	}
+
+	remarks, _ := utils.GetMemberDataStr(indata, FLD_LEDGER_REMARKS)
+
+	entry := utils.Map{
+		FLD_LEDGER_ID:              utils.GenerateUniqueId(ID_PREFIX_LEAVE_LEDGER),
+		hr_common.FLD_LEAVETYPE_ID: leaveTypeId,
+		FLD_LEDGER_ENTRY_TYPE:      entryType,
+		FLD_LEDGER_ENTRY_DATE:      entryDate.Format(time.DateOnly),
+		FLD_LEDGER_DAYS:            days,
+		FLD_LEDGER_REMARKS:         remarks,
+		db_common.FLD_CREATED_AT:   time.Now().UTC(),
+	}
+
+	err = runInTransaction(p.DaoProvider, func() error {
+		// Encashment is limited to the available balance
+		if entryType == LEDGER_ENTRY_ENCASHMENT {
+			balance, err := p.GetLeaveBalance(staffId, leaveTypeId, entryDate)
+			if err != nil {
+				return err
+			}
+			if -days > balance[FLD_LEDGER_BALANCE].(float64) {
+				err := &utils.AppError{
+					ErrorCode:   "S30102",
+					ErrorMsg:    "Insufficient Balance",
+					ErrorDetail: fmt.Sprintf("Only %v days available for encashment", balance[FLD_LEDGER_BALANCE])}
+				return err
+			}
+		}
+
+		staffInfo, err := p.daoStaff.Get(staffId)
+		if err != nil {
+			return err
+		}
+
+		// Entry is set at the end of the ledger rather than rewriting the whole ledger, the
+		// concurrent entry at the same position conflicts and the transaction is run again
+		ledgerEntries := []interface{}{}
+		dataVal, err := utils.GetMemberData(staffInfo, FLD_LEAVE_LEDGER)
+		if err == nil {
+			ledgerEntries, _ = toSlice(dataVal)
+		}
+
+		updateData := utils.Map{fmt.Sprintf("%s.%d", FLD_LEAVE_LEDGER, len(ledgerEntries)): entry}
+		if dataVal == nil {
+			updateData = utils.Map{FLD_LEAVE_LEDGER: []utils.Map{entry}}
+		}
+		_, err = p.daoStaff.Update(staffId, updateData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("LeaveBalanceService::AddLedgerEntry - End", entry)
+	return entry, nil
+}
+
+func (p *leaveBalanceBaseService) errorReturn(err error) (LeaveBalanceService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
+
+// buildLedger - Build the ledger entries with running balance for the staff & leave type
+func (p *leaveBalanceBaseService) buildLedger(staffId string, leaveTypeId string, asOf time.Time) ([]utils.Map, error) {
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	leaveTypeInfo, err := p.daoLeaveType.Get(leaveTypeId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave dates are stored without timezone
+	asOfDate := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Manual entries from Staff record
+	manualEntries := p.getManualEntries(staffInfo, leaveTypeId, asOfDate)
+
+	// Latest opening balance resets the ledger, entries before that are ignored
+	var baseDate time.Time
+	for _, entry := range manualEntries {
+		if entry.entryType == LEDGER_ENTRY_OPENING && !entry.entryDate.Before(baseDate) {
+			baseDate = entry.entryDate
+		}
+	}
+
+	// Accrual starts from joining date, or from the asOf year if joining date is unknown
+	joinDate := time.Date(asOfDate.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	joinDateStr, err := getStaffDataStr(staffInfo, FLD_STAFF_DATE_OF_JOIN)
+	if err == nil {
+		joinDate, err = parseDateValue(joinDateStr)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   "S30102",
+				ErrorMsg:    "Invalid date_of_join",
+				ErrorDetail: "Staff date_of_join value is invalid"}
+			return nil, err
+		}
+		joinDate = truncateToDate(joinDate)
+	}
+
+	entries := []ledgerEntry{}
+	for _, entry := range manualEntries {
+		if !entry.entryDate.Before(baseDate) {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, p.getAccrualEntries(leaveTypeInfo, joinDate, baseDate, asOfDate)...)
+
+	consumedEntries, err := p.getConsumptionEntries(staffId, leaveTypeId, baseDate, asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, consumedEntries...)
+
+	// Order by date, opening & carry-forward happen ahead of other entries on the same day
+	entryOrder := map[string]int{
+		LEDGER_ENTRY_OPENING:       0,
+		LEDGER_ENTRY_CARRY_FORWARD: 1,
+		LEDGER_ENTRY_ACCRUAL:       2,
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].entryDate.Equal(entries[j].entryDate) {
+			return entries[i].entryDate.Before(entries[j].entryDate)
+		}
+		orderI, okI := entryOrder[entries[i].entryType]
+		orderJ, okJ := entryOrder[entries[j].entryType]
+		if !okI {
+			orderI = len(entryOrder)
+		}
+		if !okJ {
+			orderJ = len(entryOrder)
+		}
+		return orderI < orderJ
+	})
+
+	// No cap configured, the whole balance is carried forward
+	carryForwardCap, errCap := getMemberDataFloat(leaveTypeInfo, FLD_LEAVE_CARRY_FWD_CAP)
+
+	balance := 0.0
+	ledger := []utils.Map{}
+	for _, entry := range entries {
+		switch entry.entryType {
+		case LEDGER_ENTRY_OPENING:
+			balance = entry.days
+		case LEDGER_ENTRY_CARRY_FORWARD:
+			// Lapse the balance above the carry-forward cap at the year end
+			entry.days = 0
+			if errCap == nil && balance > carryForwardCap {
+				entry.days = roundTo2Decimals(carryForwardCap - balance)
+			}
+			balance += entry.days
+		default:
+			balance += entry.days
+		}
+		balance = roundTo2Decimals(balance)
+
+		ledger = append(ledger, utils.Map{
+			FLD_LEDGER_ENTRY_DATE: entry.entryDate.Format(time.DateOnly),
+			FLD_LEDGER_ENTRY_TYPE: entry.entryType,
+			FLD_LEDGER_DAYS:       roundTo2Decimals(entry.days),
+			FLD_LEDGER_BALANCE:    balance,
+			FLD_LEDGER_REFERENCE:  entry.referenceId,
+			FLD_LEDGER_REMARKS:    entry.remarks,
+		})
+	}
+
+	return ledger, nil
+}
+
+// getManualEntries - Get the opening, encashment & adjustment entries stored in Staff record
+func (p *leaveBalanceBaseService) getManualEntries(staffInfo utils.Map, leaveTypeId string, asOfDate time.Time) []ledgerEntry {
+
+	entries := []ledgerEntry{}
+
+	dataVal, err := utils.GetMemberData(staffInfo, FLD_LEAVE_LEDGER)
+	if err != nil {
+		return entries
+	}
+
+	ledgerEntries, _ := toSlice(dataVal)
+	for _, item := range ledgerEntries {
+		entryInfo, ok := toMap(item)
+		if !ok {
+			continue
+		}
+
+		entryLeaveTypeId, _ := utils.GetMemberDataStr(entryInfo, hr_common.FLD_LEAVETYPE_ID)
+		entryDateStr, _ := utils.GetMemberDataStr(entryInfo, FLD_LEDGER_ENTRY_DATE)
+		entryDate, err := parseDateValue(entryDateStr)
+		if entryLeaveTypeId != leaveTypeId || err != nil || entryDate.After(asOfDate) {
+			continue
+		}
+
+		entryType, _ := utils.GetMemberDataStr(entryInfo, FLD_LEDGER_ENTRY_TYPE)
+		days, _ := getMemberDataFloat(entryInfo, FLD_LEDGER_DAYS)
+		ledgerId, _ := utils.GetMemberDataStr(entryInfo, FLD_LEDGER_ID)
+		remarks, _ := utils.GetMemberDataStr(entryInfo, FLD_LEDGER_REMARKS)
+
+		entries = append(entries, ledgerEntry{
+			entryDate:   entryDate,
+			entryType:   entryType,
+			days:        days,
+			referenceId: ledgerId,
+			remarks:     remarks,
+		})
+	}
+
+	return entries
+}
+
+// getAccrualEntries - Get the accrual & year-end carry-forward entries from the joining date
+func (p *leaveBalanceBaseService) getAccrualEntries(leaveTypeInfo utils.Map, joinDate time.Time, baseDate time.Time, asOfDate time.Time) []ledgerEntry {
+
+	entries := []ledgerEntry{}
+
+	entitlement, err := getMemberDataFloat(leaveTypeInfo, FLD_LEAVE_ENTITLEMENT_DAYS)
+	if err != nil || entitlement <= 0 {
+		return entries
+	}
+
+	accrualType, _ := utils.GetMemberDataStr(leaveTypeInfo, FLD_LEAVE_ACCRUAL_TYPE)
+	isProRata, _ := utils.GetMemberDataBool(leaveTypeInfo, FLD_LEAVE_IS_PRO_RATA)
+
+	// Entries on or before the opening balance date are already part of the opening balance
+	isApplicable := func(entryDate time.Time) bool {
+		return (baseDate.IsZero() || entryDate.After(baseDate)) && !entryDate.After(asOfDate)
+	}
+
+	for year := joinDate.Year(); year <= asOfDate.Year(); year++ {
+		yearStart := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		// Year end carry-forward, days are computed while building the ledger
+		if year > joinDate.Year() && isApplicable(yearStart) {
+			entries = append(entries, ledgerEntry{
+				entryDate: yearStart,
+				entryType: LEDGER_ENTRY_CARRY_FORWARD,
+				remarks:   fmt.Sprintf("Carry forward from %d", year-1),
+			})
+		}
+
+		if accrualType == LEAVE_ACCRUAL_MONTHLY {
+			// Credit 1/12th of the entitlement at the start of each month
+			for month := time.January; month <= time.December; month++ {
+				accrualDate := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+				if accrualDate.Before(joinDate) {
+					if year != joinDate.Year() || month != joinDate.Month() {
+						continue
+					}
+					accrualDate = joinDate
+				}
+				if isApplicable(accrualDate) {
+					entries = append(entries, ledgerEntry{
+						entryDate: accrualDate,
+						entryType: LEDGER_ENTRY_ACCRUAL,
+						days:      entitlement / 12,
+						remarks:   accrualDate.Format("Jan 2006"),
+					})
+				}
+			}
+		} else {
+			// Credit the yearly entitlement at the start of the year, pro-rated for the joining year
+			accrualDate := yearStart
+			days := entitlement
+			if year == joinDate.Year() {
+				accrualDate = joinDate
+				if isProRata {
+					days = entitlement * float64(12-int(joinDate.Month())+1) / 12
+				}
+			}
+			if isApplicable(accrualDate) {
+				entries = append(entries, ledgerEntry{
+					entryDate: accrualDate,
+					entryType: LEDGER_ENTRY_ACCRUAL,
+					days:      days,
+					remarks:   fmt.Sprintf("Year %d", year),
+				})
+			}
+		}
+	}
+
+	return entries
+}
+
+// getConsumptionEntries - Get the leaves availed by the staff for the leave type
+func (p *leaveBalanceBaseService) getConsumptionEntries(staffId string, leaveTypeId string, baseDate time.Time, asOfDate time.Time) ([]ledgerEntry, error) {
+
+	entries := []ledgerEntry{}
+
+	// Only the approved leaves are consumed, leaves without status are created before the workflow
+	filter := fmt.Sprintf(`{"%s":"%s","%s":"%s","%s":{"$nin":["%s","%s","%s","%s"]},"%s":false}`,
+		hr_common.FLD_STAFF_ID, staffId,
+		hr_common.FLD_LEAVETYPE_ID, leaveTypeId,
+		FLD_LEAVE_STATUS, LEAVE_STATUS_DRAFT, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_REJECTED, LEAVE_STATUS_CANCELLED,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoLeave.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return entries, nil
+	}
+
+	for _, leaveInfo := range dataList.([]utils.Map) {
+		leaveFrom, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_FROM)
+		if err != nil || (!baseDate.IsZero() && !leaveFrom.After(baseDate)) || leaveFrom.After(asOfDate) {
+			continue
+		}
+
+		leaveId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVE_ID)
+		entries = append(entries, ledgerEntry{
+			entryDate:   leaveFrom,
+			entryType:   LEDGER_ENTRY_CONSUMPTION,
+			days:        -getLeaveDays(leaveInfo),
+			referenceId: leaveId,
+		})
+	}
+
+	return entries, nil
+}
+
+// getLeaveDate - Get the date portion of leave_from/leave_to
+func getLeaveDate(leaveInfo utils.Map, fieldName string) (time.Time, error) {
+	dateStr, err := utils.GetMemberDataStr(leaveInfo, fieldName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dateVal, err := parseDateValue(dateStr)
+	if err != nil {
+		return dateVal, err
+	}
+	return truncateToDate(dateVal), nil
+}
+
+// getLeaveDays - Get the number of days charged for the leave
+func getLeaveDays(leaveInfo utils.Map) float64 {
+
+	// Chargeable days computed when the leave was created
+	leaveDays, err := getMemberDataFloat(leaveInfo, FLD_LEAVE_DAYS)
+	if err == nil {
+		return leaveDays
+	}
+
+	leaveFrom, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_FROM)
+	if err != nil {
+		return 0
+	}
+
+	leaveTo, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_TO)
+	if err != nil || leaveTo.Before(leaveFrom) {
+		leaveTo = leaveFrom
+	}
+
+	// Both days inclusive
+	return float64(int(leaveTo.Sub(leaveFrom).Hours()/24) + 1)
+}
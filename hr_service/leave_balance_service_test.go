@@ -0,0 +1,195 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestAddLedgerEntry(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_LEAVE_TYPES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVETYPE_ID: "casual"})
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2030-01-01"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2030-01-01"},
+			FLD_LEAVE_LEDGER: []utils.Map{{FLD_LEDGER_ID: "ledger_opening", hr_common.FLD_LEAVETYPE_ID: "casual",
+				FLD_LEDGER_ENTRY_TYPE: LEDGER_ENTRY_OPENING, FLD_LEDGER_ENTRY_DATE: "2030-01-01", FLD_LEDGER_DAYS: 5}}},
+	)
+
+	balanceService, err := NewLeaveBalanceService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balanceService.EndService()
+
+	tests := []struct {
+		name      string
+		staffId   string
+		entryType string
+		days      float64
+		errorCode string
+		ledger    int
+	}{
+		{"first entry", "staff_1", LEDGER_ENTRY_OPENING, 3, "", 1},
+		{"appended entry", "staff_1", LEDGER_ENTRY_ADJUSTMENT, 1, "", 2},
+		{"after seeded entry", "staff_2", LEDGER_ENTRY_ENCASHMENT, 2, "", 2},
+		{"encashment above balance", "staff_2", LEDGER_ENTRY_ENCASHMENT, 4, "S30102", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := balanceService.AddLedgerEntry(test.staffId, utils.Map{
+				hr_common.FLD_LEAVETYPE_ID: "casual",
+				FLD_LEDGER_ENTRY_TYPE:      test.entryType,
+				FLD_LEDGER_ENTRY_DATE:      "2030-02-01",
+				FLD_LEDGER_DAYS:            test.days,
+			})
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			staffInfo, err := provider.NewStaffDao(testBusinessId).Get(test.staffId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ledgerEntries, _ := toSlice(staffInfo[FLD_LEAVE_LEDGER])
+			if len(ledgerEntries) != test.ledger {
+				t.Errorf("Expected %d ledger entries, got %v", test.ledger, ledgerEntries)
+			}
+		})
+	}
+
+	balance, err := balanceService.GetLeaveBalance("staff_2", "casual", time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance[FLD_LEDGER_BALANCE] != 3.0 {
+		t.Errorf("Expected balance 3 after encashment, got %v", balance)
+	}
+}
+
+func TestBuildLedger(t *testing.T) {
+
+	provider, props := newTestProvider()
+	leaveType := func(leaveTypeId string, accrualType string, entitlement float64, extra utils.Map) utils.Map {
+		return utils.MergeMap(utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVETYPE_ID: leaveTypeId,
+			FLD_LEAVE_ACCRUAL_TYPE: accrualType, FLD_LEAVE_ENTITLEMENT_DAYS: entitlement}, extra, false)
+	}
+	provider.Seed(MEMORY_COLLECTION_LEAVE_TYPES,
+		leaveType("yearly", LEAVE_ACCRUAL_YEARLY, 12, utils.Map{}),
+		leaveType("monthly", LEAVE_ACCRUAL_MONTHLY, 12, utils.Map{}),
+		leaveType("pro_rata", LEAVE_ACCRUAL_YEARLY, 12, utils.Map{FLD_LEAVE_IS_PRO_RATA: true}),
+		leaveType("capped", LEAVE_ACCRUAL_YEARLY, 10, utils.Map{FLD_LEAVE_CARRY_FWD_CAP: 3}),
+	)
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_jan",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2030-01-01"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_apr",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2030-04-15"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_opening",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2029-01-01"},
+			FLD_LEAVE_LEDGER: []utils.Map{
+				{hr_common.FLD_LEAVETYPE_ID: "yearly", FLD_LEDGER_ENTRY_TYPE: LEDGER_ENTRY_ADJUSTMENT, FLD_LEDGER_ENTRY_DATE: "2030-02-01", FLD_LEDGER_DAYS: 2},
+				{hr_common.FLD_LEAVETYPE_ID: "yearly", FLD_LEDGER_ENTRY_TYPE: LEDGER_ENTRY_OPENING, FLD_LEDGER_ENTRY_DATE: "2030-03-01", FLD_LEDGER_DAYS: 4},
+				{hr_common.FLD_LEAVETYPE_ID: "yearly", FLD_LEDGER_ENTRY_TYPE: LEDGER_ENTRY_ADJUSTMENT, FLD_LEDGER_ENTRY_DATE: "2030-04-01", FLD_LEDGER_DAYS: 1},
+				{hr_common.FLD_LEAVETYPE_ID: "monthly", FLD_LEDGER_ENTRY_TYPE: LEDGER_ENTRY_OPENING, FLD_LEDGER_ENTRY_DATE: "2030-01-01", FLD_LEDGER_DAYS: 9},
+			}},
+	)
+	leave := func(leaveId string, staffId string, leaveTypeId string, leaveFrom string, leaveTo string, status string) utils.Map {
+		return utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVE_ID: leaveId, hr_common.FLD_STAFF_ID: staffId,
+			hr_common.FLD_LEAVETYPE_ID: leaveTypeId, hr_common.FLD_LEAVE_FROM: leaveFrom, hr_common.FLD_LEAVE_TO: leaveTo, FLD_LEAVE_STATUS: status}
+	}
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		leave("jan_yearly", "staff_jan", "yearly", "2030-02-10 09:00:00", "2030-02-11 18:00:00", LEAVE_STATUS_APPROVED),
+		leave("jan_rejected", "staff_jan", "yearly", "2030-03-10 09:00:00", "2030-03-10 18:00:00", LEAVE_STATUS_REJECTED),
+		utils.MergeMap(leave("jan_capped", "staff_jan", "capped", "2030-03-01 09:00:00", "2030-03-01 13:00:00", LEAVE_STATUS_APPROVED),
+			utils.Map{FLD_LEAVE_DAYS: 0.5}, false),
+		leave("opening_before", "staff_opening", "yearly", "2030-02-15 09:00:00", "2030-02-15 18:00:00", LEAVE_STATUS_APPROVED),
+		leave("opening_after", "staff_opening", "yearly", "2030-05-05 09:00:00", "2030-05-05 18:00:00", LEAVE_STATUS_APPROVED),
+	)
+
+	balanceService, err := NewLeaveBalanceService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balanceService.EndService()
+	p := balanceService.(*leaveBalanceBaseService)
+
+	type ledgerRow struct {
+		date      string
+		entryType string
+		days      float64
+		balance   float64
+	}
+
+	tests := []struct {
+		name        string
+		staffId     string
+		leaveTypeId string
+		asOf        string
+		expected    []ledgerRow
+	}{
+		{"yearly accrual with consumption", "staff_jan", "yearly", "2030-06-30", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_ACCRUAL, 12, 12},
+			{"2030-02-10", LEDGER_ENTRY_CONSUMPTION, -2, 10}}},
+		{"consumption after as-of date ignored", "staff_jan", "yearly", "2030-02-01", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_ACCRUAL, 12, 12}}},
+		{"monthly accrual", "staff_jan", "monthly", "2030-03-15", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_ACCRUAL, 1, 1},
+			{"2030-02-01", LEDGER_ENTRY_ACCRUAL, 1, 2},
+			{"2030-03-01", LEDGER_ENTRY_ACCRUAL, 1, 3}}},
+		{"monthly accrual from joining month", "staff_apr", "monthly", "2030-05-01", []ledgerRow{
+			{"2030-04-15", LEDGER_ENTRY_ACCRUAL, 1, 1},
+			{"2030-05-01", LEDGER_ENTRY_ACCRUAL, 1, 2}}},
+		{"pro-rata for joining year", "staff_apr", "pro_rata", "2031-01-01", []ledgerRow{
+			{"2030-04-15", LEDGER_ENTRY_ACCRUAL, 9, 9},
+			{"2031-01-01", LEDGER_ENTRY_CARRY_FORWARD, 0, 9},
+			{"2031-01-01", LEDGER_ENTRY_ACCRUAL, 12, 21}}},
+		{"carry forward without cap", "staff_jan", "yearly", "2031-01-01", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_ACCRUAL, 12, 12},
+			{"2030-02-10", LEDGER_ENTRY_CONSUMPTION, -2, 10},
+			{"2031-01-01", LEDGER_ENTRY_CARRY_FORWARD, 0, 10},
+			{"2031-01-01", LEDGER_ENTRY_ACCRUAL, 12, 22}}},
+		{"carry forward lapses above cap", "staff_jan", "capped", "2031-01-01", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_ACCRUAL, 10, 10},
+			{"2030-03-01", LEDGER_ENTRY_CONSUMPTION, -0.5, 9.5},
+			{"2031-01-01", LEDGER_ENTRY_CARRY_FORWARD, -6.5, 3},
+			{"2031-01-01", LEDGER_ENTRY_ACCRUAL, 10, 13}}},
+		{"opening balance resets ledger", "staff_opening", "yearly", "2030-12-31", []ledgerRow{
+			{"2030-03-01", LEDGER_ENTRY_OPENING, 4, 4},
+			{"2030-04-01", LEDGER_ENTRY_ADJUSTMENT, 1, 5},
+			{"2030-05-05", LEDGER_ENTRY_CONSUMPTION, -1, 4}}},
+		{"accrual after opening balance", "staff_opening", "monthly", "2030-03-01", []ledgerRow{
+			{"2030-01-01", LEDGER_ENTRY_OPENING, 9, 9},
+			{"2030-02-01", LEDGER_ENTRY_ACCRUAL, 1, 10},
+			{"2030-03-01", LEDGER_ENTRY_ACCRUAL, 1, 11}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asOf, _ := time.Parse(time.DateOnly, test.asOf)
+			ledger, err := p.buildLedger(test.staffId, test.leaveTypeId, asOf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows := []ledgerRow{}
+			for _, entry := range ledger {
+				rows = append(rows, ledgerRow{entry[FLD_LEDGER_ENTRY_DATE].(string), entry[FLD_LEDGER_ENTRY_TYPE].(string),
+					entry[FLD_LEDGER_DAYS].(float64), entry[FLD_LEDGER_BALANCE].(float64)})
+			}
+			if !reflect.DeepEqual(rows, test.expected) {
+				t.Errorf("Expected ledger %v, got %v", test.expected, rows)
+			}
+		})
+	}
+}
@@ -1,21 +1,75 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Leave Approval Workflow Fields
+	FLD_LEAVE_STATUS         = "leave_status"
+	FLD_LEAVE_APPROVERS      = "approvers"
+	FLD_LEAVE_APPROVAL_LEVEL = "approval_level"
+	FLD_LEAVE_HISTORY        = "leave_history"
+	FLD_APPROVAL_STATUS      = "approval_status"
+	FLD_ACTION               = "action"
+	FLD_ACTION_BY            = "action_by"
+	FLD_ACTION_AT            = "action_at"
+	FLD_COMMENTS             = "comments"
+	FLD_FROM_STATUS          = "from_status"
+	FLD_TO_STATUS            = "to_status"
+
+	// Number of approval levels configured in LeaveType
+	FLD_LEAVE_APPROVAL_LEVELS     = "approval_levels"
+	DEFAULT_LEAVE_APPROVAL_LEVELS = 1
+
+	// Leave Status
+	LEAVE_STATUS_DRAFT     = "draft"
+	LEAVE_STATUS_SUBMITTED = "submitted"
+	LEAVE_STATUS_APPROVED  = "approved"
+	LEAVE_STATUS_REJECTED  = "rejected"
+	LEAVE_STATUS_CANCELLED = "cancelled"
+	LEAVE_STATUS_LEGACY    = "legacy"
+
+	// Leave Workflow Actions
+	LEAVE_ACTION_CREATE       = "create"
+	LEAVE_ACTION_UPDATE       = "update"
+	LEAVE_ACTION_SUBMIT       = "submit"
+	LEAVE_ACTION_APPROVE      = "approve"
+	LEAVE_ACTION_AUTO_APPROVE = "auto_approve"
+	LEAVE_ACTION_REJECT       = "reject"
+	LEAVE_ACTION_CANCEL       = "cancel"
+
+	// Leave Workflow Error Codes
+	ERRCODE_INVALID_LEAVE_STATUS = "S30121"
+	ERRCODE_NOT_LEAVE_APPROVER   = "S30122"
+	ERRCODE_NOT_LEAVE_OWNER      = "S30125"
+
+	// Leave Duration Fields
+	FLD_LEAVE_DAYS          = "leave_days"
+	FLD_LEAVE_HOURS         = "leave_hours"
+	FLD_LEAVE_IS_HALF_DAY   = "is_half_day"
+	FLD_LEAVE_FROM_HALF_DAY = "from_half_day"
+	FLD_LEAVE_TO_HALF_DAY   = "to_half_day"
+	FLD_LEAVE_IS_PERMISSION = "is_permission"
+	ERRCODE_NO_WORKING_DAYS = "S30123"
+
+	// Leave Overlap Conflicts
+	FLD_CONFLICT_TYPE        = "conflict_type"
+	CONFLICT_TYPE_LEAVE      = "leave"
+	CONFLICT_TYPE_ATTENDANCE = "attendance"
+	ERRCODE_LEAVE_OVERLAP    = "S30124"
+)
+
 // LeaveService - Accounts Service structure
 type LeaveService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -26,6 +80,13 @@ type LeaveService interface {
 	Delete(leaveId string, delete_permanent bool) error
 	DeleteAll(delete_permanent bool) error
 
+	// Approval Workflow, should be invoked on the service opened without staff_id
+	// since the approver is different from the staff who applied the leave
+	Submit(leaveId string, comments string) (utils.Map, error)
+	Approve(leaveId string, approverId string, comments string) (utils.Map, error)
+	Reject(leaveId string, approverId string, comments string) (utils.Map, error)
+	Cancel(leaveId string, staffId string, comments string) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -35,12 +96,15 @@ type LeaveService interface {
 
 // leaveBaseService - Accounts Service structure
 type leaveBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoLeave            hr_repository.LeaveDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	daoPlatformAppUser  platform_repository.AppUserDao
 	daoStaff            hr_repository.StaffDao
+	daoLeaveType        hr_repository.LeaveTypeDao
+	daoHoliday          hr_repository.HolidayDao
+	daoShiftProfile     hr_repository.ShiftProfileDao
+	daoAttendance       hr_repository.AttendanceDao
 
 	child      LeaveService
 	businessId string
@@ -64,19 +128,12 @@ func NewLeaveService(props utils.Map) (LeaveService, error) {
 
 	p := leaveBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Verify whether the User id data passed, this is optional parameter
 	staffId, _ := utils.GetMemberDataStr(props, hr_common.FLD_STAFF_ID)
 
@@ -85,10 +142,14 @@ func NewLeaveService(props utils.Map) (LeaveService, error) {
 	p.staffId = staffId
 
 	// Instantiate other services
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
-	p.daoPlatformAppUser = platform_repository.NewAppUserDao(p.GetClient())
-	p.daoLeave = hr_repository.NewLeaveDao(p.dbRegion.GetClient(), p.businessId, p.staffId)
-	p.daoStaff = hr_repository.NewStaffDao(p.dbRegion.GetClient(), p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
+	p.daoLeave = p.NewLeaveDao(p.businessId, p.staffId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoLeaveType = p.NewLeaveTypeDao(p.businessId)
+	p.daoHoliday = p.NewHolidayDao(p.businessId)
+	p.daoShiftProfile = p.NewShiftProfileDao(p.businessId)
+	p.daoAttendance = p.NewAttendanceDao(p.businessId, "")
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -117,8 +178,7 @@ func NewLeaveService(props utils.Map) (LeaveService, error) {
 }
 
 func (p *leaveBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -162,21 +222,21 @@ func (p *leaveBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var leaveId string
+	// Validate the payload fields
+	err := normalizePayload[Leave](indata, false)
+	if err != nil {
+		return utils.Map{}, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_LEAVE_ID]
-	if dataok {
-		leaveId = strings.ToLower(dataval.(string))
-	} else {
-		leaveId = utils.GenerateUniqueId("leav")
-		log.Println("Unique Account ID", leaveId)
+	leaveId, err := getPayloadId(indata, hr_common.FLD_LEAVE_ID, ID_PREFIX_LEAVE)
+	if err != nil {
+		return utils.Map{}, err
 	}
-	indata[hr_common.FLD_LEAVE_ID] = leaveId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	indata[hr_common.FLD_STAFF_ID] = p.staffId
 	log.Println("Provided Account ID:", leaveId)
 
-	_, err := p.daoLeave.Get(leaveId)
+	_, err = p.daoLeave.Get(leaveId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return utils.Map{}, err
@@ -186,6 +246,25 @@ func (p *leaveBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return utils.Map{}, err
 	}
 
+	// Compute the chargeable days
+	err = p.computeLeaveDuration(indata)
+	if err != nil {
+		return utils.Map{}, err
+	}
+
+	// Verify the leave doesn't clash with other leaves or attendance
+	err = p.validateLeaveOverlap(indata, leaveId)
+	if err != nil {
+		return utils.Map{}, err
+	}
+
+	// Leave starts as draft, Submit it to start the approval
+	delete(indata, FLD_LEAVE_APPROVERS)
+	delete(indata, FLD_LEAVE_APPROVAL_LEVEL)
+	indata[FLD_LEAVE_STATUS] = LEAVE_STATUS_DRAFT
+	indata[FLD_LEAVE_HISTORY] = []interface{}{}
+	p.appendLeaveHistory(indata, LEAVE_ACTION_CREATE, p.staffId, "", "", LEAVE_STATUS_DRAFT)
+
 	insertResult, err := p.daoLeave.Create(indata)
 	if err != nil {
 		return utils.Map{}, err
@@ -199,21 +278,71 @@ func (p *leaveBaseService) Update(leaveId string, indata utils.Map) (utils.Map,
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Leave](indata, true)
+	if err != nil {
+		return utils.Map{}, err
+	}
+
 	data, err := p.daoLeave.Get(leaveId)
 	if err != nil {
 		return data, err
 	}
 
+	// Only draft, submitted or legacy leaves can be modified, submitted leaves go back to draft
+	leaveStatus := getLeaveStatus(data)
+	if leaveStatus != LEAVE_STATUS_DRAFT && leaveStatus != LEAVE_STATUS_SUBMITTED && leaveStatus != LEAVE_STATUS_LEGACY {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_LEAVE_STATUS,
+			ErrorMsg:    "Leave cannot be modified",
+			ErrorDetail: "Leave is already " + leaveStatus}
+		return nil, err
+	}
+
 	// Delete key fields
 	delete(indata, hr_common.FLD_LEAVE_ID)
 	delete(indata, hr_common.FLD_BUSINESS_ID)
 	delete(indata, hr_common.FLD_STAFF_ID)
 
+	// Workflow fields are changed only through the workflow actions
+	delete(indata, FLD_LEAVE_STATUS)
+	delete(indata, FLD_LEAVE_APPROVERS)
+	delete(indata, FLD_LEAVE_APPROVAL_LEVEL)
+	delete(indata, FLD_LEAVE_HISTORY)
+
 	err = p.validateDateTime(indata)
 	if err != nil {
 		return utils.Map{}, err
 	}
 
+	// Recompute the chargeable days when the duration is changed
+	delete(indata, FLD_LEAVE_DAYS)
+	delete(indata, FLD_LEAVE_HOURS)
+	if p.isDurationChanged(indata) {
+		leaveInfo := utils.MergeMap(data, indata, true)
+		err = p.computeLeaveDuration(leaveInfo)
+		if err != nil {
+			return utils.Map{}, err
+		}
+		indata[FLD_LEAVE_DAYS] = leaveInfo[FLD_LEAVE_DAYS]
+		indata[FLD_LEAVE_HOURS] = leaveInfo[FLD_LEAVE_HOURS]
+
+		// Verify the leave doesn't clash with other leaves or attendance
+		err = p.validateLeaveOverlap(leaveInfo, leaveId)
+		if err != nil {
+			return utils.Map{}, err
+		}
+	}
+
+	// Modified leave goes back to draft, Submit it again to restart the approval
+	if leaveStatus == LEAVE_STATUS_SUBMITTED {
+		indata[FLD_LEAVE_STATUS] = LEAVE_STATUS_DRAFT
+		indata[FLD_LEAVE_APPROVERS] = []utils.Map{}
+		indata[FLD_LEAVE_APPROVAL_LEVEL] = 0
+		p.appendLeaveHistory(data, LEAVE_ACTION_UPDATE, p.staffId, "", LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_DRAFT)
+		indata[FLD_LEAVE_HISTORY] = data[FLD_LEAVE_HISTORY]
+	}
+
 	data, err = p.daoLeave.Update(leaveId, indata)
 	log.Println("AccountService::Update - End ")
 	return data, err
@@ -277,6 +406,143 @@ func (p *leaveBaseService) DeleteAll(delete_permanent bool) error {
 	return nil
 }
 
+// *************************************************************
+// Submit - Submit the draft leave to the reporting approvers
+//
+// *************************************************************
+func (p *leaveBaseService) Submit(leaveId string, comments string) (utils.Map, error) {
+
+	log.Println("LeaveService::Submit - Begin", leaveId)
+
+	data, err := p.daoLeave.Get(leaveId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validateLeaveStatus(data, LEAVE_STATUS_DRAFT)
+	if err != nil {
+		return nil, err
+	}
+
+	staffId, _ := utils.GetMemberDataStr(data, hr_common.FLD_STAFF_ID)
+	approvers, err := p.getApproverChain(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(approvers) == 0 {
+		// No one to approve, e.g. staff at the top of the hierarchy
+		data[FLD_LEAVE_APPROVERS] = approvers
+		p.appendLeaveHistory(data, LEAVE_ACTION_SUBMIT, staffId, comments, LEAVE_STATUS_DRAFT, LEAVE_STATUS_SUBMITTED)
+		p.appendLeaveHistory(data, LEAVE_ACTION_AUTO_APPROVE, "", "No approver in reporting hierarchy", LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_APPROVED)
+		data[FLD_LEAVE_STATUS] = LEAVE_STATUS_APPROVED
+
+		data, err = p.approveWorkflow(leaveId, data)
+	} else {
+		data[FLD_LEAVE_APPROVERS] = approvers
+		data[FLD_LEAVE_APPROVAL_LEVEL] = 1
+		p.appendLeaveHistory(data, LEAVE_ACTION_SUBMIT, staffId, comments, LEAVE_STATUS_DRAFT, LEAVE_STATUS_SUBMITTED)
+		data[FLD_LEAVE_STATUS] = LEAVE_STATUS_SUBMITTED
+
+		data, err = p.updateWorkflow(leaveId, data)
+	}
+
+	log.Println("LeaveService::Submit - End", err)
+	return data, err
+}
+
+// ***********************************************************************
+// Approve - Approve the leave by the approver of current approval level
+//
+// ***********************************************************************
+func (p *leaveBaseService) Approve(leaveId string, approverId string, comments string) (utils.Map, error) {
+
+	log.Println("LeaveService::Approve - Begin", leaveId, approverId)
+
+	data, approvers, level, err := p.getPendingApproval(leaveId, approverId)
+	if err != nil {
+		return nil, err
+	}
+
+	approvers[level-1][FLD_APPROVAL_STATUS] = LEAVE_STATUS_APPROVED
+	approvers[level-1][FLD_ACTION_AT] = time.Now().UTC()
+	data[FLD_LEAVE_APPROVERS] = approvers
+
+	if level < len(approvers) {
+		// Move to the next approval level
+		data[FLD_LEAVE_APPROVAL_LEVEL] = level + 1
+		p.appendLeaveHistory(data, LEAVE_ACTION_APPROVE, approverId, comments, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_SUBMITTED)
+		data, err = p.updateWorkflow(leaveId, data)
+	} else {
+		data[FLD_LEAVE_STATUS] = LEAVE_STATUS_APPROVED
+		p.appendLeaveHistory(data, LEAVE_ACTION_APPROVE, approverId, comments, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_APPROVED)
+		data, err = p.approveWorkflow(leaveId, data)
+	}
+
+	log.Println("LeaveService::Approve - End", err)
+	return data, err
+}
+
+// ***********************************************************************
+// Reject - Reject the leave by the approver of current approval level
+//
+// ***********************************************************************
+func (p *leaveBaseService) Reject(leaveId string, approverId string, comments string) (utils.Map, error) {
+
+	log.Println("LeaveService::Reject - Begin", leaveId, approverId)
+
+	data, approvers, level, err := p.getPendingApproval(leaveId, approverId)
+	if err != nil {
+		return nil, err
+	}
+
+	approvers[level-1][FLD_APPROVAL_STATUS] = LEAVE_STATUS_REJECTED
+	approvers[level-1][FLD_ACTION_AT] = time.Now().UTC()
+	data[FLD_LEAVE_APPROVERS] = approvers
+	data[FLD_LEAVE_STATUS] = LEAVE_STATUS_REJECTED
+	p.appendLeaveHistory(data, LEAVE_ACTION_REJECT, approverId, comments, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_REJECTED)
+
+	data, err = p.updateWorkflow(leaveId, data)
+	log.Println("LeaveService::Reject - End", err)
+	return data, err
+}
+
+// ******************************************************
+// Cancel - Cancel the leave by the staff who applied it
+//
+// ******************************************************
+func (p *leaveBaseService) Cancel(leaveId string, staffId string, comments string) (utils.Map, error) {
+
+	log.Println("LeaveService::Cancel - Begin", leaveId, staffId)
+
+	data, err := p.daoLeave.Get(leaveId)
+	if err != nil {
+		return nil, err
+	}
+
+	leaveStatus := getLeaveStatus(data)
+	err = p.validateLeaveStatus(data, LEAVE_STATUS_DRAFT, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_APPROVED, LEAVE_STATUS_LEGACY)
+	if err != nil {
+		return nil, err
+	}
+
+	leaveStaffId, _ := utils.GetMemberDataStr(data, hr_common.FLD_STAFF_ID)
+	if leaveStaffId != staffId {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_NOT_LEAVE_OWNER,
+			ErrorMsg:    "Not allowed to cancel",
+			ErrorDetail: "Only the staff who applied can cancel the leave"}
+		return nil, err
+	}
+
+	data[FLD_LEAVE_STATUS] = LEAVE_STATUS_CANCELLED
+	p.appendLeaveHistory(data, LEAVE_ACTION_CANCEL, staffId, comments, leaveStatus, LEAVE_STATUS_CANCELLED)
+
+	data, err = p.updateWorkflow(leaveId, data)
+	log.Println("LeaveService::Cancel - End", err)
+	return data, err
+}
+
 func (p *leaveBaseService) errorReturn(err error) (LeaveService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -341,3 +607,445 @@ func (p *leaveBaseService) mergeUserInfo(staffInfo utils.Map) {
 		staffInfo[business_common.FLD_USER_INFO] = []utils.Map{staffData}
 	}
 }
+
+// getLeaveStatus - Get the leave status, leaves created before the workflow don't have the status and
+// are legacy leaves. They are taken like the approved leaves but can still be modified as before
+func getLeaveStatus(leaveInfo utils.Map) string {
+	leaveStatus, err := utils.GetMemberDataStr(leaveInfo, FLD_LEAVE_STATUS)
+	if err != nil || leaveStatus == "" {
+		return LEAVE_STATUS_LEGACY
+	}
+	return leaveStatus
+}
+
+// validateLeaveStatus - Verify the leave is in one of the allowed status
+func (p *leaveBaseService) validateLeaveStatus(leaveInfo utils.Map, allowedStatus ...string) error {
+	leaveStatus := getLeaveStatus(leaveInfo)
+	for _, status := range allowedStatus {
+		if leaveStatus == status {
+			return nil
+		}
+	}
+
+	err := &utils.AppError{
+		ErrorCode:   ERRCODE_INVALID_LEAVE_STATUS,
+		ErrorMsg:    "Invalid Leave Status",
+		ErrorDetail: "Action not allowed when the leave is " + leaveStatus}
+	return err
+}
+
+// getApproverChain - Build the approvers from the reporting hierarchy of the staff,
+// levels are configured in the leave type
+func (p *leaveBaseService) getApproverChain(leaveInfo utils.Map) ([]utils.Map, error) {
+
+	approvalLevels := DEFAULT_LEAVE_APPROVAL_LEVELS
+	leaveTypeId, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVETYPE_ID)
+	if err == nil {
+		leaveTypeInfo, err := p.daoLeaveType.Get(leaveTypeId)
+		if err == nil {
+			levels, err := utils.GetMemberDataInt(leaveTypeInfo, FLD_LEAVE_APPROVAL_LEVELS, true)
+			if err == nil && levels > 0 {
+				approvalLevels = levels
+			}
+		}
+	}
+
+	staffId, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_STAFF_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvers := []utils.Map{}
+	visited := map[string]bool{staffId: true}
+	for level := 1; level <= approvalLevels; level++ {
+		staffInfo, err := p.daoStaff.Get(staffId)
+		if err != nil {
+			break
+		}
+
+		reportingStaffId, err := getStaffDataStr(staffInfo, hr_common.FLD_REPORTING_STAFF_ID)
+		if err != nil || visited[reportingStaffId] {
+			// Reached the top of the hierarchy
+			break
+		}
+		visited[reportingStaffId] = true
+
+		approvers = append(approvers, utils.Map{
+			hr_common.FLD_STAFF_ID:   reportingStaffId,
+			FLD_LEAVE_APPROVAL_LEVEL: level,
+			FLD_APPROVAL_STATUS:      LEAVE_STATUS_SUBMITTED,
+		})
+		staffId = reportingStaffId
+	}
+
+	return approvers, nil
+}
+
+// getPendingApproval - Get the leave and verify the given approver is pending at the current level
+func (p *leaveBaseService) getPendingApproval(leaveId string, approverId string) (utils.Map, []utils.Map, int, error) {
+
+	data, err := p.daoLeave.Get(leaveId)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	err = p.validateLeaveStatus(data, LEAVE_STATUS_SUBMITTED)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	approvers := []utils.Map{}
+	dataVal, _ := utils.GetMemberData(data, FLD_LEAVE_APPROVERS)
+	approverList, _ := toSlice(dataVal)
+	for _, item := range approverList {
+		approver, ok := toMap(item)
+		if ok {
+			approvers = append(approvers, approver)
+		}
+	}
+
+	level, err := utils.GetMemberDataInt(data, FLD_LEAVE_APPROVAL_LEVEL, true)
+	if err != nil || level < 1 || level > len(approvers) {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_LEAVE_STATUS,
+			ErrorMsg:    "Invalid Approval Level",
+			ErrorDetail: "Leave has no pending approval"}
+		return nil, nil, 0, err
+	}
+
+	pendingApproverId, _ := utils.GetMemberDataStr(approvers[level-1], hr_common.FLD_STAFF_ID)
+	if pendingApproverId != approverId {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_NOT_LEAVE_APPROVER,
+			ErrorMsg:    "Not an Approver",
+			ErrorDetail: "Given staff is not the approver of current approval level"}
+		return nil, nil, 0, err
+	}
+
+	return data, approvers, level, nil
+}
+
+// appendLeaveHistory - Record who acted on the leave, when and with which comment
+func (p *leaveBaseService) appendLeaveHistory(leaveInfo utils.Map, action string, actionBy string, comments string, fromStatus string, toStatus string) {
+
+	history := []interface{}{}
+	dataVal, err := utils.GetMemberData(leaveInfo, FLD_LEAVE_HISTORY)
+	if err == nil {
+		history, _ = toSlice(dataVal)
+	}
+
+	history = append(history, utils.Map{
+		FLD_ACTION:      action,
+		FLD_ACTION_BY:   actionBy,
+		FLD_COMMENTS:    comments,
+		FLD_FROM_STATUS: fromStatus,
+		FLD_TO_STATUS:   toStatus,
+		FLD_ACTION_AT:   time.Now().UTC(),
+	})
+	leaveInfo[FLD_LEAVE_HISTORY] = history
+}
+
+// updateWorkflow - Persist the workflow fields of the leave
+func (p *leaveBaseService) updateWorkflow(leaveId string, leaveInfo utils.Map) (utils.Map, error) {
+
+	updateData := utils.Map{
+		FLD_LEAVE_STATUS:    leaveInfo[FLD_LEAVE_STATUS],
+		FLD_LEAVE_APPROVERS: leaveInfo[FLD_LEAVE_APPROVERS],
+		FLD_LEAVE_HISTORY:   leaveInfo[FLD_LEAVE_HISTORY],
+	}
+	if level, ok := leaveInfo[FLD_LEAVE_APPROVAL_LEVEL]; ok {
+		updateData[FLD_LEAVE_APPROVAL_LEVEL] = level
+	}
+
+	_, err := p.daoLeave.Update(leaveId, updateData)
+	if err != nil {
+		return nil, err
+	}
+	return leaveInfo, nil
+}
+
+// approveWorkflow - Persist the approval of the leave, the approved leave is debited from the
+// balance of its leave type so the balance is checked in the same transaction
+func (p *leaveBaseService) approveWorkflow(leaveId string, leaveInfo utils.Map) (utils.Map, error) {
+
+	var data utils.Map
+	err := runInTransaction(p.DaoProvider, func() error {
+		err := p.validateLeaveBalance(leaveInfo)
+		if err != nil {
+			return err
+		}
+
+		data, err = p.updateWorkflow(leaveId, leaveInfo)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// validateLeaveBalance - Verify the balance of the leave type covers the leave days, balance is
+// not tracked for the leave types without entitlement
+func (p *leaveBaseService) validateLeaveBalance(leaveInfo utils.Map) error {
+
+	leaveTypeId, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVETYPE_ID)
+	if err != nil {
+		return nil
+	}
+
+	leaveTypeInfo, err := p.daoLeaveType.Get(leaveTypeId)
+	if err != nil {
+		return err
+	}
+
+	entitlement, err := getMemberDataFloat(leaveTypeInfo, FLD_LEAVE_ENTITLEMENT_DAYS)
+	if err != nil || entitlement <= 0 {
+		return nil
+	}
+
+	leaveFrom, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_FROM)
+	if err != nil {
+		return err
+	}
+
+	// Balance of the leaves of any staff, through the DAOs of the transaction
+	staffId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_STAFF_ID)
+	balanceService := &leaveBalanceBaseService{
+		DaoProvider:  p.DaoProvider,
+		daoLeave:     p.NewLeaveDao(p.businessId, ""),
+		daoLeaveType: p.daoLeaveType,
+		daoStaff:     p.daoStaff,
+		businessId:   p.businessId,
+	}
+	balance, err := balanceService.GetLeaveBalance(staffId, leaveTypeId, leaveFrom)
+	if err != nil {
+		return err
+	}
+
+	leaveDays := getLeaveDays(leaveInfo)
+	if leaveDays > balance[FLD_LEDGER_BALANCE].(float64) {
+		err := &utils.AppError{
+			ErrorCode:   "S30102",
+			ErrorMsg:    "Insufficient Balance",
+			ErrorDetail: fmt.Sprintf("Only %v days available for the leave of %v days", balance[FLD_LEDGER_BALANCE], leaveDays)}
+		return err
+	}
+	return nil
+}
+
+// isDurationChanged - Check whether any of the fields affecting leave duration is modified
+func (p *leaveBaseService) isDurationChanged(indata utils.Map) bool {
+	for _, fieldName := range []string{hr_common.FLD_LEAVE_FROM, hr_common.FLD_LEAVE_TO,
+		FLD_LEAVE_IS_HALF_DAY, FLD_LEAVE_FROM_HALF_DAY, FLD_LEAVE_TO_HALF_DAY, FLD_LEAVE_IS_PERMISSION} {
+		if _, ok := indata[fieldName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// computeLeaveDuration - Compute the chargeable days between leave_from and leave_to excluding the
+// staff's week-offs and the holidays, half-days are charged 0.5 and permissions are charged in hours
+func (p *leaveBaseService) computeLeaveDuration(leaveInfo utils.Map) error {
+
+	leaveFromStr, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVE_FROM)
+	if err != nil {
+		return err
+	}
+	leaveFrom, _ := time.Parse(time.DateTime, leaveFromStr)
+
+	leaveTo := leaveFrom
+	leaveToStr, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVE_TO)
+	if err == nil {
+		leaveTo, _ = time.Parse(time.DateTime, leaveToStr)
+	}
+
+	if leaveTo.Before(leaveFrom) {
+		err := &utils.AppError{
+			ErrorCode:   "S30102",
+			ErrorMsg:    "Invalid leave_to",
+			ErrorDetail: "leave_to should not be earlier than leave_from"}
+		return err
+	}
+
+	// Hourly permission within a day
+	isPermission, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_IS_PERMISSION)
+	if isPermission {
+		if !truncateToDate(leaveFrom).Equal(truncateToDate(leaveTo)) {
+			err := &utils.AppError{
+				ErrorCode:   "S30102",
+				ErrorMsg:    "Invalid Permission",
+				ErrorDetail: "Permission should start and end on the same day"}
+			return err
+		}
+		leaveInfo[FLD_LEAVE_DAYS] = 0.0
+		leaveInfo[FLD_LEAVE_HOURS] = roundTo2Decimals(leaveTo.Sub(leaveFrom).Hours())
+		return nil
+	}
+
+	// Week-Offs & holidays of the staff aren't counted
+	staffId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_STAFF_ID)
+	staffInfo, _ := p.daoStaff.Get(staffId)
+	weekOffs := getStaffWeekOffs(p.daoShiftProfile, staffInfo)
+
+	holidays, err := getHolidayDates(p.daoHoliday, leaveFrom, leaveTo, staffInfo)
+	if err != nil {
+		return err
+	}
+
+	fromHalfDay, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_FROM_HALF_DAY)
+	toHalfDay, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_TO_HALF_DAY)
+	isHalfDay, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_IS_HALF_DAY)
+	fromHalfDay = fromHalfDay || isHalfDay
+
+	fromDate := truncateToDate(leaveFrom)
+	toDate := truncateToDate(leaveTo)
+
+	leaveDays := 0.0
+	for day := fromDate; !day.After(toDate); day = day.AddDate(0, 0, 1) {
+		if weekOffs[day.Weekday()] || holidays[day.Format(time.DateOnly)] {
+			continue
+		}
+
+		if (day.Equal(fromDate) && fromHalfDay) || (day.Equal(toDate) && toHalfDay) {
+			leaveDays += 0.5
+		} else {
+			leaveDays += 1
+		}
+	}
+
+	if leaveDays == 0 {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_NO_WORKING_DAYS,
+			ErrorMsg:    "No Working Days",
+			ErrorDetail: "Given leave period falls on week-offs or holidays"}
+		return err
+	}
+
+	leaveInfo[FLD_LEAVE_DAYS] = leaveDays
+	leaveInfo[FLD_LEAVE_HOURS] = 0.0
+	return nil
+}
+
+// validateLeaveOverlap - Verify the leave doesn't overlap other active leaves of the staff or the
+// attendance already recorded, conflicts are listed in the error. Leaves charged in whole days take
+// the whole calendar days, permissions & half-days take the period between leave_from and leave_to.
+// Attendance on the day of a permission is expected, it is not a conflict
+func (p *leaveBaseService) validateLeaveOverlap(leaveInfo utils.Map, leaveId string) error {
+
+	staffId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_STAFF_ID)
+	windowFrom, windowTo, err := getLeaveWindow(leaveInfo)
+	if err != nil {
+		return nil
+	}
+
+	// Leaves on the calendar days of the window, their windows are compared below
+	periodFrom := truncateToDate(windowFrom).Format(time.DateTime)
+	periodTo := truncateToDate(windowTo.Add(-time.Second)).Add(24*time.Hour - time.Second).Format(time.DateTime)
+
+	conflicts := []utils.Map{}
+
+	// Other leaves of the staff which are not rejected or cancelled
+	filter := fmt.Sprintf(`{"%s":"%s","%s":{"$ne":"%s"},"%s":{"$lte":"%s"},"$or":[{"%s":{"$gte":"%s"}},{"%s":{"$in":[null,""]},"%s":{"$gte":"%s"}}],"%s":{"$nin":["%s","%s"]},"%s":false}`,
+		hr_common.FLD_STAFF_ID, staffId,
+		hr_common.FLD_LEAVE_ID, leaveId,
+		hr_common.FLD_LEAVE_FROM, periodTo,
+		hr_common.FLD_LEAVE_TO, periodFrom,
+		hr_common.FLD_LEAVE_TO, hr_common.FLD_LEAVE_FROM, periodFrom,
+		FLD_LEAVE_STATUS, LEAVE_STATUS_REJECTED, LEAVE_STATUS_CANCELLED,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoLeave.List(filter, "", 0, 0)
+	if err != nil {
+		return err
+	}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		for _, otherLeave := range dataList.([]utils.Map) {
+			otherFrom, otherTo, err := getLeaveWindow(otherLeave)
+			if err == nil && !(otherFrom.Before(windowTo) && windowFrom.Before(otherTo)) {
+				continue
+			}
+			conflicts = append(conflicts, utils.Map{
+				FLD_CONFLICT_TYPE:        CONFLICT_TYPE_LEAVE,
+				hr_common.FLD_LEAVE_ID:   otherLeave[hr_common.FLD_LEAVE_ID],
+				hr_common.FLD_LEAVE_FROM: otherLeave[hr_common.FLD_LEAVE_FROM],
+				hr_common.FLD_LEAVE_TO:   otherLeave[hr_common.FLD_LEAVE_TO],
+				FLD_LEAVE_STATUS:         getLeaveStatus(otherLeave),
+			})
+		}
+	}
+
+	// Attendance clocked-in during the leave period
+	isPermission, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_IS_PERMISSION)
+	if !isPermission {
+		filter = fmt.Sprintf(`{"%s":"%s","%s.%s":{"$gte":"%s","$lt":"%s"},"%s":false}`,
+			hr_common.FLD_STAFF_ID, staffId,
+			hr_common.FLD_CLOCK_IN, hr_common.FLD_DATETIME, windowFrom.Format(time.DateTime), windowTo.Format(time.DateTime),
+			db_common.FLD_IS_DELETED)
+
+		response, err = p.daoAttendance.List(filter, "", 0, 0)
+		if err != nil {
+			return err
+		}
+		dataList, err = utils.GetMemberData(response, db_common.LIST_RESULT)
+		if err == nil {
+			for _, attendance := range dataList.([]utils.Map) {
+				conflicts = append(conflicts, utils.Map{
+					FLD_CONFLICT_TYPE:           CONFLICT_TYPE_ATTENDANCE,
+					hr_common.FLD_ATTENDANCE_ID: attendance[hr_common.FLD_ATTENDANCE_ID],
+					hr_common.FLD_CLOCK_IN:      attendance[hr_common.FLD_CLOCK_IN],
+					hr_common.FLD_CLOCK_OUT:     attendance[hr_common.FLD_CLOCK_OUT],
+				})
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		err := &ConflictError{
+			AppError: utils.AppError{
+				ErrorCode:   ERRCODE_LEAVE_OVERLAP,
+				ErrorMsg:    "Leave Overlaps",
+				ErrorDetail: fmt.Sprintf("Given leave period clashes with %d existing record(s)", len(conflicts))},
+			Conflicts: conflicts,
+		}
+		return err
+	}
+	return nil
+}
+
+// getLeaveWindow - Get the period the leave takes, the end is exclusive. Leaves charged in whole days
+// take the whole calendar days, leaves without leave_to are of the leave_from day. Permissions &
+// half-days take the period between leave_from and leave_to when it is given
+func getLeaveWindow(leaveInfo utils.Map) (time.Time, time.Time, error) {
+
+	leaveFromStr, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVE_FROM)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	leaveFrom, err := time.Parse(time.DateTime, leaveFromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	leaveTo := leaveFrom
+	leaveToStr, err := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVE_TO)
+	if err == nil && leaveToStr != "" {
+		leaveTo, err = time.Parse(time.DateTime, leaveToStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	isPartial := false
+	for _, fieldName := range []string{FLD_LEAVE_IS_PERMISSION, FLD_LEAVE_IS_HALF_DAY, FLD_LEAVE_FROM_HALF_DAY, FLD_LEAVE_TO_HALF_DAY} {
+		if flag, _ := utils.GetMemberDataBool(leaveInfo, fieldName); flag {
+			isPartial = true
+		}
+	}
+	if isPartial && leaveTo.After(leaveFrom) {
+		return leaveFrom, leaveTo, nil
+	}
+
+	return truncateToDate(leaveFrom), truncateToDate(leaveTo).AddDate(0, 0, 1), nil
+}
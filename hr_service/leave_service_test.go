@@ -0,0 +1,206 @@
+package hr_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestLeaveOverlap(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_STAFF_DATA: utils.Map{}})
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_approved",
+			hr_common.FLD_LEAVE_FROM: "2030-03-11 09:00:00", hr_common.FLD_LEAVE_TO: "2030-03-12 18:00:00", FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_rejected",
+			hr_common.FLD_LEAVE_FROM: "2030-03-20 09:00:00", hr_common.FLD_LEAVE_TO: "2030-03-20 18:00:00", FLD_LEAVE_STATUS: LEAVE_STATUS_REJECTED},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_single_day",
+			hr_common.FLD_LEAVE_FROM: "2030-03-27 09:00:00", FLD_LEAVE_STATUS: LEAVE_STATUS_SUBMITTED},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2", hr_common.FLD_LEAVE_ID: "leave_other_staff",
+			hr_common.FLD_LEAVE_FROM: "2030-03-13 09:00:00", hr_common.FLD_LEAVE_TO: "2030-03-13 18:00:00", FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "permission_1",
+			hr_common.FLD_LEAVE_FROM: "2030-03-25 10:00:00", hr_common.FLD_LEAVE_TO: "2030-03-25 11:00:00", FLD_LEAVE_IS_PERMISSION: true,
+			FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "half_day_1",
+			hr_common.FLD_LEAVE_FROM: "2030-03-28 09:00:00", hr_common.FLD_LEAVE_TO: "2030-03-28 13:00:00", FLD_LEAVE_IS_HALF_DAY: true,
+			FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED},
+	)
+	provider.Seed(MEMORY_COLLECTION_ATTENDANCES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_ATTENDANCE_ID: "attendance_1",
+			hr_common.FLD_CLOCK_IN: utils.Map{hr_common.FLD_DATETIME: "2030-03-25 09:05:00"}})
+
+	props[hr_common.FLD_STAFF_ID] = "staff_1"
+	leaveService, err := NewLeaveService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaveService.EndService()
+
+	tests := []struct {
+		name      string
+		leaveFrom string
+		leaveTo   string
+		partial   string
+		conflicts []string
+	}{
+		{"overlaps the last day", "2030-03-12 14:00:00", "2030-03-13 18:00:00", "", []string{"leave_approved"}},
+		{"without leave_to", "2030-03-11 14:00:00", "", "", []string{"leave_approved"}},
+		{"rejected leave", "2030-03-20 09:00:00", "2030-03-20 18:00:00", "", nil},
+		{"leave of other staff", "2030-03-13 09:00:00", "", "", nil},
+		{"single day leave", "2030-03-26 09:00:00", "2030-03-27 09:00:00", "", []string{"leave_single_day"}},
+		{"attendance", "2030-03-25 00:00:00", "", "", []string{"permission_1", "attendance_1"}},
+		{"overlapping permission", "2030-03-25 10:30:00", "2030-03-25 10:45:00", FLD_LEAVE_IS_PERMISSION, []string{"permission_1"}},
+		{"permission on attendance day", "2030-03-25 11:00:00", "2030-03-25 12:00:00", FLD_LEAVE_IS_PERMISSION, nil},
+		{"half-day with attendance", "2030-03-25 08:00:00", "2030-03-25 10:00:00", FLD_LEAVE_IS_HALF_DAY, []string{"attendance_1"}},
+		{"half-day after attendance", "2030-03-25 14:00:00", "2030-03-25 18:00:00", FLD_LEAVE_IS_HALF_DAY, nil},
+		{"overlapping half-day", "2030-03-28 12:00:00", "2030-03-28 14:00:00", FLD_LEAVE_IS_HALF_DAY, []string{"half_day_1"}},
+		{"other half of the day", "2030-03-28 13:00:00", "2030-03-28 18:00:00", FLD_LEAVE_IS_HALF_DAY, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indata := utils.Map{
+				hr_common.FLD_LEAVETYPE_ID: "casual",
+				hr_common.FLD_LEAVE_FROM:   test.leaveFrom,
+			}
+			if test.leaveTo != "" {
+				indata[hr_common.FLD_LEAVE_TO] = test.leaveTo
+			}
+			if test.partial != "" {
+				indata[test.partial] = true
+			}
+
+			_, err := leaveService.Create(indata)
+			if len(test.conflicts) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var conflictErr *ConflictError
+			if !errors.As(err, &conflictErr) || conflictErr.ErrorCode != ERRCODE_LEAVE_OVERLAP {
+				t.Fatalf("Expected error %s, got %v", ERRCODE_LEAVE_OVERLAP, err)
+			}
+
+			conflicts := []string{}
+			for _, conflict := range conflictErr.Conflicts {
+				conflictId, _ := utils.GetMemberDataStr(conflict, hr_common.FLD_LEAVE_ID)
+				if conflict[FLD_CONFLICT_TYPE] == CONFLICT_TYPE_ATTENDANCE {
+					conflictId, _ = utils.GetMemberDataStr(conflict, hr_common.FLD_ATTENDANCE_ID)
+				}
+				conflicts = append(conflicts, conflictId)
+			}
+			if !reflect.DeepEqual(conflicts, test.conflicts) {
+				t.Errorf("Expected conflicts %v, got %v", test.conflicts, conflicts)
+			}
+		})
+	}
+}
+
+func TestLegacyLeave(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_STAFF_DATA: utils.Map{}})
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_legacy",
+			hr_common.FLD_LEAVE_FROM: "2030-04-01 09:00:00", hr_common.FLD_LEAVE_TO: "2030-04-01 18:00:00"},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_approved",
+			hr_common.FLD_LEAVE_FROM: "2030-04-08 09:00:00", hr_common.FLD_LEAVE_TO: "2030-04-08 18:00:00", FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED},
+	)
+
+	props[hr_common.FLD_STAFF_ID] = "staff_1"
+	leaveService, err := NewLeaveService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaveService.EndService()
+
+	tests := []struct {
+		leaveId   string
+		errorCode string
+	}{
+		{"leave_legacy", ""},
+		{"leave_approved", ERRCODE_INVALID_LEAVE_STATUS},
+	}
+
+	for _, test := range tests {
+		t.Run(test.leaveId, func(t *testing.T) {
+			_, err := leaveService.Update(test.leaveId, utils.Map{hr_common.FLD_LEAVE_TO: "2030-04-02 18:00:00"})
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Legacy leave is still taken, it stays without the status
+	leaveInfo, err := leaveService.Get("leave_legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := leaveInfo[FLD_LEAVE_STATUS]; ok || leaveInfo[FLD_LEAVE_DAYS] != 2.0 {
+		t.Errorf("Expected legacy leave of 2 days, got %v", leaveInfo)
+	}
+
+	_, err = leaveService.Create(utils.Map{hr_common.FLD_LEAVETYPE_ID: "casual", hr_common.FLD_LEAVE_FROM: "2030-04-02 09:00:00"})
+	assertErrorCode(t, err, ERRCODE_LEAVE_OVERLAP)
+}
+
+func TestApproveLeaveBalance(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_LEAVE_TYPES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVETYPE_ID: "casual", FLD_LEAVE_ENTITLEMENT_DAYS: 2})
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_STAFF_DATA: utils.Map{FLD_STAFF_DATE_OF_JOIN: "2030-01-01"}})
+
+	approvers := []utils.Map{{hr_common.FLD_STAFF_ID: "manager_1", FLD_APPROVAL_STATUS: LEAVE_STATUS_SUBMITTED}}
+	for _, leave := range []struct {
+		leaveId   string
+		leaveFrom string
+		leaveTo   string
+		days      float64
+	}{
+		{"leave_1", "2030-03-04 00:00:00", "2030-03-05 00:00:00", 2},
+		{"leave_2", "2030-03-06 00:00:00", "2030-03-06 00:00:00", 1},
+	} {
+		provider.Seed(MEMORY_COLLECTION_LEAVES, utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId,
+			hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: leave.leaveId, hr_common.FLD_LEAVETYPE_ID: "casual",
+			hr_common.FLD_LEAVE_FROM: leave.leaveFrom, hr_common.FLD_LEAVE_TO: leave.leaveTo, FLD_LEAVE_DAYS: leave.days,
+			FLD_LEAVE_STATUS: LEAVE_STATUS_SUBMITTED, FLD_LEAVE_APPROVERS: approvers, FLD_LEAVE_APPROVAL_LEVEL: 1})
+	}
+
+	leaveService, err := NewLeaveService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaveService.EndService()
+
+	_, err = leaveService.Approve("leave_1", "manager_1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Yearly entitlement is consumed by leave_1
+	_, err = leaveService.Approve("leave_2", "manager_1", "")
+	assertErrorCode(t, err, "S30102")
+
+	leaveInfo, err := leaveService.Get("leave_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getLeaveStatus(leaveInfo) != LEAVE_STATUS_SUBMITTED {
+		t.Errorf("Expected leave_2 pending approval, got %v", leaveInfo[FLD_LEAVE_STATUS])
+	}
+}
@@ -2,17 +2,25 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// LeaveType Entitlement Policy Fields
+	FLD_LEAVE_ENTITLEMENT_DAYS = "entitlement_days"
+	FLD_LEAVE_ACCRUAL_TYPE     = "accrual_type"
+	FLD_LEAVE_IS_PRO_RATA      = "is_pro_rata"
+	FLD_LEAVE_CARRY_FWD_CAP    = "carry_forward_cap"
+
+	LEAVE_ACCRUAL_YEARLY  = "yearly"
+	LEAVE_ACCRUAL_MONTHLY = "monthly"
+)
+
 // LeaveTypeService - LeaveTypes Service structure
 type LeaveTypeService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -32,9 +40,10 @@ type LeaveTypeService interface {
 }
 
 type leaveTypeBaseService struct {
-	db_utils.DatabaseService
-	dbRegion     db_utils.DatabaseService
+	DaoProvider
 	daoLeaveType hr_repository.LeaveTypeDao
+	daoLeave     hr_repository.LeaveDao
+	daoStaff     hr_repository.StaffDao
 	daoBusiness  platform_repository.BusinessDao
 	child        LeaveTypeService
 	businessID   string
@@ -56,16 +65,9 @@ func NewLeaveTypeService(props utils.Map) (LeaveTypeService, error) {
 	}
 
 	p := leaveTypeBaseService{}
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -89,14 +91,15 @@ func NewLeaveTypeService(props utils.Map) (LeaveTypeService, error) {
 
 func (p *leaveTypeBaseService) EndService() {
 	log.Printf("EndLeaveTypeMongoService ")
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 func (p *leaveTypeBaseService) initializeService() {
 	log.Printf("LeaveTypeMongoService:: GetBusinessDao ")
-	p.daoLeaveType = hr_repository.NewLeaveTypeDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoLeaveType = p.NewLeaveTypeDao(p.businessID)
+	p.daoLeave = p.NewLeaveDao(p.businessID, "")
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoBusiness = p.NewBusinessDao()
 }
 
 // List - List All records
@@ -143,21 +146,21 @@ func (p *leaveTypeBaseService) Find(filter string) (utils.Map, error) {
 func (p *leaveTypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var deptId string
 
-	dataval, dataok := indata[hr_common.FLD_LEAVETYPE_ID]
-	if dataok {
-		deptId = strings.ToLower(dataval.(string))
-	} else {
-		deptId = utils.GenerateUniqueId("ltype")
-		log.Println("Unique LeaveType ID", deptId)
+	// Validate the payload fields
+	err := normalizePayload[LeaveType](indata, false)
+	if err != nil {
+		return indata, err
 	}
 
-	indata[hr_common.FLD_LEAVETYPE_ID] = deptId
+	deptId, err := getPayloadId(indata, hr_common.FLD_LEAVETYPE_ID, ID_PREFIX_LEAVE_TYPE)
+	if err != nil {
+		return indata, err
+	}
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
-	log.Println("Provided LeaveType ID:", dataval)
+	log.Println("Provided LeaveType ID:", deptId)
 
-	_, err := p.daoLeaveType.Get(deptId)
+	_, err = p.daoLeaveType.Get(deptId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing LeaveType ID !", ErrorDetail: "Given LeaveType ID already exist"}
 		return indata, err
@@ -176,6 +179,12 @@ func (p *leaveTypeBaseService) Update(LeaveType_id string, indata utils.Map) (ut
 
 	log.Println("LeaveTypeService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[LeaveType](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoLeaveType.Get(LeaveType_id)
 	if err != nil {
 		return data, err
@@ -200,6 +209,12 @@ func (p *leaveTypeBaseService) Delete(LeaveType_id string, delete_permanent bool
 		return err
 	}
 
+	// Leaves & leave ledger entries still referring the leave type can't be deleted
+	err = checkReferences(p.getReferences(), "Leave Type", LeaveType_id)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoLeaveType.Delete(LeaveType_id)
 		if err != nil {
@@ -219,6 +234,24 @@ func (p *leaveTypeBaseService) Delete(LeaveType_id string, delete_permanent bool
 	return nil
 }
 
+// getReferences - Records referring the leave type
+func (p *leaveTypeBaseService) getReferences() []recordReference {
+	return []recordReference{
+		{
+			referenceType: REFERENCE_TYPE_LEAVE,
+			idField:       hr_common.FLD_LEAVE_ID,
+			fields:        []string{hr_common.FLD_LEAVETYPE_ID},
+			dao:           p.daoLeave,
+		},
+		{
+			referenceType: REFERENCE_TYPE_STAFF,
+			idField:       hr_common.FLD_STAFF_ID,
+			fields:        []string{FLD_LEAVE_LEDGER + "." + hr_common.FLD_LEAVETYPE_ID},
+			dao:           p.daoStaff,
+		},
+	}
+}
+
 func (p *leaveTypeBaseService) errorReturn(err error) (LeaveTypeService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -0,0 +1,62 @@
+package hr_service
+
+import (
+	"testing"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestLeaveTypeReferences(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			FLD_LEAVE_LEDGER: []interface{}{utils.Map{hr_common.FLD_LEAVETYPE_ID: "earned", FLD_LEDGER_DAYS: 5}}})
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_1",
+			hr_common.FLD_LEAVETYPE_ID: "casual"})
+
+	leaveTypeService, err := NewLeaveTypeService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaveTypeService.EndService()
+
+	for _, leaveTypeId := range []string{"casual", "earned", "unused"} {
+		_, err := leaveTypeService.Create(utils.Map{hr_common.FLD_LEAVETYPE_ID: leaveTypeId})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		leaveTypeId string
+		reference   string
+	}{
+		{"casual", REFERENCE_TYPE_LEAVE + " leave_1"},
+		{"earned", REFERENCE_TYPE_STAFF + " staff_1"},
+		{"unused", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.leaveTypeId, func(t *testing.T) {
+			err := leaveTypeService.Delete(test.leaveTypeId, false)
+			if test.reference == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			conflictErr, ok := err.(*ConflictError)
+			if !ok || len(conflictErr.Conflicts) != 1 {
+				t.Fatalf("Expected leave type in use, got %v", err)
+			}
+			conflict := conflictErr.Conflicts[0]
+			if reference := conflict[FLD_REFERENCE_TYPE].(string) + " " + conflict[FLD_REFERENCE_ID].(string); reference != test.reference {
+				t.Errorf("Expected reference %s, got %s", test.reference, reference)
+			}
+		})
+	}
+}
@@ -1,18 +1,48 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Overtime Hours-Factor Fields
+	FLD_OT_DAY_TYPE     = "day_type"
+	FLD_OT_HOURS_FACTOR = "hours_factor"
+
+	// Overtime Day Types
+	OT_DAY_TYPE_WEEKDAY = "weekday"
+	OT_DAY_TYPE_WEEKEND = "weekend"
+	OT_DAY_TYPE_HOLIDAY = "holiday"
+	OT_DAY_TYPE_NIGHT   = "night"
+
+	DEFAULT_OT_HOURS_FACTOR = 1.0
+
+	// Overtime Entry Fields, computed from completed attendance
+	FLD_OT_DATE           = "date"
+	FLD_OT_HOURS          = "overtime_hours"
+	FLD_OT_DAILY_HOURS    = "daily_overtime_hours"
+	FLD_OT_WEEKLY_HOURS   = "weekly_overtime_hours"
+	FLD_OT_PAYABLE_HOURS  = "overtime_payable_hours"
+	FLD_OT_ATTENDANCE_IDS = "attendance_ids"
+
+	// Overtime Thresholds in hours, 0 disables the threshold
+	FLD_OT_DAILY_THRESHOLD  = "overtime_daily_threshold"
+	FLD_OT_WEEKLY_THRESHOLD = "overtime_weekly_threshold"
+
+	// Night window, a day is night type when most of the worked hours fall within
+	OT_NIGHT_START_HOUR = 22
+	OT_NIGHT_END_HOUR   = 6
+)
+
 // OvertimeService - Accounts Service structure
 type OvertimeService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -22,6 +52,8 @@ type OvertimeService interface {
 	Update(overtimeId string, indata utils.Map) (utils.Map, error)
 	Delete(overtimeId string, delete_permanent bool) error
 
+	ComputeOvertime(staffId string, fromDate string, toDate string) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -31,13 +63,18 @@ type OvertimeService interface {
 
 // OvertimeeBaseService - Accounts Service structure
 type OvertimeBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoHrsFactor        hr_repository.OvertimeDao
+	daoStaff            hr_repository.StaffDao
+	daoAttendance       hr_repository.AttendanceDao
+	daoHoliday          hr_repository.HolidayDao
+	daoShiftProfile     hr_repository.ShiftProfileDao
 	daoPlatformBusiness platform_repository.BusinessDao
 
-	child      OvertimeService
-	businessId string
+	child           OvertimeService
+	businessId      string
+	dailyThreshold  float64
+	weeklyThreshold float64
 }
 
 func init() {
@@ -57,25 +94,26 @@ func NewOvertimeService(props utils.Map) (OvertimeService, error) {
 
 	p := OvertimeBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
 	// Assign the BusinessId & StaffId
 	p.businessId = businessId
 
+	// Overtime thresholds, scheduled hours of the shift applies when not given
+	p.dailyThreshold, _ = getMemberDataFloat(props, FLD_OT_DAILY_THRESHOLD)
+	p.weeklyThreshold, _ = getMemberDataFloat(props, FLD_OT_WEEKLY_THRESHOLD)
+
 	// Instantiate other services
-	p.daoHrsFactor = hr_repository.NewOvertimeDao(p.dbRegion.GetClient(), p.businessId)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoHrsFactor = p.NewOvertimeDao(p.businessId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoAttendance = p.NewAttendanceDao(p.businessId, "")
+	p.daoHoliday = p.NewHolidayDao(p.businessId)
+	p.daoShiftProfile = p.NewShiftProfileDao(p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -92,8 +130,7 @@ func NewOvertimeService(props utils.Map) (OvertimeService, error) {
 }
 
 func (p *OvertimeBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -132,20 +169,20 @@ func (p *OvertimeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var overtimeId string
+	// Validate the payload fields
+	err := normalizePayload[Overtime](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_OVERTIME_ID]
-	if dataok {
-		overtimeId = strings.ToLower(dataval.(string))
-	} else {
-		overtimeId = utils.GenerateUniqueId("ot")
-		log.Println("Unique OT ID", overtimeId)
+	overtimeId, err := getPayloadId(indata, hr_common.FLD_OVERTIME_ID, ID_PREFIX_OVERTIME)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_OVERTIME_ID] = overtimeId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	log.Println("Provided OT ID:", overtimeId)
 
-	_, err := p.daoHrsFactor.Get(overtimeId)
+	_, err = p.daoHrsFactor.Get(overtimeId)
 	if err == nil {
 		err := &utils.AppError{
 			ErrorCode:   "S30102",
@@ -167,6 +204,12 @@ func (p *OvertimeBaseService) Update(overtimeId string, indata utils.Map) (utils
 
 	log.Println("OvertimeService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Overtime](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoHrsFactor.Get(overtimeId)
 	if err != nil {
 		return data, err
@@ -206,8 +249,327 @@ func (p *OvertimeBaseService) Delete(overtimeId string, delete_permanent bool) e
 	return nil
 }
 
+// ************************************************************************
+// ComputeOvertime - Compute the overtime entries of the staff for the given
+// period (yyyy-mm-dd) from the completed attendance, the scheduled hours of
+// the shift and the hours-factor of the day type. The overtime hours are
+// also saved in the attendance records of each day
+//
+// ************************************************************************
+func (p *OvertimeBaseService) ComputeOvertime(staffId string, fromDate string, toDate string) (utils.Map, error) {
+
+	log.Println("OvertimeService::ComputeOvertime - Begin", staffId, fromDate, toDate)
+
+	from, err := time.Parse(time.DateOnly, fromDate)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid from date", ErrorDetail: "from date should be in yyyy-mm-dd format"}
+		return nil, err
+	}
+
+	to, err := time.Parse(time.DateOnly, toDate)
+	if err != nil || to.Before(from) {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid to date", ErrorDetail: "to date should be in yyyy-mm-dd format and not before from date"}
+		return nil, err
+	}
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Weekly threshold needs the hours from the start of the week
+	weekStart := getWeekStart(from)
+
+	// Punches after midnight of the period end are attributed to the last day's shift
+	sessions, err := getCompletedAttendance(p.daoAttendance, staffId, weekStart, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err := getHolidayDates(p.daoHoliday, weekStart, to, staffInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := getOvertimeFactors(p.daoHrsFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	weekOffs := getStaffWeekOffs(p.daoShiftProfile, staffInfo)
+
+	entries := []utils.Map{}
+	totalHours, totalPayable := 0.0, 0.0
+	for _, entry := range computeOvertimeEntries(sessions, holidays, weekOffs, factors, p.dailyThreshold, p.weeklyThreshold) {
+		entryDate, _ := utils.GetMemberDataStr(entry, FLD_OT_DATE)
+		if entryDate < fromDate || entryDate > toDate {
+			continue
+		}
+
+		// Days without overtime are saved too, to reset the earlier computation
+		err = p.saveOvertime(entry)
+		if err != nil {
+			return nil, err
+		}
+		if entry[FLD_OT_HOURS].(float64) <= 0 {
+			continue
+		}
+
+		entry[hr_common.FLD_STAFF_ID] = staffId
+		entries = append(entries, entry)
+		totalHours += entry[FLD_OT_HOURS].(float64)
+		totalPayable += entry[FLD_OT_PAYABLE_HOURS].(float64)
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staffId,
+		FLD_OT_HOURS:              roundTo2Decimals(totalHours),
+		FLD_OT_PAYABLE_HOURS:      roundTo2Decimals(totalPayable),
+		db_common.LIST_RESULTSIZE: len(entries),
+		db_common.LIST_RESULT:     entries,
+	}
+
+	log.Println("OvertimeService::ComputeOvertime - End", len(entries))
+	return response, nil
+}
+
+// saveOvertime - Save the overtime of the day in its last attendance session and reset the others
+func (p *OvertimeBaseService) saveOvertime(entry utils.Map) error {
+
+	attendanceIds := entry[FLD_OT_ATTENDANCE_IDS].([]string)
+	for idx, attendanceId := range attendanceIds {
+		indata := utils.Map{
+			FLD_OT_DAY_TYPE:      entry[FLD_OT_DAY_TYPE],
+			FLD_OT_HOURS:         0.0,
+			FLD_OT_PAYABLE_HOURS: 0.0,
+		}
+		if idx == len(attendanceIds)-1 {
+			indata[FLD_OT_HOURS] = entry[FLD_OT_HOURS]
+			indata[FLD_OT_PAYABLE_HOURS] = entry[FLD_OT_PAYABLE_HOURS]
+		}
+
+		_, err := p.daoAttendance.Update(attendanceId, indata)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *OvertimeBaseService) errorReturn(err error) (OvertimeService, error) {
 	// Close the Database Connection
 	p.EndService()
 	return nil, err
 }
+
+// getOvertimeFactors - Get the hours-factor configured for each day type
+func getOvertimeFactors(daoHrsFactor hr_repository.OvertimeDao) (map[string]float64, error) {
+
+	filter := fmt.Sprintf(`{"%s":false}`, db_common.FLD_IS_DELETED)
+	response, err := daoHrsFactor.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	factors := map[string]float64{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		for _, factorInfo := range dataList.([]utils.Map) {
+			dayType, err := utils.GetMemberDataStr(factorInfo, FLD_OT_DAY_TYPE)
+			if err != nil {
+				continue
+			}
+			factor, err := getMemberDataFloat(factorInfo, FLD_OT_HOURS_FACTOR)
+			if err == nil && factor > 0 {
+				factors[dayType] = factor
+			}
+		}
+	}
+	return factors, nil
+}
+
+// getOvertimeFactor - Get the hours-factor of the day type
+func getOvertimeFactor(factors map[string]float64, dayType string) float64 {
+	factor, ok := factors[dayType]
+	if !ok {
+		return DEFAULT_OT_HOURS_FACTOR
+	}
+	return factor
+}
+
+// getCompletedAttendance - Get the clocked-out attendance sessions of the staff sorted by clock-in
+func getCompletedAttendance(daoAttendance hr_repository.AttendanceDao, staffId string, fromDate time.Time, toDate time.Time) ([]utils.Map, error) {
+
+	filter := fmt.Sprintf(`{"%s":"%s","%s.%s":{"$gte":"%s","$lte":"%s"},"%s":{"$exists":true},"%s":false}`,
+		hr_common.FLD_STAFF_ID, staffId,
+		hr_common.FLD_CLOCK_IN, hr_common.FLD_DATETIME,
+		fromDate.Format(time.DateTime), toDate.Add(24*time.Hour-time.Second).Format(time.DateTime),
+		hr_common.FLD_CLOCK_OUT,
+		db_common.FLD_IS_DELETED)
+
+	response, err := daoAttendance.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []utils.Map{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		sessions = dataList.([]utils.Map)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return getAttendanceDateTime(sessions[i]) < getAttendanceDateTime(sessions[j])
+	})
+	return sessions, nil
+}
+
+// getAttendanceDateTime - Get the clock-in date_time string of the attendance
+func getAttendanceDateTime(attendance utils.Map) string {
+	clockIn, err := getMemberDataMap(attendance, hr_common.FLD_CLOCK_IN)
+	if err != nil {
+		return ""
+	}
+	dateTime, _ := utils.GetMemberDataStr(clockIn, hr_common.FLD_DATETIME)
+	return dateTime
+}
+
+// getAttendanceDate - Get the date (yyyy-mm-dd) the attendance is counted for, which is the
+// shift date for the cross-midnight shifts
+func getAttendanceDate(attendance utils.Map) string {
+	shiftDate, err := utils.GetMemberDataStr(attendance, FLD_SHIFT_DATE)
+	if err == nil && shiftDate != "" {
+		return shiftDate
+	}
+	return utils.Left(getAttendanceDateTime(attendance), len(time.DateOnly))
+}
+
+// getWeekStart - Get the Monday of the week of the given date
+func getWeekStart(date time.Time) time.Time {
+	return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+}
+
+// getNightDuration - Get the duration of the session falling within the night window
+func getNightDuration(clockInTime time.Time, clockOutTime time.Time) time.Duration {
+
+	nightDuration := time.Duration(0)
+	for day := truncateToDate(clockInTime).AddDate(0, 0, -1); day.Before(clockOutTime); day = day.AddDate(0, 0, 1) {
+		nightStart := day.Add(OT_NIGHT_START_HOUR * time.Hour)
+		nightEnd := day.AddDate(0, 0, 1).Add(OT_NIGHT_END_HOUR * time.Hour)
+		nightDuration += getOverlapDuration(clockInTime, clockOutTime, nightStart, nightEnd)
+	}
+	return nightDuration
+}
+
+// computeOvertimeEntries - Compute the overtime entry of each worked day from the attendance sessions of
+// a staff sorted by clock-in. Week-off & holiday hours are fully overtime, on other days the
+// hours beyond the daily threshold (or the scheduled hours) are overtime, and the regular hours
+// beyond the weekly threshold of a Monday-Sunday week are overtime too
+func computeOvertimeEntries(sessions []utils.Map, holidays map[string]bool, weekOffs map[time.Weekday]bool,
+	factors map[string]float64, dailyThreshold float64, weeklyThreshold float64) []utils.Map {
+
+	type dayHours struct {
+		netHours       float64
+		scheduledHours float64
+		nightDuration  time.Duration
+		workedDuration time.Duration
+		attendanceIds  []string
+	}
+
+	dates := []string{}
+	days := map[string]*dayHours{}
+	for _, session := range sessions {
+		date := getAttendanceDate(session)
+		if date == "" {
+			continue
+		}
+
+		day, ok := days[date]
+		if !ok {
+			day = &dayHours{}
+			days[date] = day
+			dates = append(dates, date)
+		}
+
+		netHours, _ := getMemberDataFloat(session, FLD_NET_HOURS)
+		scheduledHours, _ := getMemberDataFloat(session, FLD_SCHEDULED_HOURS)
+		day.netHours += netHours
+		if scheduledHours > day.scheduledHours {
+			day.scheduledHours = scheduledHours
+		}
+
+		clockIn, errIn := time.Parse(time.DateTime, getAttendanceDateTime(session))
+		clockOutData, errOut := getMemberDataMap(session, hr_common.FLD_CLOCK_OUT)
+		if errIn == nil && errOut == nil {
+			clockOutStr, _ := utils.GetMemberDataStr(clockOutData, hr_common.FLD_DATETIME)
+			clockOut, err := time.Parse(time.DateTime, clockOutStr)
+			if err == nil && clockOut.After(clockIn) {
+				day.workedDuration += clockOut.Sub(clockIn)
+				day.nightDuration += getNightDuration(clockIn, clockOut)
+			}
+		}
+
+		attendanceId, _ := utils.GetMemberDataStr(session, hr_common.FLD_ATTENDANCE_ID)
+		day.attendanceIds = append(day.attendanceIds, attendanceId)
+	}
+	sort.Strings(dates)
+
+	entries := []utils.Map{}
+	weekStart, weekRegular := "", 0.0
+	for _, date := range dates {
+		day := days[date]
+		dayDate, _ := time.Parse(time.DateOnly, date)
+
+		// Regular hours are accumulated per week for the weekly threshold
+		if curWeek := getWeekStart(dayDate).Format(time.DateOnly); curWeek != weekStart {
+			weekStart, weekRegular = curWeek, 0
+		}
+
+		dayType := OT_DAY_TYPE_WEEKDAY
+		if holidays[date] {
+			dayType = OT_DAY_TYPE_HOLIDAY
+		} else if weekOffs[dayDate.Weekday()] {
+			dayType = OT_DAY_TYPE_WEEKEND
+		} else if day.workedDuration > 0 && day.nightDuration*2 > day.workedDuration {
+			dayType = OT_DAY_TYPE_NIGHT
+		}
+
+		dailyHours, weeklyHours := 0.0, 0.0
+		if dayType == OT_DAY_TYPE_HOLIDAY || dayType == OT_DAY_TYPE_WEEKEND {
+			dailyHours = day.netHours
+		} else {
+			threshold := dailyThreshold
+			if threshold <= 0 {
+				threshold = day.scheduledHours
+			}
+			if threshold > 0 && day.netHours > threshold {
+				dailyHours = day.netHours - threshold
+			}
+
+			regularHours := day.netHours - dailyHours
+			if weeklyThreshold > 0 && weekRegular+regularHours > weeklyThreshold {
+				weeklyHours = weekRegular + regularHours - weeklyThreshold
+				if weeklyHours > regularHours {
+					weeklyHours = regularHours
+				}
+			}
+			weekRegular += regularHours
+		}
+
+		otHours := dailyHours + weeklyHours
+		factor := getOvertimeFactor(factors, dayType)
+		entries = append(entries, utils.Map{
+			FLD_OT_DATE:           date,
+			FLD_OT_DAY_TYPE:       dayType,
+			FLD_NET_HOURS:         roundTo2Decimals(day.netHours),
+			FLD_SCHEDULED_HOURS:   roundTo2Decimals(day.scheduledHours),
+			FLD_OT_DAILY_HOURS:    roundTo2Decimals(dailyHours),
+			FLD_OT_WEEKLY_HOURS:   roundTo2Decimals(weeklyHours),
+			FLD_OT_HOURS:          roundTo2Decimals(otHours),
+			FLD_OT_HOURS_FACTOR:   factor,
+			FLD_OT_PAYABLE_HOURS:  roundTo2Decimals(otHours * factor),
+			FLD_OT_ATTENDANCE_IDS: day.attendanceIds,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,118 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestComputeOvertimeEntries(t *testing.T) {
+
+	session := func(attendanceId string, clockIn string, clockOut string, netHours float64, scheduledHours float64) utils.Map {
+		return utils.Map{
+			hr_common.FLD_ATTENDANCE_ID: attendanceId,
+			hr_common.FLD_CLOCK_IN:      utils.Map{hr_common.FLD_DATETIME: clockIn},
+			hr_common.FLD_CLOCK_OUT:     utils.Map{hr_common.FLD_DATETIME: clockOut},
+			FLD_NET_HOURS:               netHours,
+			FLD_SCHEDULED_HOURS:         scheduledHours,
+		}
+	}
+	// Night session of the 2030-01-08 shift clocked in after midnight
+	afterMidnight := utils.MergeMap(session("night_2", "2030-01-09 00:30:00", "2030-01-09 09:30:00", 9, 8),
+		utils.Map{FLD_SHIFT_DATE: "2030-01-08"}, false)
+
+	holidays := map[string]bool{"2030-01-01": true}
+	weekOffs := map[time.Weekday]bool{time.Sunday: true}
+	factors := map[string]float64{OT_DAY_TYPE_WEEKDAY: 1.5, OT_DAY_TYPE_HOLIDAY: 2, OT_DAY_TYPE_NIGHT: 1.75}
+
+	type entry struct {
+		date        string
+		dayType     string
+		dailyHours  float64
+		weeklyHours float64
+		payable     float64
+		ids         []string
+	}
+
+	tests := []struct {
+		name            string
+		sessions        []utils.Map
+		dailyThreshold  float64
+		weeklyThreshold float64
+		expected        []entry
+	}{
+		{"within daily threshold",
+			[]utils.Map{session("day_1", "2030-01-07 09:00:00", "2030-01-07 17:00:00", 8, 8)}, 8, 0,
+			[]entry{{"2030-01-07", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"day_1"}}}},
+		{"beyond daily threshold",
+			[]utils.Map{session("day_1", "2030-01-07 09:00:00", "2030-01-07 19:00:00", 10, 8)}, 8, 0,
+			[]entry{{"2030-01-07", OT_DAY_TYPE_WEEKDAY, 2, 0, 3, []string{"day_1"}}}},
+		{"scheduled hours as daily threshold",
+			[]utils.Map{session("day_1", "2030-01-07 09:00:00", "2030-01-07 17:00:00", 8, 6)}, 0, 0,
+			[]entry{{"2030-01-07", OT_DAY_TYPE_WEEKDAY, 2, 0, 3, []string{"day_1"}}}},
+		{"split sessions of the day",
+			[]utils.Map{
+				session("day_1", "2030-01-07 08:00:00", "2030-01-07 13:00:00", 5, 8),
+				session("day_2", "2030-01-07 14:00:00", "2030-01-07 19:00:00", 5, 8)}, 8, 0,
+			[]entry{{"2030-01-07", OT_DAY_TYPE_WEEKDAY, 2, 0, 3, []string{"day_1", "day_2"}}}},
+		{"holiday hours are overtime",
+			[]utils.Map{session("day_1", "2030-01-01 09:00:00", "2030-01-01 13:00:00", 4, 8)}, 8, 0,
+			[]entry{{"2030-01-01", OT_DAY_TYPE_HOLIDAY, 4, 0, 8, []string{"day_1"}}}},
+		{"week-off hours are overtime with default factor",
+			[]utils.Map{session("day_1", "2030-01-06 09:00:00", "2030-01-06 12:00:00", 3, 8)}, 8, 0,
+			[]entry{{"2030-01-06", OT_DAY_TYPE_WEEKEND, 3, 0, 3, []string{"day_1"}}}},
+		{"night shift",
+			[]utils.Map{session("night_1", "2030-01-07 22:00:00", "2030-01-08 07:00:00", 9, 8)}, 8, 0,
+			[]entry{{"2030-01-07", OT_DAY_TYPE_NIGHT, 1, 0, 1.75, []string{"night_1"}}}},
+		{"clock-in after midnight counted for the shift date",
+			[]utils.Map{afterMidnight}, 8, 0,
+			[]entry{{"2030-01-08", OT_DAY_TYPE_NIGHT, 1, 0, 1.75, []string{"night_2"}}}},
+		{"weekly threshold",
+			[]utils.Map{
+				session("mon", "2030-01-07 09:00:00", "2030-01-07 19:00:00", 10, 8),
+				session("tue", "2030-01-08 09:00:00", "2030-01-08 17:00:00", 8, 8),
+				session("wed", "2030-01-09 09:00:00", "2030-01-09 17:00:00", 8, 8),
+				session("thu", "2030-01-10 09:00:00", "2030-01-10 17:00:00", 8, 8),
+				session("fri", "2030-01-11 09:00:00", "2030-01-11 17:00:00", 8, 8)}, 8, 36,
+			[]entry{
+				{"2030-01-07", OT_DAY_TYPE_WEEKDAY, 2, 0, 3, []string{"mon"}},
+				{"2030-01-08", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"tue"}},
+				{"2030-01-09", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"wed"}},
+				{"2030-01-10", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"thu"}},
+				{"2030-01-11", OT_DAY_TYPE_WEEKDAY, 0, 4, 6, []string{"fri"}}}},
+		{"weekly threshold resets on monday",
+			[]utils.Map{
+				session("sat", "2030-01-12 09:00:00", "2030-01-12 17:00:00", 8, 8),
+				session("mon", "2030-01-14 09:00:00", "2030-01-14 17:00:00", 8, 8)}, 0, 8,
+			[]entry{
+				{"2030-01-12", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"sat"}},
+				{"2030-01-14", OT_DAY_TYPE_WEEKDAY, 0, 0, 0, []string{"mon"}}}},
+		{"session without clock-in skipped",
+			[]utils.Map{{hr_common.FLD_ATTENDANCE_ID: "broken", FLD_NET_HOURS: 8.0}}, 8, 0,
+			[]entry{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := computeOvertimeEntries(test.sessions, holidays, weekOffs, factors, test.dailyThreshold, test.weeklyThreshold)
+
+			results := []entry{}
+			for _, otEntry := range entries {
+				results = append(results, entry{
+					otEntry[FLD_OT_DATE].(string),
+					otEntry[FLD_OT_DAY_TYPE].(string),
+					otEntry[FLD_OT_DAILY_HOURS].(float64),
+					otEntry[FLD_OT_WEEKLY_HOURS].(float64),
+					otEntry[FLD_OT_PAYABLE_HOURS].(float64),
+					otEntry[FLD_OT_ATTENDANCE_IDS].([]string),
+				})
+			}
+			if !reflect.DeepEqual(results, test.expected) {
+				t.Errorf("Expected entries %v, got %v", test.expected, results)
+			}
+		})
+	}
+}
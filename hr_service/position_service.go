@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type PositionService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(position_id string, indata utils.Map) (utils.Map, error)
 	Delete(position_id string, delete_permanent bool) error
+	DeleteAndReassign(position_id string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +29,9 @@ type PositionService interface {
 
 // positionBaseService - Accounts Service structure
 type positionBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoPosition         hr_repository.PositionDao
+	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               PositionService
 	businessID          string
@@ -56,25 +54,19 @@ func NewPositionService(props utils.Map) (PositionService, error) {
 
 	p := positionBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoPosition = hr_repository.NewPositionDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoPosition = p.NewPositionDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -91,8 +83,7 @@ func NewPositionService(props utils.Map) (PositionService, error) {
 }
 
 func (p *positionBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -130,20 +121,20 @@ func (p *positionBaseService) Find(filter string) (utils.Map, error) {
 func (p *positionBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var posId string
 
-	dataval, dataok := indata[hr_common.FLD_POSITION_ID]
-	if dataok {
-		posId = strings.ToLower(dataval.(string))
-	} else {
-		posId = utils.GenerateUniqueId("posi")
-		log.Println("Unique Account ID", posId)
+	// Validate the payload fields
+	err := normalizePayload[Position](indata, false)
+	if err != nil {
+		return indata, err
+	}
+	posId, err := getPayloadId(indata, hr_common.FLD_POSITION_ID, ID_PREFIX_POSITION)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_POSITION_ID] = posId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Account ID:", posId)
 
-	_, err := p.daoPosition.Get(posId)
+	_, err = p.daoPosition.Get(posId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
@@ -162,6 +153,12 @@ func (p *positionBaseService) Update(position_id string, indata utils.Map) (util
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Position](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoPosition.Get(position_id)
 	if err != nil {
 		return data, err
@@ -187,6 +184,12 @@ func (p *positionBaseService) Delete(position_id string, delete_permanent bool)
 		return err
 	}
 
+	// Records still referring the position can't be deleted
+	err = checkReferences(p.getReferences(), "Position", position_id)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoPosition.Delete(position_id)
 		if err != nil {
@@ -206,6 +209,29 @@ func (p *positionBaseService) Delete(position_id string, delete_permanent bool)
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the position to another position
+// and delete the position
+//
+// ************************************************************************
+func (p *positionBaseService) DeleteAndReassign(position_id string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("PositionService::DeleteAndReassign - Begin", position_id, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Position", p.daoPosition, p.getReferences(), position_id, reassign_id, func() error {
+		return p.Delete(position_id, delete_permanent)
+	})
+	log.Println("PositionService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the position
+func (p *positionBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_POSITION_ID),
+	}
+}
+
 func (p *positionBaseService) errorReturn(err error) (PositionService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type PositionTypeService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(positionTypeId string, indata utils.Map) (utils.Map, error)
 	Delete(positionTypeId string, delete_permanent bool) error
+	DeleteAndReassign(positionTypeId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +29,10 @@ type PositionTypeService interface {
 
 // positionTypeBaseService - Accounts Service structure
 type positionTypeBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoPositionType     hr_repository.PositionTypeDao
+	daoStaff            hr_repository.StaffDao
+	daoPosition         hr_repository.PositionDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               PositionTypeService
 	businessID          string
@@ -56,25 +55,20 @@ func NewPositionTypeService(props utils.Map) (PositionTypeService, error) {
 
 	p := positionTypeBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoPositionType = hr_repository.NewPositionTypeDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoPositionType = p.NewPositionTypeDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPosition = p.NewPositionDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -91,8 +85,7 @@ func NewPositionTypeService(props utils.Map) (PositionTypeService, error) {
 }
 
 func (p *positionTypeBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -130,20 +123,20 @@ func (p *positionTypeBaseService) Find(filter string) (utils.Map, error) {
 func (p *positionTypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
-	var posTypeId string
 
-	dataval, dataok := indata[hr_common.FLD_POSITION_TYPE_ID]
-	if dataok {
-		posTypeId = strings.ToLower(dataval.(string))
-	} else {
-		posTypeId = utils.GenerateUniqueId("posityp")
-		log.Println("Unique Account ID", posTypeId)
+	// Validate the payload fields
+	err := normalizePayload[PositionType](indata, false)
+	if err != nil {
+		return indata, err
+	}
+	posTypeId, err := getPayloadId(indata, hr_common.FLD_POSITION_TYPE_ID, ID_PREFIX_POSITION_TYPE)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_POSITION_TYPE_ID] = posTypeId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Account ID:", posTypeId)
 
-	_, err := p.daoPositionType.Get(posTypeId)
+	_, err = p.daoPositionType.Get(posTypeId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
@@ -162,6 +155,12 @@ func (p *positionTypeBaseService) Update(positionTypeId string, indata utils.Map
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[PositionType](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoPositionType.Get(positionTypeId)
 	if err != nil {
 		return data, err
@@ -187,6 +186,12 @@ func (p *positionTypeBaseService) Delete(positionTypeId string, delete_permanent
 		return err
 	}
 
+	// Records still referring the position type can't be deleted
+	err = checkReferences(p.getReferences(), "Position Type", positionTypeId)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoPositionType.Delete(positionTypeId)
 		if err != nil {
@@ -206,6 +211,35 @@ func (p *positionTypeBaseService) Delete(positionTypeId string, delete_permanent
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the position type to another position type
+// and delete the position type
+//
+// ************************************************************************
+func (p *positionTypeBaseService) DeleteAndReassign(positionTypeId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("PositionTypeService::DeleteAndReassign - Begin", positionTypeId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Position Type", p.daoPositionType, p.getReferences(), positionTypeId, reassign_id, func() error {
+		return p.Delete(positionTypeId, delete_permanent)
+	})
+	log.Println("PositionTypeService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the position type
+func (p *positionTypeBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_POSITION_TYPE_ID),
+		{
+			referenceType: REFERENCE_TYPE_POSITION,
+			idField:       hr_common.FLD_POSITION_ID,
+			fields:        []string{hr_common.FLD_POSITION_TYPE_ID},
+			dao:           p.daoPosition,
+		},
+	}
+}
+
 func (p *positionTypeBaseService) errorReturn(err error) (PositionTypeService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -31,8 +28,7 @@ type ProjectService interface {
 
 // projectBaseService - Projects Service structure
 type projectBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoProject          hr_repository.ProjectDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               ProjectService
@@ -56,25 +52,18 @@ func NewProjectService(props utils.Map) (ProjectService, error) {
 
 	p := projectBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoProject = hr_repository.NewProjectDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoProject = p.NewProjectDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -91,8 +80,7 @@ func NewProjectService(props utils.Map) (ProjectService, error) {
 }
 
 func (p *projectBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -131,20 +119,20 @@ func (p *projectBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var projectId string
+	// Validate the payload fields
+	err := normalizePayload[Project](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_PROJECT_ID]
-	if dataok {
-		projectId = strings.ToLower(dataval.(string))
-	} else {
-		projectId = utils.GenerateUniqueId("projt")
-		log.Println("Unique Project ID", projectId)
+	projectId, err := getPayloadId(indata, hr_common.FLD_PROJECT_ID, ID_PREFIX_PROJECT)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_PROJECT_ID] = projectId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Project ID:", projectId)
 
-	_, err := p.daoProject.Get(projectId)
+	_, err = p.daoProject.Get(projectId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Project ID !", ErrorDetail: "Given Project ID already exist"}
 		return indata, err
@@ -163,6 +151,12 @@ func (p *projectBaseService) Update(projectId string, indata utils.Map) (utils.M
 
 	log.Println("ProjectService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Project](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoProject.Get(projectId)
 	if err != nil {
 		return data, err
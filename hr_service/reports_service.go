@@ -1,24 +1,109 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	// Workforce Analytics Fields
+	FLD_REPORT_FROM_DATE         = "from_date"
+	FLD_REPORT_TO_DATE           = "to_date"
+	FLD_REPORT_PERIOD            = "period"
+	FLD_REPORT_GROUP_BY          = "group_by"
+	FLD_REPORT_LABEL             = "label"
+	FLD_REPORT_PERIOD_START      = "period_start"
+	FLD_REPORT_PERIOD_END        = "period_end"
+	FLD_REPORT_TOTAL             = "total"
+	FLD_REPORT_VALUES            = "values"
+	FLD_REPORT_JOINERS           = "joiners"
+	FLD_REPORT_LEAVERS           = "leavers"
+	FLD_REPORT_OPENING_HEADCOUNT = "opening_headcount"
+	FLD_REPORT_CLOSING_HEADCOUNT = "closing_headcount"
+	FLD_REPORT_ATTRITION_RATE    = "attrition_rate"
+	FLD_REPORT_AVERAGE_TENURE    = "average_tenure_years"
+	FLD_REPORT_GENDER            = "gender"
+	FLD_REPORT_AGE_BAND          = "age_band"
+
+	// Staff Personal Fields, looked up in the Staff record then in the App User
+	FLD_STAFF_GENDER        = "gender"
+	FLD_STAFF_DATE_OF_BIRTH = "date_of_birth"
+
+	// Report Periods
+	REPORT_PERIOD_MONTH   = "month"
+	REPORT_PERIOD_QUARTER = "quarter"
+	REPORT_PERIOD_YEAR    = "year"
+	MAX_REPORT_PERIODS    = 240
+
+	// Value used when the staff has no value for the group
+	REPORT_VALUE_UNKNOWN = "unknown"
+
+	// Workforce Analytics Error Codes
+	ERRCODE_INVALID_REPORT_PERIOD   = "S30191"
+	ERRCODE_INVALID_REPORT_GROUP_BY = "S30192"
+)
+
+// Staff fields the headcount can be grouped by
+var reportGroupByFields = []string{
+	hr_common.FLD_DEPARTMENT_ID,
+	hr_common.FLD_DESIGNATION_ID,
+	hr_common.FLD_WORKLOCATION_ID,
+	hr_common.FLD_STAFFTYPE_ID,
+}
+
+// Age bands as lower bound of the age in years, ordered from the oldest
+var reportAgeBands = []struct {
+	label  string
+	minAge int
+}{
+	{"55+", 55},
+	{"45-54", 45},
+	{"35-44", 35},
+	{"25-34", 25},
+	{"below 25", 0},
+}
+
+// reportPeriod - Period of the time-series, both start & end dates are inclusive
+type reportPeriod struct {
+	label string
+	start time.Time
+	end   time.Time
+}
+
+// employmentSpell - Employment of the staff from join/rehire till exit, exit date is exclusive
+type employmentSpell struct {
+	start time.Time
+	end   time.Time
+}
+
+// workforceStaff - Staff record along with the employment history used for the analytics
+type workforceStaff struct {
+	info   utils.Map
+	events []employmentEvent
+	spells []employmentSpell
+}
+
 // ReportsService - Reports Service structure
 type ReportsService interface {
 	GetAttendanceSummary(filter string, aggr string, sort string, skip int64, limit int64) (utils.Map, error)
 	GetLeavePermissionSummary(filter string, aggr string, sort string, skip int64, limit int64) (utils.Map, error)
 
+	GetHeadcountTrend(fromDate string, toDate string, period string, groupBy string) (utils.Map, error)
+	GetJoinersLeavers(fromDate string, toDate string, period string) (utils.Map, error)
+	GetAttritionRate(fromDate string, toDate string, period string) (utils.Map, error)
+	GetAverageTenure(fromDate string, toDate string, period string) (utils.Map, error)
+	GetGenderAgeDistribution(fromDate string, toDate string, period string) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -27,9 +112,9 @@ type ReportsService interface {
 }
 
 type reportsBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoReports          hr_repository.ReportsDao
+	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	daoPlatformAppUser  platform_repository.AppUserDao
 
@@ -55,16 +140,9 @@ func NewReportsService(props utils.Map) (ReportsService, error) {
 
 	p := reportsBaseService{} // Initialize p as a pointer to the struct
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -76,9 +154,10 @@ func NewReportsService(props utils.Map) (ReportsService, error) {
 	p.staffID = staffID
 
 	// Instantiate other services
-	p.daoReports = hr_repository.NewReportsDao(p.dbRegion.GetClient(), p.businessID, p.staffID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
-	p.daoPlatformAppUser = platform_repository.NewAppUserDao(p.GetClient())
+	p.daoReports = p.NewReportsDao(p.businessID, p.staffID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
 
 	_, err = p.daoPlatformBusiness.Get(businessID)
 	if err != nil {
@@ -96,8 +175,7 @@ func NewReportsService(props utils.Map) (ReportsService, error) {
 
 func (p *reportsBaseService) EndService() {
 	log.Printf("EndReportsMongoService ")
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // GetAttendanceSummary retrieves reports data
@@ -134,6 +212,255 @@ func (p *reportsBaseService) GetLeavePermissionSummary(filter string, aggr strin
 	return response, nil
 }
 
+// ************************************************************************
+// GetHeadcountTrend - Get the headcount at the end of each period, grouped
+// by department, designation, work location or staff type when given
+//
+// ************************************************************************
+func (p *reportsBaseService) GetHeadcountTrend(fromDate string, toDate string, period string, groupBy string) (utils.Map, error) {
+
+	log.Println("ReportsService::GetHeadcountTrend - Begin", fromDate, toDate, period, groupBy)
+
+	if groupBy != "" && !isReportGroupByField(groupBy) {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_REPORT_GROUP_BY,
+			ErrorMsg:    "Invalid Group By",
+			ErrorDetail: "Headcount can be grouped by " + strings.Join(reportGroupByFields, ", ")}
+		return nil, err
+	}
+
+	periods, err := getReportPeriods(fromDate, toDate, period)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs, err := p.getWorkforceStaffs()
+	if err != nil {
+		return nil, err
+	}
+
+	series := []utils.Map{}
+	for _, reportPeriod := range periods {
+		total := 0
+		values := utils.Map{}
+		for _, staff := range staffs {
+			if !staff.isEmployedOn(reportPeriod.end) {
+				continue
+			}
+			total++
+
+			if groupBy != "" {
+				groupValue := staff.getFieldAsOf(groupBy, reportPeriod.end)
+				count, _ := values[groupValue].(int)
+				values[groupValue] = count + 1
+			}
+		}
+
+		point := reportPeriod.toMap()
+		point[FLD_REPORT_TOTAL] = total
+		if groupBy != "" {
+			point[FLD_REPORT_VALUES] = values
+		}
+		series = append(series, point)
+	}
+
+	response := getReportResponse(fromDate, toDate, period, series)
+	if groupBy != "" {
+		response[FLD_REPORT_GROUP_BY] = groupBy
+	}
+
+	log.Println("ReportsService::GetHeadcountTrend - End", len(series))
+	return response, nil
+}
+
+// ************************************************************************
+// GetJoinersLeavers - Get the staffs joined or rehired and the staffs
+// resigned or terminated in each period
+//
+// ************************************************************************
+func (p *reportsBaseService) GetJoinersLeavers(fromDate string, toDate string, period string) (utils.Map, error) {
+
+	log.Println("ReportsService::GetJoinersLeavers - Begin", fromDate, toDate, period)
+
+	periods, err := getReportPeriods(fromDate, toDate, period)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs, err := p.getWorkforceStaffs()
+	if err != nil {
+		return nil, err
+	}
+
+	series := []utils.Map{}
+	for _, reportPeriod := range periods {
+		joiners, leavers := countJoinersLeavers(staffs, reportPeriod)
+
+		point := reportPeriod.toMap()
+		point[FLD_REPORT_JOINERS] = joiners
+		point[FLD_REPORT_LEAVERS] = leavers
+		series = append(series, point)
+	}
+
+	log.Println("ReportsService::GetJoinersLeavers - End", len(series))
+	return getReportResponse(fromDate, toDate, period, series), nil
+}
+
+// ************************************************************************
+// GetAttritionRate - Get the leavers of each period as percentage of the
+// average of opening and closing headcount
+//
+// ************************************************************************
+func (p *reportsBaseService) GetAttritionRate(fromDate string, toDate string, period string) (utils.Map, error) {
+
+	log.Println("ReportsService::GetAttritionRate - Begin", fromDate, toDate, period)
+
+	periods, err := getReportPeriods(fromDate, toDate, period)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs, err := p.getWorkforceStaffs()
+	if err != nil {
+		return nil, err
+	}
+
+	series := []utils.Map{}
+	for _, reportPeriod := range periods {
+		// Opening headcount is the headcount at the end of the previous day
+		opening, closing := 0, 0
+		for _, staff := range staffs {
+			if staff.isEmployedOn(reportPeriod.start.AddDate(0, 0, -1)) {
+				opening++
+			}
+			if staff.isEmployedOn(reportPeriod.end) {
+				closing++
+			}
+		}
+		_, leavers := countJoinersLeavers(staffs, reportPeriod)
+
+		attritionRate := 0.0
+		averageHeadcount := float64(opening+closing) / 2
+		if averageHeadcount > 0 {
+			attritionRate = roundTo2Decimals(float64(leavers) * 100 / averageHeadcount)
+		}
+
+		point := reportPeriod.toMap()
+		point[FLD_REPORT_OPENING_HEADCOUNT] = opening
+		point[FLD_REPORT_CLOSING_HEADCOUNT] = closing
+		point[FLD_REPORT_LEAVERS] = leavers
+		point[FLD_REPORT_ATTRITION_RATE] = attritionRate
+		series = append(series, point)
+	}
+
+	log.Println("ReportsService::GetAttritionRate - End", len(series))
+	return getReportResponse(fromDate, toDate, period, series), nil
+}
+
+// ************************************************************************
+// GetAverageTenure - Get the average tenure in years of the staffs employed
+// at the end of each period, tenure counts from the latest join or rehire
+//
+// ************************************************************************
+func (p *reportsBaseService) GetAverageTenure(fromDate string, toDate string, period string) (utils.Map, error) {
+
+	log.Println("ReportsService::GetAverageTenure - Begin", fromDate, toDate, period)
+
+	periods, err := getReportPeriods(fromDate, toDate, period)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs, err := p.getWorkforceStaffs()
+	if err != nil {
+		return nil, err
+	}
+
+	series := []utils.Map{}
+	for _, reportPeriod := range periods {
+		headcount := 0
+		tenureDays := 0.0
+		for _, staff := range staffs {
+			spell, ok := staff.getSpellOn(reportPeriod.end)
+			if !ok || spell.start.IsZero() {
+				// Tenure not known without the joining date
+				continue
+			}
+			headcount++
+			tenureDays += reportPeriod.end.Sub(spell.start).Hours() / 24
+		}
+
+		averageTenure := 0.0
+		if headcount > 0 {
+			averageTenure = roundTo2Decimals(tenureDays / float64(headcount) / 365.25)
+		}
+
+		point := reportPeriod.toMap()
+		point[FLD_REPORT_TOTAL] = headcount
+		point[FLD_REPORT_AVERAGE_TENURE] = averageTenure
+		series = append(series, point)
+	}
+
+	log.Println("ReportsService::GetAverageTenure - End", len(series))
+	return getReportResponse(fromDate, toDate, period, series), nil
+}
+
+// ************************************************************************
+// GetGenderAgeDistribution - Get the staffs employed at the end of each
+// period by gender and by age band
+//
+// ************************************************************************
+func (p *reportsBaseService) GetGenderAgeDistribution(fromDate string, toDate string, period string) (utils.Map, error) {
+
+	log.Println("ReportsService::GetGenderAgeDistribution - Begin", fromDate, toDate, period)
+
+	periods, err := getReportPeriods(fromDate, toDate, period)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs, err := p.getWorkforceStaffs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Personal details don't change over the periods
+	genders := make([]string, len(staffs))
+	birthDates := make([]time.Time, len(staffs))
+	for i, staff := range staffs {
+		genders[i], birthDates[i] = p.getPersonalDetails(staff.info)
+	}
+
+	series := []utils.Map{}
+	for _, reportPeriod := range periods {
+		total := 0
+		genderCounts := utils.Map{}
+		ageBandCounts := utils.Map{}
+		for i, staff := range staffs {
+			if !staff.isEmployedOn(reportPeriod.end) {
+				continue
+			}
+			total++
+
+			count, _ := genderCounts[genders[i]].(int)
+			genderCounts[genders[i]] = count + 1
+
+			ageBand := getAgeBand(birthDates[i], reportPeriod.end)
+			count, _ = ageBandCounts[ageBand].(int)
+			ageBandCounts[ageBand] = count + 1
+		}
+
+		point := reportPeriod.toMap()
+		point[FLD_REPORT_TOTAL] = total
+		point[FLD_REPORT_GENDER] = genderCounts
+		point[FLD_REPORT_AGE_BAND] = ageBandCounts
+		series = append(series, point)
+	}
+
+	log.Println("ReportsService::GetGenderAgeDistribution - End", len(series))
+	return getReportResponse(fromDate, toDate, period, series), nil
+}
+
 // errorReturn handles error and closes the database connection
 func (p *reportsBaseService) errorReturn(err error) (ReportsService, error) {
 	// Close the Database Connection
@@ -175,3 +502,276 @@ func (p *reportsBaseService) mergeUserInfo(staffInfo utils.Map) {
 		staffInfo[hr_common.FLD_STAFF_INFO] = []utils.Map{staffData}
 	}
 }
+
+// getWorkforceStaffs - Get the staffs along with their employment spells
+func (p *reportsBaseService) getWorkforceStaffs() ([]workforceStaff, error) {
+
+	filter := fmt.Sprintf(`{"%s":false}`, db_common.FLD_IS_DELETED)
+	response, err := p.daoStaff.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	staffs := []workforceStaff{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return staffs, nil
+	}
+
+	for _, staffInfo := range dataList.([]utils.Map) {
+		staff := workforceStaff{info: staffInfo, events: getEmploymentEvents(staffInfo)}
+		staff.spells = getEmploymentSpells(staffInfo, staff.events)
+		staffs = append(staffs, staff)
+	}
+	return staffs, nil
+}
+
+// getPersonalDetails - Get the gender & date of birth from the Staff record or the App User
+func (p *reportsBaseService) getPersonalDetails(staffInfo utils.Map) (string, time.Time) {
+
+	gender, errGender := getStaffDataStr(staffInfo, FLD_STAFF_GENDER)
+	birthDateStr, errBirthDate := getStaffDataStr(staffInfo, FLD_STAFF_DATE_OF_BIRTH)
+	if errGender != nil || errBirthDate != nil {
+		staffId, _ := utils.GetMemberDataStr(staffInfo, hr_common.FLD_STAFF_ID)
+		userInfo, err := p.daoPlatformAppUser.Get(staffId)
+		if err == nil {
+			if errGender != nil {
+				gender, _ = utils.GetMemberDataStr(userInfo, FLD_STAFF_GENDER)
+			}
+			if errBirthDate != nil {
+				birthDateStr, _ = utils.GetMemberDataStr(userInfo, FLD_STAFF_DATE_OF_BIRTH)
+			}
+		}
+	}
+
+	gender = strings.ToLower(strings.TrimSpace(gender))
+	if gender == "" {
+		gender = REPORT_VALUE_UNKNOWN
+	}
+
+	birthDate, err := parseDateValue(birthDateStr)
+	if err != nil {
+		return gender, time.Time{}
+	}
+	return gender, truncateToDate(birthDate)
+}
+
+// getEmploymentSpells - Get the employment spells from the employment history, the date of
+// join & exit are used for the staffs without history
+func getEmploymentSpells(staffInfo utils.Map, events []employmentEvent) []employmentSpell {
+
+	spells := []employmentSpell{}
+	if len(events) == 0 {
+		spell := employmentSpell{}
+		joinDateStr, err := getStaffDataStr(staffInfo, FLD_STAFF_DATE_OF_JOIN)
+		if err == nil {
+			joinDate, err := parseDateValue(joinDateStr)
+			if err == nil {
+				spell.start = truncateToDate(joinDate)
+			}
+		}
+
+		exitDateStr, err := getStaffDataStr(staffInfo, FLD_STAFF_DATE_OF_EXIT)
+		if err == nil {
+			exitDate, err := parseDateValue(exitDateStr)
+			if err == nil {
+				spell.end = truncateToDate(exitDate)
+			}
+		}
+		return append(spells, spell)
+	}
+
+	for _, event := range events {
+		switch event.eventType {
+		case EMPLOYMENT_EVENT_JOIN, EMPLOYMENT_EVENT_REHIRE:
+			spells = append(spells, employmentSpell{start: event.effectiveDate})
+
+		case EMPLOYMENT_EVENT_RESIGN, EMPLOYMENT_EVENT_TERMINATE:
+			if len(spells) > 0 && spells[len(spells)-1].end.IsZero() {
+				spells[len(spells)-1].end = event.effectiveDate
+			}
+		}
+	}
+	return spells
+}
+
+// getSpellOn - Get the employment spell of the staff on the date
+func (s workforceStaff) getSpellOn(date time.Time) (employmentSpell, bool) {
+	for _, spell := range s.spells {
+		if !spell.start.After(date) && (spell.end.IsZero() || spell.end.After(date)) {
+			return spell, true
+		}
+	}
+	return employmentSpell{}, false
+}
+
+// isEmployedOn - Check the staff is employed on the date
+func (s workforceStaff) isEmployedOn(date time.Time) bool {
+	_, ok := s.getSpellOn(date)
+	return ok
+}
+
+// getFieldAsOf - Get the employment field of the staff as on the date
+func (s workforceStaff) getFieldAsOf(field string, date time.Time) string {
+
+	value := ""
+	if len(s.events) > 0 {
+		state, _, err := replayEmploymentEvents(s.events, date)
+		if err == nil {
+			value, _ = state[field].(string)
+		}
+	} else {
+		value, _ = getStaffDataStr(s.info, field)
+	}
+
+	if value == "" {
+		value = REPORT_VALUE_UNKNOWN
+	}
+	return value
+}
+
+// countJoinersLeavers - Count the employment spells started & ended in the period
+func countJoinersLeavers(staffs []workforceStaff, reportPeriod reportPeriod) (int, int) {
+
+	joiners, leavers := 0, 0
+	for _, staff := range staffs {
+		for _, spell := range staff.spells {
+			if reportPeriod.contains(spell.start) {
+				joiners++
+			}
+			if reportPeriod.contains(spell.end) {
+				leavers++
+			}
+		}
+	}
+	return joiners, leavers
+}
+
+// contains - Check the date falls in the period
+func (r reportPeriod) contains(date time.Time) bool {
+	return !date.IsZero() && !date.Before(r.start) && !date.After(r.end)
+}
+
+// toMap - Get the time-series point for the period
+func (r reportPeriod) toMap() utils.Map {
+	return utils.Map{
+		FLD_REPORT_LABEL:        r.label,
+		FLD_REPORT_PERIOD_START: r.start.Format(time.DateOnly),
+		FLD_REPORT_PERIOD_END:   r.end.Format(time.DateOnly),
+	}
+}
+
+// getReportPeriods - Split the date range into calendar months, quarters or years, the first
+// and last periods are clipped to the date range
+func getReportPeriods(fromDate string, toDate string, period string) ([]reportPeriod, error) {
+
+	invalidPeriod := func(detail string) error {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_REPORT_PERIOD,
+			ErrorMsg:    "Invalid Report Period",
+			ErrorDetail: detail}
+		return err
+	}
+
+	from, err := parseDateValue(fromDate)
+	if err != nil {
+		return nil, invalidPeriod("From date should be in YYYY-MM-DD format")
+	}
+	to, err := parseDateValue(toDate)
+	if err != nil {
+		return nil, invalidPeriod("To date should be in YYYY-MM-DD format")
+	}
+	from, to = truncateToDate(from), truncateToDate(to)
+	if to.Before(from) {
+		return nil, invalidPeriod("To date should be on or after the from date")
+	}
+
+	if period == "" {
+		period = REPORT_PERIOD_MONTH
+	}
+
+	periods := []reportPeriod{}
+	for start := from; !start.After(to); {
+		if len(periods) >= MAX_REPORT_PERIODS {
+			return nil, invalidPeriod(fmt.Sprintf("Date range should have at most %d periods", MAX_REPORT_PERIODS))
+		}
+
+		var periodStart time.Time
+		var label string
+		months := 0
+		switch period {
+		case REPORT_PERIOD_MONTH:
+			periodStart = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+			label = periodStart.Format("2006-01")
+			months = 1
+		case REPORT_PERIOD_QUARTER:
+			quarter := (int(start.Month()) - 1) / 3
+			periodStart = time.Date(start.Year(), time.Month(quarter*3+1), 1, 0, 0, 0, 0, start.Location())
+			label = fmt.Sprintf("%d-Q%d", start.Year(), quarter+1)
+			months = 3
+		case REPORT_PERIOD_YEAR:
+			periodStart = time.Date(start.Year(), time.January, 1, 0, 0, 0, 0, start.Location())
+			label = periodStart.Format("2006")
+			months = 12
+		default:
+			return nil, invalidPeriod("Period should be month, quarter or year")
+		}
+
+		nextStart := periodStart.AddDate(0, months, 0)
+		end := nextStart.AddDate(0, 0, -1)
+		if end.After(to) {
+			end = to
+		}
+
+		periods = append(periods, reportPeriod{label: label, start: start, end: end})
+		start = nextStart
+	}
+	return periods, nil
+}
+
+// getReportResponse - Get the time-series response for the date range
+func getReportResponse(fromDate string, toDate string, period string, series []utils.Map) utils.Map {
+
+	if period == "" {
+		period = REPORT_PERIOD_MONTH
+	}
+
+	return utils.Map{
+		FLD_REPORT_FROM_DATE:      fromDate,
+		FLD_REPORT_TO_DATE:        toDate,
+		FLD_REPORT_PERIOD:         period,
+		db_common.LIST_RESULTSIZE: len(series),
+		db_common.LIST_RESULT:     series,
+	}
+}
+
+// getAgeBand - Get the age band for the age on the date
+func getAgeBand(birthDate time.Time, date time.Time) string {
+
+	if birthDate.IsZero() || birthDate.After(date) {
+		return REPORT_VALUE_UNKNOWN
+	}
+
+	age := date.Year() - birthDate.Year()
+	if date.Month() < birthDate.Month() || (date.Month() == birthDate.Month() && date.Day() < birthDate.Day()) {
+		// Birthday not yet reached in the year
+		age--
+	}
+
+	for _, ageBand := range reportAgeBands {
+		if age >= ageBand.minAge {
+			return ageBand.label
+		}
+	}
+	return REPORT_VALUE_UNKNOWN
+}
+
+// isReportGroupByField - Check the headcount can be grouped by the field
+func isReportGroupByField(field string) bool {
+	for _, groupByField := range reportGroupByFields {
+		if field == groupByField {
+			return true
+		}
+	}
+	return false
+}
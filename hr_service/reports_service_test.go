@@ -0,0 +1,78 @@
+package hr_service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestReportPeriods(t *testing.T) {
+
+	// Periods as label:start:end
+	tests := []struct {
+		name      string
+		fromDate  string
+		toDate    string
+		period    string
+		expected  []string
+		errorCode string
+	}{
+		{"months clipped to the range", "2030-01-15", "2030-03-10", REPORT_PERIOD_MONTH,
+			[]string{"2030-01:2030-01-15:2030-01-31", "2030-02:2030-02-01:2030-02-28", "2030-03:2030-03-01:2030-03-10"}, ""},
+		{"month by default", "2030-02-01", "2030-02-28", "",
+			[]string{"2030-02:2030-02-01:2030-02-28"}, ""},
+		{"leap year february", "2032-02-10", "2032-03-01", REPORT_PERIOD_MONTH,
+			[]string{"2032-02:2032-02-10:2032-02-29", "2032-03:2032-03-01:2032-03-01"}, ""},
+		{"single day", "2030-05-20", "2030-05-20", REPORT_PERIOD_MONTH,
+			[]string{"2030-05:2030-05-20:2030-05-20"}, ""},
+		{"date-time values", "2030-05-20 10:30:00", "2030-06-02 18:00:00", REPORT_PERIOD_MONTH,
+			[]string{"2030-05:2030-05-20:2030-05-31", "2030-06:2030-06-01:2030-06-02"}, ""},
+		{"quarters across years", "2030-11-15", "2031-04-01", REPORT_PERIOD_QUARTER,
+			[]string{"2030-Q4:2030-11-15:2030-12-31", "2031-Q1:2031-01-01:2031-03-31", "2031-Q2:2031-04-01:2031-04-01"}, ""},
+		{"years", "2029-07-01", "2031-06-30", REPORT_PERIOD_YEAR,
+			[]string{"2029:2029-07-01:2029-12-31", "2030:2030-01-01:2030-12-31", "2031:2031-01-01:2031-06-30"}, ""},
+		{"maximum periods", "2011-01-01", "2030-12-31", REPORT_PERIOD_MONTH, nil, ""},
+		{"too many periods", "2010-12-31", "2030-12-31", REPORT_PERIOD_MONTH, nil, ERRCODE_INVALID_REPORT_PERIOD},
+		{"invalid from date", "15-01-2030", "2030-03-10", REPORT_PERIOD_MONTH, nil, ERRCODE_INVALID_REPORT_PERIOD},
+		{"invalid to date", "2030-01-15", "2030-13-01", REPORT_PERIOD_MONTH, nil, ERRCODE_INVALID_REPORT_PERIOD},
+		{"to date before from date", "2030-03-10", "2030-01-15", REPORT_PERIOD_MONTH, nil, ERRCODE_INVALID_REPORT_PERIOD},
+		{"unknown period", "2030-01-15", "2030-03-10", "week", nil, ERRCODE_INVALID_REPORT_PERIOD},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			periods, err := getReportPeriods(test.fromDate, test.toDate, test.period)
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expected == nil {
+				if len(periods) != MAX_REPORT_PERIODS {
+					t.Errorf("Expected %d periods, got %d", MAX_REPORT_PERIODS, len(periods))
+				}
+				return
+			}
+
+			results := []string{}
+			for _, period := range periods {
+				point := period.toMap()
+				results = append(results, strings.Join([]string{point[FLD_REPORT_LABEL].(string),
+					point[FLD_REPORT_PERIOD_START].(string), point[FLD_REPORT_PERIOD_END].(string)}, ":"))
+			}
+			if !reflect.DeepEqual(results, test.expected) {
+				t.Errorf("Expected periods %v, got %v", test.expected, results)
+			}
+		})
+	}
+
+	response := getReportResponse("2030-01-15", "2030-03-10", "", []utils.Map{})
+	if response[FLD_REPORT_PERIOD] != REPORT_PERIOD_MONTH {
+		t.Errorf("Expected %s period by default, got %v", REPORT_PERIOD_MONTH, response)
+	}
+}
@@ -0,0 +1,526 @@
+package hr_service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	// Roster assignments are kept in the Staff record
+	FLD_ROSTER              = "roster"
+	FLD_ROSTER_DATE         = "date"
+	FLD_ROSTER_IS_WEEK_OFF  = "is_week_off"
+	FLD_ROSTER_SWAPPED_WITH = "swapped_with"
+
+	// Roster Generation Fields
+	FLD_ROSTER_STAFF_IDS = "staff_ids"
+	FLD_ROSTER_FROM_DATE = "from_date"
+	FLD_ROSTER_TO_DATE   = "to_date"
+	FLD_ROSTER_STAGGER   = "stagger"
+
+	// Week-Off staffs listed by GetShiftStaffs
+	FLD_ROSTER_WEEK_OFF_STAFF_IDS = "week_off_staff_ids"
+
+	// Maximum days of roster generated in a request
+	MAX_ROSTER_DAYS = 366
+
+	// Days the past roster assignments are kept in the Staff record, for the
+	// timesheets & reports of the past periods
+	ROSTER_RETENTION_DAYS = 400
+
+	// Roster Error Codes
+	ERRCODE_NO_ROSTER        = "S30131"
+	ERRCODE_INVALID_ROTATION = "S30132"
+)
+
+// RosterService - Roster Service structure
+type RosterService interface {
+	GenerateRoster(indata utils.Map) (utils.Map, error)
+	GetStaffRoster(staffId string, fromDate string, toDate string) (utils.Map, error)
+	GetShiftStaffs(date string) (utils.Map, error)
+	SwapShift(date string, staffId string, otherStaffId string) (utils.Map, error)
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// rosterBaseService - Roster Service structure
+type rosterBaseService struct {
+	DaoProvider
+	daoStaff            hr_repository.StaffDao
+	daoShift            hr_repository.ShiftDao
+	daoShiftProfile     hr_repository.ShiftProfileDao
+	daoPlatformBusiness platform_repository.BusinessDao
+
+	child      RosterService
+	businessId string
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewRosterService(props utils.Map) (RosterService, error) {
+	funcode := hr_common.GetServiceModuleCode() + "M" + "01"
+
+	log.Printf("RosterService::Start")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, hr_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := rosterBaseService{}
+
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessId = businessId
+
+	// Instantiate other services
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoShift = p.NewShiftDao(p.businessId)
+	p.daoShiftProfile = p.NewShiftProfileDao(p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+
+	_, err = p.daoPlatformBusiness.Get(p.businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business id",
+			ErrorDetail: "Given business id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, nil
+}
+
+func (p *rosterBaseService) EndService() {
+	p.Close()
+}
+
+// ************************************************************************
+// GenerateRoster - Generate the dated shift assignments of the given staffs
+// from the rotation pattern and week-offs of the shift profile. Existing
+// assignments of the staffs within the period are replaced
+//
+// ************************************************************************
+func (p *rosterBaseService) GenerateRoster(indata utils.Map) (utils.Map, error) {
+
+	log.Println("RosterService::GenerateRoster - Begin")
+
+	shiftProfileId, err := utils.GetMemberDataStr(indata, hr_common.FLD_SHIFT_PROFILE_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	shiftProfileInfo, err := p.daoShiftProfile.Get(shiftProfileId)
+	if err != nil {
+		return nil, err
+	}
+
+	fromDate, toDate, err := p.getRosterPeriod(indata)
+	if err != nil {
+		return nil, err
+	}
+
+	staffIds, err := p.getRosterStaffIds(indata)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := getRotationShifts(shiftProfileInfo)
+	if len(rotation) == 0 {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_ROTATION,
+			ErrorMsg:    "Invalid Rotation",
+			ErrorDetail: "Shift profile has no shifts in rotation"}
+		return nil, err
+	}
+	for _, shiftId := range rotation {
+		_, err = p.daoShift.Get(shiftId)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_ROTATION,
+				ErrorMsg:    "Invalid Rotation",
+				ErrorDetail: "Shift " + shiftId + " in rotation is not exist"}
+			return nil, err
+		}
+	}
+
+	rotationDays, err := utils.GetMemberDataInt(shiftProfileInfo, FLD_SHIFT_PROFILE_ROTATION_DAYS, true)
+	if err != nil || rotationDays <= 0 {
+		rotationDays = DEFAULT_ROTATION_DAYS
+	}
+
+	rotationStart := fromDate
+	rotationStartStr, err := utils.GetMemberDataStr(shiftProfileInfo, FLD_SHIFT_PROFILE_ROTATION_START)
+	if err == nil {
+		rotationStart, err = parseDateValue(rotationStartStr)
+		if err != nil {
+			rotationStart = fromDate
+		}
+	}
+
+	// Stagger starts each staff at the next shift of the rotation
+	stagger, _ := utils.GetMemberDataBool(indata, FLD_ROSTER_STAGGER)
+	weekOffs := getWeekOffs(shiftProfileInfo)
+
+	staffRosters := []utils.Map{}
+	for staffIdx, staffId := range staffIds {
+		staffInfo, err := p.daoStaff.Get(staffId)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := 0
+		if stagger {
+			offset = staffIdx
+		}
+
+		assignments := []utils.Map{}
+		for day := fromDate; !day.After(toDate); day = day.AddDate(0, 0, 1) {
+			assignment := utils.Map{
+				FLD_ROSTER_DATE:                day.Format(time.DateOnly),
+				hr_common.FLD_SHIFT_PROFILE_ID: shiftProfileId,
+			}
+			if weekOffs[day.Weekday()] {
+				assignment[FLD_ROSTER_IS_WEEK_OFF] = true
+			} else {
+				cycle := int(math.Floor(day.Sub(rotationStart).Hours() / 24 / float64(rotationDays)))
+				shiftIdx := ((cycle+offset)%len(rotation) + len(rotation)) % len(rotation)
+				assignment[hr_common.FLD_SHIFT_ID] = rotation[shiftIdx]
+				assignment[FLD_ROSTER_IS_WEEK_OFF] = false
+			}
+			assignments = append(assignments, assignment)
+		}
+
+		err = p.saveStaffRoster(staffId, staffInfo, fromDate, toDate, assignments)
+		if err != nil {
+			return nil, err
+		}
+
+		staffRosters = append(staffRosters, utils.Map{
+			hr_common.FLD_STAFF_ID: staffId,
+			FLD_ROSTER:             assignments,
+		})
+	}
+
+	response := utils.Map{
+		hr_common.FLD_SHIFT_PROFILE_ID: shiftProfileId,
+		FLD_ROSTER_FROM_DATE:           fromDate.Format(time.DateOnly),
+		FLD_ROSTER_TO_DATE:             toDate.Format(time.DateOnly),
+		db_common.LIST_RESULTSIZE:      len(staffRosters),
+		db_common.LIST_RESULT:          staffRosters,
+	}
+
+	log.Println("RosterService::GenerateRoster - End", len(staffRosters))
+	return response, nil
+}
+
+// ***************************************************************
+// GetStaffRoster - Get the shift assignments of the staff for the
+// given period (yyyy-mm-dd)
+//
+// ***************************************************************
+func (p *rosterBaseService) GetStaffRoster(staffId string, fromDate string, toDate string) (utils.Map, error) {
+
+	log.Println("RosterService::GetStaffRoster - Begin", staffId, fromDate, toDate)
+
+	staffInfo, err := p.daoStaff.Get(staffId)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := []utils.Map{}
+	for _, assignment := range getRosterAssignments(staffInfo) {
+		date, _ := utils.GetMemberDataStr(assignment, FLD_ROSTER_DATE)
+		if date >= fromDate && date <= toDate {
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staffId,
+		db_common.LIST_RESULTSIZE: len(assignments),
+		db_common.LIST_RESULT:     assignments,
+	}
+
+	log.Println("RosterService::GetStaffRoster - End", len(assignments))
+	return response, nil
+}
+
+// ************************************************************
+// GetShiftStaffs - Get the staffs on each shift on the given
+// date (yyyy-mm-dd), staffs on week-off are listed separately
+//
+// ************************************************************
+func (p *rosterBaseService) GetShiftStaffs(date string) (utils.Map, error) {
+
+	log.Println("RosterService::GetShiftStaffs - Begin", date)
+
+	_, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid date", ErrorDetail: "date should be in yyyy-mm-dd format"}
+		return nil, err
+	}
+
+	filter := fmt.Sprintf(`{"%s.%s":"%s","%s":false}`,
+		FLD_ROSTER, FLD_ROSTER_DATE, date,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoStaff.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	shiftStaffs := map[string][]string{}
+	weekOffStaffs := []string{}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		for _, staffInfo := range dataList.([]utils.Map) {
+			staffId, _ := utils.GetMemberDataStr(staffInfo, hr_common.FLD_STAFF_ID)
+
+			assignment, ok := getRosterAssignment(staffInfo, date)
+			if !ok {
+				continue
+			}
+
+			isWeekOff, _ := utils.GetMemberDataBool(assignment, FLD_ROSTER_IS_WEEK_OFF)
+			shiftId, _ := utils.GetMemberDataStr(assignment, hr_common.FLD_SHIFT_ID)
+			if isWeekOff || shiftId == "" {
+				weekOffStaffs = append(weekOffStaffs, staffId)
+			} else {
+				shiftStaffs[shiftId] = append(shiftStaffs[shiftId], staffId)
+			}
+		}
+	}
+
+	shiftIds := make([]string, 0, len(shiftStaffs))
+	for shiftId := range shiftStaffs {
+		shiftIds = append(shiftIds, shiftId)
+	}
+	sort.Strings(shiftIds)
+
+	shifts := []utils.Map{}
+	for _, shiftId := range shiftIds {
+		shifts = append(shifts, utils.Map{
+			hr_common.FLD_SHIFT_ID: shiftId,
+			FLD_ROSTER_STAFF_IDS:   shiftStaffs[shiftId],
+		})
+	}
+
+	result := utils.Map{
+		FLD_ROSTER_DATE:               date,
+		FLD_ROSTER_WEEK_OFF_STAFF_IDS: weekOffStaffs,
+		db_common.LIST_RESULTSIZE:     len(shifts),
+		db_common.LIST_RESULT:         shifts,
+	}
+
+	log.Println("RosterService::GetShiftStaffs - End", len(shifts))
+	return result, nil
+}
+
+// **************************************************************
+// SwapShift - Swap the shift assignments of two staffs on the
+// given date (yyyy-mm-dd), both staffs are updated in a transaction
+//
+// **************************************************************
+func (p *rosterBaseService) SwapShift(date string, staffId string, otherStaffId string) (utils.Map, error) {
+
+	log.Println("RosterService::SwapShift - Begin", date, staffId, otherStaffId)
+
+	if staffId == otherStaffId {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid Swap", ErrorDetail: "Shift can't be swapped with the same staff"}
+		return nil, err
+	}
+
+	newAssignment := utils.Map{FLD_ROSTER_DATE: date, FLD_ROSTER_SWAPPED_WITH: otherStaffId}
+	newOtherAssignment := utils.Map{FLD_ROSTER_DATE: date, FLD_ROSTER_SWAPPED_WITH: staffId}
+
+	// Staffs are read in the transaction, so the swap is not made on a roster changed meanwhile
+	err := runInTransaction(p.DaoProvider, func() error {
+		staffInfo, err := p.daoStaff.Get(staffId)
+		if err != nil {
+			return err
+		}
+
+		otherStaffInfo, err := p.daoStaff.Get(otherStaffId)
+		if err != nil {
+			return err
+		}
+
+		assignment, ok := getRosterAssignment(staffInfo, date)
+		otherAssignment, otherOk := getRosterAssignment(otherStaffInfo, date)
+		if !ok || !otherOk {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_NO_ROSTER,
+				ErrorMsg:    "No Roster",
+				ErrorDetail: "Both staffs should have roster on " + date}
+			return err
+		}
+
+		swappedFields := []string{hr_common.FLD_SHIFT_ID, hr_common.FLD_SHIFT_PROFILE_ID, FLD_ROSTER_IS_WEEK_OFF}
+		for _, field := range swappedFields {
+			if dataVal, ok := otherAssignment[field]; ok {
+				newAssignment[field] = dataVal
+			}
+			if dataVal, ok := assignment[field]; ok {
+				newOtherAssignment[field] = dataVal
+			}
+		}
+
+		dateVal, _ := time.Parse(time.DateOnly, date)
+		err = p.saveStaffRoster(staffId, staffInfo, dateVal, dateVal, []utils.Map{newAssignment})
+		if err != nil {
+			return err
+		}
+
+		return p.saveStaffRoster(otherStaffId, otherStaffInfo, dateVal, dateVal, []utils.Map{newOtherAssignment})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		staffId:      newAssignment,
+		otherStaffId: newOtherAssignment,
+	}
+
+	log.Println("RosterService::SwapShift - End")
+	return response, nil
+}
+
+func (p *rosterBaseService) errorReturn(err error) (RosterService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
+
+// getRosterPeriod - Get the from & to date of the roster to generate
+func (p *rosterBaseService) getRosterPeriod(indata utils.Map) (time.Time, time.Time, error) {
+
+	fromDateStr, _ := utils.GetMemberDataStr(indata, FLD_ROSTER_FROM_DATE)
+	fromDate, err := time.Parse(time.DateOnly, fromDateStr)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid from_date", ErrorDetail: "from_date should be in yyyy-mm-dd format"}
+		return time.Time{}, time.Time{}, err
+	}
+
+	toDateStr, _ := utils.GetMemberDataStr(indata, FLD_ROSTER_TO_DATE)
+	toDate, err := time.Parse(time.DateOnly, toDateStr)
+	if err != nil || toDate.Before(fromDate) {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid to_date", ErrorDetail: "to_date should be in yyyy-mm-dd format and not before from_date"}
+		return time.Time{}, time.Time{}, err
+	}
+
+	if toDate.Sub(fromDate).Hours()/24 >= MAX_ROSTER_DAYS {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid Period", ErrorDetail: fmt.Sprintf("Roster can be generated for maximum %d days", MAX_ROSTER_DAYS)}
+		return time.Time{}, time.Time{}, err
+	}
+
+	return fromDate, toDate, nil
+}
+
+// getRosterStaffIds - Get the staff ids to generate the roster for
+func (p *rosterBaseService) getRosterStaffIds(indata utils.Map) ([]string, error) {
+
+	dataVal, err := utils.GetMemberData(indata, FLD_ROSTER_STAFF_IDS)
+	if err != nil {
+		return nil, err
+	}
+
+	staffList, ok := toSlice(dataVal)
+	if !ok || len(staffList) == 0 {
+		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid staff_ids", ErrorDetail: "staff_ids should be a list of staff id"}
+		return nil, err
+	}
+
+	staffIds := []string{}
+	for _, item := range staffList {
+		staffId, ok := item.(string)
+		if !ok || staffId == "" {
+			err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Invalid staff_ids", ErrorDetail: "staff_ids should be a list of staff id"}
+			return nil, err
+		}
+		staffIds = append(staffIds, staffId)
+	}
+	return staffIds, nil
+}
+
+// saveStaffRoster - Replace the roster assignments of the staff within the period, assignments
+// past the retention days are pruned so the Staff record doesn't grow with every roster
+func (p *rosterBaseService) saveStaffRoster(staffId string, staffInfo utils.Map, fromDate time.Time, toDate time.Time, assignments []utils.Map) error {
+
+	from, to := fromDate.Format(time.DateOnly), toDate.Format(time.DateOnly)
+	retainFrom := getToday().AddDate(0, 0, -ROSTER_RETENTION_DAYS).Format(time.DateOnly)
+
+	roster := []utils.Map{}
+	for _, assignment := range getRosterAssignments(staffInfo) {
+		date, _ := utils.GetMemberDataStr(assignment, FLD_ROSTER_DATE)
+		if date >= retainFrom && (date < from || date > to) {
+			roster = append(roster, assignment)
+		}
+	}
+	roster = append(roster, assignments...)
+
+	sort.SliceStable(roster, func(i, j int) bool {
+		dateI, _ := utils.GetMemberDataStr(roster[i], FLD_ROSTER_DATE)
+		dateJ, _ := utils.GetMemberDataStr(roster[j], FLD_ROSTER_DATE)
+		return dateI < dateJ
+	})
+
+	_, err := p.daoStaff.Update(staffId, utils.Map{FLD_ROSTER: roster})
+	return err
+}
+
+// getRosterAssignments - Get the roster assignments kept in the Staff record
+func getRosterAssignments(staffInfo utils.Map) []utils.Map {
+
+	assignments := []utils.Map{}
+
+	dataVal, err := utils.GetMemberData(staffInfo, FLD_ROSTER)
+	if err != nil {
+		return assignments
+	}
+
+	roster, _ := toSlice(dataVal)
+	for _, item := range roster {
+		if assignment, ok := toMap(item); ok {
+			assignments = append(assignments, assignment)
+		}
+	}
+	return assignments
+}
+
+// getRosterAssignment - Get the roster assignment of the staff on the date (yyyy-mm-dd)
+func getRosterAssignment(staffInfo utils.Map, date string) (utils.Map, bool) {
+
+	for _, assignment := range getRosterAssignments(staffInfo) {
+		assignmentDate, _ := utils.GetMemberDataStr(assignment, FLD_ROSTER_DATE)
+		if assignmentDate == date {
+			return assignment, true
+		}
+	}
+	return nil, false
+}
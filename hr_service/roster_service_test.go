@@ -0,0 +1,227 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestRosterRetention(t *testing.T) {
+
+	provider, props := newTestProvider()
+
+	today := getToday()
+	expired := today.AddDate(0, 0, -ROSTER_RETENTION_DAYS-1).Format(time.DateOnly)
+	retained := today.AddDate(0, 0, -ROSTER_RETENTION_DAYS).Format(time.DateOnly)
+	date := today.Format(time.DateOnly)
+
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			FLD_ROSTER: []utils.Map{
+				{FLD_ROSTER_DATE: expired, hr_common.FLD_SHIFT_ID: "shift_day"},
+				{FLD_ROSTER_DATE: retained, hr_common.FLD_SHIFT_ID: "shift_day"},
+				{FLD_ROSTER_DATE: date, hr_common.FLD_SHIFT_ID: "shift_day", FLD_ROSTER_IS_WEEK_OFF: false},
+			}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2",
+			FLD_ROSTER: []utils.Map{
+				{FLD_ROSTER_DATE: date, FLD_ROSTER_IS_WEEK_OFF: true},
+			}},
+	)
+
+	rosterService, err := NewRosterService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rosterService.EndService()
+
+	_, err = rosterService.SwapShift(date, "staff_1", "staff_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := rosterService.GetStaffRoster("staff_1", expired, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dates := getResultIds(t, response, FLD_ROSTER_DATE)
+	if len(dates) != 2 || dates[0] != retained || dates[1] != date {
+		t.Errorf("Expected the roster of %s & %s kept, got %v", retained, date, dates)
+	}
+
+	response, err = rosterService.GetShiftStaffs(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekOffStaffIds, _ := response[FLD_ROSTER_WEEK_OFF_STAFF_IDS].([]string)
+	if len(weekOffStaffIds) != 1 || weekOffStaffIds[0] != "staff_1" {
+		t.Errorf("Expected staff_1 on week-off after swap, got %v", response)
+	}
+
+	// Swap without the roster of both staffs leaves them unchanged
+	_, err = rosterService.SwapShift(retained, "staff_1", "staff_2")
+	assertErrorCode(t, err, ERRCODE_NO_ROSTER)
+}
+
+func TestGenerateRoster(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_SHIFTS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_ID: "shift_day"},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_ID: "shift_night"})
+	provider.Seed(MEMORY_COLLECTION_SHIFT_PROFILES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating",
+			FLD_SHIFT_PROFILE_ROTATION: []string{"shift_day", "shift_night"}, FLD_SHIFT_PROFILE_ROTATION_DAYS: 7,
+			FLD_SHIFT_PROFILE_ROTATION_START: "2030-01-07", FLD_SHIFT_PROFILE_WEEK_OFFS: []string{"sunday"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_PROFILE_ID: "profile_unknown_shift",
+			FLD_SHIFT_PROFILE_ROTATION: []string{"shift_day", "shift_unknown"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_SHIFT_PROFILE_ID: "profile_no_rotation"})
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1",
+			FLD_ROSTER: []utils.Map{
+				{FLD_ROSTER_DATE: "2030-01-12", hr_common.FLD_SHIFT_ID: "shift_old"},
+				{FLD_ROSTER_DATE: "2030-01-20", hr_common.FLD_SHIFT_ID: "shift_old"},
+			}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2"})
+
+	rosterService, err := NewRosterService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rosterService.EndService()
+
+	// Assignments as date:shift, or date:off for the week-off
+	getAssignments := func(roster interface{}) []string {
+		assignments := []string{}
+		items, _ := toSlice(roster)
+		for _, item := range items {
+			assignment, _ := toMap(item)
+			shiftId, _ := utils.GetMemberDataStr(assignment, hr_common.FLD_SHIFT_ID)
+			if isWeekOff, _ := utils.GetMemberDataBool(assignment, FLD_ROSTER_IS_WEEK_OFF); isWeekOff {
+				shiftId = "off"
+			}
+			assignments = append(assignments, assignment[FLD_ROSTER_DATE].(string)+":"+shiftId)
+		}
+		return assignments
+	}
+
+	tests := []struct {
+		name      string
+		indata    utils.Map
+		errorCode string
+		expected  map[string][]string
+	}{
+		{"staggered rotation",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1", "staff_2"},
+				FLD_ROSTER_FROM_DATE: "2030-01-12", FLD_ROSTER_TO_DATE: "2030-01-15", FLD_ROSTER_STAGGER: true}, "",
+			map[string][]string{
+				"staff_1": {"2030-01-12:shift_day", "2030-01-13:off", "2030-01-14:shift_night", "2030-01-15:shift_night"},
+				"staff_2": {"2030-01-12:shift_night", "2030-01-13:off", "2030-01-14:shift_day", "2030-01-15:shift_day"}}},
+		{"before rotation start",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "2030-01-05", FLD_ROSTER_TO_DATE: "2030-01-07"}, "",
+			map[string][]string{
+				"staff_1": {"2030-01-05:shift_night", "2030-01-06:off", "2030-01-07:shift_day"}}},
+		{"invalid from_date",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "12-01-2030", FLD_ROSTER_TO_DATE: "2030-01-15"}, "S30102", nil},
+		{"to_date before from_date",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "2030-01-15", FLD_ROSTER_TO_DATE: "2030-01-12"}, "S30102", nil},
+		{"period too long",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "2030-01-01", FLD_ROSTER_TO_DATE: "2031-01-02"}, "S30102", nil},
+		{"empty staff_ids",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_rotating", FLD_ROSTER_STAFF_IDS: []interface{}{},
+				FLD_ROSTER_FROM_DATE: "2030-01-12", FLD_ROSTER_TO_DATE: "2030-01-15"}, "S30102", nil},
+		{"no shifts in rotation",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_no_rotation", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "2030-01-12", FLD_ROSTER_TO_DATE: "2030-01-15"}, ERRCODE_INVALID_ROTATION, nil},
+		{"unknown shift in rotation",
+			utils.Map{hr_common.FLD_SHIFT_PROFILE_ID: "profile_unknown_shift", FLD_ROSTER_STAFF_IDS: []interface{}{"staff_1"},
+				FLD_ROSTER_FROM_DATE: "2030-01-12", FLD_ROSTER_TO_DATE: "2030-01-15"}, ERRCODE_INVALID_ROTATION, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := rosterService.GenerateRoster(test.indata)
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			staffRosters, _ := toSlice(response[db_common.LIST_RESULT])
+			if len(staffRosters) != len(test.expected) {
+				t.Fatalf("Expected roster of %d staffs, got %v", len(test.expected), response)
+			}
+			for _, item := range staffRosters {
+				staffRoster, _ := toMap(item)
+				staffId := staffRoster[hr_common.FLD_STAFF_ID].(string)
+				if assignments := getAssignments(staffRoster[FLD_ROSTER]); !reflect.DeepEqual(assignments, test.expected[staffId]) {
+					t.Errorf("Expected roster %v of %s, got %v", test.expected[staffId], staffId, assignments)
+				}
+			}
+		})
+	}
+
+	// Generated periods replace the stored assignments, others are kept
+	response, err := rosterService.GetStaffRoster("staff_1", "2030-01-01", "2030-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"2030-01-05:shift_night", "2030-01-06:off", "2030-01-07:shift_day", "2030-01-12:shift_day",
+		"2030-01-13:off", "2030-01-14:shift_night", "2030-01-15:shift_night", "2030-01-20:shift_old"}
+	if assignments := getAssignments(response[db_common.LIST_RESULT]); !reflect.DeepEqual(assignments, expected) {
+		t.Errorf("Expected stored roster %v, got %v", expected, assignments)
+	}
+
+	swapTests := []struct {
+		name         string
+		date         string
+		staffId      string
+		otherStaffId string
+		errorCode    string
+		expected     []string
+	}{
+		{"shifts swapped", "2030-01-14", "staff_1", "staff_2", "", []string{"2030-01-14:shift_day", "2030-01-14:shift_night"}},
+		{"swapped back", "2030-01-14", "staff_2", "staff_1", "", []string{"2030-01-14:shift_day", "2030-01-14:shift_night"}},
+		{"same staff", "2030-01-14", "staff_1", "staff_1", "S30102", nil},
+		{"no roster of other staff", "2030-01-20", "staff_1", "staff_2", ERRCODE_NO_ROSTER, nil},
+	}
+
+	for _, test := range swapTests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := rosterService.SwapShift(test.date, test.staffId, test.otherStaffId)
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			swapped := getAssignments([]utils.Map{response[test.staffId].(utils.Map), response[test.otherStaffId].(utils.Map)})
+			if !reflect.DeepEqual(swapped, test.expected) {
+				t.Errorf("Expected swapped roster %v, got %v", test.expected, swapped)
+			}
+			if response[test.staffId].(utils.Map)[FLD_ROSTER_SWAPPED_WITH] != test.otherStaffId {
+				t.Errorf("Expected swapped with %s, got %v", test.otherStaffId, response)
+			}
+
+			// Swapped assignment is stored in the Staff record
+			stored, err := rosterService.GetStaffRoster(test.staffId, test.date, test.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assignments := getAssignments(stored[db_common.LIST_RESULT]); !reflect.DeepEqual(assignments, test.expected[:1]) {
+				t.Errorf("Expected stored roster %v, got %v", test.expected[:1], assignments)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package hr_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// HRServiceContext - Services of a business sharing the database connections & the transaction,
+// the databases are opened and the business is validated once for all the services
+type HRServiceContext struct {
+	daoProvider *contextDaoProvider
+	props       utils.Map
+	owned       bool
+}
+
+// contextDaoProvider - DaoProvider of the services of the context, the validated business is reused
+type contextDaoProvider struct {
+	DaoProvider
+	businessId string
+	business   utils.Map
+}
+
+// contextBusinessDao - Business DAO returning the validated business without reading it again
+type contextBusinessDao struct {
+	platform_repository.BusinessDao
+	provider *contextDaoProvider
+}
+
+// NewHRServiceContext - Open the databases & validate the business given in the props, the
+// DaoProvider given in the props is used instead of opening the databases
+func NewHRServiceContext(props utils.Map) (*HRServiceContext, error) {
+	funcode := hr_common.GetServiceModuleCode() + "M" + "01"
+
+	log.Printf("HRServiceContext::Start ")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, hr_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := HRServiceContext{props: utils.Map{}}
+	for key, value := range props {
+		p.props[key] = value
+	}
+
+	daoProvider, ok := props[FLD_DAO_PROVIDER].(DaoProvider)
+	if !ok || daoProvider == nil {
+		// Open Database Services
+		daoProvider, err = NewMongoDaoProvider(props)
+		if err != nil {
+			return nil, err
+		}
+		p.owned = true
+	}
+
+	p.daoProvider = &contextDaoProvider{DaoProvider: daoProvider, businessId: businessId}
+	p.props[FLD_DAO_PROVIDER] = p.daoProvider
+
+	business, err := daoProvider.NewBusinessDao().Get(businessId)
+	if err != nil {
+		p.EndService()
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business id",
+			ErrorDetail: "Given business id is not exist"}
+		return nil, err
+	}
+	p.daoProvider.business = business
+
+	log.Printf("HRServiceContext::End ")
+	return &p, nil
+}
+
+// EndService - Close the database connections, services of the context should not be used afterwards
+func (p *HRServiceContext) EndService() {
+	if p.owned {
+		p.daoProvider.DaoProvider.Close()
+	}
+}
+
+// BeginTransaction - Begin the transaction shared by the services of the context
+func (p *HRServiceContext) BeginTransaction() {
+	p.daoProvider.BeginTransaction()
+}
+
+// CommitTransaction - Commit the transaction shared by the services of the context
+func (p *HRServiceContext) CommitTransaction() {
+	p.daoProvider.CommitTransaction()
+}
+
+// RollbackTransaction - Rollback the transaction shared by the services of the context
+func (p *HRServiceContext) RollbackTransaction() {
+	p.daoProvider.RollbackTransaction()
+}
+
+// getProps - Props of the services, staff scoped services are given the staff id
+func (p *HRServiceContext) getProps(staffId string) utils.Map {
+	props := utils.Map{}
+	for key, value := range p.props {
+		props[key] = value
+	}
+
+	delete(props, hr_common.FLD_STAFF_ID)
+	if staffId != "" {
+		props[hr_common.FLD_STAFF_ID] = staffId
+	}
+	return props
+}
+
+func (p *HRServiceContext) AttendanceService(staffId string) (AttendanceService, error) {
+	return NewAttendanceService(p.getProps(staffId))
+}
+
+func (p *HRServiceContext) ClientService() (ClientService, error) {
+	return NewClientService(p.getProps(""))
+}
+
+func (p *HRServiceContext) DashboardService(staffId string) (DashboardService, error) {
+	return NewDashboardService(p.getProps(staffId))
+}
+
+func (p *HRServiceContext) DepartmentService() (DepartmentService, error) {
+	return NewDepartmentService(p.getProps(""))
+}
+
+func (p *HRServiceContext) DesignationService() (DesignationService, error) {
+	return NewDesignationService(p.getProps(""))
+}
+
+func (p *HRServiceContext) FeedbackService() (FeedbackService, error) {
+	return NewFeedbackService(p.getProps(""))
+}
+
+func (p *HRServiceContext) HolidayService() (HolidayService, error) {
+	return NewHolidayService(p.getProps(""))
+}
+
+func (p *HRServiceContext) LeaveBalanceService() (LeaveBalanceService, error) {
+	return NewLeaveBalanceService(p.getProps(""))
+}
+
+func (p *HRServiceContext) LeaveService(staffId string) (LeaveService, error) {
+	return NewLeaveService(p.getProps(staffId))
+}
+
+func (p *HRServiceContext) LeaveTypeService() (LeaveTypeService, error) {
+	return NewLeaveTypeService(p.getProps(""))
+}
+
+func (p *HRServiceContext) OvertimeService() (OvertimeService, error) {
+	return NewOvertimeService(p.getProps(""))
+}
+
+func (p *HRServiceContext) PositionService() (PositionService, error) {
+	return NewPositionService(p.getProps(""))
+}
+
+func (p *HRServiceContext) PositionTypeService() (PositionTypeService, error) {
+	return NewPositionTypeService(p.getProps(""))
+}
+
+func (p *HRServiceContext) ProjectService() (ProjectService, error) {
+	return NewProjectService(p.getProps(""))
+}
+
+func (p *HRServiceContext) ReportsService(staffId string) (ReportsService, error) {
+	return NewReportsService(p.getProps(staffId))
+}
+
+func (p *HRServiceContext) RosterService() (RosterService, error) {
+	return NewRosterService(p.getProps(""))
+}
+
+func (p *HRServiceContext) ShiftProfileService() (ShiftProfileService, error) {
+	return NewShiftProfileService(p.getProps(""))
+}
+
+func (p *HRServiceContext) ShiftService() (ShiftService, error) {
+	return NewShiftService(p.getProps(""))
+}
+
+func (p *HRServiceContext) StaffCategoryService() (Staff_categoryService, error) {
+	return NewStaff_categoryService(p.getProps(""))
+}
+
+func (p *HRServiceContext) StaffService() (StaffService, error) {
+	return NewStaffService(p.getProps(""))
+}
+
+func (p *HRServiceContext) StaffTypeService() (StaffTypeService, error) {
+	return NewStaffTypeService(p.getProps(""))
+}
+
+func (p *HRServiceContext) TimesheetService() (TimesheetService, error) {
+	return NewTimesheetService(p.getProps(""))
+}
+
+func (p *HRServiceContext) VisaTypeService() (VisaTypeService, error) {
+	return NewVisaTypeService(p.getProps(""))
+}
+
+func (p *HRServiceContext) WorkLocationService() (WorkLocationService, error) {
+	return NewWorkLocationService(p.getProps(""))
+}
+
+// Close - Connections are closed by the context
+func (p *contextDaoProvider) Close() {
+}
+
+func (p *contextDaoProvider) NewBusinessDao() platform_repository.BusinessDao {
+	return &contextBusinessDao{BusinessDao: p.DaoProvider.NewBusinessDao(), provider: p}
+}
+
+// Get - Validated business of the context is returned without reading it again
+func (t *contextBusinessDao) Get(businessid string) (utils.Map, error) {
+	if businessid == t.provider.businessId && t.provider.business != nil {
+		data, _ := toMap(deepCopy(t.provider.business))
+		return data, nil
+	}
+	return t.BusinessDao.Get(businessid)
+}
@@ -0,0 +1,342 @@
+package hr_service
+
+import (
+	"context"
+	"log"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-platform-service/platform_service"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	// Props field of the DaoProvider, services open the MongoDB databases when it is not given
+	FLD_DAO_PROVIDER = "dao_provider"
+
+	// Fields of the MongoDB client the DAOs read to write through the transaction, same as the
+	// fields set by the transactions of dbutils
+	MONGO_TXN_CONTEXT         = "context"
+	MONGO_TXN_SESSION         = "session"
+	MONGO_TXN_SESSION_CONTEXT = "session_context"
+
+	// Transaction Error Codes
+	ERRCODE_TRANSACTION_STARTED     = "S30221"
+	ERRCODE_TRANSACTION_NOT_STARTED = "S30222"
+	ERRCODE_TRANSACTION_UNSUPPORTED = "S30223"
+)
+
+// DaoProvider - Database connections & the DAOs of the services
+type DaoProvider interface {
+	// Platform DAOs
+	NewBusinessDao() platform_repository.BusinessDao
+	NewAppUserDao() platform_repository.AppUserDao
+
+	// Region DAOs
+	NewAttendanceDao(businessId string, staffId string) hr_repository.AttendanceDao
+	NewClientDao(businessId string) hr_repository.ClientDao
+	NewDashboardDao(businessId string, staffId string) hr_repository.DashboardDao
+	NewDepartmentDao(businessId string) hr_repository.DepartmentDao
+	NewDesignationDao(businessId string) hr_repository.DesignationDao
+	NewFeedbackDao(businessId string) hr_repository.FeedbackDao
+	NewHolidayDao(businessId string) hr_repository.HolidayDao
+	NewLeaveDao(businessId string, staffId string) hr_repository.LeaveDao
+	NewLeaveTypeDao(businessId string) hr_repository.LeaveTypeDao
+	NewOvertimeDao(businessId string) hr_repository.OvertimeDao
+	NewPositionDao(businessId string) hr_repository.PositionDao
+	NewPositionTypeDao(businessId string) hr_repository.PositionTypeDao
+	NewProjectDao(businessId string) hr_repository.ProjectDao
+	NewReportsDao(businessId string, staffId string) hr_repository.ReportsDao
+	NewShiftDao(businessId string) hr_repository.ShiftDao
+	NewShiftProfileDao(businessId string) hr_repository.ShiftProfileDao
+	NewStaffDao(businessId string) hr_repository.StaffDao
+	NewStaffCategoryDao(businessId string, staffId string) hr_repository.Staff_categoryDao
+	NewStaffTypeDao(businessId string) hr_repository.StaffTypeDao
+	NewVisaTypeDao(businessId string) hr_repository.VisaTypeDao
+	NewWorkLocationDao(businessId string) hr_repository.WorkLocationDao
+
+	// Transaction of the Region database, the DAOs write through it until it ends
+	StartTransaction() error
+	EndTransaction(commit bool) error
+
+	// Same as StartTransaction & EndTransaction, the errors are logged
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	// Close - Close the Database connections
+	Close()
+}
+
+// mongoDaoProvider - DAOs of the Platform & Region MongoDB databases
+type mongoDaoProvider struct {
+	db_utils.DatabaseService
+	dbRegion db_utils.DatabaseService
+
+	// Copy of the Region database client, the transaction session is set only in this copy
+	// so it is not seen by the DAOs of the other providers sharing the connection
+	regionClient utils.Map
+}
+
+// sharedDaoProvider - DaoProvider owned by the caller, it is not closed by the services
+type sharedDaoProvider struct {
+	DaoProvider
+}
+
+// NewMongoDaoProvider - Open the Platform & Region databases given in the props
+func NewMongoDaoProvider(props utils.Map) (DaoProvider, error) {
+
+	log.Printf("MongoDaoProvider::Start ")
+
+	p := mongoDaoProvider{}
+
+	// Open Database Service
+	err := p.OpenDatabaseService(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open RegionDB Service
+	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	if err != nil {
+		p.CloseDatabaseService()
+		return nil, err
+	}
+	p.regionClient = utils.CopyMap(p.dbRegion.GetClient())
+
+	return &p, nil
+}
+
+// openDaoProvider - DaoProvider given in the props, otherwise the MongoDB databases are opened
+func openDaoProvider(props utils.Map) (DaoProvider, error) {
+
+	daoProvider, ok := props[FLD_DAO_PROVIDER].(DaoProvider)
+	if ok && daoProvider != nil {
+		return &sharedDaoProvider{daoProvider}, nil
+	}
+
+	return NewMongoDaoProvider(props)
+}
+
+func (p *mongoDaoProvider) Close() {
+	if _, ok := p.regionClient[MONGO_TXN_SESSION]; ok {
+		p.RollbackTransaction()
+	}
+	p.CloseDatabaseService()
+	p.dbRegion.CloseDatabaseService()
+}
+
+// StartTransaction - Start the transaction in the Region database client of the provider's DAOs.
+// The session is set in the provider's copy of the client, the transactions of dbutils set it in
+// the client shared by all the connections of the region. Only the MongoDB region database
+// supports the transactions
+func (p *mongoDaoProvider) StartTransaction() error {
+
+	log.Println("MongoDaoProvider::StartTransaction - Begin")
+
+	client := p.regionClient
+	if _, ok := client[MONGO_TXN_SESSION]; ok {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_STARTED,
+			ErrorMsg:    "Transaction In Progress",
+			ErrorDetail: "Transaction is already started in the region database of the provider"}
+		return err
+	}
+
+	if dbType, err := db_common.GetDatabaseType(client); err == nil && dbType != db_common.DATABASE_TYPE_MONGODB {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_UNSUPPORTED,
+			ErrorMsg:    "Transaction Not Supported",
+			ErrorDetail: "Transactions are supported only in the MongoDB region database"}
+		return err
+	}
+
+	connection, ok := client[db_common.DB_CONNECTION].(*mongo.Client)
+	if !ok {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_NOT_STARTED,
+			ErrorMsg:    "Connection not found",
+			ErrorDetail: "Region database is not connected to start the transaction"}
+		return err
+	}
+
+	session, err := connection.StartSession()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	txnOpts := options.Transaction().SetWriteConcern(writeconcern.Majority()).SetReadConcern(readconcern.Snapshot())
+	err = session.StartTransaction(txnOpts)
+	if err != nil {
+		session.EndSession(ctx)
+		return err
+	}
+
+	client[MONGO_TXN_CONTEXT] = ctx
+	client[MONGO_TXN_SESSION] = session
+	client[MONGO_TXN_SESSION_CONTEXT] = mongo.NewSessionContext(ctx, session)
+
+	log.Println("MongoDaoProvider::StartTransaction - End")
+	return nil
+}
+
+// EndTransaction - Commit or abort the transaction, the transaction is kept when the commit
+// result is unknown so the commit can be retried
+func (p *mongoDaoProvider) EndTransaction(commit bool) error {
+
+	log.Println("MongoDaoProvider::EndTransaction - Begin", commit)
+
+	client := p.regionClient
+	session, ok := client[MONGO_TXN_SESSION].(mongo.Session)
+	if !ok {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_NOT_STARTED,
+			ErrorMsg:    "No Transaction",
+			ErrorDetail: "Transaction is not started in the region database"}
+		return err
+	}
+	sessionContext, _ := client[MONGO_TXN_SESSION_CONTEXT].(mongo.SessionContext)
+
+	var err error
+	if commit {
+		err = session.CommitTransaction(sessionContext)
+		if hasErrorLabel(err, ERRLABEL_UNKNOWN_COMMIT_RESULT) {
+			return err
+		}
+	} else {
+		err = session.AbortTransaction(sessionContext)
+	}
+
+	session.EndSession(context.Background())
+	delete(client, MONGO_TXN_CONTEXT)
+	delete(client, MONGO_TXN_SESSION)
+	delete(client, MONGO_TXN_SESSION_CONTEXT)
+
+	log.Println("MongoDaoProvider::EndTransaction - End", err)
+	return err
+}
+
+// BeginTransaction - Transactions are of the Region database the DAOs write to
+func (p *mongoDaoProvider) BeginTransaction() {
+	err := p.StartTransaction()
+	if err != nil {
+		log.Println("MongoDaoProvider::BeginTransaction - Error", err)
+	}
+}
+
+func (p *mongoDaoProvider) CommitTransaction() {
+	err := p.EndTransaction(true)
+	if err != nil {
+		log.Println("MongoDaoProvider::CommitTransaction - Error", err)
+	}
+}
+
+func (p *mongoDaoProvider) RollbackTransaction() {
+	err := p.EndTransaction(false)
+	if err != nil {
+		log.Println("MongoDaoProvider::RollbackTransaction - Error", err)
+	}
+}
+
+func (p *mongoDaoProvider) NewBusinessDao() platform_repository.BusinessDao {
+	return platform_repository.NewBusinessDao(p.GetClient())
+}
+
+func (p *mongoDaoProvider) NewAppUserDao() platform_repository.AppUserDao {
+	return platform_repository.NewAppUserDao(p.GetClient())
+}
+
+func (p *mongoDaoProvider) NewAttendanceDao(businessId string, staffId string) hr_repository.AttendanceDao {
+	return hr_repository.NewAttendanceDao(p.regionClient, businessId, staffId)
+}
+
+func (p *mongoDaoProvider) NewClientDao(businessId string) hr_repository.ClientDao {
+	return hr_repository.NewClientDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewDashboardDao(businessId string, staffId string) hr_repository.DashboardDao {
+	return hr_repository.NewDashboardDao(p.regionClient, businessId, staffId)
+}
+
+func (p *mongoDaoProvider) NewDepartmentDao(businessId string) hr_repository.DepartmentDao {
+	return hr_repository.NewDepartmentDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewDesignationDao(businessId string) hr_repository.DesignationDao {
+	return hr_repository.NewDesignationDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewFeedbackDao(businessId string) hr_repository.FeedbackDao {
+	return hr_repository.NewFeedbackDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewHolidayDao(businessId string) hr_repository.HolidayDao {
+	return hr_repository.NewHolidayDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewLeaveDao(businessId string, staffId string) hr_repository.LeaveDao {
+	return hr_repository.NewLeaveDao(p.regionClient, businessId, staffId)
+}
+
+func (p *mongoDaoProvider) NewLeaveTypeDao(businessId string) hr_repository.LeaveTypeDao {
+	return hr_repository.NewLeaveTypeDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewOvertimeDao(businessId string) hr_repository.OvertimeDao {
+	return hr_repository.NewOvertimeDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewPositionDao(businessId string) hr_repository.PositionDao {
+	return hr_repository.NewPositionDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewPositionTypeDao(businessId string) hr_repository.PositionTypeDao {
+	return hr_repository.NewPositionTypeDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewProjectDao(businessId string) hr_repository.ProjectDao {
+	return hr_repository.NewProjectDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewReportsDao(businessId string, staffId string) hr_repository.ReportsDao {
+	return hr_repository.NewReportsDao(p.regionClient, businessId, staffId)
+}
+
+func (p *mongoDaoProvider) NewShiftDao(businessId string) hr_repository.ShiftDao {
+	return hr_repository.NewShiftDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewShiftProfileDao(businessId string) hr_repository.ShiftProfileDao {
+	return hr_repository.NewShiftProfileDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewStaffDao(businessId string) hr_repository.StaffDao {
+	return newEmploymentStaffDao(hr_repository.NewStaffDao(p.regionClient, businessId))
+}
+
+func (p *mongoDaoProvider) NewStaffCategoryDao(businessId string, staffId string) hr_repository.Staff_categoryDao {
+	return hr_repository.NewStaff_categoryeDao(p.regionClient, businessId, staffId)
+}
+
+func (p *mongoDaoProvider) NewStaffTypeDao(businessId string) hr_repository.StaffTypeDao {
+	return hr_repository.NewStaffTypeDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewVisaTypeDao(businessId string) hr_repository.VisaTypeDao {
+	return hr_repository.NewVisaTypeDao(p.regionClient, businessId)
+}
+
+func (p *mongoDaoProvider) NewWorkLocationDao(businessId string) hr_repository.WorkLocationDao {
+	return hr_repository.NewWorkLocationDao(p.regionClient, businessId)
+}
+
+// Close - Connections are closed by the owner of the provider
+func (p *sharedDaoProvider) Close() {
+}
@@ -0,0 +1,112 @@
+package hr_service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	// Prefixes of the generated unique ids
+	ID_PREFIX_ATTENDANCE       = "atten"
+	ID_PREFIX_CLIENT           = "clnt"
+	ID_PREFIX_DEPARTMENT       = "dept"
+	ID_PREFIX_DESIGNATION      = "desig"
+	ID_PREFIX_EMPLOYMENT_EVENT = "empevt"
+	ID_PREFIX_FEEDBACK         = "fedback"
+	ID_PREFIX_HOLIDAY          = "holi"
+	ID_PREFIX_LEAVE            = "leav"
+	ID_PREFIX_LEAVE_LEDGER     = "lvldg"
+	ID_PREFIX_LEAVE_TYPE       = "ltype"
+	ID_PREFIX_OVERTIME         = "ot"
+	ID_PREFIX_POSITION         = "posi"
+	ID_PREFIX_POSITION_TYPE    = "posityp"
+	ID_PREFIX_PROJECT          = "projt"
+	ID_PREFIX_SHIFT            = "shift"
+	ID_PREFIX_SHIFT_PROFILE    = "sftprof"
+	ID_PREFIX_STAFF            = "stf"
+	ID_PREFIX_STAFF_CATEGORY   = "stfcat"
+	ID_PREFIX_STAFF_TYPE       = "stftyp"
+	ID_PREFIX_VISA_TYPE        = "vity"
+	ID_PREFIX_WORK_LOCATION    = "wrkloc"
+
+	// Length limit of the ids, generated ids are the prefix, "_" and 20 characters
+	MAX_ID_LENGTH = 64
+
+	// ID Error Codes
+	ERRCODE_INVALID_ID = "S30211"
+)
+
+// getPayloadId - Normalize the id given in the payload, a new id with the prefix is generated
+// when the id is not given. The normalized id is set back into the payload
+func getPayloadId(indata utils.Map, idField string, prefix string) (string, error) {
+
+	var id string
+	dataVal, dataOk := indata[idField]
+	if !dataOk || dataVal == nil || dataVal == "" {
+		id = utils.GenerateUniqueId(prefix)
+		log.Println("Unique ID", idField, id)
+	} else {
+		strVal, ok := dataVal.(string)
+		if !ok {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_ID,
+				ErrorMsg:    "Invalid ID",
+				ErrorDetail: "Given " + idField + " should be a string"}
+			return "", err
+		}
+		id = strVal
+	}
+
+	id, err := normalizeId(idField, id)
+	if err != nil {
+		return "", err
+	}
+
+	indata[idField] = id
+	return id, nil
+}
+
+// normalizeId - Trim the id and check its length & characters. staff_id is the platform app user
+// id, its case is kept and it is checked with the document key rule of the platform. Other ids are
+// lower cased and may have letters, digits, "_" and "-" only
+func normalizeId(idField string, id string) (string, error) {
+
+	id = strings.TrimSpace(id)
+	if idField != hr_common.FLD_STAFF_ID {
+		id = strings.ToLower(id)
+	}
+	if id == "" || len(id) > MAX_ID_LENGTH {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_ID,
+			ErrorMsg:    "Invalid ID",
+			ErrorDetail: fmt.Sprintf("Given %s should have 1 to %d characters", idField, MAX_ID_LENGTH)}
+		return "", err
+	}
+
+	if idField == hr_common.FLD_STAFF_ID {
+		valid, err := utils.ValidateDocumentKey(id)
+		if err != nil || !valid {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_ID,
+				ErrorMsg:    "Invalid ID",
+				ErrorDetail: "Given " + idField + " " + id + " should start with a letter and have letters, digits, _ or - only"}
+			return "", err
+		}
+		return id, nil
+	}
+
+	for _, ch := range id {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '_' && ch != '-' {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_ID,
+				ErrorMsg:    "Invalid ID",
+				ErrorDetail: "Given " + idField + " " + id + " has invalid character " + string(ch)}
+			return "", err
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,40 @@
+package hr_service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+)
+
+func TestNormalizeId(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		idField string
+		id      string
+		result  string
+		valid   bool
+	}{
+		{"lower cased", hr_common.FLD_CLIENT_ID, " Client_A ", "client_a", true},
+		{"starts with digit", hr_common.FLD_DEPARTMENT_ID, "10-sales", "10-sales", true},
+		{"single character", hr_common.FLD_LEAVETYPE_ID, "C", "c", true},
+		{"invalid character", hr_common.FLD_SHIFT_ID, "shift.1", "", false},
+		{"too long", hr_common.FLD_PROJECT_ID, strings.Repeat("p", MAX_ID_LENGTH+1), "", false},
+		{"staff case kept", hr_common.FLD_STAFF_ID, "Staff_A", "Staff_A", true},
+		{"staff document key", hr_common.FLD_STAFF_ID, "1staff", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := normalizeId(test.idField, test.id)
+			if !test.valid {
+				assertErrorCode(t, err, ERRCODE_INVALID_ID)
+				return
+			}
+			if err != nil || result != test.result {
+				t.Errorf("Expected %s, got %s %v", test.result, result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,997 @@
+package hr_service
+
+import (
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// In-Memory Collections
+	MEMORY_COLLECTION_BUSINESSES     = "businesses"
+	MEMORY_COLLECTION_BUSINESS_USERS = "business_users"
+	MEMORY_COLLECTION_APP_USERS      = "app_users"
+	MEMORY_COLLECTION_ATTENDANCES    = "attendances"
+	MEMORY_COLLECTION_CLIENTS        = "clients"
+	MEMORY_COLLECTION_DEPARTMENTS    = "departments"
+	MEMORY_COLLECTION_DESIGNATIONS   = "designations"
+	MEMORY_COLLECTION_FEEDBACKS      = "feedbacks"
+	MEMORY_COLLECTION_HOLIDAYS       = "holidays"
+	MEMORY_COLLECTION_LEAVES         = "leaves"
+	MEMORY_COLLECTION_LEAVE_TYPES    = "leave_types"
+	MEMORY_COLLECTION_OVERTIMES      = "overtimes"
+	MEMORY_COLLECTION_POSITIONS      = "positions"
+	MEMORY_COLLECTION_POSITION_TYPES = "position_types"
+	MEMORY_COLLECTION_PROJECTS       = "projects"
+	MEMORY_COLLECTION_SHIFTS         = "shifts"
+	MEMORY_COLLECTION_SHIFT_PROFILES = "shift_profiles"
+	MEMORY_COLLECTION_STAFFS         = "staffs"
+	MEMORY_COLLECTION_STAFF_CATEGORY = "staff_categories"
+	MEMORY_COLLECTION_STAFF_TYPES    = "staff_types"
+	MEMORY_COLLECTION_VISA_TYPES     = "visa_types"
+	MEMORY_COLLECTION_WORK_LOCATIONS = "work_locations"
+)
+
+// MemoryDaoProvider - DAOs keeping the records in memory, used to unit test the services without
+// a database. Filters & sorts are the MongoDB JSON used by the services
+type MemoryDaoProvider struct {
+	mutex       sync.Mutex
+	collections map[string][]utils.Map
+	snapshot    map[string][]utils.Map
+}
+
+// memoryDao - In-Memory collection, records are scoped to the business & staff of the DAO
+type memoryDao struct {
+	provider   *MemoryDaoProvider
+	collection string
+	idField    string
+	scope      utils.Map
+}
+
+// memoryBusinessDao - In-Memory Platform Business DAO along with the business users
+type memoryBusinessDao struct {
+	memoryDao
+}
+
+// memoryAppUserDao - In-Memory Platform AppUser DAO
+type memoryAppUserDao struct {
+	memoryDao
+}
+
+// memoryReportsDao - In-Memory Reports & Dashboard DAO, aggregations are not supported and
+// the summaries list the matching attendance & leave records
+type memoryReportsDao struct {
+	provider *MemoryDaoProvider
+	scope    utils.Map
+}
+
+// In-Memory DAOs should keep up with the DAO interfaces of the repositories
+var (
+	_ DaoProvider = (*MemoryDaoProvider)(nil)
+
+	_ platform_repository.BusinessDao = (*memoryBusinessDao)(nil)
+	_ platform_repository.AppUserDao  = (*memoryAppUserDao)(nil)
+
+	_ hr_repository.AttendanceDao     = (*memoryDao)(nil)
+	_ hr_repository.ClientDao         = (*memoryDao)(nil)
+	_ hr_repository.DashboardDao      = (*memoryReportsDao)(nil)
+	_ hr_repository.DepartmentDao     = (*memoryDao)(nil)
+	_ hr_repository.DesignationDao    = (*memoryDao)(nil)
+	_ hr_repository.FeedbackDao       = (*memoryDao)(nil)
+	_ hr_repository.HolidayDao        = (*memoryDao)(nil)
+	_ hr_repository.LeaveDao          = (*memoryDao)(nil)
+	_ hr_repository.LeaveTypeDao      = (*memoryDao)(nil)
+	_ hr_repository.OvertimeDao       = (*memoryDao)(nil)
+	_ hr_repository.PositionDao       = (*memoryDao)(nil)
+	_ hr_repository.PositionTypeDao   = (*memoryDao)(nil)
+	_ hr_repository.ProjectDao        = (*memoryDao)(nil)
+	_ hr_repository.ReportsDao        = (*memoryReportsDao)(nil)
+	_ hr_repository.ShiftDao          = (*memoryDao)(nil)
+	_ hr_repository.ShiftProfileDao   = (*memoryDao)(nil)
+	_ hr_repository.StaffDao          = (*memoryDao)(nil)
+	_ hr_repository.Staff_categoryDao = (*memoryDao)(nil)
+	_ hr_repository.StaffTypeDao      = (*memoryDao)(nil)
+	_ hr_repository.VisaTypeDao       = (*memoryDao)(nil)
+	_ hr_repository.WorkLocationDao   = (*memoryDao)(nil)
+)
+
+// NewMemoryDaoProvider - Empty In-Memory DaoProvider, pass it in the props as FLD_DAO_PROVIDER
+func NewMemoryDaoProvider() *MemoryDaoProvider {
+	return &MemoryDaoProvider{collections: map[string][]utils.Map{}}
+}
+
+func (p *MemoryDaoProvider) Close() {
+}
+
+// StartTransaction - Snapshot the collections to restore on abort, changes are not isolated
+// from the other users of the provider
+func (p *MemoryDaoProvider) StartTransaction() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.snapshot != nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_STARTED,
+			ErrorMsg:    "Transaction In Progress",
+			ErrorDetail: "Transaction is already started in the memory database"}
+		return err
+	}
+
+	p.snapshot = map[string][]utils.Map{}
+	for collection, records := range p.collections {
+		for _, record := range records {
+			data, _ := toMap(deepCopy(record))
+			p.snapshot[collection] = append(p.snapshot[collection], data)
+		}
+	}
+	return nil
+}
+
+// EndTransaction - Keep the changes on commit, restore the snapshot on abort
+func (p *MemoryDaoProvider) EndTransaction(commit bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.snapshot == nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_TRANSACTION_NOT_STARTED,
+			ErrorMsg:    "No Transaction",
+			ErrorDetail: "Transaction is not started in the memory database"}
+		return err
+	}
+
+	if !commit {
+		p.collections = p.snapshot
+	}
+	p.snapshot = nil
+	return nil
+}
+
+func (p *MemoryDaoProvider) BeginTransaction() {
+	err := p.StartTransaction()
+	if err != nil {
+		log.Println("MemoryDaoProvider::BeginTransaction - Error", err)
+	}
+}
+
+func (p *MemoryDaoProvider) CommitTransaction() {
+	err := p.EndTransaction(true)
+	if err != nil {
+		log.Println("MemoryDaoProvider::CommitTransaction - Error", err)
+	}
+}
+
+func (p *MemoryDaoProvider) RollbackTransaction() {
+	err := p.EndTransaction(false)
+	if err != nil {
+		log.Println("MemoryDaoProvider::RollbackTransaction - Error", err)
+	}
+}
+
+// Seed - Insert the records into the collection as they are, e.g. Platform businesses & users
+func (p *MemoryDaoProvider) Seed(collection string, records ...utils.Map) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, record := range records {
+		data, _ := toMap(deepCopy(record))
+		if _, ok := data[db_common.FLD_IS_DELETED]; !ok {
+			data[db_common.FLD_IS_DELETED] = false
+		}
+		p.collections[collection] = append(p.collections[collection], data)
+	}
+}
+
+func (p *MemoryDaoProvider) newDao(collection string, idField string, businessId string, staffId string) memoryDao {
+	return memoryDao{provider: p, collection: collection, idField: idField, scope: getMemoryScope(businessId, staffId)}
+}
+
+func (p *MemoryDaoProvider) NewBusinessDao() platform_repository.BusinessDao {
+	return &memoryBusinessDao{p.newDao(MEMORY_COLLECTION_BUSINESSES, platform_common.FLD_BUSINESS_ID, "", "")}
+}
+
+func (p *MemoryDaoProvider) NewAppUserDao() platform_repository.AppUserDao {
+	return &memoryAppUserDao{p.newDao(MEMORY_COLLECTION_APP_USERS, platform_common.FLD_APP_USER_ID, "", "")}
+}
+
+func (p *MemoryDaoProvider) NewAttendanceDao(businessId string, staffId string) hr_repository.AttendanceDao {
+	dao := p.newDao(MEMORY_COLLECTION_ATTENDANCES, hr_common.FLD_ATTENDANCE_ID, businessId, staffId)
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewClientDao(businessId string) hr_repository.ClientDao {
+	dao := p.newDao(MEMORY_COLLECTION_CLIENTS, hr_common.FLD_CLIENT_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewDashboardDao(businessId string, staffId string) hr_repository.DashboardDao {
+	return &memoryReportsDao{provider: p, scope: getMemoryScope(businessId, staffId)}
+}
+
+func (p *MemoryDaoProvider) NewDepartmentDao(businessId string) hr_repository.DepartmentDao {
+	dao := p.newDao(MEMORY_COLLECTION_DEPARTMENTS, hr_common.FLD_DEPARTMENT_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewDesignationDao(businessId string) hr_repository.DesignationDao {
+	dao := p.newDao(MEMORY_COLLECTION_DESIGNATIONS, hr_common.FLD_DESIGNATION_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewFeedbackDao(businessId string) hr_repository.FeedbackDao {
+	dao := p.newDao(MEMORY_COLLECTION_FEEDBACKS, hr_common.FLD_FEEDBACK_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewHolidayDao(businessId string) hr_repository.HolidayDao {
+	dao := p.newDao(MEMORY_COLLECTION_HOLIDAYS, hr_common.FLD_HOLIDAY_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewLeaveDao(businessId string, staffId string) hr_repository.LeaveDao {
+	dao := p.newDao(MEMORY_COLLECTION_LEAVES, hr_common.FLD_LEAVE_ID, businessId, staffId)
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewLeaveTypeDao(businessId string) hr_repository.LeaveTypeDao {
+	dao := p.newDao(MEMORY_COLLECTION_LEAVE_TYPES, hr_common.FLD_LEAVETYPE_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewOvertimeDao(businessId string) hr_repository.OvertimeDao {
+	dao := p.newDao(MEMORY_COLLECTION_OVERTIMES, hr_common.FLD_OVERTIME_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewPositionDao(businessId string) hr_repository.PositionDao {
+	dao := p.newDao(MEMORY_COLLECTION_POSITIONS, hr_common.FLD_POSITION_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewPositionTypeDao(businessId string) hr_repository.PositionTypeDao {
+	dao := p.newDao(MEMORY_COLLECTION_POSITION_TYPES, hr_common.FLD_POSITION_TYPE_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewProjectDao(businessId string) hr_repository.ProjectDao {
+	dao := p.newDao(MEMORY_COLLECTION_PROJECTS, hr_common.FLD_PROJECT_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewReportsDao(businessId string, staffId string) hr_repository.ReportsDao {
+	return &memoryReportsDao{provider: p, scope: getMemoryScope(businessId, staffId)}
+}
+
+func (p *MemoryDaoProvider) NewShiftDao(businessId string) hr_repository.ShiftDao {
+	dao := p.newDao(MEMORY_COLLECTION_SHIFTS, hr_common.FLD_SHIFT_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewShiftProfileDao(businessId string) hr_repository.ShiftProfileDao {
+	dao := p.newDao(MEMORY_COLLECTION_SHIFT_PROFILES, hr_common.FLD_SHIFT_PROFILE_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewStaffDao(businessId string) hr_repository.StaffDao {
+	dao := p.newDao(MEMORY_COLLECTION_STAFFS, hr_common.FLD_STAFF_ID, businessId, "")
+	return newEmploymentStaffDao(&dao)
+}
+
+func (p *MemoryDaoProvider) NewStaffCategoryDao(businessId string, staffId string) hr_repository.Staff_categoryDao {
+	dao := p.newDao(MEMORY_COLLECTION_STAFF_CATEGORY, hr_common.FLD_STAFF_CATEGORY_ID, businessId, staffId)
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewStaffTypeDao(businessId string) hr_repository.StaffTypeDao {
+	dao := p.newDao(MEMORY_COLLECTION_STAFF_TYPES, hr_common.FLD_STAFFTYPE_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewVisaTypeDao(businessId string) hr_repository.VisaTypeDao {
+	dao := p.newDao(MEMORY_COLLECTION_VISA_TYPES, hr_common.FLD_VISA_TYPE_ID, businessId, "")
+	return &dao
+}
+
+func (p *MemoryDaoProvider) NewWorkLocationDao(businessId string) hr_repository.WorkLocationDao {
+	dao := p.newDao(MEMORY_COLLECTION_WORK_LOCATIONS, hr_common.FLD_WORKLOCATION_ID, businessId, "")
+	return &dao
+}
+
+// ****************************
+// In-Memory Collection
+//
+// ****************************
+func (t *memoryDao) InitializeDao(client utils.Map) {
+}
+
+func (t *memoryDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.list(t.collection, t.scope, filter, sort, skip, limit)
+}
+
+// ListNew - Same as List for the In-Memory DAO
+func (t *memoryDao) ListNew(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.list(t.collection, t.scope, filter, sort, skip, limit)
+}
+
+func (t *memoryDao) Get(id string) (utils.Map, error) {
+	return t.provider.find(t.collection, t.scope, utils.Map{t.idField: id})
+}
+
+// GetDeptCodeDetails - Codes are looked up as the ids in the In-Memory DAO
+func (t *memoryDao) GetDeptCodeDetails(code string) (utils.Map, error) {
+	return t.Get(code)
+}
+
+func (t *memoryDao) Find(filter string) (utils.Map, error) {
+	filterDoc, err := parseMemoryFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return t.provider.find(t.collection, t.scope, filterDoc)
+}
+
+func (t *memoryDao) Create(indata utils.Map) (utils.Map, error) {
+
+	indata = db_common.AmendFldsforCreate(indata)
+	for key, value := range t.scope {
+		if _, ok := indata[key]; !ok {
+			indata[key] = value
+		}
+	}
+
+	t.provider.mutex.Lock()
+	defer t.provider.mutex.Unlock()
+
+	// Document ids given by the services are unique as in MongoDB
+	if id, ok := indata[db_common.FLD_DEFAULT_ID]; ok {
+		for _, record := range t.provider.collections[t.collection] {
+			if record[db_common.FLD_DEFAULT_ID] == id {
+				err := mongo.WriteException{WriteErrors: mongo.WriteErrors{
+					{Code: 11000, Message: "duplicate key error collection: " + t.collection}}}
+				return indata, err
+			}
+		}
+	}
+
+	data, _ := toMap(deepCopy(indata))
+	t.provider.collections[t.collection] = append(t.provider.collections[t.collection], data)
+	return indata, nil
+}
+
+func (t *memoryDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	indata = db_common.AmendFldsforUpdate(indata)
+	t.provider.update(t.collection, t.scope, utils.Map{t.idField: id}, indata, false)
+	return indata, nil
+}
+
+// UpdateMany - Update all the records of the business & staff
+func (t *memoryDao) UpdateMany(indata utils.Map) (utils.Map, error) {
+	indata = db_common.AmendFldsforUpdate(indata)
+	count := t.provider.update(t.collection, t.scope, utils.Map{}, indata, true)
+	return utils.Map{"modified_count": count}, nil
+}
+
+func (t *memoryDao) Delete(id string) (int64, error) {
+	return t.provider.delete(t.collection, t.scope, utils.Map{t.idField: id}, false), nil
+}
+
+// DeleteMany - Delete all the records of the business & staff
+func (t *memoryDao) DeleteMany() (int64, error) {
+	return t.provider.delete(t.collection, t.scope, utils.Map{}, true), nil
+}
+
+// ****************************
+// In-Memory Business DAO
+//
+// ****************************
+func (t *memoryBusinessDao) AddUser(indata utils.Map) (utils.Map, error) {
+	dao := t.provider.newDao(MEMORY_COLLECTION_BUSINESS_USERS, platform_common.FLD_SYS_ACCESS_ID, "", "")
+	return dao.Create(indata)
+}
+
+func (t *memoryBusinessDao) UpdateUser(accessid string, indata utils.Map) (utils.Map, error) {
+	dao := t.provider.newDao(MEMORY_COLLECTION_BUSINESS_USERS, platform_common.FLD_SYS_ACCESS_ID, "", "")
+	return dao.Update(accessid, indata)
+}
+
+func (t *memoryBusinessDao) RemoveUser(accessid string) (string, error) {
+	dao := t.provider.newDao(MEMORY_COLLECTION_BUSINESS_USERS, platform_common.FLD_SYS_ACCESS_ID, "", "")
+	count, err := dao.Delete(accessid)
+	return strconv.FormatInt(count, 10), err
+}
+
+func (t *memoryBusinessDao) GetAccessDetails(accessid string) (utils.Map, error) {
+	dao := t.provider.newDao(MEMORY_COLLECTION_BUSINESS_USERS, platform_common.FLD_SYS_ACCESS_ID, "", "")
+	return dao.Get(accessid)
+}
+
+func (t *memoryBusinessDao) UserList(businessid string, filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	scope := utils.Map{platform_common.FLD_BUSINESS_ID: businessid}
+	return t.provider.list(MEMORY_COLLECTION_BUSINESS_USERS, scope, filter, sort, skip, limit)
+}
+
+func (t *memoryBusinessDao) BusinessList(userId string, filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.listUserBusinesses(userId, filter, sort, skip, limit)
+}
+
+// ****************************
+// In-Memory AppUser DAO
+//
+// ****************************
+func (t *memoryAppUserDao) Authenticate(auth_key string, auth_login string, auth_pwd string) (utils.Map, error) {
+	return t.provider.find(t.collection, t.scope,
+		utils.Map{auth_key: auth_login, platform_common.FLD_APP_USER_PASSWORD: auth_pwd})
+}
+
+func (t *memoryAppUserDao) BusinessUser(businessId, userId string) (utils.Map, error) {
+	return t.provider.find(MEMORY_COLLECTION_BUSINESS_USERS, utils.Map{},
+		utils.Map{platform_common.FLD_BUSINESS_ID: businessId, platform_common.FLD_APP_USER_ID: userId})
+}
+
+func (t *memoryAppUserDao) BusinessList(userId string, filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.listUserBusinesses(userId, filter, sort, skip, limit)
+}
+
+// ****************************
+// In-Memory Reports DAO
+//
+// ****************************
+func (t *memoryReportsDao) GetAttendanceSummary(filter string, aggr string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.list(MEMORY_COLLECTION_ATTENDANCES, t.scope, filter, sort, skip, limit)
+}
+
+func (t *memoryReportsDao) GetLeavePermissionSummary(filter string, aggr string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return t.provider.list(MEMORY_COLLECTION_LEAVES, t.scope, filter, sort, skip, limit)
+}
+
+// GetDashboardData - Count of the active records in the collections of the business
+func (t *memoryReportsDao) GetDashboardData() (utils.Map, error) {
+	response := utils.Map{}
+	for _, collection := range []string{MEMORY_COLLECTION_STAFFS, MEMORY_COLLECTION_ATTENDANCES, MEMORY_COLLECTION_LEAVES} {
+		data, err := t.provider.list(collection, t.scope, "", "", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		response[collection] = data[db_common.LIST_SUMMARY]
+	}
+	return response, nil
+}
+
+// ****************************
+// In-Memory Operations
+//
+// ****************************
+
+// list - List the active records matching the scope & the filter
+func (p *MemoryDaoProvider) list(collection string, scope utils.Map, filter string, sortBy string, skip int64, limit int64) (utils.Map, error) {
+
+	log.Println("MemoryDaoProvider::List - Begin", collection, filter, sortBy, skip, limit)
+
+	filterDoc, err := parseMemoryFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sortDoc := bson.D{}
+	if len(sortBy) > 0 {
+		err = bson.UnmarshalExtJSON([]byte(sortBy), false, &sortDoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	totalCount := 0
+	results := []utils.Map{}
+	for _, record := range p.collections[collection] {
+		if !matchMemoryRecord(record, scope) || record[db_common.FLD_IS_DELETED] == true {
+			continue
+		}
+		totalCount++
+
+		if matchMemoryRecord(record, filterDoc) {
+			results = append(results, record)
+		}
+	}
+	filteredCount := len(results)
+
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, sortElem := range sortDoc {
+			order := 1
+			if dir, err := getMemberDataFloat(utils.Map{sortElem.Key: sortElem.Value}, sortElem.Key); err == nil && dir < 0 {
+				order = -1
+			}
+
+			result := compareMemorySortValues(
+				getMemoryFieldValues(results[i], strings.Split(sortElem.Key, ".")),
+				getMemoryFieldValues(results[j], strings.Split(sortElem.Key, ".")))
+			if result != 0 {
+				return result*order < 0
+			}
+		}
+		return false
+	})
+
+	if skip > 0 {
+		if skip > int64(len(results)) {
+			skip = int64(len(results))
+		}
+		results = results[skip:]
+	}
+	if limit > 0 && limit < int64(len(results)) {
+		results = results[:limit]
+	}
+
+	listData := []utils.Map{}
+	for _, record := range results {
+		data, _ := toMap(deepCopy(record))
+		listData = append(listData, db_common.AmendFldsForGet(data))
+	}
+
+	response := utils.Map{
+		db_common.LIST_SUMMARY: utils.Map{
+			db_common.LIST_TOTALSIZE:    int64(totalCount),
+			db_common.LIST_FILTEREDSIZE: int64(filteredCount),
+			db_common.LIST_RESULTSIZE:   len(listData),
+		},
+		db_common.LIST_RESULT: listData,
+	}
+
+	log.Println("MemoryDaoProvider::List - End", filteredCount)
+	return response, nil
+}
+
+// find - First active record matching the scope & the filter
+func (p *MemoryDaoProvider) find(collection string, scope utils.Map, filterDoc utils.Map) (utils.Map, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, record := range p.collections[collection] {
+		if matchMemoryRecord(record, scope) && record[db_common.FLD_IS_DELETED] != true && matchMemoryRecord(record, filterDoc) {
+			data, _ := toMap(deepCopy(record))
+			return db_common.AmendFldsForGet(data), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// update - Set the fields of the first or all records matching the scope & the filter, dotted
+// fields set the fields of the sub-documents
+func (p *MemoryDaoProvider) update(collection string, scope utils.Map, filterDoc utils.Map, indata utils.Map, many bool) int64 {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	count := int64(0)
+	for _, record := range p.collections[collection] {
+		if !matchMemoryRecord(record, scope) || !matchMemoryRecord(record, filterDoc) {
+			continue
+		}
+
+		for key, value := range indata {
+			setMemoryFieldValue(record, strings.Split(key, "."), deepCopy(value))
+		}
+		count++
+
+		if !many {
+			break
+		}
+	}
+	return count
+}
+
+// delete - Remove the first or all records matching the scope & the filter
+func (p *MemoryDaoProvider) delete(collection string, scope utils.Map, filterDoc utils.Map, many bool) int64 {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	count := int64(0)
+	records := []utils.Map{}
+	for _, record := range p.collections[collection] {
+		if (many || count == 0) && matchMemoryRecord(record, scope) && matchMemoryRecord(record, filterDoc) {
+			count++
+			continue
+		}
+		records = append(records, record)
+	}
+	p.collections[collection] = records
+	return count
+}
+
+// listUserBusinesses - Businesses the user has access to
+func (p *MemoryDaoProvider) listUserBusinesses(userId string, filter string, sortBy string, skip int64, limit int64) (utils.Map, error) {
+
+	access, err := p.list(MEMORY_COLLECTION_BUSINESS_USERS, utils.Map{platform_common.FLD_APP_USER_ID: userId}, "", "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	businessIds := []interface{}{}
+	for _, item := range access[db_common.LIST_RESULT].([]utils.Map) {
+		businessIds = append(businessIds, item[platform_common.FLD_BUSINESS_ID])
+	}
+
+	scope := utils.Map{platform_common.FLD_BUSINESS_ID: utils.Map{"$in": businessIds}}
+	return p.list(MEMORY_COLLECTION_BUSINESSES, scope, filter, sortBy, skip, limit)
+}
+
+// getMemoryScope - Filter of the records belonging to the business & staff
+func getMemoryScope(businessId string, staffId string) utils.Map {
+	scope := utils.Map{}
+	if businessId != "" {
+		scope[hr_common.FLD_BUSINESS_ID] = businessId
+	}
+	if staffId != "" {
+		scope[hr_common.FLD_STAFF_ID] = staffId
+	}
+	return scope
+}
+
+// parseMemoryFilter - Parse the MongoDB Extended JSON filter
+func parseMemoryFilter(filter string) (utils.Map, error) {
+
+	filterDoc := bson.M{}
+	if len(filter) > 0 {
+		err := bson.UnmarshalExtJSON([]byte(filter), false, &filterDoc)
+		if err != nil {
+			err := &utils.AppError{ErrorStatus: 400, ErrorMsg: "Invalid Filter", ErrorDetail: err.Error()}
+			return nil, err
+		}
+	}
+	return utils.Map(filterDoc), nil
+}
+
+// matchMemoryRecord - Check the record matches the MongoDB filter document
+func matchMemoryRecord(record utils.Map, filterDoc utils.Map) bool {
+
+	for key, cond := range filterDoc {
+		switch key {
+		case "$and", "$or", "$nor":
+			subFilters, _ := toSlice(cond)
+			matched := 0
+			for _, subFilter := range subFilters {
+				subDoc, _ := toMap(subFilter)
+				if matchMemoryRecord(record, subDoc) {
+					matched++
+				}
+			}
+
+			if (key == "$and" && matched != len(subFilters)) || (key == "$or" && matched == 0) || (key == "$nor" && matched > 0) {
+				return false
+			}
+
+		default:
+			if !matchMemoryField(getMemoryFieldValues(record, strings.Split(key, ".")), cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchMemoryField - Check the values of the field match the condition, the condition is either
+// the value or the document of the query operators
+func matchMemoryField(values []interface{}, cond interface{}) bool {
+
+	operators, ok := toMap(cond)
+	if !ok || len(operators) == 0 {
+		return matchMemoryEqual(values, cond)
+	}
+	for operator := range operators {
+		if !strings.HasPrefix(operator, "$") {
+			return matchMemoryEqual(values, cond)
+		}
+	}
+
+	for operator, operand := range operators {
+		matched := false
+		switch operator {
+		case "$eq":
+			matched = matchMemoryEqual(values, operand)
+
+		case "$ne":
+			matched = !matchMemoryEqual(values, operand)
+
+		case "$in", "$nin":
+			items, _ := toSlice(operand)
+			for _, item := range items {
+				if matchMemoryEqual(values, item) {
+					matched = true
+					break
+				}
+			}
+			if operator == "$nin" {
+				matched = !matched
+			}
+
+		case "$exists":
+			matched = (len(values) > 0) == (operand == true)
+
+		case "$gt", "$gte", "$lt", "$lte":
+			for _, value := range expandMemoryValues(values) {
+				result, ok := compareMemoryValues(value, operand)
+				if ok && ((operator == "$gt" && result > 0) || (operator == "$gte" && result >= 0) ||
+					(operator == "$lt" && result < 0) || (operator == "$lte" && result <= 0)) {
+					matched = true
+					break
+				}
+			}
+
+		case "$regex":
+			pattern, _ := operand.(string)
+			if options, ok := operators["$options"].(string); ok && strings.Contains(options, "i") {
+				pattern = "(?i)" + pattern
+			}
+			if regex, ok := operand.(primitive.Regex); ok {
+				pattern = regex.Pattern
+				if strings.Contains(regex.Options, "i") {
+					pattern = "(?i)" + pattern
+				}
+			}
+
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return false
+			}
+			for _, value := range expandMemoryValues(values) {
+				if strVal, ok := value.(string); ok && re.MatchString(strVal) {
+					matched = true
+					break
+				}
+			}
+
+		case "$options":
+			matched = true
+
+		case "$elemMatch":
+			subDoc, _ := toMap(operand)
+			for _, value := range values {
+				items, _ := toSlice(value)
+				for _, item := range items {
+					itemMap, isMap := toMap(item)
+					if (isMap && matchMemoryRecord(itemMap, subDoc)) || (!isMap && matchMemoryField([]interface{}{item}, subDoc)) {
+						matched = true
+						break
+					}
+				}
+			}
+
+		case "$size":
+			size, err := getMemberDataFloat(utils.Map{operator: operand}, operator)
+			for _, value := range values {
+				if items, ok := toSlice(value); ok && err == nil && float64(len(items)) == size {
+					matched = true
+				}
+			}
+
+		default:
+			log.Println("MemoryDaoProvider:: Unsupported query operator", operator)
+		}
+
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchMemoryEqual - Check any value or any item of the array values equals to the operand,
+// null matches the missing fields
+func matchMemoryEqual(values []interface{}, operand interface{}) bool {
+
+	if operand == nil && len(values) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		if reflect.DeepEqual(deepCopy(value), deepCopy(operand)) {
+			return true
+		}
+	}
+	for _, value := range expandMemoryValues(values) {
+		if result, ok := compareMemoryValues(value, operand); ok && result == 0 {
+			return true
+		}
+		if value == nil && operand == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getMemoryFieldValues - Values of the dotted field, arrays in the path are traversed like MongoDB
+func getMemoryFieldValues(data interface{}, path []string) []interface{} {
+
+	if len(path) == 0 {
+		return []interface{}{data}
+	}
+
+	if mapVal, ok := toMap(data); ok {
+		dataVal, ok := mapVal[path[0]]
+		if !ok {
+			return nil
+		}
+		return getMemoryFieldValues(dataVal, path[1:])
+	}
+
+	if items, ok := toSlice(data); ok {
+		if index, err := strconv.Atoi(path[0]); err == nil {
+			if index >= 0 && index < len(items) {
+				return getMemoryFieldValues(items[index], path[1:])
+			}
+			return nil
+		}
+
+		values := []interface{}{}
+		for _, item := range items {
+			values = append(values, getMemoryFieldValues(item, path)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// setMemoryFieldValue - Set the value of the dotted field, missing sub-documents are created
+func setMemoryFieldValue(data utils.Map, path []string, value interface{}) {
+
+	if len(path) == 1 {
+		data[path[0]] = value
+		return
+	}
+
+	if items, ok := toSlice(data[path[0]]); ok {
+		index, err := strconv.Atoi(path[1])
+		if err != nil || index < 0 {
+			return
+		}
+		if len(path) == 2 {
+			// Same as MongoDB, index past the end appends to the array padded with nulls
+			for len(items) <= index {
+				items = append(items, nil)
+			}
+			items[index] = value
+			data[path[0]] = items
+			return
+		}
+		if index >= len(items) {
+			return
+		}
+		if itemMap, ok := toMap(items[index]); ok {
+			setMemoryFieldValue(itemMap, path[2:], value)
+		}
+		return
+	}
+
+	subDoc, ok := toMap(data[path[0]])
+	if !ok {
+		subDoc = utils.Map{}
+		data[path[0]] = subDoc
+	}
+	setMemoryFieldValue(subDoc, path[1:], value)
+}
+
+// expandMemoryValues - Values along with the items of the array values
+func expandMemoryValues(values []interface{}) []interface{} {
+
+	expanded := []interface{}{}
+	for _, value := range values {
+		expanded = append(expanded, value)
+		if items, ok := toSlice(value); ok {
+			expanded = append(expanded, items...)
+		}
+	}
+	return expanded
+}
+
+// compareMemoryValues - Compare the numbers, strings, booleans & dates, values of the
+// different types are not comparable
+func compareMemoryValues(value interface{}, operand interface{}) (int, bool) {
+
+	switch val := value.(type) {
+	case string:
+		if strOperand, ok := operand.(string); ok {
+			return strings.Compare(val, strOperand), true
+		}
+
+	case bool:
+		if boolOperand, ok := operand.(bool); ok {
+			if val == boolOperand {
+				return 0, true
+			} else if val {
+				return 1, true
+			}
+			return -1, true
+		}
+
+	case time.Time, primitive.DateTime:
+		timeVal := getMemoryTime(val)
+		switch operand.(type) {
+		case time.Time, primitive.DateTime:
+			return timeVal.Compare(getMemoryTime(operand)), true
+		}
+
+	default:
+		number, err := getMemberDataFloat(utils.Map{"value": value}, "value")
+		if err != nil {
+			return 0, false
+		}
+		if _, isStr := operand.(string); isStr {
+			return 0, false
+		}
+
+		numOperand, err := getMemberDataFloat(utils.Map{"value": operand}, "value")
+		if err != nil {
+			return 0, false
+		}
+
+		if number < numOperand {
+			return -1, true
+		} else if number > numOperand {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// compareMemorySortValues - Compare the sort field values, missing values sort first and
+// values of the different types sort by their type
+func compareMemorySortValues(values1 []interface{}, values2 []interface{}) int {
+
+	getRank := func(values []interface{}) (int, interface{}) {
+		if len(values) == 0 || values[0] == nil {
+			return 0, nil
+		}
+		switch values[0].(type) {
+		case string:
+			return 2, values[0]
+		case bool:
+			return 4, values[0]
+		case time.Time, primitive.DateTime:
+			return 5, values[0]
+		}
+		if _, err := getMemberDataFloat(utils.Map{"value": values[0]}, "value"); err == nil {
+			return 1, values[0]
+		}
+		return 3, values[0]
+	}
+
+	rank1, value1 := getRank(values1)
+	rank2, value2 := getRank(values2)
+	if rank1 != rank2 {
+		return rank1 - rank2
+	}
+
+	result, _ := compareMemoryValues(value1, value2)
+	return result
+}
+
+// getMemoryTime - Time of the date value
+func getMemoryTime(value interface{}) time.Time {
+	switch val := value.(type) {
+	case time.Time:
+		return val
+	case primitive.DateTime:
+		return val.Time()
+	}
+	return time.Time{}
+}
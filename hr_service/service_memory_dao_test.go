@@ -0,0 +1,281 @@
+package hr_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	testBusinessId      = "business_1"
+	testOtherBusinessId = "business_2"
+)
+
+// newTestProvider - In-Memory DaoProvider with the test business, along with the props of the services
+func newTestProvider() (*MemoryDaoProvider, utils.Map) {
+	provider := NewMemoryDaoProvider()
+	provider.Seed(MEMORY_COLLECTION_BUSINESSES, utils.Map{platform_common.FLD_BUSINESS_ID: testBusinessId})
+
+	props := utils.Map{
+		hr_common.FLD_BUSINESS_ID: testBusinessId,
+		FLD_DAO_PROVIDER:          provider,
+	}
+	return provider, props
+}
+
+// getResultIds - Ids of the listed records in the listed order
+func getResultIds(t *testing.T, response utils.Map, idField string) []string {
+	t.Helper()
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		t.Fatalf("List result not found: %v", response)
+	}
+
+	ids := []string{}
+	items, _ := toSlice(dataList)
+	for _, item := range items {
+		data, _ := toMap(item)
+		id, _ := utils.GetMemberDataStr(data, idField)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// assertErrorCode - Verify the error is or wraps the AppError of the code
+func assertErrorCode(t *testing.T, err error, errorCode string) {
+	t.Helper()
+
+	var appErr *utils.AppError
+	if !errors.As(err, &appErr) || appErr.ErrorCode != errorCode {
+		t.Fatalf("Expected error %s, got %v", errorCode, err)
+	}
+}
+
+func seedMemoryClients(provider *MemoryDaoProvider) {
+	provider.Seed(MEMORY_COLLECTION_CLIENTS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_CLIENT_ID: "client_a", "name": "Acme", "rank": 3,
+			"tags": []interface{}{"gold", "retail"}, "contacts": []interface{}{utils.Map{"role": "owner", "age": 50}}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_CLIENT_ID: "client_b", "name": "Bolt", "rank": 1,
+			"tags": []interface{}{"silver"}, "contacts": []interface{}{utils.Map{"role": "owner", "age": 30}, utils.Map{"role": "admin", "age": 45}}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_CLIENT_ID: "client_c", "name": "Core", "rank": 2,
+			"address": utils.Map{"city": "Chennai"}},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_CLIENT_ID: "client_d", "name": "Dash", "rank": 4,
+			db_common.FLD_IS_DELETED: true},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testOtherBusinessId, hr_common.FLD_CLIENT_ID: "client_e", "name": "Edge", "rank": 5},
+	)
+}
+
+func TestMemoryDaoList(t *testing.T) {
+
+	provider, _ := newTestProvider()
+	seedMemoryClients(provider)
+	daoClient := provider.NewClientDao(testBusinessId)
+
+	tests := []struct {
+		name   string
+		filter string
+		sort   string
+		skip   int64
+		limit  int64
+		ids    []string
+	}{
+		{"all of the business", "", "", 0, 0, []string{"client_a", "client_b", "client_c"}},
+		{"equal", `{"name":"Bolt"}`, "", 0, 0, []string{"client_b"}},
+		{"number range", `{"rank":{"$gte":2,"$lt":4}}`, "", 0, 0, []string{"client_a", "client_c"}},
+		{"sort ascending", "", `{"rank":1}`, 0, 0, []string{"client_b", "client_c", "client_a"}},
+		{"sort descending", "", `{"rank":-1}`, 0, 0, []string{"client_a", "client_c", "client_b"}},
+		{"skip & limit", "", `{"rank":1}`, 1, 1, []string{"client_c"}},
+		{"skip beyond", "", "", 5, 0, []string{}},
+		{"or", `{"$or":[{"name":"Acme"},{"rank":2}]}`, `{"name":1}`, 0, 0, []string{"client_a", "client_c"}},
+		{"in", `{"name":{"$in":["Core","Bolt","Edge"]}}`, `{"name":1}`, 0, 0, []string{"client_b", "client_c"}},
+		{"nin", `{"name":{"$nin":["Core","Bolt"]}}`, "", 0, 0, []string{"client_a"}},
+		{"array item", `{"tags":"gold"}`, "", 0, 0, []string{"client_a"}},
+		{"elemMatch", `{"contacts":{"$elemMatch":{"role":"owner","age":{"$lt":40}}}}`, "", 0, 0, []string{"client_b"}},
+		{"elemMatch across items", `{"contacts":{"$elemMatch":{"role":"admin","age":50}}}`, "", 0, 0, []string{}},
+		{"dotted field", `{"address.city":"Chennai"}`, "", 0, 0, []string{"client_c"}},
+		{"array dotted field", `{"contacts.age":{"$gt":40}}`, `{"name":1}`, 0, 0, []string{"client_a", "client_b"}},
+		{"not equal null", `{"address":{"$ne":null}}`, "", 0, 0, []string{"client_c"}},
+		{"exists", `{"tags":{"$exists":false}}`, "", 0, 0, []string{"client_c"}},
+		{"regex", `{"name":{"$regex":"^[ab]","$options":"i"}}`, `{"name":1}`, 0, 0, []string{"client_a", "client_b"}},
+		{"size", `{"tags":{"$size":2}}`, "", 0, 0, []string{"client_a"}},
+		{"deleted records", `{"name":"Dash"}`, "", 0, 0, []string{}},
+		{"other business", `{"name":"Edge"}`, "", 0, 0, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := daoClient.List(test.filter, test.sort, test.skip, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := getResultIds(t, response, hr_common.FLD_CLIENT_ID)
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("Expected %v, got %v", test.ids, ids)
+			}
+		})
+	}
+}
+
+func TestMemoryDaoListSummary(t *testing.T) {
+
+	provider, _ := newTestProvider()
+	seedMemoryClients(provider)
+
+	response, err := provider.NewClientDao(testBusinessId).List(`{"rank":{"$gt":1}}`, "", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, _ := toMap(response[db_common.LIST_SUMMARY])
+	expected := utils.Map{
+		db_common.LIST_TOTALSIZE:    int64(3),
+		db_common.LIST_FILTEREDSIZE: int64(2),
+		db_common.LIST_RESULTSIZE:   1,
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %v, got %v", expected, summary)
+	}
+}
+
+func TestMemoryDaoScope(t *testing.T) {
+
+	provider, _ := newTestProvider()
+	seedMemoryClients(provider)
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1", hr_common.FLD_LEAVE_ID: "leave_1"},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2", hr_common.FLD_LEAVE_ID: "leave_2"},
+	)
+
+	// Records of the other business aren't seen by Get, Update & Delete
+	daoClient := provider.NewClientDao(testBusinessId)
+	_, err := daoClient.Get("client_e")
+	if err == nil {
+		t.Error("Client of the other business should not be found")
+	}
+
+	_, err = daoClient.Update("client_e", utils.Map{"name": "Changed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := provider.NewClientDao(testOtherBusinessId).Get("client_e")
+	if err != nil || data["name"] != "Edge" {
+		t.Errorf("Client of the other business should not be updated, got %v %v", data, err)
+	}
+
+	count, _ := daoClient.DeleteMany()
+	if count != 4 {
+		t.Errorf("Expected 4 clients deleted, got %d", count)
+	}
+	_, err = provider.NewClientDao(testOtherBusinessId).Get("client_e")
+	if err != nil {
+		t.Error("Client of the other business should not be deleted")
+	}
+
+	// Staff scoped DAO lists the records of the staff, the business scoped DAO lists all
+	response, err := provider.NewLeaveDao(testBusinessId, "staff_1").List("", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := getResultIds(t, response, hr_common.FLD_LEAVE_ID); !reflect.DeepEqual(ids, []string{"leave_1"}) {
+		t.Errorf("Expected the leave of the staff, got %v", ids)
+	}
+
+	response, err = provider.NewLeaveDao(testBusinessId, "").List("", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := getResultIds(t, response, hr_common.FLD_LEAVE_ID); len(ids) != 2 {
+		t.Errorf("Expected the leaves of the business, got %v", ids)
+	}
+
+	// Created records are given the scope
+	created, err := provider.NewLeaveDao(testBusinessId, "staff_2").Create(utils.Map{hr_common.FLD_LEAVE_ID: "leave_3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created[hr_common.FLD_BUSINESS_ID] != testBusinessId || created[hr_common.FLD_STAFF_ID] != "staff_2" {
+		t.Errorf("Created leave should have the scope, got %v", created)
+	}
+}
+
+func TestMatchMemoryRecord(t *testing.T) {
+
+	record := utils.Map{
+		"name":   "Acme",
+		"rank":   int64(3),
+		"active": true,
+		"empty":  nil,
+		"items":  []interface{}{utils.Map{"code": "x", "qty": 2}, utils.Map{"code": "y", "qty": 5}},
+	}
+
+	tests := []struct {
+		name    string
+		filter  utils.Map
+		matched bool
+	}{
+		{"empty filter", utils.Map{}, true},
+		{"number types", utils.Map{"rank": int32(3)}, true},
+		{"float number", utils.Map{"rank": utils.Map{"$lte": 3.5}}, true},
+		{"string not number", utils.Map{"rank": "3"}, false},
+		{"bool", utils.Map{"active": true}, true},
+		{"null matches missing", utils.Map{"missing": nil}, true},
+		{"null matches null", utils.Map{"empty": nil}, true},
+		{"not null excludes null", utils.Map{"empty": utils.Map{"$ne": nil}}, false},
+		{"not null excludes missing", utils.Map{"missing": utils.Map{"$ne": nil}}, false},
+		{"exists with null", utils.Map{"empty": utils.Map{"$exists": true}}, true},
+		{"and", utils.Map{"$and": []interface{}{utils.Map{"name": "Acme"}, utils.Map{"rank": 4}}}, false},
+		{"or", utils.Map{"$or": []interface{}{utils.Map{"name": "Bolt"}, utils.Map{"rank": 3}}}, true},
+		{"nor", utils.Map{"$nor": []interface{}{utils.Map{"name": "Bolt"}, utils.Map{"rank": 3}}}, false},
+		{"in with null", utils.Map{"missing": utils.Map{"$in": []interface{}{nil, ""}}}, true},
+		{"elemMatch", utils.Map{"items": utils.Map{"$elemMatch": utils.Map{"code": "y", "qty": utils.Map{"$gt": 4}}}}, true},
+		{"elemMatch same item", utils.Map{"items": utils.Map{"$elemMatch": utils.Map{"code": "x", "qty": 5}}}, false},
+		{"array index", utils.Map{"items.1.code": "y"}, true},
+		{"unsupported operator", utils.Map{"name": utils.Map{"$where": "true"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matched := matchMemoryRecord(record, test.filter); matched != test.matched {
+				t.Errorf("Expected %v for %v", test.matched, test.filter)
+			}
+		})
+	}
+}
+
+func TestMemoryDaoTransaction(t *testing.T) {
+
+	provider, _ := newTestProvider()
+	seedMemoryClients(provider)
+	daoClient := provider.NewClientDao(testBusinessId)
+
+	err := provider.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertErrorCode(t, provider.StartTransaction(), ERRCODE_TRANSACTION_STARTED)
+
+	daoClient.Update("client_a", utils.Map{"name": "Changed"})
+	daoClient.Delete("client_b")
+
+	err = provider.EndTransaction(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertErrorCode(t, provider.EndTransaction(false), ERRCODE_TRANSACTION_NOT_STARTED)
+
+	data, err := daoClient.Get("client_a")
+	if err != nil || data["name"] != "Acme" {
+		t.Errorf("Update should be rolled back, got %v %v", data, err)
+	}
+	_, err = daoClient.Get("client_b")
+	if err != nil {
+		t.Error("Delete should be rolled back")
+	}
+}
@@ -0,0 +1,414 @@
+package hr_service
+
+// Typed payloads of the services, the Map payloads of Create & Update are validated against these
+// structs. Optional numbers & booleans are pointers to tell the missing value from zero value
+
+// Staff - Staff record payload
+type Staff struct {
+	StaffId           string             `json:"staff_id,omitempty"`
+	StaffData         *StaffData         `json:"staff_data,omitempty"`
+	EmploymentHistory []EmploymentEvent  `json:"employment_history,omitempty"`
+	Roster            []RosterAssignment `json:"roster,omitempty"`
+	LeaveLedger       []LeaveLedgerEntry `json:"leave_ledger,omitempty"`
+}
+
+// StaffData - Staff details kept in staff_data of the Staff record
+type StaffData struct {
+	DepartmentId       string `json:"department_id,omitempty"`
+	DesignationId      string `json:"designation_id,omitempty"`
+	PositionId         string `json:"position_id,omitempty"`
+	PositionTypeId     string `json:"position_type_id,omitempty"`
+	WorklocationId     string `json:"worklocation_id,omitempty"`
+	ReportingStaffId   string `json:"reporting_staff_id,omitempty"`
+	StafftypeId        string `json:"stafftype_id,omitempty"`
+	StaffCategoryId    string `json:"staff_category_id,omitempty"`
+	VisaTypeId         string `json:"visa_type_id,omitempty"`
+	ShiftId            string `json:"shift_id,omitempty"`
+	ShiftProfileId     string `json:"shift_profile_id,omitempty"`
+	DateOfJoin         string `json:"date_of_join,omitempty" validate:"format=date"`
+	DateOfConfirmation string `json:"date_of_confirmation,omitempty" validate:"format=date"`
+	DateOfExit         string `json:"date_of_exit,omitempty" validate:"format=date"`
+	ExitType           string `json:"exit_type,omitempty" validate:"enum=resign|terminate"`
+	EmploymentStatus   string `json:"employment_status,omitempty" validate:"enum=probation|confirmed|resigned|terminated"`
+	Gender             string `json:"gender,omitempty"`
+	DateOfBirth        string `json:"date_of_birth,omitempty" validate:"format=date"`
+}
+
+// EmploymentEvent - Employment History event payload
+type EmploymentEvent struct {
+	EventId       string             `json:"event_id,omitempty"`
+	EventType     string             `json:"event_type" validate:"required,enum=join|confirm|transfer|promote|resign|terminate|rehire"`
+	EffectiveDate string             `json:"effective_date,omitempty" validate:"format=date"`
+	Changes       *EmploymentChanges `json:"changes,omitempty"`
+	Remarks       string             `json:"remarks,omitempty"`
+}
+
+// EmploymentChanges - Employment fields changed by the event
+type EmploymentChanges struct {
+	DepartmentId     string `json:"department_id,omitempty"`
+	DesignationId    string `json:"designation_id,omitempty"`
+	PositionId       string `json:"position_id,omitempty"`
+	PositionTypeId   string `json:"position_type_id,omitempty"`
+	WorklocationId   string `json:"worklocation_id,omitempty"`
+	ReportingStaffId string `json:"reporting_staff_id,omitempty"`
+	StafftypeId      string `json:"stafftype_id,omitempty"`
+	StaffCategoryId  string `json:"staff_category_id,omitempty"`
+}
+
+// RosterAssignment - Roster entry of the Staff record
+type RosterAssignment struct {
+	Date           string `json:"date" validate:"required,format=date"`
+	ShiftId        string `json:"shift_id,omitempty"`
+	ShiftProfileId string `json:"shift_profile_id,omitempty"`
+	IsWeekOff      *bool  `json:"is_week_off,omitempty"`
+	SwappedWith    string `json:"swapped_with,omitempty"`
+}
+
+// LeaveLedgerEntry - Leave Ledger entry of the Staff record
+type LeaveLedgerEntry struct {
+	LedgerId    string   `json:"ledger_id,omitempty"`
+	LeavetypeId string   `json:"leavetype_id" validate:"required"`
+	EntryType   string   `json:"entry_type" validate:"required,enum=opening|accrual|consumption|carry_forward|encashment|adjustment"`
+	EntryDate   string   `json:"entry_date,omitempty" validate:"format=date"`
+	Days        *float64 `json:"days,omitempty"`
+	ReferenceId string   `json:"reference_id,omitempty"`
+	Remarks     string   `json:"remarks,omitempty"`
+}
+
+// Leave - Leave record payload
+type Leave struct {
+	LeaveId       string              `json:"leave_id,omitempty"`
+	StaffId       string              `json:"staff_id,omitempty"`
+	LeavetypeId   string              `json:"leavetype_id" validate:"required"`
+	LeaveFrom     string              `json:"leave_from" validate:"required,format=datetime"`
+	LeaveTo       string              `json:"leave_to,omitempty" validate:"format=datetime"`
+	IsHalfDay     *bool               `json:"is_half_day,omitempty"`
+	FromHalfDay   *bool               `json:"from_half_day,omitempty"`
+	ToHalfDay     *bool               `json:"to_half_day,omitempty"`
+	IsPermission  *bool               `json:"is_permission,omitempty"`
+	LeaveDays     *float64            `json:"leave_days,omitempty"`
+	LeaveHours    *float64            `json:"leave_hours,omitempty"`
+	LeaveStatus   string              `json:"leave_status,omitempty" validate:"enum=draft|submitted|approved|rejected|cancelled"`
+	Approvers     []LeaveApprover     `json:"approvers,omitempty"`
+	ApprovalLevel *int                `json:"approval_level,omitempty" validate:"min=0"`
+	LeaveHistory  []LeaveHistoryEntry `json:"leave_history,omitempty"`
+	Comments      string              `json:"comments,omitempty"`
+}
+
+// LeaveApprover - Approver of the Leave at the level of the reporting hierarchy
+type LeaveApprover struct {
+	StaffId        string      `json:"staff_id" validate:"required"`
+	ApprovalLevel  *int        `json:"approval_level,omitempty" validate:"min=1"`
+	ApprovalStatus string      `json:"approval_status,omitempty" validate:"enum=submitted|approved|rejected"`
+	ActionAt       interface{} `json:"action_at,omitempty"`
+}
+
+// LeaveHistoryEntry - Workflow action recorded in the Leave History
+type LeaveHistoryEntry struct {
+	Action     string      `json:"action" validate:"required"`
+	ActionBy   string      `json:"action_by,omitempty"`
+	ActionAt   interface{} `json:"action_at,omitempty"`
+	Comments   string      `json:"comments,omitempty"`
+	FromStatus string      `json:"from_status,omitempty"`
+	ToStatus   string      `json:"to_status,omitempty"`
+}
+
+// LeaveType - Leave Type record payload
+type LeaveType struct {
+	LeavetypeId     string   `json:"leavetype_id,omitempty"`
+	EntitlementDays *float64 `json:"entitlement_days,omitempty" validate:"min=0"`
+	AccrualType     string   `json:"accrual_type,omitempty" validate:"enum=yearly|monthly"`
+	IsProRata       *bool    `json:"is_pro_rata,omitempty"`
+	CarryForwardCap *float64 `json:"carry_forward_cap,omitempty" validate:"min=0"`
+	ApprovalLevels  *int     `json:"approval_levels,omitempty" validate:"min=0"`
+}
+
+// Shift - Shift record payload
+type Shift struct {
+	ShiftId          string   `json:"shift_id,omitempty"`
+	ShiftFrom        string   `json:"shift_from" validate:"required,format=time"`
+	ShiftTo          string   `json:"shift_to,omitempty" validate:"required_without=duration_mins,format=time"`
+	BreakFrom        string   `json:"break_from,omitempty" validate:"format=time"`
+	BreakTo          string   `json:"break_to,omitempty" validate:"format=time"`
+	LateGraceMins    *float64 `json:"late_grace_mins,omitempty" validate:"min=0"`
+	EarlyGraceMins   *float64 `json:"early_grace_mins,omitempty" validate:"min=0"`
+	ShiftToDayOffset *int     `json:"shift_to_day_offset,omitempty" validate:"enum=0|1"`
+	DurationMins     *float64 `json:"duration_mins,omitempty" validate:"min=30,max=1440"`
+}
+
+// ShiftProfile - Shift Profile record payload
+type ShiftProfile struct {
+	ShiftProfileId string        `json:"shift_profile_id,omitempty"`
+	ShiftId        interface{}   `json:"shift_id,omitempty"`
+	WeekOffs       []interface{} `json:"week_offs,omitempty"`
+	Rotation       []string      `json:"rotation,omitempty"`
+	RotationDays   *int          `json:"rotation_days,omitempty" validate:"min=1"`
+	RotationStart  string        `json:"rotation_start,omitempty" validate:"format=date"`
+}
+
+// Holiday - Holiday record payload
+type Holiday struct {
+	HolidayId       string             `json:"holiday_id,omitempty"`
+	HolidayDate     string             `json:"holiday_date,omitempty" validate:"format=date"`
+	HolidayName     string             `json:"holiday_name,omitempty"`
+	HolidayDesc     string             `json:"holiday_desc,omitempty"`
+	IcsUid          string             `json:"ics_uid,omitempty"`
+	WorklocationIds []string           `json:"worklocation_ids,omitempty"`
+	DepartmentIds   []string           `json:"department_ids,omitempty"`
+	Recurrence      *HolidayRecurrence `json:"recurrence,omitempty"`
+}
+
+// HolidayRecurrence - Recurrence of the Holiday
+type HolidayRecurrence struct {
+	Type    string      `json:"type" validate:"required,enum=annual|nth_weekday"`
+	Month   *int        `json:"month,omitempty" validate:"min=1,max=12"`
+	Day     *int        `json:"day,omitempty" validate:"min=1,max=31"`
+	Week    *int        `json:"week,omitempty" validate:"enum=1|2|3|4|5|-1"`
+	Weekday interface{} `json:"weekday,omitempty"`
+}
+
+// Attendance - Attendance record payload
+type Attendance struct {
+	AttendanceId     string           `json:"attendance_id,omitempty"`
+	StaffId          string           `json:"staff_id,omitempty"`
+	ClockIn          *AttendancePunch `json:"clock_in,omitempty"`
+	ClockOut         *AttendancePunch `json:"clock_out,omitempty"`
+	ShiftDate        string           `json:"shift_date,omitempty" validate:"format=date"`
+	AttendanceStatus string           `json:"attendance_status,omitempty" validate:"enum=open|closed|auto_closed"`
+	WorkedHours      *float64         `json:"worked_hours,omitempty" validate:"min=0"`
+	BreakHours       *float64         `json:"break_hours,omitempty" validate:"min=0"`
+	NetHours         *float64         `json:"net_hours,omitempty" validate:"min=0"`
+}
+
+// AttendancePunch - Clock-In/Clock-Out details of the Attendance
+type AttendancePunch struct {
+	DateTime          string   `json:"date_time,omitempty" validate:"format=datetime"`
+	Latitude          *float64 `json:"latitude,omitempty" validate:"min=-90,max=90"`
+	Longitude         *float64 `json:"longitude,omitempty" validate:"min=-180,max=180"`
+	IsOutsideGeofence *bool    `json:"is_outside_geofence,omitempty"`
+}
+
+// Overtime - Overtime record payload
+type Overtime struct {
+	OvertimeId    string   `json:"overtime_id,omitempty"`
+	StaffId       string   `json:"staff_id,omitempty"`
+	Date          string   `json:"date,omitempty" validate:"format=date"`
+	DayType       string   `json:"day_type,omitempty" validate:"enum=weekday|weekend|holiday|night"`
+	OvertimeHours *float64 `json:"overtime_hours,omitempty" validate:"min=0"`
+	PayableHours  *float64 `json:"overtime_payable_hours,omitempty" validate:"min=0"`
+	AttendanceIds []string `json:"attendance_ids,omitempty"`
+}
+
+// WorkLocation - Work Location record payload
+type WorkLocation struct {
+	WorklocationId  string        `json:"worklocation_id,omitempty"`
+	Latitude        *float64      `json:"latitude,omitempty" validate:"min=-90,max=90"`
+	Longitude       *float64      `json:"longitude,omitempty" validate:"min=-180,max=180"`
+	GeofenceRadius  *float64      `json:"geofence_radius,omitempty" validate:"min=0"`
+	GeofencePolygon []interface{} `json:"geofence_polygon,omitempty" validate:"min=3"`
+}
+
+// Department - Department record payload
+type Department struct {
+	DepartmentId       string `json:"department_id,omitempty"`
+	DepartmentName     string `json:"department_name,omitempty"`
+	DepartmentDesc     string `json:"department_desc,omitempty"`
+	DepartmentCode     string `json:"department_code,omitempty"`
+	ParentDepartmentId string `json:"parent_department_id,omitempty"`
+	HeadStaffId        string `json:"head_staff_id,omitempty"`
+	CostCentreCode     string `json:"cost_centre_code,omitempty"`
+}
+
+// Designation - Designation record payload
+type Designation struct {
+	DesignationId   string `json:"designation_id,omitempty"`
+	DesignationName string `json:"designation_name,omitempty"`
+	DesignationDesc string `json:"designation_desc,omitempty"`
+}
+
+// Position - Position record payload
+type Position struct {
+	PositionId     string `json:"position_id,omitempty"`
+	PositionName   string `json:"position_name,omitempty"`
+	PositionDesc   string `json:"position_desc,omitempty"`
+	PositionTypeId string `json:"position_type_id,omitempty"`
+}
+
+// PositionType - Position Type record payload
+type PositionType struct {
+	PositionTypeId   string `json:"position_type_id,omitempty"`
+	PositionTypeName string `json:"position_type_name,omitempty"`
+	PositionTypeDesc string `json:"position_type_desc,omitempty"`
+}
+
+// StaffType - Staff Type record payload
+type StaffType struct {
+	StafftypeId   string `json:"stafftype_id,omitempty"`
+	StaffTypeName string `json:"stafftype_name,omitempty"`
+	StaffTypeDesc string `json:"stafftype_desc,omitempty"`
+}
+
+// StaffCategory - Staff Category record payload
+type StaffCategory struct {
+	StaffCategoryId   string `json:"staff_category_id,omitempty"`
+	StaffCategoryName string `json:"staff_category_name,omitempty"`
+	StaffCategoryDesc string `json:"staff_category_desc,omitempty"`
+}
+
+// VisaType - Visa Type record payload
+type VisaType struct {
+	VisaTypeId   string `json:"visa_type_id,omitempty"`
+	VisaTypeName string `json:"visa_type_name,omitempty"`
+	VisaTypeDesc string `json:"visa_type_desc,omitempty"`
+}
+
+// Client - Client record payload
+type Client struct {
+	ClientId   string `json:"client_id,omitempty"`
+	ClientName string `json:"client_name,omitempty"`
+	ClientDesc string `json:"client_desc,omitempty"`
+}
+
+// Project - Project record payload
+type Project struct {
+	ProjectId   string `json:"project_id,omitempty"`
+	ProjectName string `json:"project_name,omitempty"`
+	ProjectDesc string `json:"project_desc,omitempty"`
+	ClientId    string `json:"client_id,omitempty"`
+}
+
+// Feedback - Feedback record payload
+type Feedback struct {
+	FeedbackId string `json:"feedback_id,omitempty"`
+	StaffId    string `json:"staff_id,omitempty"`
+}
+
+// Record - Fields maintained by the services & the database in the records returned
+type Record struct {
+	BusinessId string      `json:"business_id,omitempty"`
+	IsDeleted  *bool       `json:"is_deleted,omitempty"`
+	CreatedAt  interface{} `json:"created_at,omitempty"`
+	UpdatedAt  interface{} `json:"updated_at,omitempty"`
+}
+
+// ListResponse - Response of the List methods with the records of the typed response struct
+type ListResponse[T any] struct {
+	TotalSize    *int64 `json:"totalsize,omitempty"`
+	FilteredSize *int64 `json:"filteredsize,omitempty"`
+	ResultSize   *int64 `json:"resultsize,omitempty"`
+	Result       []T    `json:"result"`
+}
+
+// StaffRecord - Staff record returned by the services
+type StaffRecord struct {
+	Staff
+	Record
+}
+
+// LeaveRecord - Leave record returned by the services
+type LeaveRecord struct {
+	Leave
+	Record
+}
+
+// LeaveTypeRecord - Leave Type record returned by the services
+type LeaveTypeRecord struct {
+	LeaveType
+	Record
+}
+
+// ShiftRecord - Shift record returned by the services
+type ShiftRecord struct {
+	Shift
+	Record
+}
+
+// ShiftProfileRecord - Shift Profile record returned by the services
+type ShiftProfileRecord struct {
+	ShiftProfile
+	Record
+}
+
+// HolidayRecord - Holiday record returned by the services
+type HolidayRecord struct {
+	Holiday
+	Record
+}
+
+// AttendanceRecord - Attendance record returned by the services
+type AttendanceRecord struct {
+	Attendance
+	Record
+}
+
+// OvertimeRecord - Overtime record returned by the services
+type OvertimeRecord struct {
+	Overtime
+	Record
+}
+
+// WorkLocationRecord - Work Location record returned by the services
+type WorkLocationRecord struct {
+	WorkLocation
+	Record
+}
+
+// DepartmentRecord - Department record returned by the services
+type DepartmentRecord struct {
+	Department
+	Record
+}
+
+// DesignationRecord - Designation record returned by the services
+type DesignationRecord struct {
+	Designation
+	Record
+}
+
+// PositionRecord - Position record returned by the services
+type PositionRecord struct {
+	Position
+	Record
+}
+
+// PositionTypeRecord - Position Type record returned by the services
+type PositionTypeRecord struct {
+	PositionType
+	Record
+}
+
+// StaffTypeRecord - Staff Type record returned by the services
+type StaffTypeRecord struct {
+	StaffType
+	Record
+}
+
+// StaffCategoryRecord - Staff Category record returned by the services
+type StaffCategoryRecord struct {
+	StaffCategory
+	Record
+}
+
+// VisaTypeRecord - Visa Type record returned by the services
+type VisaTypeRecord struct {
+	VisaType
+	Record
+}
+
+// ClientRecord - Client record returned by the services
+type ClientRecord struct {
+	Client
+	Record
+}
+
+// ProjectRecord - Project record returned by the services
+type ProjectRecord struct {
+	Project
+	Record
+}
+
+// FeedbackRecord - Feedback record returned by the services
+type FeedbackRecord struct {
+	Feedback
+	Record
+}
@@ -0,0 +1,334 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Struct tags can't refer the constants, the field names of the services are verified here
+func TestPayloadFieldNames(t *testing.T) {
+
+	tests := []struct {
+		payload interface{}
+		field   string
+		name    string
+	}{
+		{Staff{}, "StaffId", hr_common.FLD_STAFF_ID},
+		{Staff{}, "StaffData", hr_common.FLD_STAFF_DATA},
+		{Staff{}, "EmploymentHistory", FLD_EMPLOYMENT_HISTORY},
+		{Staff{}, "Roster", FLD_ROSTER},
+		{Staff{}, "LeaveLedger", FLD_LEAVE_LEDGER},
+
+		{StaffData{}, "DepartmentId", hr_common.FLD_DEPARTMENT_ID},
+		{StaffData{}, "DesignationId", hr_common.FLD_DESIGNATION_ID},
+		{StaffData{}, "PositionId", hr_common.FLD_POSITION_ID},
+		{StaffData{}, "PositionTypeId", hr_common.FLD_POSITION_TYPE_ID},
+		{StaffData{}, "WorklocationId", hr_common.FLD_WORKLOCATION_ID},
+		{StaffData{}, "ReportingStaffId", hr_common.FLD_REPORTING_STAFF_ID},
+		{StaffData{}, "StafftypeId", hr_common.FLD_STAFFTYPE_ID},
+		{StaffData{}, "StaffCategoryId", hr_common.FLD_STAFF_CATEGORY_ID},
+		{StaffData{}, "VisaTypeId", hr_common.FLD_VISA_TYPE_ID},
+		{StaffData{}, "ShiftId", hr_common.FLD_SHIFT_ID},
+		{StaffData{}, "ShiftProfileId", hr_common.FLD_SHIFT_PROFILE_ID},
+		{StaffData{}, "DateOfJoin", FLD_STAFF_DATE_OF_JOIN},
+		{StaffData{}, "DateOfConfirmation", FLD_STAFF_DATE_OF_CONFIRMATION},
+		{StaffData{}, "DateOfExit", FLD_STAFF_DATE_OF_EXIT},
+		{StaffData{}, "ExitType", FLD_STAFF_EXIT_TYPE},
+		{StaffData{}, "EmploymentStatus", FLD_EMPLOYMENT_STATUS},
+		{StaffData{}, "Gender", FLD_STAFF_GENDER},
+		{StaffData{}, "DateOfBirth", FLD_STAFF_DATE_OF_BIRTH},
+
+		{EmploymentEvent{}, "EventId", FLD_EMPLOYMENT_EVENT_ID},
+		{EmploymentEvent{}, "EventType", FLD_EMPLOYMENT_EVENT_TYPE},
+		{EmploymentEvent{}, "EffectiveDate", FLD_EMPLOYMENT_EFFECTIVE_DATE},
+		{EmploymentEvent{}, "Changes", FLD_EMPLOYMENT_CHANGES},
+		{EmploymentEvent{}, "Remarks", FLD_EMPLOYMENT_REMARKS},
+
+		{EmploymentChanges{}, "DepartmentId", hr_common.FLD_DEPARTMENT_ID},
+		{EmploymentChanges{}, "DesignationId", hr_common.FLD_DESIGNATION_ID},
+		{EmploymentChanges{}, "PositionId", hr_common.FLD_POSITION_ID},
+		{EmploymentChanges{}, "PositionTypeId", hr_common.FLD_POSITION_TYPE_ID},
+		{EmploymentChanges{}, "WorklocationId", hr_common.FLD_WORKLOCATION_ID},
+		{EmploymentChanges{}, "ReportingStaffId", hr_common.FLD_REPORTING_STAFF_ID},
+		{EmploymentChanges{}, "StafftypeId", hr_common.FLD_STAFFTYPE_ID},
+		{EmploymentChanges{}, "StaffCategoryId", hr_common.FLD_STAFF_CATEGORY_ID},
+
+		{RosterAssignment{}, "Date", FLD_ROSTER_DATE},
+		{RosterAssignment{}, "ShiftId", hr_common.FLD_SHIFT_ID},
+		{RosterAssignment{}, "ShiftProfileId", hr_common.FLD_SHIFT_PROFILE_ID},
+		{RosterAssignment{}, "IsWeekOff", FLD_ROSTER_IS_WEEK_OFF},
+		{RosterAssignment{}, "SwappedWith", FLD_ROSTER_SWAPPED_WITH},
+
+		{LeaveLedgerEntry{}, "LedgerId", FLD_LEDGER_ID},
+		{LeaveLedgerEntry{}, "LeavetypeId", hr_common.FLD_LEAVETYPE_ID},
+		{LeaveLedgerEntry{}, "EntryType", FLD_LEDGER_ENTRY_TYPE},
+		{LeaveLedgerEntry{}, "EntryDate", FLD_LEDGER_ENTRY_DATE},
+		{LeaveLedgerEntry{}, "Days", FLD_LEDGER_DAYS},
+		{LeaveLedgerEntry{}, "ReferenceId", FLD_LEDGER_REFERENCE},
+		{LeaveLedgerEntry{}, "Remarks", FLD_LEDGER_REMARKS},
+
+		{Leave{}, "LeaveId", hr_common.FLD_LEAVE_ID},
+		{Leave{}, "StaffId", hr_common.FLD_STAFF_ID},
+		{Leave{}, "LeavetypeId", hr_common.FLD_LEAVETYPE_ID},
+		{Leave{}, "LeaveFrom", hr_common.FLD_LEAVE_FROM},
+		{Leave{}, "LeaveTo", hr_common.FLD_LEAVE_TO},
+		{Leave{}, "IsHalfDay", FLD_LEAVE_IS_HALF_DAY},
+		{Leave{}, "FromHalfDay", FLD_LEAVE_FROM_HALF_DAY},
+		{Leave{}, "ToHalfDay", FLD_LEAVE_TO_HALF_DAY},
+		{Leave{}, "IsPermission", FLD_LEAVE_IS_PERMISSION},
+		{Leave{}, "LeaveDays", FLD_LEAVE_DAYS},
+		{Leave{}, "LeaveHours", FLD_LEAVE_HOURS},
+		{Leave{}, "LeaveStatus", FLD_LEAVE_STATUS},
+		{Leave{}, "Approvers", FLD_LEAVE_APPROVERS},
+		{Leave{}, "ApprovalLevel", FLD_LEAVE_APPROVAL_LEVEL},
+		{Leave{}, "LeaveHistory", FLD_LEAVE_HISTORY},
+		{Leave{}, "Comments", FLD_COMMENTS},
+
+		{LeaveApprover{}, "StaffId", hr_common.FLD_STAFF_ID},
+		{LeaveApprover{}, "ApprovalLevel", FLD_LEAVE_APPROVAL_LEVEL},
+		{LeaveApprover{}, "ApprovalStatus", FLD_APPROVAL_STATUS},
+		{LeaveApprover{}, "ActionAt", FLD_ACTION_AT},
+
+		{LeaveHistoryEntry{}, "Action", FLD_ACTION},
+		{LeaveHistoryEntry{}, "ActionBy", FLD_ACTION_BY},
+		{LeaveHistoryEntry{}, "ActionAt", FLD_ACTION_AT},
+		{LeaveHistoryEntry{}, "Comments", FLD_COMMENTS},
+		{LeaveHistoryEntry{}, "FromStatus", FLD_FROM_STATUS},
+		{LeaveHistoryEntry{}, "ToStatus", FLD_TO_STATUS},
+
+		{LeaveType{}, "LeavetypeId", hr_common.FLD_LEAVETYPE_ID},
+		{LeaveType{}, "EntitlementDays", FLD_LEAVE_ENTITLEMENT_DAYS},
+		{LeaveType{}, "AccrualType", FLD_LEAVE_ACCRUAL_TYPE},
+		{LeaveType{}, "IsProRata", FLD_LEAVE_IS_PRO_RATA},
+		{LeaveType{}, "CarryForwardCap", FLD_LEAVE_CARRY_FWD_CAP},
+		{LeaveType{}, "ApprovalLevels", FLD_LEAVE_APPROVAL_LEVELS},
+
+		{Shift{}, "ShiftId", hr_common.FLD_SHIFT_ID},
+		{Shift{}, "ShiftFrom", hr_common.FLD_SHIFT_FROM},
+		{Shift{}, "ShiftTo", hr_common.FLD_SHIFT_TO},
+		{Shift{}, "BreakFrom", FLD_SHIFT_BREAK_FROM},
+		{Shift{}, "BreakTo", FLD_SHIFT_BREAK_TO},
+		{Shift{}, "LateGraceMins", FLD_SHIFT_LATE_GRACE_MINS},
+		{Shift{}, "EarlyGraceMins", FLD_SHIFT_EARLY_GRACE_MINS},
+		{Shift{}, "ShiftToDayOffset", FLD_SHIFT_TO_DAY_OFFSET},
+		{Shift{}, "DurationMins", FLD_SHIFT_DURATION_MINS},
+
+		{ShiftProfile{}, "ShiftProfileId", hr_common.FLD_SHIFT_PROFILE_ID},
+		{ShiftProfile{}, "ShiftId", hr_common.FLD_SHIFT_ID},
+		{ShiftProfile{}, "WeekOffs", FLD_SHIFT_PROFILE_WEEK_OFFS},
+		{ShiftProfile{}, "Rotation", FLD_SHIFT_PROFILE_ROTATION},
+		{ShiftProfile{}, "RotationDays", FLD_SHIFT_PROFILE_ROTATION_DAYS},
+		{ShiftProfile{}, "RotationStart", FLD_SHIFT_PROFILE_ROTATION_START},
+
+		{Holiday{}, "HolidayId", hr_common.FLD_HOLIDAY_ID},
+		{Holiday{}, "HolidayDate", FLD_HOLIDAY_DATE},
+		{Holiday{}, "HolidayName", FLD_HOLIDAY_NAME},
+		{Holiday{}, "HolidayDesc", FLD_HOLIDAY_DESC},
+		{Holiday{}, "IcsUid", FLD_HOLIDAY_ICS_UID},
+		{Holiday{}, "WorklocationIds", FLD_HOLIDAY_WORKLOCATION_IDS},
+		{Holiday{}, "DepartmentIds", FLD_HOLIDAY_DEPARTMENT_IDS},
+		{Holiday{}, "Recurrence", FLD_HOLIDAY_RECURRENCE},
+
+		{HolidayRecurrence{}, "Type", FLD_RECURRENCE_TYPE},
+		{HolidayRecurrence{}, "Month", FLD_RECURRENCE_MONTH},
+		{HolidayRecurrence{}, "Day", FLD_RECURRENCE_DAY},
+		{HolidayRecurrence{}, "Week", FLD_RECURRENCE_WEEK},
+		{HolidayRecurrence{}, "Weekday", FLD_RECURRENCE_WEEKDAY},
+
+		{Attendance{}, "AttendanceId", hr_common.FLD_ATTENDANCE_ID},
+		{Attendance{}, "StaffId", hr_common.FLD_STAFF_ID},
+		{Attendance{}, "ClockIn", hr_common.FLD_CLOCK_IN},
+		{Attendance{}, "ClockOut", hr_common.FLD_CLOCK_OUT},
+		{Attendance{}, "ShiftDate", FLD_SHIFT_DATE},
+		{Attendance{}, "AttendanceStatus", FLD_ATTENDANCE_STATUS},
+		{Attendance{}, "BreakHours", FLD_BREAK_HOURS},
+		{Attendance{}, "NetHours", FLD_NET_HOURS},
+
+		{AttendancePunch{}, "DateTime", hr_common.FLD_DATETIME},
+		{AttendancePunch{}, "Latitude", FLD_LATITUDE},
+		{AttendancePunch{}, "Longitude", FLD_LONGITUDE},
+		{AttendancePunch{}, "IsOutsideGeofence", FLD_IS_OUTSIDE_GEOFENCE},
+
+		{Overtime{}, "OvertimeId", hr_common.FLD_OVERTIME_ID},
+		{Overtime{}, "StaffId", hr_common.FLD_STAFF_ID},
+		{Overtime{}, "Date", FLD_OT_DATE},
+		{Overtime{}, "DayType", FLD_OT_DAY_TYPE},
+		{Overtime{}, "OvertimeHours", FLD_OT_HOURS},
+		{Overtime{}, "PayableHours", FLD_OT_PAYABLE_HOURS},
+		{Overtime{}, "AttendanceIds", FLD_OT_ATTENDANCE_IDS},
+
+		{WorkLocation{}, "WorklocationId", hr_common.FLD_WORKLOCATION_ID},
+		{WorkLocation{}, "Latitude", FLD_LATITUDE},
+		{WorkLocation{}, "Longitude", FLD_LONGITUDE},
+		{WorkLocation{}, "GeofenceRadius", FLD_GEOFENCE_RADIUS},
+		{WorkLocation{}, "GeofencePolygon", FLD_GEOFENCE_POLYGON},
+
+		{Department{}, "DepartmentId", hr_common.FLD_DEPARTMENT_ID},
+		{Department{}, "ParentDepartmentId", FLD_DEPARTMENT_PARENT_ID},
+		{Department{}, "HeadStaffId", FLD_DEPARTMENT_HEAD_ID},
+		{Department{}, "CostCentreCode", FLD_DEPARTMENT_COST_CENTRE},
+
+		{Designation{}, "DesignationId", hr_common.FLD_DESIGNATION_ID},
+		{Position{}, "PositionId", hr_common.FLD_POSITION_ID},
+		{Position{}, "PositionTypeId", hr_common.FLD_POSITION_TYPE_ID},
+		{PositionType{}, "PositionTypeId", hr_common.FLD_POSITION_TYPE_ID},
+		{StaffType{}, "StafftypeId", hr_common.FLD_STAFFTYPE_ID},
+		{StaffCategory{}, "StaffCategoryId", hr_common.FLD_STAFF_CATEGORY_ID},
+		{VisaType{}, "VisaTypeId", hr_common.FLD_VISA_TYPE_ID},
+		{Client{}, "ClientId", hr_common.FLD_CLIENT_ID},
+		{Project{}, "ProjectId", hr_common.FLD_PROJECT_ID},
+		{Project{}, "ClientId", hr_common.FLD_CLIENT_ID},
+		{Feedback{}, "FeedbackId", hr_common.FLD_FEEDBACK_ID},
+		{Feedback{}, "StaffId", hr_common.FLD_STAFF_ID},
+
+		{Record{}, "BusinessId", hr_common.FLD_BUSINESS_ID},
+		{Record{}, "IsDeleted", db_common.FLD_IS_DELETED},
+		{Record{}, "CreatedAt", db_common.FLD_CREATED_AT},
+		{Record{}, "UpdatedAt", db_common.FLD_UPDATED_AT},
+		{ListResponse[StaffRecord]{}, "TotalSize", db_common.LIST_TOTALSIZE},
+		{ListResponse[StaffRecord]{}, "FilteredSize", db_common.LIST_FILTEREDSIZE},
+		{ListResponse[StaffRecord]{}, "ResultSize", db_common.LIST_RESULTSIZE},
+		{ListResponse[StaffRecord]{}, "Result", db_common.LIST_RESULT},
+	}
+
+	for _, test := range tests {
+		field, ok := reflect.TypeOf(test.payload).FieldByName(test.field)
+		if !ok {
+			t.Errorf("%T has no field %s", test.payload, test.field)
+			continue
+		}
+		if name := getPayloadFieldName(field); name != test.name {
+			t.Errorf("%T.%s is tagged %q, should be %q", test.payload, test.field, name, test.name)
+		}
+	}
+}
+
+func TestValidatePayloadClockInDateTime(t *testing.T) {
+
+	indata := utils.Map{
+		hr_common.FLD_CLOCK_IN + "." + hr_common.FLD_DATETIME: "2024-05-01 09:00:00",
+	}
+	err := validatePayload(indata, Attendance{}, true)
+	if err != nil {
+		t.Fatalf("clock_in date time should be accepted, got %v", err)
+	}
+
+	indata = utils.Map{
+		hr_common.FLD_CLOCK_IN: utils.Map{hr_common.FLD_DATETIME: "2024-05-01"},
+	}
+	err = validatePayload(indata, Attendance{}, true)
+	if err == nil {
+		t.Fatal("clock_in date time without the time should be rejected")
+	}
+}
+
+func TestNormalizePayloadTypedValues(t *testing.T) {
+
+	indata := utils.Map{
+		hr_common.FLD_SHIFT_FROM:  "09:00:00",
+		hr_common.FLD_SHIFT_TO:    "18:00:00",
+		FLD_SHIFT_LATE_GRACE_MINS: "10",
+		FLD_SHIFT_TO_DAY_OFFSET:   "0",
+		"shift_name":              "General",
+	}
+	err := normalizePayload[Shift](indata, false)
+	if err != nil {
+		t.Fatalf("normalizePayload failed: %v", err)
+	}
+
+	if indata[FLD_SHIFT_LATE_GRACE_MINS] != int64(10) {
+		t.Errorf("late_grace_mins should be the number 10, got %#v", indata[FLD_SHIFT_LATE_GRACE_MINS])
+	}
+	if indata[FLD_SHIFT_TO_DAY_OFFSET] != int64(0) {
+		t.Errorf("shift_to_day_offset should be the number 0, got %#v", indata[FLD_SHIFT_TO_DAY_OFFSET])
+	}
+	if indata["shift_name"] != "General" {
+		t.Errorf("fields not in the payload struct should be kept, got %#v", indata["shift_name"])
+	}
+
+	indata = utils.Map{FLD_SHIFT_LATE_GRACE_MINS: "ten"}
+	err = normalizePayload[Shift](indata, true)
+	if err == nil {
+		t.Fatal("late_grace_mins that isn't a number should be rejected")
+	}
+}
+
+func TestValidatePayloadRequiredWithout(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		indata  utils.Map
+		partial bool
+		valid   bool
+	}{
+		{"shift_to", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00"}, false, true},
+		{"duration_mins", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", FLD_SHIFT_DURATION_MINS: 480}, false, true},
+		{"neither", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00"}, false, false},
+		{"update without both", utils.Map{FLD_SHIFT_LATE_GRACE_MINS: 10}, true, true},
+		{"update clearing shift_to", utils.Map{hr_common.FLD_SHIFT_TO: ""}, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validatePayload(test.indata, Shift{}, test.partial)
+			if test.valid && err != nil {
+				t.Errorf("Payload should be accepted, got %v", err)
+			}
+			if !test.valid {
+				assertErrorCode(t, err, ERRCODE_INVALID_PAYLOAD)
+			}
+		})
+	}
+}
+
+func TestValidatePayloadLeaveApprovers(t *testing.T) {
+
+	indata := utils.Map{
+		hr_common.FLD_LEAVETYPE_ID: "casual",
+		hr_common.FLD_LEAVE_FROM:   "2030-03-25 09:00:00",
+		FLD_LEAVE_APPROVERS: []utils.Map{
+			{hr_common.FLD_STAFF_ID: "staff_2", FLD_LEAVE_APPROVAL_LEVEL: 1, FLD_APPROVAL_STATUS: LEAVE_STATUS_APPROVED, FLD_ACTION_AT: time.Now().UTC()},
+			{hr_common.FLD_STAFF_ID: "staff_3", FLD_LEAVE_APPROVAL_LEVEL: 2, FLD_APPROVAL_STATUS: LEAVE_STATUS_SUBMITTED},
+		},
+	}
+	leave, err := DecodePayload[Leave](indata)
+	if err != nil {
+		t.Fatalf("Approvers of the workflow should be accepted, got %v", err)
+	}
+	if len(leave.Approvers) != 2 || leave.Approvers[1].StaffId != "staff_3" || *leave.Approvers[1].ApprovalLevel != 2 {
+		t.Errorf("Unexpected approvers %+v", leave.Approvers)
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+
+	response := utils.Map{
+		db_common.LIST_RESULTSIZE: 1,
+		db_common.LIST_RESULT: []utils.Map{{
+			hr_common.FLD_BUSINESS_ID:   testBusinessId,
+			hr_common.FLD_DEPARTMENT_ID: "dept_1",
+			"department_name":           "Sales",
+			db_common.FLD_IS_DELETED:    false,
+			"headcount":                 5,
+		}},
+	}
+
+	departments, err := DecodeList[DepartmentRecord](response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *departments.ResultSize != 1 || len(departments.Result) != 1 {
+		t.Fatalf("Unexpected list %+v", departments)
+	}
+
+	department := departments.Result[0]
+	if department.DepartmentId != "dept_1" || department.DepartmentName != "Sales" ||
+		department.BusinessId != testBusinessId || department.IsDeleted == nil || *department.IsDeleted {
+		t.Errorf("Unexpected department %+v", department)
+	}
+}
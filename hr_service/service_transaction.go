@@ -0,0 +1,144 @@
+package hr_service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// Attempts of the unit of work & its commit on the transient errors
+	MAX_TRANSACTION_ATTEMPTS = 3
+	TRANSACTION_RETRY_DELAY  = 100 * time.Millisecond
+
+	// MongoDB error labels of the transactions
+	ERRLABEL_TRANSIENT_TRANSACTION = "TransientTransactionError"
+	ERRLABEL_UNKNOWN_COMMIT_RESULT = "UnknownTransactionCommitResult"
+)
+
+// WithTransaction - Run the unit of work in a transaction of the Region database, the changes made
+// through the services of the context are committed when the work succeeds and rolled back when
+// it fails. Work failing with transient errors is run again, so it should not have other side effects
+// and the services should not begin or end their own transactions within it
+func (p *HRServiceContext) WithTransaction(work func(ctx *HRServiceContext) error) error {
+
+	log.Println("HRServiceContext::WithTransaction - Begin")
+
+	var err error
+	for attempt := 1; attempt <= MAX_TRANSACTION_ATTEMPTS; attempt++ {
+		err = p.runTransaction(work)
+		if err == nil || !hasErrorLabel(err, ERRLABEL_TRANSIENT_TRANSACTION) {
+			break
+		}
+
+		log.Println("HRServiceContext::WithTransaction - Retry", attempt, err)
+		time.Sleep(time.Duration(attempt) * TRANSACTION_RETRY_DELAY)
+	}
+
+	log.Println("HRServiceContext::WithTransaction - End", err)
+	return err
+}
+
+// runTransaction - Run the unit of work once, the commit with unknown result is retried
+func (p *HRServiceContext) runTransaction(work func(ctx *HRServiceContext) error) (err error) {
+
+	err = p.daoProvider.StartTransaction()
+	if err != nil {
+		return err
+	}
+
+	// Panic in the work should not leave the transaction open
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			p.daoProvider.EndTransaction(false)
+			panic(recovered)
+		}
+	}()
+
+	err = work(p)
+	if err != nil {
+		errAbort := p.daoProvider.EndTransaction(false)
+		if errAbort != nil {
+			log.Println("HRServiceContext::WithTransaction - Rollback Error", errAbort)
+		}
+		return err
+	}
+
+	for attempt := 1; attempt <= MAX_TRANSACTION_ATTEMPTS; attempt++ {
+		err = p.daoProvider.EndTransaction(true)
+		if !hasErrorLabel(err, ERRLABEL_UNKNOWN_COMMIT_RESULT) {
+			return err
+		}
+		log.Println("HRServiceContext::WithTransaction - Commit Retry", attempt, err)
+	}
+
+	// Commit result still unknown, end the transaction
+	p.daoProvider.EndTransaction(false)
+	return err
+}
+
+// runInTransaction - Run the work of the service in a transaction of the DaoProvider, the changes are
+// committed when the work succeeds and rolled back when it fails. Work failing with transient errors,
+// like the write conflict of a concurrent transaction, is run again. When the transaction is already
+// started, like in the unit of work of WithTransaction, the work is run as part of it. Region databases
+// without transactions, like ZapsDB, run the work without a transaction
+func runInTransaction(daoProvider DaoProvider, work func() error) error {
+
+	err := daoProvider.StartTransaction()
+	if hasErrorCode(err, ERRCODE_TRANSACTION_STARTED) {
+		return work()
+	}
+	if hasErrorCode(err, ERRCODE_TRANSACTION_UNSUPPORTED) {
+		log.Println("runInTransaction - Work runs without transaction", err)
+		return work()
+	}
+
+	for attempt := 1; err == nil; attempt++ {
+		err = endInTransaction(daoProvider, work)
+		if err == nil || attempt == MAX_TRANSACTION_ATTEMPTS || !hasErrorLabel(err, ERRLABEL_TRANSIENT_TRANSACTION) {
+			return err
+		}
+
+		log.Println("runInTransaction - Retry", attempt, err)
+		time.Sleep(time.Duration(attempt) * TRANSACTION_RETRY_DELAY)
+		err = daoProvider.StartTransaction()
+	}
+	return err
+}
+
+// endInTransaction - Run the work in the started transaction and end it with the result of the work
+func endInTransaction(daoProvider DaoProvider, work func() error) (err error) {
+
+	// Panic in the work should not leave the transaction open
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			daoProvider.EndTransaction(false)
+			panic(recovered)
+		}
+	}()
+
+	err = work()
+	if err != nil {
+		errAbort := daoProvider.EndTransaction(false)
+		if errAbort != nil {
+			log.Println("runInTransaction - Rollback Error", errAbort)
+		}
+		return err
+	}
+	return daoProvider.EndTransaction(true)
+}
+
+// hasErrorCode - Check the error or the error it wraps is the Application Error with the code
+func hasErrorCode(err error, errorCode string) bool {
+	var appErr *utils.AppError
+	return errors.As(err, &appErr) && appErr.ErrorCode == errorCode
+}
+
+// hasErrorLabel - Check the error or the error it wraps is a MongoDB error with the label
+func hasErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel(label)
+}
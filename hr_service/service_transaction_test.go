@@ -0,0 +1,123 @@
+package hr_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestWithTransaction(t *testing.T) {
+
+	provider, props := newTestProvider()
+	serviceContext, err := NewHRServiceContext(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serviceContext.EndService()
+
+	createClient := func(ctx *HRServiceContext, clientId string) error {
+		clientService, err := ctx.ClientService()
+		if err != nil {
+			return err
+		}
+		_, err = clientService.Create(utils.Map{hr_common.FLD_CLIENT_ID: clientId})
+		return err
+	}
+
+	errWork := errors.New("work failed")
+	tests := []struct {
+		name     string
+		work     func(ctx *HRServiceContext) error
+		err      error
+		clientId string
+		exists   bool
+	}{
+		{"commit", func(ctx *HRServiceContext) error {
+			return createClient(ctx, "client_committed")
+		}, nil, "client_committed", true},
+		{"rollback", func(ctx *HRServiceContext) error {
+			err := createClient(ctx, "client_rolled_back")
+			if err != nil {
+				return err
+			}
+			return errWork
+		}, errWork, "client_rolled_back", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := serviceContext.WithTransaction(test.work)
+			if err != test.err {
+				t.Fatalf("Expected error %v, got %v", test.err, err)
+			}
+
+			_, errGet := provider.NewClientDao(testBusinessId).Get(test.clientId)
+			if (errGet == nil) != test.exists {
+				t.Errorf("Expected client %s exists %v", test.clientId, test.exists)
+			}
+		})
+	}
+
+	// Panic in the work doesn't leave the transaction open
+	func() {
+		defer func() {
+			if recovered := recover(); recovered == nil {
+				t.Error("Panic of the work should be raised again")
+			}
+		}()
+		serviceContext.WithTransaction(func(ctx *HRServiceContext) error {
+			createClient(ctx, "client_panic")
+			panic("work panicked")
+		})
+	}()
+
+	_, err = provider.NewClientDao(testBusinessId).Get("client_panic")
+	if err == nil {
+		t.Error("Client created before the panic should be rolled back")
+	}
+
+	// Transaction can't be started within the work
+	err = serviceContext.WithTransaction(func(ctx *HRServiceContext) error {
+		return ctx.WithTransaction(func(ctx *HRServiceContext) error { return nil })
+	})
+	assertErrorCode(t, err, ERRCODE_TRANSACTION_STARTED)
+
+	err = provider.StartTransaction()
+	if err != nil {
+		t.Errorf("Transaction should be ended after the work, got %v", err)
+	}
+}
+
+// noTransactionDaoProvider - Memory database without transactions, like ZapsDB
+type noTransactionDaoProvider struct {
+	*MemoryDaoProvider
+}
+
+func (p *noTransactionDaoProvider) StartTransaction() error {
+	return &utils.AppError{ErrorCode: ERRCODE_TRANSACTION_UNSUPPORTED, ErrorMsg: "Transaction Not Supported"}
+}
+
+func TestTransactionUnsupported(t *testing.T) {
+
+	daoProvider := &mongoDaoProvider{regionClient: utils.Map{db_common.DB_TYPE: db_common.DATABASE_TYPE_ZAPSDB}}
+	err := daoProvider.StartTransaction()
+	assertErrorCode(t, err, ERRCODE_TRANSACTION_UNSUPPORTED)
+
+	// Work of the services runs without the transaction
+	provider, _ := newTestProvider()
+	err = runInTransaction(&noTransactionDaoProvider{provider}, func() error {
+		_, err := provider.NewClientDao(testBusinessId).Create(utils.Map{
+			hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_CLIENT_ID: "client_1"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.NewClientDao(testBusinessId).Get("client_1")
+	if err != nil {
+		t.Errorf("Expected client_1 created without transaction, got %v", err)
+	}
+}
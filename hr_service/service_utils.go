@@ -0,0 +1,466 @@
+package hr_service
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Referring record details listed in the Record In Use error
+	FLD_REFERENCE_TYPE  = "reference_type"
+	FLD_REFERENCE_ID    = "reference_id"
+	FLD_REFERENCE_FIELD = "reference_field"
+
+	// Referring record types
+	REFERENCE_TYPE_STAFF         = "staff"
+	REFERENCE_TYPE_SHIFT_PROFILE = "shift_profile"
+	REFERENCE_TYPE_POSITION      = "position"
+	REFERENCE_TYPE_PROJECT       = "project"
+	REFERENCE_TYPE_HOLIDAY       = "holiday"
+	REFERENCE_TYPE_LEAVE         = "leave"
+
+	// Referential Integrity Error Codes
+	ERRCODE_RECORD_IN_USE    = "S30171"
+	ERRCODE_INVALID_REASSIGN = "S30172"
+)
+
+// referenceDao - Dao operations used to find and reassign the referring records
+type referenceDao interface {
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	Update(id string, indata utils.Map) (utils.Map, error)
+}
+
+// masterDao - Dao operation used to verify the master data exists
+type masterDao interface {
+	Get(id string) (utils.Map, error)
+}
+
+// recordReference - Records of a collection referring the master data through the (dotted) fields,
+// the employment field of the Staff records is reassigned through a transfer event to keep the history
+type recordReference struct {
+	referenceType   string
+	idField         string
+	fields          []string
+	employmentField string
+	dao             referenceDao
+}
+
+// ConflictError - Application Error along with the records conflicting with the request
+type ConflictError struct {
+	utils.AppError
+	Conflicts []utils.Map
+}
+
+// Unwrap - Allows errors.As to match *utils.AppError
+func (e *ConflictError) Unwrap() error {
+	return &e.AppError
+}
+
+// toMap - Convert the sub-document read from Database/Client into utils.Map
+func toMap(data interface{}) (utils.Map, bool) {
+	switch val := data.(type) {
+	case utils.Map:
+		return val, true
+	case map[string]interface{}:
+		return utils.Map(val), true
+	case primitive.M:
+		return utils.Map(val), true
+	case primitive.D:
+		return utils.Map(val.Map()), true
+	}
+	return nil, false
+}
+
+// toSlice - Convert the array read from Database/Client into slice
+func toSlice(data interface{}) ([]interface{}, bool) {
+	switch val := data.(type) {
+	case []interface{}:
+		return val, true
+	case primitive.A:
+		return []interface{}(val), true
+	case []utils.Map:
+		slice := make([]interface{}, len(val))
+		for i, item := range val {
+			slice[i] = item
+		}
+		return slice, true
+	}
+	return nil, false
+}
+
+// deepCopy - Deep copy of the value, documents are copied into utils.Map and
+// arrays into []interface{} like the values read from MongoDB
+func deepCopy(data interface{}) interface{} {
+
+	if data == nil {
+		return nil
+	}
+
+	if mapVal, ok := toMap(data); ok {
+		copied := utils.Map{}
+		for key, value := range mapVal {
+			copied[key] = deepCopy(value)
+		}
+		return copied
+	}
+
+	dataVal := reflect.ValueOf(data)
+	switch dataVal.Kind() {
+	case reflect.Map:
+		if dataVal.Type().Key().Kind() == reflect.String {
+			copied := utils.Map{}
+			iter := dataVal.MapRange()
+			for iter.Next() {
+				copied[iter.Key().String()] = deepCopy(iter.Value().Interface())
+			}
+			return copied
+		}
+
+	case reflect.Slice, reflect.Array:
+		if dataVal.Type().Elem().Kind() != reflect.Uint8 {
+			copied := make([]interface{}, dataVal.Len())
+			for i := 0; i < dataVal.Len(); i++ {
+				copied[i] = deepCopy(dataVal.Index(i).Interface())
+			}
+			return copied
+		}
+	}
+	return data
+}
+
+// getMemberDataMap - Get the sub-document for the given member
+func getMemberDataMap(data utils.Map, memberName string) (utils.Map, error) {
+	dataVal, err := utils.GetMemberData(data, memberName)
+	if err != nil {
+		return nil, err
+	}
+
+	mapVal, ok := toMap(dataVal)
+	if !ok {
+		err := &utils.AppError{ErrorStatus: 400, ErrorMsg: "Invalid Datatype", ErrorDetail: memberName + " value should be an object"}
+		return nil, err
+	}
+	return mapVal, nil
+}
+
+// getMemberDataFloat - Get the numeric value for the given member, numbers sent as string also accepted
+func getMemberDataFloat(data utils.Map, memberName string) (float64, error) {
+	dataVal, err := utils.GetMemberData(data, memberName)
+	if err != nil {
+		return 0, err
+	}
+
+	switch val := dataVal.(type) {
+	case float64:
+		return val, nil
+	case float32:
+		return float64(val), nil
+	case int:
+		return float64(val), nil
+	case int32:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case string:
+		fVal, err := strconv.ParseFloat(val, 64)
+		if err == nil {
+			return fVal, nil
+		}
+	}
+
+	err = &utils.AppError{ErrorStatus: 400, ErrorMsg: "Invalid Datatype", ErrorDetail: memberName + " value should be a number"}
+	return 0, err
+}
+
+// getStaffDataStr - Get the member from Staff record, looks in root first then in staff_data
+func getStaffDataStr(staffInfo utils.Map, memberName string) (string, error) {
+	dataVal, err := utils.GetMemberDataStr(staffInfo, memberName)
+	if err == nil {
+		return dataVal, nil
+	}
+
+	staffData, errData := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if errData != nil {
+		return "", err
+	}
+
+	return utils.GetMemberDataStr(staffData, memberName)
+}
+
+// roundTo2Decimals - Round the hours/days value to 2 decimals
+func roundTo2Decimals(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// parseDateValue - Parse the date value sent either in date or date-time format
+func parseDateValue(dateStr string) (time.Time, error) {
+	dateVal, err := time.Parse(time.DateOnly, dateStr)
+	if err != nil {
+		dateVal, err = time.Parse(time.DateTime, dateStr)
+	}
+	return dateVal, err
+}
+
+// truncateToDate - Strip the time portion of the given time
+func truncateToDate(dateTime time.Time) time.Time {
+	return time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), 0, 0, 0, 0, dateTime.Location())
+}
+
+// parseWeekday - Parse the weekday given as name (Sunday/Sun) or number (0 - Sunday)
+func parseWeekday(value interface{}) (time.Weekday, bool) {
+	if dayName, ok := value.(string); ok {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.EqualFold(dayName, day.String()) || strings.EqualFold(dayName, day.String()[:3]) {
+				return day, true
+			}
+		}
+		return time.Sunday, false
+	}
+
+	dayNum, err := getMemberDataFloat(utils.Map{"weekday": value}, "weekday")
+	if err != nil || dayNum < 0 || dayNum > 6 || dayNum != math.Trunc(dayNum) {
+		return time.Sunday, false
+	}
+	return time.Weekday(dayNum), true
+}
+
+// staffReference - Staff records referring the master data in root, staff_data or roster field
+func staffReference(daoStaff hr_repository.StaffDao, field string) recordReference {
+	reference := recordReference{
+		referenceType: REFERENCE_TYPE_STAFF,
+		idField:       hr_common.FLD_STAFF_ID,
+		fields:        []string{field, hr_common.FLD_STAFF_DATA + "." + field},
+		dao:           daoStaff,
+	}
+
+	// Roster assignments refer the shifts & shift profiles
+	if field == hr_common.FLD_SHIFT_ID || field == hr_common.FLD_SHIFT_PROFILE_ID {
+		reference.fields = append(reference.fields, FLD_ROSTER+"."+field)
+	}
+
+	if isEmploymentField(field) {
+		reference.employmentField = field
+	}
+	return reference
+}
+
+// checkReferences - Verify no live record refers the master data, the referring records
+// are listed in the error
+func checkReferences(references []recordReference, recordName string, id string) error {
+
+	conflicts := []utils.Map{}
+	for _, reference := range references {
+		records, err := listReferringRecords(reference, reference.fields, id)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			for _, field := range reference.fields {
+				if hasFieldValue(record, strings.Split(field, "."), id) {
+					recordId, _ := utils.GetMemberDataStr(record, reference.idField)
+					conflicts = append(conflicts, utils.Map{
+						FLD_REFERENCE_TYPE:  reference.referenceType,
+						FLD_REFERENCE_ID:    recordId,
+						FLD_REFERENCE_FIELD: field,
+					})
+					break
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		err := &ConflictError{
+			AppError: utils.AppError{
+				ErrorCode:   ERRCODE_RECORD_IN_USE,
+				ErrorMsg:    "Record In Use",
+				ErrorDetail: fmt.Sprintf("%s %s is referred by %d record(s)", recordName, id, len(conflicts))},
+			Conflicts: conflicts,
+		}
+		return err
+	}
+	return nil
+}
+
+// reassignReferences - Refer the records to the new master data, the Staff records in service are
+// transferred from today and the earlier events of their Employment History are kept as they are
+func reassignReferences(references []recordReference, id string, newId string) error {
+
+	for _, reference := range references {
+		records, err := listReferringRecords(reference, reference.fields, id)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			updateData := utils.Map{}
+			for _, field := range reference.fields {
+				path := strings.Split(field, ".")
+				if replaceFieldValue(record, path, id, newId) {
+					updateData[path[0]] = record[path[0]]
+				}
+			}
+			if len(updateData) == 0 {
+				continue
+			}
+
+			if reference.employmentField != "" {
+				transferData, ok, err := getTransferUpdate(record, utils.Map{reference.employmentField: newId},
+					"Reassigned from "+id+" on delete")
+				if err != nil {
+					return err
+				}
+				if ok {
+					for key, dataVal := range transferData {
+						updateData[key] = dataVal
+					}
+				}
+			}
+
+			recordId, _ := utils.GetMemberDataStr(record, reference.idField)
+			_, err = reference.dao.Update(recordId, updateData)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAndReassign - Refer the records to the other master data and delete the master data through
+// the given delete of the service, all in a transaction of the DaoProvider
+func deleteAndReassign(daoProvider DaoProvider, recordName string, dao masterDao, references []recordReference, id string, newId string, deleteRecord func() error) error {
+
+	err := validateReassignId(recordName, id, newId)
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.Get(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = dao.Get(newId)
+	if err != nil {
+		return err
+	}
+
+	return runInTransaction(daoProvider, func() error {
+		err := reassignReferences(references, id, newId)
+		if err != nil {
+			return err
+		}
+		return deleteRecord()
+	})
+}
+
+// validateReassignId - Verify the master data to reassign is a different record
+func validateReassignId(recordName string, id string, newId string) error {
+	if newId == "" || newId == id {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_REASSIGN,
+			ErrorMsg:    "Invalid Reassign " + recordName,
+			ErrorDetail: recordName + " to reassign should be other than " + id}
+		return err
+	}
+	return nil
+}
+
+// listReferringRecords - List the records having the id in any of the fields
+func listReferringRecords(reference recordReference, fields []string, id string) ([]utils.Map, error) {
+
+	conditions := []string{}
+	for _, field := range fields {
+		conditions = append(conditions, fmt.Sprintf(`{"%s":"%s"}`, field, id))
+	}
+	filter := fmt.Sprintf(`{"$or":[%s],"%s":false}`, strings.Join(conditions, ","), db_common.FLD_IS_DELETED)
+
+	response, err := reference.dao.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return []utils.Map{}, nil
+	}
+	return dataList.([]utils.Map), nil
+}
+
+// hasFieldValue - Check the dotted field path has the value, arrays on the path match
+// when any of the items has the value
+func hasFieldValue(data interface{}, path []string, value string) bool {
+
+	if items, ok := toSlice(data); ok {
+		for _, item := range items {
+			if hasFieldValue(item, path, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		strVal, ok := data.(string)
+		return ok && strVal == value
+	}
+
+	mapVal, ok := toMap(data)
+	if !ok {
+		return false
+	}
+	return hasFieldValue(mapVal[path[0]], path[1:], value)
+}
+
+// replaceFieldValue - Replace the value of the dotted field path in place, arrays on the
+// path are replaced item by item
+func replaceFieldValue(data interface{}, path []string, value string, newValue string) bool {
+
+	if items, ok := toSlice(data); ok {
+		replaced := false
+		for i, item := range items {
+			if len(path) == 0 {
+				if strVal, ok := item.(string); ok && strVal == value {
+					items[i] = newValue
+					replaced = true
+				}
+			} else if replaceFieldValue(item, path, value, newValue) {
+				replaced = true
+			}
+		}
+		return replaced
+	}
+
+	mapVal, ok := toMap(data)
+	if !ok || len(path) == 0 {
+		return false
+	}
+
+	dataVal, ok := mapVal[path[0]]
+	if !ok {
+		return false
+	}
+
+	if len(path) == 1 {
+		if strVal, ok := dataVal.(string); ok {
+			if strVal != value {
+				return false
+			}
+			mapVal[path[0]] = newValue
+			return true
+		}
+	}
+	return replaceFieldValue(dataVal, path[1:], value, newValue)
+}
@@ -0,0 +1,581 @@
+package hr_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	// Payload struct tag with the comma separated validation rules
+	//   required         - field should be sent with non-empty value, not checked for partial updates
+	//   required_without=<field>
+	//                    - same as required, unless the other field is sent with non-empty value
+	//   format=<format>  - string should be in date, time or datetime format
+	//   enum=<a|b|c>     - value should be one of the given values
+	//   min=<n>, max=<n> - range of the number, or range of the length for strings & arrays
+	TAG_VALIDATE = "validate"
+
+	// Validation Rules
+	RULE_REQUIRED         = "required"
+	RULE_REQUIRED_WITHOUT = "required_without"
+	RULE_TYPE             = "type"
+	RULE_FORMAT           = "format"
+	RULE_ENUM             = "enum"
+	RULE_MIN              = "min"
+	RULE_MAX              = "max"
+	RULE_UNKNOWN          = "unknown"
+
+	// Validation Formats
+	FORMAT_DATE     = "date"
+	FORMAT_TIME     = "time"
+	FORMAT_DATETIME = "datetime"
+
+	// Fields not in the payload struct are reported as typos when the name is this close to a payload field
+	MAX_FIELD_NAME_DISTANCE = 2
+
+	// Payload Validation Error Codes
+	ERRCODE_INVALID_PAYLOAD = "S30201"
+)
+
+// Fields maintained by the services & the database, accepted in every payload
+var systemFields = map[string]bool{
+	"_id":                     true,
+	hr_common.FLD_BUSINESS_ID: true,
+	db_common.FLD_IS_DELETED:  true,
+	db_common.FLD_CREATED_AT:  true,
+	db_common.FLD_UPDATED_AT:  true,
+}
+
+// FieldError - Validation failure of a payload field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError - Application Error along with the field level validation failures
+type ValidationError struct {
+	utils.AppError
+	Fields []FieldError
+}
+
+// Unwrap - Allows errors.As to match *utils.AppError
+func (e *ValidationError) Unwrap() error {
+	return &e.AppError
+}
+
+// DecodePayload - Validate the Map payload and decode it into the typed payload struct
+func DecodePayload[T any](indata utils.Map) (T, error) {
+	return decodePayload[T](indata, false)
+}
+
+// DecodeRecord - Decode the record returned by the services into the typed response struct, the
+// record isn't validated and the fields not in the struct are left out
+func DecodeRecord[T any](data utils.Map) (T, error) {
+	var record T
+	err := setPayloadValue(reflect.ValueOf(&record).Elem(), data)
+	return record, err
+}
+
+// DecodeList - Decode the response of the List methods into the typed list response
+func DecodeList[T any](response utils.Map) (ListResponse[T], error) {
+	return DecodeRecord[ListResponse[T]](response)
+}
+
+// EncodePayload - Encode the typed payload struct into Map, empty fields are omitted and the
+// whole numbers are encoded as int64
+func EncodePayload(payload interface{}) (utils.Map, error) {
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	data := utils.Map{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	err = decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	encodeNumbers(data)
+	return data, nil
+}
+
+// decodePayload - Validate the Map payload, the partial payload of the updates without the required
+// fields, and decode it into the typed payload struct
+func decodePayload[T any](indata utils.Map, partial bool) (T, error) {
+
+	var payload T
+	err := validatePayload(indata, payload, partial)
+	if err != nil {
+		return payload, err
+	}
+
+	err = setPayloadValue(reflect.ValueOf(&payload).Elem(), indata)
+	return payload, err
+}
+
+// normalizePayload - Validate the Map payload of Create & Update through the typed payload struct,
+// the values converted by the struct, like the numbers sent as strings, are set back in the Map
+func normalizePayload[T any](indata utils.Map, partial bool) error {
+
+	payload, err := decodePayload[T](indata, partial)
+	if err != nil {
+		return err
+	}
+
+	typedData, err := EncodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	setTypedValues(indata, typedData)
+	return nil
+}
+
+// setTypedValues - Set the typed values of the strings in the Map payload, documents & arrays are
+// updated in place so the fields not in the payload struct are kept
+func setTypedValues(data utils.Map, typedData utils.Map) {
+
+	for name, typedVal := range typedData {
+		switch dataVal := data[name].(type) {
+		case string:
+			if _, ok := typedVal.(string); !ok && typedVal != nil {
+				data[name] = typedVal
+			}
+
+		default:
+			if mapVal, ok := toMap(dataVal); ok {
+				if typedMap, ok := toMap(typedVal); ok {
+					setTypedValues(mapVal, typedMap)
+				}
+				continue
+			}
+
+			items, _ := toSlice(dataVal)
+			typedItems, _ := toSlice(typedVal)
+			for i := 0; i < len(items) && i < len(typedItems); i++ {
+				itemMap, isMap := toMap(items[i])
+				typedMap, isTypedMap := toMap(typedItems[i])
+				if isMap && isTypedMap {
+					setTypedValues(itemMap, typedMap)
+				}
+			}
+		}
+	}
+}
+
+// encodeNumbers - Convert the JSON numbers of the decoded document into int64 or float64
+func encodeNumbers(data interface{}) interface{} {
+
+	switch val := data.(type) {
+	case json.Number:
+		if intVal, err := val.Int64(); err == nil {
+			return intVal
+		}
+		floatVal, _ := val.Float64()
+		return floatVal
+
+	case utils.Map:
+		for key, item := range val {
+			val[key] = encodeNumbers(item)
+		}
+
+	case map[string]interface{}:
+		for key, item := range val {
+			val[key] = encodeNumbers(item)
+		}
+
+	case []interface{}:
+		for i, item := range val {
+			val[i] = encodeNumbers(item)
+		}
+	}
+	return data
+}
+
+// validatePayload - Validate the Map payload against the payload struct, the required fields
+// are not checked for the partial payloads of the updates
+func validatePayload(indata utils.Map, schema interface{}, partial bool) error {
+
+	fieldErrors := validatePayloadFields(indata, reflect.TypeOf(schema), "", partial)
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	details := []string{}
+	for _, fieldError := range fieldErrors {
+		details = append(details, fieldError.Field+" "+fieldError.Message)
+	}
+
+	err := &ValidationError{
+		AppError: utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_PAYLOAD,
+			ErrorMsg:    "Invalid Payload",
+			ErrorDetail: strings.Join(details, "; ")},
+		Fields: fieldErrors,
+	}
+	return err
+}
+
+// validatePayloadFields - Validate the fields of the Map against the fields of the struct type
+func validatePayloadFields(data utils.Map, schemaType reflect.Type, prefix string, partial bool) []FieldError {
+
+	schemaType = getBaseType(schemaType)
+	fieldErrors := []FieldError{}
+	knownFields := map[string]reflect.StructField{}
+	for i := 0; i < schemaType.NumField(); i++ {
+		field := schemaType.Field(i)
+		name := getPayloadFieldName(field)
+		if name == "" {
+			continue
+		}
+		knownFields[name] = field
+
+		rules := parseValidationRules(field.Tag.Get(TAG_VALIDATE))
+		dataVal, ok := data[name]
+		if !ok || dataVal == nil || dataVal == "" {
+			_, required := rules[RULE_REQUIRED]
+			if required && (ok || !partial) {
+				fieldErrors = append(fieldErrors, FieldError{prefix + name, RULE_REQUIRED, "value should be sent"})
+			}
+
+			otherName, requiredWithout := rules[RULE_REQUIRED_WITHOUT]
+			if otherVal := data[otherName]; requiredWithout && (ok || !partial) && (otherVal == nil || otherVal == "") {
+				fieldErrors = append(fieldErrors, FieldError{prefix + name, RULE_REQUIRED, "value should be sent when " + prefix + otherName + " isn't sent"})
+			}
+			continue
+		}
+
+		fieldErrors = append(fieldErrors, validatePayloadValue(dataVal, field.Type, rules, prefix+name, partial)...)
+	}
+
+	// Fields not in the struct are allowed unless they look like a typo of a struct field
+	names := []string{}
+	for name := range data {
+		if _, ok := knownFields[name]; !ok && !systemFields[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// Dotted fields of the updates refer the fields of the sub-document
+		parts := strings.SplitN(name, ".", 2)
+		if field, ok := knownFields[parts[0]]; ok && len(parts) == 2 && getBaseType(field.Type).Kind() == reflect.Struct {
+			subData := utils.Map{parts[1]: data[name]}
+			fieldErrors = append(fieldErrors, validatePayloadFields(subData, field.Type, prefix+parts[0]+".", true)...)
+			continue
+		}
+
+		similarName := getSimilarFieldName(name, knownFields)
+		if similarName != "" {
+			fieldErrors = append(fieldErrors, FieldError{prefix + name, RULE_UNKNOWN, "is not a known field, did you mean " + prefix + similarName})
+		}
+	}
+	return fieldErrors
+}
+
+// validatePayloadValue - Validate the value against the type & rules of the struct field
+func validatePayloadValue(dataVal interface{}, fieldType reflect.Type, rules map[string]string, path string, partial bool) []FieldError {
+
+	typeError := func(typeName string) []FieldError {
+		return []FieldError{{path, RULE_TYPE, "value should be " + typeName}}
+	}
+
+	baseType := getBaseType(fieldType)
+	switch baseType.Kind() {
+	case reflect.String:
+		strVal, ok := dataVal.(string)
+		if !ok {
+			return typeError("a string")
+		}
+
+		if format, ok := rules[RULE_FORMAT]; ok && !isValidFormat(strVal, format) {
+			return []FieldError{{path, RULE_FORMAT, "value should be in " + format + " format"}}
+		}
+		return validateRange(float64(len(strVal)), rules, path, "length")
+
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		number, err := getMemberDataFloat(utils.Map{path: dataVal}, path)
+		if err != nil {
+			return typeError("a number")
+		}
+		if baseType.Kind() != reflect.Float32 && baseType.Kind() != reflect.Float64 && number != math.Trunc(number) {
+			return typeError("an integer")
+		}
+
+		if enumValues, ok := rules[RULE_ENUM]; ok && !isEnumValue(strconv.FormatFloat(number, 'f', -1, 64), enumValues) {
+			return []FieldError{{path, RULE_ENUM, "value should be one of " + strings.ReplaceAll(enumValues, "|", ", ")}}
+		}
+		return validateRange(number, rules, path, "value")
+
+	case reflect.Bool:
+		if _, ok := dataVal.(bool); !ok {
+			return typeError("a boolean")
+		}
+
+	case reflect.Slice:
+		items, ok := toSlice(dataVal)
+		if !ok {
+			return typeError("an array")
+		}
+
+		fieldErrors := validateRange(float64(len(items)), rules, path, "count")
+
+		// Format & enum rules are for the items of the array
+		itemRules := map[string]string{}
+		for _, rule := range []string{RULE_FORMAT, RULE_ENUM} {
+			if ruleVal, ok := rules[rule]; ok {
+				itemRules[rule] = ruleVal
+			}
+		}
+		for i, item := range items {
+			fieldErrors = append(fieldErrors, validatePayloadValue(item, baseType.Elem(), itemRules, fmt.Sprintf("%s[%d]", path, i), partial)...)
+		}
+		return fieldErrors
+
+	case reflect.Struct:
+		mapVal, ok := toMap(dataVal)
+		if !ok {
+			return typeError("an object")
+		}
+		return validatePayloadFields(mapVal, baseType, path+".", partial)
+
+	case reflect.Map:
+		if _, ok := toMap(dataVal); !ok {
+			return typeError("an object")
+		}
+	}
+
+	if enumValues, ok := rules[RULE_ENUM]; ok && !isEnumValue(fmt.Sprint(dataVal), enumValues) {
+		return []FieldError{{path, RULE_ENUM, "value should be one of " + strings.ReplaceAll(enumValues, "|", ", ")}}
+	}
+	return nil
+}
+
+// validateRange - Validate the value, length or count is within the min & max rules
+func validateRange(value float64, rules map[string]string, path string, measure string) []FieldError {
+
+	if minStr, ok := rules[RULE_MIN]; ok {
+		minVal, err := strconv.ParseFloat(minStr, 64)
+		if err == nil && value < minVal {
+			return []FieldError{{path, RULE_MIN, measure + " should be minimum " + minStr}}
+		}
+	}
+
+	if maxStr, ok := rules[RULE_MAX]; ok {
+		maxVal, err := strconv.ParseFloat(maxStr, 64)
+		if err == nil && value > maxVal {
+			return []FieldError{{path, RULE_MAX, measure + " should be maximum " + maxStr}}
+		}
+	}
+	return nil
+}
+
+// setPayloadValue - Set the validated value into the field of the payload struct
+func setPayloadValue(target reflect.Value, dataVal interface{}) error {
+
+	if dataVal == nil {
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Ptr:
+		value := reflect.New(target.Type().Elem())
+		err := setPayloadValue(value.Elem(), dataVal)
+		if err != nil {
+			return err
+		}
+		target.Set(value)
+
+	case reflect.String:
+		strVal, _ := dataVal.(string)
+		target.SetString(strVal)
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		number, err := getMemberDataFloat(utils.Map{"value": dataVal}, "value")
+		if err != nil {
+			return err
+		}
+		target.SetInt(int64(number))
+
+	case reflect.Float32, reflect.Float64:
+		number, err := getMemberDataFloat(utils.Map{"value": dataVal}, "value")
+		if err != nil {
+			return err
+		}
+		target.SetFloat(number)
+
+	case reflect.Bool:
+		boolVal, _ := dataVal.(bool)
+		target.SetBool(boolVal)
+
+	case reflect.Slice:
+		items, _ := toSlice(dataVal)
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			err := setPayloadValue(slice.Index(i), item)
+			if err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+
+	case reflect.Struct:
+		mapVal, _ := toMap(dataVal)
+		for i := 0; i < target.NumField(); i++ {
+			field := target.Type().Field(i)
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				// Fields of the embedded struct are in the same document
+				err := setPayloadValue(target.Field(i), mapVal)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			name := getPayloadFieldName(field)
+			if name == "" {
+				continue
+			}
+			err := setPayloadValue(target.Field(i), mapVal[name])
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		mapVal, _ := toMap(dataVal)
+		target.Set(reflect.ValueOf(mapVal))
+
+	case reflect.Interface:
+		target.Set(reflect.ValueOf(dataVal))
+	}
+	return nil
+}
+
+// getBaseType - Get the type pointed by the pointer type
+func getBaseType(fieldType reflect.Type) reflect.Type {
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType
+}
+
+// getPayloadFieldName - Get the field name from the json tag of the struct field
+func getPayloadFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// parseValidationRules - Parse the validation tag into rule & value
+func parseValidationRules(tag string) map[string]string {
+	rules := map[string]string{}
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) == 2 {
+			rules[parts[0]] = parts[1]
+		} else {
+			rules[parts[0]] = ""
+		}
+	}
+	return rules
+}
+
+// isValidFormat - Check the string is in the given format
+func isValidFormat(value string, format string) bool {
+	var err error
+	switch format {
+	case FORMAT_DATE:
+		_, err = parseDateValue(value)
+	case FORMAT_TIME:
+		_, err = time.Parse(time.TimeOnly, value)
+	case FORMAT_DATETIME:
+		_, err = time.Parse(time.DateTime, value)
+	}
+	return err == nil
+}
+
+// isEnumValue - Check the value is one of the '|' separated values
+func isEnumValue(value string, enumValues string) bool {
+	for _, enumValue := range strings.Split(enumValues, "|") {
+		if value == enumValue {
+			return true
+		}
+	}
+	return false
+}
+
+// getSimilarFieldName - Get the struct field closest to the given name, when it is close enough
+// to be a typo
+func getSimilarFieldName(name string, knownFields map[string]reflect.StructField) string {
+
+	normalize := func(fieldName string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(fieldName))
+	}
+
+	similarName := ""
+	bestDistance := MAX_FIELD_NAME_DISTANCE + 1
+	for knownName := range knownFields {
+		distance := getEditDistance(normalize(name), normalize(knownName))
+		if distance > 0 && len(knownName) <= MAX_FIELD_NAME_DISTANCE*2 {
+			// Short names differ by a couple of letters anyway
+			continue
+		}
+		if distance < bestDistance || (distance == bestDistance && knownName < similarName) {
+			similarName = knownName
+			bestDistance = distance
+		}
+	}
+	return similarName
+}
+
+// getEditDistance - Get the Levenshtein distance between the strings
+func getEditDistance(first string, second string) int {
+
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(second)]
+}
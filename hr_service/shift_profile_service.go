@@ -1,18 +1,32 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
-	"strings"
+	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// ShiftProfile Week-Off Field, list of weekday names or numbers (0 - Sunday)
+	FLD_SHIFT_PROFILE_WEEK_OFFS = "week_offs"
+
+	// ShiftProfile Rotation Fields, list of shift ids each worked for rotation_days
+	// counted from rotation_start date
+	FLD_SHIFT_PROFILE_ROTATION       = "rotation"
+	FLD_SHIFT_PROFILE_ROTATION_DAYS  = "rotation_days"
+	FLD_SHIFT_PROFILE_ROTATION_START = "rotation_start"
+	DEFAULT_ROTATION_DAYS            = 7
+)
+
+// Default Week-Off when the staff has no shift profile
+var defaultWeekOffs = map[time.Weekday]bool{time.Sunday: true}
+
 // ShiftProfileService - Accounts Service structure
 type ShiftProfileService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -21,6 +35,7 @@ type ShiftProfileService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(shiftProfileId string, indata utils.Map) (utils.Map, error)
 	Delete(shiftProfileId string, delete_permanent bool) error
+	DeleteAndReassign(shiftProfileId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +46,10 @@ type ShiftProfileService interface {
 
 // shiftProfileBaseService - Accounts Service structure
 type shiftProfileBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoShift            hr_repository.ShiftProfileDao
+	daoStaff            hr_repository.StaffDao
+	daoShiftDetail      hr_repository.ShiftDao
 	daoPlatformBusiness platform_repository.BusinessDao
 
 	child      ShiftProfileService
@@ -57,16 +73,9 @@ func NewShiftProfileService(props utils.Map) (ShiftProfileService, error) {
 
 	p := shiftProfileBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -74,8 +83,10 @@ func NewShiftProfileService(props utils.Map) (ShiftProfileService, error) {
 	p.businessId = businessId
 
 	// Instantiate other services
-	p.daoShift = hr_repository.NewShiftProfileDao(p.dbRegion.GetClient(), p.businessId)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoShift = p.NewShiftProfileDao(p.businessId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoShiftDetail = p.NewShiftDao(p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -92,8 +103,7 @@ func NewShiftProfileService(props utils.Map) (ShiftProfileService, error) {
 }
 
 func (p *shiftProfileBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -132,20 +142,20 @@ func (p *shiftProfileBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var shiftProfileId string
+	// Validate the payload fields
+	err := normalizePayload[ShiftProfile](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_SHIFT_PROFILE_ID]
-	if dataok {
-		shiftProfileId = strings.ToLower(dataval.(string))
-	} else {
-		shiftProfileId = utils.GenerateUniqueId("sftprof")
-		log.Println("Unique Account ID", shiftProfileId)
+	shiftProfileId, err := getPayloadId(indata, hr_common.FLD_SHIFT_PROFILE_ID, ID_PREFIX_SHIFT_PROFILE)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_SHIFT_PROFILE_ID] = shiftProfileId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	log.Println("Provided Account ID:", shiftProfileId)
 
-	_, err := p.daoShift.Get(shiftProfileId)
+	_, err = p.daoShift.Get(shiftProfileId)
 	if err == nil {
 		err := &utils.AppError{
 			ErrorCode:   "S30102",
@@ -158,6 +168,12 @@ func (p *shiftProfileBaseService) Create(indata utils.Map) (utils.Map, error) {
 	// 	return indata, err
 	// }
 
+	// Shifts of the profile shouldn't overlap
+	err = p.validateShifts(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoShift.Create(indata)
 	if err != nil {
 		return indata, err
@@ -171,6 +187,12 @@ func (p *shiftProfileBaseService) Update(shiftProfileId string, indata utils.Map
 
 	log.Println("ShiftProfileService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[ShiftProfile](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoShift.Get(shiftProfileId)
 	if err != nil {
 		return data, err
@@ -186,6 +208,12 @@ func (p *shiftProfileBaseService) Update(shiftProfileId string, indata utils.Map
 	// 	return indata, err
 	// }
 
+	// Shifts of the profile shouldn't overlap
+	err = p.validateShifts(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err = p.daoShift.Update(shiftProfileId, indata)
 	log.Println("ShiftProfileService::Update - End ", err)
 	return data, err
@@ -196,6 +224,12 @@ func (p *shiftProfileBaseService) Delete(shiftProfileId string, delete_permanent
 
 	log.Println("ShiftProfileService::Delete - Begin", shiftProfileId)
 
+	// Records still referring the shift profile can't be deleted
+	err := checkReferences(p.getReferences(), "Shift Profile", shiftProfileId)
+	if err != nil {
+		return err
+	}
+
 	daoShift := p.daoShift
 	if delete_permanent {
 		result, err := daoShift.Delete(shiftProfileId)
@@ -216,12 +250,53 @@ func (p *shiftProfileBaseService) Delete(shiftProfileId string, delete_permanent
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the shift profile to another shift profile
+// and delete the shift profile
+//
+// ************************************************************************
+func (p *shiftProfileBaseService) DeleteAndReassign(shiftProfileId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("ShiftProfileService::DeleteAndReassign - Begin", shiftProfileId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Shift Profile", p.daoShift, p.getReferences(), shiftProfileId, reassign_id, func() error {
+		return p.Delete(shiftProfileId, delete_permanent)
+	})
+	log.Println("ShiftProfileService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the shift profile
+func (p *shiftProfileBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_SHIFT_PROFILE_ID),
+	}
+}
+
 func (p *shiftProfileBaseService) errorReturn(err error) (ShiftProfileService, error) {
 	// Close the Database Connection
 	p.EndService()
 	return nil, err
 }
 
+// validateShifts - Verify the shifts of the profile exist and the rotation doesn't overlap
+func (p *shiftProfileBaseService) validateShifts(indata utils.Map) error {
+
+	_, errRotation := utils.GetMemberData(indata, FLD_SHIFT_PROFILE_ROTATION)
+	_, errShift := utils.GetMemberData(indata, hr_common.FLD_SHIFT_ID)
+	if errRotation != nil && errShift != nil {
+		// Shifts not changed
+		return nil
+	}
+
+	shifts, err := getProfileShifts(p.daoShiftDetail, indata, utils.Map{})
+	if err != nil {
+		return err
+	}
+
+	return validateShiftsOverlap(shifts)
+}
+
 // func (p *shiftProfileBaseService) validateTimeFormat(indata utils.Map) error {
 // 	// Convert Time string to Date Format
 // 	shiftFromTime, err := utils.GetMemberDataStr(indata, hr_common.FLD_SHIFT_FROM)
@@ -251,3 +326,143 @@ func (p *shiftProfileBaseService) errorReturn(err error) (ShiftProfileService, e
 
 // 	return nil
 // }
+
+// getWeekOffs - Get the Week-Off days of the shift profile
+func getWeekOffs(shiftProfileInfo utils.Map) map[time.Weekday]bool {
+
+	dataVal, err := utils.GetMemberData(shiftProfileInfo, FLD_SHIFT_PROFILE_WEEK_OFFS)
+	if err != nil {
+		return defaultWeekOffs
+	}
+
+	weekOffList, ok := toSlice(dataVal)
+	if !ok {
+		return defaultWeekOffs
+	}
+
+	weekOffs := map[time.Weekday]bool{}
+	for _, weekOff := range weekOffList {
+		if day, ok := parseWeekday(weekOff); ok {
+			weekOffs[day] = true
+		}
+	}
+	return weekOffs
+}
+
+// getStaffWeekOffs - Get the Week-Offs from the shift profile assigned to the staff
+func getStaffWeekOffs(daoShiftProfile hr_repository.ShiftProfileDao, staffInfo utils.Map) map[time.Weekday]bool {
+
+	shiftProfileId, err := getStaffDataStr(staffInfo, hr_common.FLD_SHIFT_PROFILE_ID)
+	if err != nil {
+		return defaultWeekOffs
+	}
+
+	shiftProfileInfo, err := daoShiftProfile.Get(shiftProfileId)
+	if err != nil {
+		return defaultWeekOffs
+	}
+
+	return getWeekOffs(shiftProfileInfo)
+}
+
+// getRotationShifts - Get the shift ids of the rotation pattern, single shift_id of the profile is
+// taken as a rotation of one shift
+func getRotationShifts(shiftProfileInfo utils.Map) []string {
+
+	shiftIds := []string{}
+
+	dataVal, err := utils.GetMemberData(shiftProfileInfo, FLD_SHIFT_PROFILE_ROTATION)
+	if err == nil {
+		rotation, _ := toSlice(dataVal)
+		for _, item := range rotation {
+			if shiftId, ok := item.(string); ok && shiftId != "" {
+				shiftIds = append(shiftIds, shiftId)
+			}
+		}
+	}
+
+	if len(shiftIds) == 0 {
+		shiftId, err := utils.GetMemberDataStr(shiftProfileInfo, hr_common.FLD_SHIFT_ID)
+		if err == nil && shiftId != "" {
+			shiftIds = append(shiftIds, shiftId)
+		}
+	}
+	return shiftIds
+}
+
+// getProfileShifts - Get the shifts of the shift profile, the given shifts are used in place
+// of the stored ones
+func getProfileShifts(daoShift hr_repository.ShiftDao, shiftProfileInfo utils.Map, overrides utils.Map) ([]utils.Map, error) {
+
+	shifts := []utils.Map{}
+	for _, shiftId := range getRotationShifts(shiftProfileInfo) {
+		if shiftInfo, ok := toMap(overrides[shiftId]); ok {
+			shifts = append(shifts, shiftInfo)
+			continue
+		}
+
+		shiftInfo, err := daoShift.Get(shiftId)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_SHIFT,
+				ErrorMsg:    "Invalid Shift",
+				ErrorDetail: "Shift " + shiftId + " is not exist"}
+			return nil, err
+		}
+		shifts = append(shifts, shiftInfo)
+	}
+	return shifts, nil
+}
+
+// validateShiftsOverlap - Verify the shifts of the profile don't overlap on consecutive days. Rotation
+// days, week-offs and shift swaps can place any shift of the profile on the day after any other, so
+// each pair is checked both ways, e.g. a cross-midnight shift running into the start of another shift
+func validateShiftsOverlap(shifts []utils.Map) error {
+
+	// Any date serves to compare the timings
+	shiftDate := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// Shift repeated in the rotation is checked once
+	shiftIds := map[string]bool{}
+	uniqueShifts := []utils.Map{}
+	for _, shiftInfo := range shifts {
+		shiftId, _ := utils.GetMemberDataStr(shiftInfo, hr_common.FLD_SHIFT_ID)
+		if !shiftIds[shiftId] {
+			shiftIds[shiftId] = true
+			uniqueShifts = append(uniqueShifts, shiftInfo)
+		}
+	}
+
+	if len(uniqueShifts) < 2 {
+		// Shift running every day can't exceed a day
+		return nil
+	}
+
+	for i := range uniqueShifts {
+		start, end, err := getShiftWindow(uniqueShifts[i], shiftDate)
+		if err != nil {
+			continue
+		}
+
+		for next := range uniqueShifts {
+			if next == i {
+				continue
+			}
+			nextStart, nextEnd, err := getShiftWindow(uniqueShifts[next], shiftDate.AddDate(0, 0, 1))
+			if err != nil {
+				continue
+			}
+
+			if getOverlapDuration(start, end, nextStart, nextEnd) > 0 {
+				shiftId, _ := utils.GetMemberDataStr(uniqueShifts[i], hr_common.FLD_SHIFT_ID)
+				nextShiftId, _ := utils.GetMemberDataStr(uniqueShifts[next], hr_common.FLD_SHIFT_ID)
+				err := &utils.AppError{
+					ErrorCode:   ERRCODE_SHIFT_OVERLAP,
+					ErrorMsg:    "Overlapping Shifts",
+					ErrorDetail: fmt.Sprintf("Shift %s runs into the shift %s worked on the next day", shiftId, nextShiftId)}
+				return err
+			}
+		}
+	}
+	return nil
+}
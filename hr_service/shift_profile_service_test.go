@@ -0,0 +1,50 @@
+package hr_service
+
+import (
+	"testing"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestShiftsOverlap(t *testing.T) {
+
+	shifts := map[string]utils.Map{
+		"early": {hr_common.FLD_SHIFT_ID: "early", hr_common.FLD_SHIFT_FROM: "05:00:00", hr_common.FLD_SHIFT_TO: "13:00:00"},
+		"day":   {hr_common.FLD_SHIFT_ID: "day", hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00"},
+		"night": {hr_common.FLD_SHIFT_ID: "night", hr_common.FLD_SHIFT_FROM: "22:00:00", hr_common.FLD_SHIFT_TO: "06:00:00"},
+		"full": {hr_common.FLD_SHIFT_ID: "full", hr_common.FLD_SHIFT_FROM: "08:00:00", hr_common.FLD_SHIFT_TO: "08:00:00",
+			FLD_SHIFT_TO_DAY_OFFSET: 1},
+	}
+
+	tests := []struct {
+		name     string
+		rotation []string
+		overlap  bool
+	}{
+		{"single shift", []string{"night"}, false},
+		{"repeated shift", []string{"night", "night"}, false},
+		{"day & night", []string{"day", "night"}, false},
+		{"night before early", []string{"early", "night"}, true},
+		// Night & early are not consecutive in the rotation, a swap places them on consecutive days
+		{"night & early apart", []string{"night", "day", "early"}, true},
+		{"full day & day", []string{"full", "day"}, false},
+		{"full day & early", []string{"full", "early"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rotation := []utils.Map{}
+			for _, shiftId := range test.rotation {
+				rotation = append(rotation, shifts[shiftId])
+			}
+
+			err := validateShiftsOverlap(rotation)
+			if test.overlap {
+				assertErrorCode(t, err, ERRCODE_SHIFT_OVERLAP)
+			} else if err != nil {
+				t.Errorf("Expected no overlap, got %v", err)
+			}
+		})
+	}
+}
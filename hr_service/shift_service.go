@@ -1,19 +1,44 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Shift Break & Grace Fields
+	FLD_SHIFT_BREAK_FROM       = "break_from"
+	FLD_SHIFT_BREAK_TO         = "break_to"
+	FLD_SHIFT_LATE_GRACE_MINS  = "late_grace_mins"
+	FLD_SHIFT_EARLY_GRACE_MINS = "early_grace_mins"
+
+	// Shift End Fields, shift_to falls on the shift date plus the day offset
+	// (1 for shifts crossing midnight) and the duration is from shift_from
+	FLD_SHIFT_TO_DAY_OFFSET = "shift_to_day_offset"
+	FLD_SHIFT_DURATION_MINS = "duration_mins"
+
+	// Shift duration limits in minutes
+	MIN_SHIFT_DURATION_MINS = 30
+	MAX_SHIFT_DURATION_MINS = 24 * 60
+
+	// Shift Validation Error Codes
+	ERRCODE_INVALID_SHIFT = "S30141"
+	ERRCODE_SHIFT_OVERLAP = "S30142"
+)
+
+// Shift fields validated for consistency when any of them changes
+var shiftTimingFields = []string{
+	hr_common.FLD_SHIFT_FROM, hr_common.FLD_SHIFT_TO, FLD_SHIFT_TO_DAY_OFFSET, FLD_SHIFT_DURATION_MINS,
+	FLD_SHIFT_BREAK_FROM, FLD_SHIFT_BREAK_TO, FLD_SHIFT_LATE_GRACE_MINS, FLD_SHIFT_EARLY_GRACE_MINS,
+}
+
 // ShiftService - Accounts Service structure
 type ShiftService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -22,6 +47,7 @@ type ShiftService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(shiftId string, indata utils.Map) (utils.Map, error)
 	Delete(shiftId string, delete_permanent bool) error
+	DeleteAndReassign(shiftId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -32,9 +58,10 @@ type ShiftService interface {
 
 // shiftBaseService - Accounts Service structure
 type shiftBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoShift            hr_repository.ShiftDao
+	daoStaff            hr_repository.StaffDao
+	daoShiftProfile     hr_repository.ShiftProfileDao
 	daoPlatformBusiness platform_repository.BusinessDao
 
 	child      ShiftService
@@ -58,16 +85,9 @@ func NewShiftService(props utils.Map) (ShiftService, error) {
 
 	p := shiftBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -75,8 +95,10 @@ func NewShiftService(props utils.Map) (ShiftService, error) {
 	p.businessId = businessId
 
 	// Instantiate other services
-	p.daoShift = hr_repository.NewShiftDao(p.dbRegion.GetClient(), p.businessId)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoShift = p.NewShiftDao(p.businessId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoShiftProfile = p.NewShiftProfileDao(p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -93,8 +115,7 @@ func NewShiftService(props utils.Map) (ShiftService, error) {
 }
 
 func (p *shiftBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -133,20 +154,20 @@ func (p *shiftBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var shiftId string
+	// Validate the payload fields
+	err := normalizePayload[Shift](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_SHIFT_ID]
-	if dataok {
-		shiftId = strings.ToLower(dataval.(string))
-	} else {
-		shiftId = utils.GenerateUniqueId("shift")
-		log.Println("Unique Account ID", shiftId)
+	shiftId, err := getPayloadId(indata, hr_common.FLD_SHIFT_ID, ID_PREFIX_SHIFT)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_SHIFT_ID] = shiftId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	log.Println("Provided Account ID:", shiftId)
 
-	_, err := p.daoShift.Get(shiftId)
+	_, err = p.daoShift.Get(shiftId)
 	if err == nil {
 		err := &utils.AppError{
 			ErrorCode:   "S30102",
@@ -155,7 +176,20 @@ func (p *shiftBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return indata, err
 	}
 	// Validate TimeFormat
-	if p.validateTimeFormat(indata) != nil {
+	err = p.validateTimeFormat(indata)
+	if err != nil {
+		return indata, err
+	}
+
+	// Derive the day offset & duration of shift end
+	err = p.normalizeShiftEnd(indata, utils.Map{})
+	if err != nil {
+		return indata, err
+	}
+
+	// Validate the shift timings are consistent
+	err = validateShiftTimings(indata)
+	if err != nil {
 		return indata, err
 	}
 
@@ -172,6 +206,12 @@ func (p *shiftBaseService) Update(shiftId string, indata utils.Map) (utils.Map,
 
 	log.Println("ShiftService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Shift](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoShift.Get(shiftId)
 	if err != nil {
 		return data, err
@@ -182,11 +222,34 @@ func (p *shiftBaseService) Update(shiftId string, indata utils.Map) (utils.Map,
 	delete(indata, hr_common.FLD_BUSINESS_ID)
 
 	// Validate the TimeFormat
-	if p.validateTimeFormat(indata) != nil {
+	err = p.validateTimeFormat(indata)
+	if err != nil {
 		log.Println("ShiftService::convertStrToTimeFormat - Error ", err)
 		return indata, err
 	}
 
+	// Derive the day offset & duration of shift end
+	err = p.normalizeShiftEnd(indata, data)
+	if err != nil {
+		return indata, err
+	}
+
+	if isShiftTimingChanged(indata) {
+		shiftInfo := utils.MergeMap(utils.CopyMap(data), indata, true)
+
+		// Validate the shift timings are consistent
+		err = validateShiftTimings(shiftInfo)
+		if err != nil {
+			return indata, err
+		}
+
+		// Changed timings shouldn't overlap other shifts of the profiles
+		err = p.validateProfilesOverlap(shiftId, shiftInfo)
+		if err != nil {
+			return indata, err
+		}
+	}
+
 	data, err = p.daoShift.Update(shiftId, indata)
 	log.Println("ShiftService::Update - End ", err)
 	return data, err
@@ -197,6 +260,12 @@ func (p *shiftBaseService) Delete(shiftId string, delete_permanent bool) error {
 
 	log.Println("ShiftService::Delete - Begin", shiftId)
 
+	// Records still referring the shift can't be deleted
+	err := checkReferences(p.getReferences(), "Shift", shiftId)
+	if err != nil {
+		return err
+	}
+
 	daoShift := p.daoShift
 	if delete_permanent {
 		result, err := daoShift.Delete(shiftId)
@@ -217,6 +286,35 @@ func (p *shiftBaseService) Delete(shiftId string, delete_permanent bool) error {
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the shift to another shift
+// and delete the shift
+//
+// ************************************************************************
+func (p *shiftBaseService) DeleteAndReassign(shiftId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("ShiftService::DeleteAndReassign - Begin", shiftId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Shift", p.daoShift, p.getReferences(), shiftId, reassign_id, func() error {
+		return p.Delete(shiftId, delete_permanent)
+	})
+	log.Println("ShiftService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the shift
+func (p *shiftBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_SHIFT_ID),
+		{
+			referenceType: REFERENCE_TYPE_SHIFT_PROFILE,
+			idField:       hr_common.FLD_SHIFT_PROFILE_ID,
+			fields:        []string{hr_common.FLD_SHIFT_ID, FLD_SHIFT_PROFILE_ROTATION},
+			dao:           p.daoShiftProfile,
+		},
+	}
+}
+
 func (p *shiftBaseService) errorReturn(err error) (ShiftService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -252,3 +350,246 @@ func (p *shiftBaseService) validateTimeFormat(indata utils.Map) error {
 
 	return nil
 }
+
+// validateProfilesOverlap - Verify the changed shift doesn't overlap the other shifts of the
+// shift profiles containing it
+func (p *shiftBaseService) validateProfilesOverlap(shiftId string, shiftInfo utils.Map) error {
+
+	filter := fmt.Sprintf(`{"%s":"%s","%s":false}`,
+		FLD_SHIFT_PROFILE_ROTATION, shiftId,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoShiftProfile.List(filter, "", 0, 0)
+	if err != nil {
+		return nil
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return nil
+	}
+
+	for _, shiftProfileInfo := range dataList.([]utils.Map) {
+		shifts, err := getProfileShifts(p.daoShift, shiftProfileInfo, utils.Map{shiftId: shiftInfo})
+		if err != nil {
+			return err
+		}
+
+		err = validateShiftsOverlap(shifts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeShiftEnd - Derive the explicit day offset & duration of the shift end, so a shift
+// crossing midnight (e.g. 22:00 - 06:00) is stored unambiguously. The shift_to is derived
+// from the duration when only duration_mins is given
+func (p *shiftBaseService) normalizeShiftEnd(indata utils.Map, existing utils.Map) error {
+
+	_, errFrom := utils.GetMemberData(indata, hr_common.FLD_SHIFT_FROM)
+	_, errTo := utils.GetMemberData(indata, hr_common.FLD_SHIFT_TO)
+	_, errOffset := utils.GetMemberData(indata, FLD_SHIFT_TO_DAY_OFFSET)
+	durationMins, errDuration := utils.GetMemberDataInt(indata, FLD_SHIFT_DURATION_MINS, true)
+	if errFrom != nil && errTo != nil && errOffset != nil && errDuration != nil {
+		// Shift timings not changed
+		return nil
+	}
+
+	shiftInfo := utils.MergeMap(utils.CopyMap(existing), indata, true)
+
+	// Any date serves to derive the offset
+	shiftDate := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	shiftStart, err := getShiftTime(shiftInfo, hr_common.FLD_SHIFT_FROM, shiftDate)
+	if err != nil {
+		// Shift without timings
+		return nil
+	}
+
+	if errOffset == nil {
+		dayOffset, err := utils.GetMemberDataInt(indata, FLD_SHIFT_TO_DAY_OFFSET, true)
+		if err != nil || dayOffset < 0 || dayOffset > 1 {
+			err := &utils.AppError{
+				ErrorCode:   "S30102",
+				ErrorMsg:    "Invalid Day Offset",
+				ErrorDetail: FLD_SHIFT_TO_DAY_OFFSET + " should be 0 or 1"}
+			return err
+		}
+	} else {
+		// Offset derived from the changed timings
+		delete(shiftInfo, FLD_SHIFT_TO_DAY_OFFSET)
+	}
+
+	// Same start & end is a 24-hour shift only when the day offset or the duration is given
+	shiftTo, err := getShiftTime(shiftInfo, hr_common.FLD_SHIFT_TO, shiftDate)
+	if err == nil && shiftTo.Equal(shiftStart) && errOffset != nil && errDuration != nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_SHIFT,
+			ErrorMsg:    "Invalid Shift",
+			ErrorDetail: "Shift start and end should not be the same, unless the duration or day offset is given"}
+		return err
+	}
+
+	if errTo != nil && errDuration == nil {
+		// Shift end derived from the duration
+		shiftEnd := shiftStart.Add(time.Duration(durationMins) * time.Minute)
+		shiftInfo[hr_common.FLD_SHIFT_TO] = shiftEnd.Format(time.TimeOnly)
+		shiftInfo[FLD_SHIFT_TO_DAY_OFFSET] = int(truncateToDate(shiftEnd).Sub(shiftDate).Hours() / 24)
+		indata[hr_common.FLD_SHIFT_TO] = shiftInfo[hr_common.FLD_SHIFT_TO]
+	}
+
+	_, shiftEnd, err := getShiftWindow(shiftInfo, shiftDate)
+	if err != nil {
+		// Shift without end time
+		return nil
+	}
+
+	indata[FLD_SHIFT_TO_DAY_OFFSET] = int(truncateToDate(shiftEnd).Sub(shiftDate).Hours() / 24)
+	indata[FLD_SHIFT_DURATION_MINS] = int(shiftEnd.Sub(shiftStart).Minutes())
+
+	return nil
+}
+
+// getShiftWindow - Get the Shift start & end time for the given shift date, the shift end
+// falls on the next day as per the day offset or when it is not later than the shift start
+func getShiftWindow(shiftInfo utils.Map, shiftDate time.Time) (time.Time, time.Time, error) {
+
+	shiftStart, err := getShiftTime(shiftInfo, hr_common.FLD_SHIFT_FROM, shiftDate)
+	if err != nil {
+		return shiftStart, shiftStart, err
+	}
+
+	shiftEnd, err := getShiftTime(shiftInfo, hr_common.FLD_SHIFT_TO, shiftDate)
+	if err != nil {
+		// Shift end from the duration
+		durationMins, errDuration := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_DURATION_MINS, true)
+		if errDuration != nil || durationMins <= 0 {
+			return shiftStart, shiftEnd, err
+		}
+		return shiftStart, shiftStart.Add(time.Duration(durationMins) * time.Minute), nil
+	}
+
+	dayOffset, err := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_TO_DAY_OFFSET, true)
+	if err == nil {
+		shiftEnd = shiftEnd.AddDate(0, 0, dayOffset)
+	} else if !shiftEnd.After(shiftStart) {
+		// Shift ends on the next day
+		shiftEnd = shiftEnd.AddDate(0, 0, 1)
+	}
+
+	return shiftStart, shiftEnd, nil
+}
+
+// getBreakWindow - Get the Break start & end time within the given shift window
+func getBreakWindow(shiftInfo utils.Map, shiftStart time.Time) (time.Time, time.Time, error) {
+
+	breakStart, err := getShiftTime(shiftInfo, FLD_SHIFT_BREAK_FROM, shiftStart)
+	if err != nil {
+		return breakStart, breakStart, err
+	}
+
+	breakEnd, err := getShiftTime(shiftInfo, FLD_SHIFT_BREAK_TO, shiftStart)
+	if err != nil {
+		return breakStart, breakEnd, err
+	}
+
+	// Break falls after midnight
+	if breakStart.Before(shiftStart) {
+		breakStart = breakStart.AddDate(0, 0, 1)
+		breakEnd = breakEnd.AddDate(0, 0, 1)
+	}
+	if !breakEnd.After(breakStart) {
+		breakEnd = breakEnd.AddDate(0, 0, 1)
+	}
+
+	return breakStart, breakEnd, nil
+}
+
+// getShiftTime - Combine the time-only shift field with the given date
+func getShiftTime(shiftInfo utils.Map, fieldName string, shiftDate time.Time) (time.Time, error) {
+
+	timeStr, err := utils.GetMemberDataStr(shiftInfo, fieldName)
+	if err != nil {
+		return shiftDate, err
+	}
+
+	timeVal, err := time.Parse(time.TimeOnly, timeStr)
+	if err != nil {
+		return shiftDate, err
+	}
+
+	return time.Date(shiftDate.Year(), shiftDate.Month(), shiftDate.Day(),
+		timeVal.Hour(), timeVal.Minute(), timeVal.Second(), 0, shiftDate.Location()), nil
+}
+
+// isShiftTimingChanged - Check whether any of the shift timing fields is in the data
+func isShiftTimingChanged(indata utils.Map) bool {
+	for _, field := range shiftTimingFields {
+		if _, ok := indata[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateShiftTimings - Validate the shift has the minimum duration, the break window falls
+// inside the shift and the grace periods don't cross each other
+func validateShiftTimings(shiftInfo utils.Map) error {
+
+	invalidShift := func(detail string) error {
+		return &utils.AppError{ErrorCode: ERRCODE_INVALID_SHIFT, ErrorMsg: "Invalid Shift", ErrorDetail: detail}
+	}
+
+	// Any date serves to compare the timings
+	shiftDate := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	shiftStart, shiftEnd, err := getShiftWindow(shiftInfo, shiftDate)
+	if err != nil {
+		// Shift without timings
+		return nil
+	}
+
+	durationMins := int(shiftEnd.Sub(shiftStart).Minutes())
+	if durationMins < MIN_SHIFT_DURATION_MINS {
+		return invalidShift(fmt.Sprintf("Shift duration should be minimum %d minutes", MIN_SHIFT_DURATION_MINS))
+	}
+	if durationMins > MAX_SHIFT_DURATION_MINS {
+		return invalidShift(fmt.Sprintf("Shift duration should not exceed %d minutes", MAX_SHIFT_DURATION_MINS))
+	}
+
+	_, errBreakFrom := utils.GetMemberData(shiftInfo, FLD_SHIFT_BREAK_FROM)
+	_, errBreakTo := utils.GetMemberData(shiftInfo, FLD_SHIFT_BREAK_TO)
+	if errBreakFrom == nil || errBreakTo == nil {
+		if errBreakFrom != nil || errBreakTo != nil {
+			return invalidShift("Both " + FLD_SHIFT_BREAK_FROM + " and " + FLD_SHIFT_BREAK_TO + " should be given")
+		}
+
+		breakStart, errStart := getShiftTime(shiftInfo, FLD_SHIFT_BREAK_FROM, shiftStart)
+		breakEnd, errEnd := getShiftTime(shiftInfo, FLD_SHIFT_BREAK_TO, shiftStart)
+		if errStart != nil || errEnd != nil {
+			return invalidShift("Break time should be in hh:mm:ss format")
+		}
+		if breakStart.Equal(breakEnd) {
+			return invalidShift("Break should not be of zero length")
+		}
+
+		breakStart, breakEnd, _ = getBreakWindow(shiftInfo, shiftStart)
+		if breakStart.Before(shiftStart) || breakEnd.After(shiftEnd) {
+			return invalidShift("Break window should be within the shift")
+		}
+	}
+
+	lateGrace, errLate := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_LATE_GRACE_MINS, true)
+	earlyGrace, errEarly := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_EARLY_GRACE_MINS, true)
+	if _, ok := shiftInfo[FLD_SHIFT_LATE_GRACE_MINS]; ok && (errLate != nil || lateGrace < 0) {
+		return invalidShift(FLD_SHIFT_LATE_GRACE_MINS + " should be a positive number")
+	}
+	if _, ok := shiftInfo[FLD_SHIFT_EARLY_GRACE_MINS]; ok && (errEarly != nil || earlyGrace < 0) {
+		return invalidShift(FLD_SHIFT_EARLY_GRACE_MINS + " should be a positive number")
+	}
+	if lateGrace+earlyGrace >= durationMins {
+		return invalidShift("Late-In grace should end before the Early-Out grace starts")
+	}
+
+	return nil
+}
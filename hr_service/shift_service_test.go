@@ -0,0 +1,72 @@
+package hr_service
+
+import (
+	"testing"
+
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestShiftValidation(t *testing.T) {
+
+	_, props := newTestProvider()
+	shiftService, err := NewShiftService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shiftService.EndService()
+
+	tests := []struct {
+		name      string
+		indata    utils.Map
+		errorCode string
+		dayOffset int
+		duration  int
+	}{
+		{"day shift", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00",
+			FLD_SHIFT_BREAK_FROM: "13:00:00", FLD_SHIFT_BREAK_TO: "14:00:00"}, "", 0, 540},
+		{"night shift", utils.Map{hr_common.FLD_SHIFT_FROM: "22:00:00", hr_common.FLD_SHIFT_TO: "06:00:00",
+			FLD_SHIFT_BREAK_FROM: "02:00:00", FLD_SHIFT_BREAK_TO: "02:30:00"}, "", 1, 480},
+		{"24-hour shift", utils.Map{hr_common.FLD_SHIFT_FROM: "08:00:00", hr_common.FLD_SHIFT_TO: "08:00:00",
+			FLD_SHIFT_TO_DAY_OFFSET: 1}, "", 1, 1440},
+		{"same start & end", utils.Map{hr_common.FLD_SHIFT_FROM: "08:00:00", hr_common.FLD_SHIFT_TO: "08:00:00"},
+			ERRCODE_INVALID_SHIFT, 0, 0},
+		{"too short", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "09:15:00"},
+			ERRCODE_INVALID_SHIFT, 0, 0},
+		{"break outside", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00",
+			FLD_SHIFT_BREAK_FROM: "17:30:00", FLD_SHIFT_BREAK_TO: "18:30:00"}, ERRCODE_INVALID_SHIFT, 0, 0},
+		{"break without end", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00",
+			FLD_SHIFT_BREAK_FROM: "13:00:00"}, ERRCODE_INVALID_SHIFT, 0, 0},
+		{"grace crossing", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "13:00:00",
+			FLD_SHIFT_LATE_GRACE_MINS: 120, FLD_SHIFT_EARLY_GRACE_MINS: 120}, ERRCODE_INVALID_SHIFT, 0, 0},
+		{"invalid time", utils.Map{hr_common.FLD_SHIFT_FROM: "9am", hr_common.FLD_SHIFT_TO: "18:00:00"},
+			ERRCODE_INVALID_PAYLOAD, 0, 0},
+		{"invalid day offset", utils.Map{hr_common.FLD_SHIFT_FROM: "09:00:00", hr_common.FLD_SHIFT_TO: "18:00:00",
+			FLD_SHIFT_TO_DAY_OFFSET: 2}, ERRCODE_INVALID_PAYLOAD, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := shiftService.Create(test.indata)
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			shiftId, _ := utils.GetMemberDataStr(data, hr_common.FLD_SHIFT_ID)
+			shiftInfo, err := shiftService.Get(shiftId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dayOffset, _ := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_TO_DAY_OFFSET, true)
+			duration, _ := utils.GetMemberDataInt(shiftInfo, FLD_SHIFT_DURATION_MINS, true)
+			if dayOffset != test.dayOffset || duration != test.duration {
+				t.Errorf("Expected day offset %d & duration %d, got %d & %d", test.dayOffset, test.duration, dayOffset, duration)
+			}
+		})
+	}
+}
@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type Staff_categoryService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(Staff_categoryId string, indata utils.Map) (utils.Map, error)
 	Delete(Staff_categoryId string, delete_permanent bool) error
+	DeleteAndReassign(Staff_categoryId string, reassign_id string, delete_permanent bool) error
 	DeleteAll(delete_permanent bool) error
 
 	BeginTransaction()
@@ -32,8 +30,7 @@ type Staff_categoryService interface {
 
 // Staff_categoryBaseService - Accounts Service structure
 type Staff_categoryBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoStaff_category   hr_repository.Staff_categoryDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	daoPlatformAppUser  platform_repository.AppUserDao
@@ -61,27 +58,20 @@ func NewStaff_categoryService(props utils.Map) (Staff_categoryService, error) {
 
 	p := Staff_categoryBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId & StaffId
 	p.businessId = businessId
 
 	// Instantiate other services
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
-	p.daoPlatformAppUser = platform_repository.NewAppUserDao(p.GetClient())
-	p.daoStaff_category = hr_repository.NewStaff_categoryeDao(p.dbRegion.GetClient(), p.businessId, p.staffId)
-	p.daoStaff = hr_repository.NewStaffDao(p.dbRegion.GetClient(), p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
+	p.daoStaff_category = p.NewStaffCategoryDao(p.businessId, p.staffId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -110,8 +100,7 @@ func NewStaff_categoryService(props utils.Map) (Staff_categoryService, error) {
 }
 
 func (p *Staff_categoryBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -153,20 +142,20 @@ func (p *Staff_categoryBaseService) Create(indata utils.Map) (utils.Map, error)
 
 	log.Println("UserService::Create - Begin")
 
-	var Staff_categoryId string
+	// Validate the payload fields
+	err := normalizePayload[StaffCategory](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_STAFF_CATEGORY_ID]
-	if dataok {
-		Staff_categoryId = strings.ToLower(dataval.(string))
-	} else {
-		Staff_categoryId = utils.GenerateUniqueId("stfcat")
-		log.Println("Unique Account ID", Staff_categoryId)
+	Staff_categoryId, err := getPayloadId(indata, hr_common.FLD_STAFF_CATEGORY_ID, ID_PREFIX_STAFF_CATEGORY)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_STAFF_CATEGORY_ID] = Staff_categoryId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	log.Println("Provided Account ID:", Staff_categoryId)
 
-	_, err := p.daoStaff_category.Get(Staff_categoryId)
+	_, err = p.daoStaff_category.Get(Staff_categoryId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return utils.Map{}, err
@@ -185,6 +174,12 @@ func (p *Staff_categoryBaseService) Update(Staff_categoryId string, indata utils
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[StaffCategory](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoStaff_category.Get(Staff_categoryId)
 	if err != nil {
 		return data, err
@@ -209,6 +204,12 @@ func (p *Staff_categoryBaseService) Delete(Staff_categoryId string, delete_perma
 		return err
 	}
 
+	// Records still referring the staff category can't be deleted
+	err = checkReferences(p.getReferences(), "Staff Category", Staff_categoryId)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoStaff_category.Delete(Staff_categoryId)
 		if err != nil {
@@ -228,6 +229,29 @@ func (p *Staff_categoryBaseService) Delete(Staff_categoryId string, delete_perma
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the staff category to another staff category
+// and delete the staff category
+//
+// ************************************************************************
+func (p *Staff_categoryBaseService) DeleteAndReassign(Staff_categoryId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("Staff_categoryService::DeleteAndReassign - Begin", Staff_categoryId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Staff Category", p.daoStaff_category, p.getReferences(), Staff_categoryId, reassign_id, func() error {
+		return p.Delete(Staff_categoryId, delete_permanent)
+	})
+	log.Println("Staff_categoryService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the staff category
+func (p *Staff_categoryBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_STAFF_CATEGORY_ID),
+	}
+}
+
 // ***********************************************
 // DeleteAll - Delete All Staff_category/Permissions for the staff
 //
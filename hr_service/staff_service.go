@@ -1,18 +1,98 @@
 package hr_service
 
 import (
+	"fmt"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// Staff Employment Fields
+	FLD_STAFF_DATE_OF_JOIN         = "date_of_join"
+	FLD_STAFF_DATE_OF_CONFIRMATION = "date_of_confirmation"
+	FLD_STAFF_DATE_OF_EXIT         = "date_of_exit"
+	FLD_STAFF_EXIT_TYPE            = "exit_type"
+	FLD_EMPLOYMENT_STATUS          = "employment_status"
+
+	// Employment History is kept in the Staff record, employment fields are derived from it
+	FLD_EMPLOYMENT_HISTORY        = "employment_history"
+	FLD_EMPLOYMENT_EVENT_ID       = "event_id"
+	FLD_EMPLOYMENT_EVENT_TYPE     = "event_type"
+	FLD_EMPLOYMENT_EFFECTIVE_DATE = "effective_date"
+	FLD_EMPLOYMENT_CHANGES        = "changes"
+	FLD_EMPLOYMENT_REMARKS        = "remarks"
+	FLD_EMPLOYMENT_AS_OF          = "as_of"
+
+	// Effective date of the next future dated event, the employment fields are derived again on the date
+	FLD_EMPLOYMENT_NEXT_DATE = "employment_next_date"
+
+	// Employment Event types
+	EMPLOYMENT_EVENT_JOIN      = "join"
+	EMPLOYMENT_EVENT_CONFIRM   = "confirm"
+	EMPLOYMENT_EVENT_TRANSFER  = "transfer"
+	EMPLOYMENT_EVENT_PROMOTE   = "promote"
+	EMPLOYMENT_EVENT_RESIGN    = "resign"
+	EMPLOYMENT_EVENT_TERMINATE = "terminate"
+	EMPLOYMENT_EVENT_REHIRE    = "rehire"
+
+	// Employment Status
+	EMPLOYMENT_STATUS_PROBATION  = "probation"
+	EMPLOYMENT_STATUS_CONFIRMED  = "confirmed"
+	EMPLOYMENT_STATUS_RESIGNED   = "resigned"
+	EMPLOYMENT_STATUS_TERMINATED = "terminated"
+
+	// Org Chart Fields
+	FLD_ORG_LEVEL       = "level"
+	FLD_ORG_MAX_DEPTH   = "max_depth"
+	MAX_REPORTING_CHAIN = 100
+
+	// Reporting Hierarchy Error Codes
+	ERRCODE_INVALID_REPORTING = "S30161"
+	ERRCODE_REPORTING_CYCLE   = "S30162"
+
+	// Employment History Error Codes
+	ERRCODE_INVALID_EMPLOYMENT_EVENT = "S30163"
+	ERRCODE_NOT_EMPLOYED             = "S30164"
+	ERRCODE_EMPLOYMENT_FIELD_CHANGE  = "S30165"
+)
+
+// employmentFields - Staff fields changed only through the employment events
+var employmentFields = []string{
+	hr_common.FLD_DEPARTMENT_ID,
+	hr_common.FLD_DESIGNATION_ID,
+	hr_common.FLD_POSITION_ID,
+	hr_common.FLD_POSITION_TYPE_ID,
+	hr_common.FLD_WORKLOCATION_ID,
+	hr_common.FLD_REPORTING_STAFF_ID,
+	hr_common.FLD_STAFFTYPE_ID,
+	hr_common.FLD_STAFF_CATEGORY_ID,
+}
+
+// employmentStatusFields - Staff fields derived from the employment status changed by the events
+var employmentStatusFields = []string{
+	FLD_STAFF_DATE_OF_JOIN,
+	FLD_STAFF_DATE_OF_CONFIRMATION,
+	FLD_STAFF_DATE_OF_EXIT,
+	FLD_STAFF_EXIT_TYPE,
+	FLD_EMPLOYMENT_STATUS,
+}
+
+// employmentEvent - Employment History event read from the Staff record
+type employmentEvent struct {
+	eventType     string
+	effectiveDate time.Time
+	changes       utils.Map
+	data          utils.Map
+}
+
 // StaffService - Accounts Service structure
 type StaffService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -22,6 +102,15 @@ type StaffService interface {
 	Update(staff_id string, indata utils.Map) (utils.Map, error)
 	Delete(staff_id string, delete_permanent bool) error
 
+	GetReportingChain(staff_id string) (utils.Map, error)
+	GetDirectReports(staff_id string) (utils.Map, error)
+	GetAllSubordinates(staff_id string, maxDepth int) (utils.Map, error)
+
+	AddEmploymentEvent(staff_id string, indata utils.Map) (utils.Map, error)
+	GetEmploymentHistory(staff_id string) (utils.Map, error)
+	GetAsOf(staff_id string, asOfDate string) (utils.Map, error)
+	ApplyDueEmploymentEvents() (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -31,8 +120,7 @@ type StaffService interface {
 
 // staffBaseService - Accounts Service structure
 type staffBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	daoPlatformAppUser  platform_repository.AppUserDao
@@ -57,16 +145,9 @@ func NewStaffService(props utils.Map) (StaffService, error) {
 
 	p := staffBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
-		p.CloseDatabaseService()
 		return nil, err
 	}
 
@@ -74,9 +155,9 @@ func NewStaffService(props utils.Map) (StaffService, error) {
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoStaff = hr_repository.NewStaffDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
-	p.daoPlatformAppUser = platform_repository.NewAppUserDao(p.GetClient())
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -93,8 +174,7 @@ func NewStaffService(props utils.Map) (StaffService, error) {
 }
 
 func (p *staffBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -121,6 +201,13 @@ func (p *staffBaseService) Get(staff_id string) (utils.Map, error) {
 	log.Printf("AccountService::FindByCode::  Begin %v", staff_id)
 
 	data, err := p.daoStaff.Get(staff_id)
+	if events := getEmploymentEvents(data); err == nil && len(events) > 0 {
+		// Future dated events take effect from their effective date
+		state, _, errState := replayEmploymentEvents(events, getToday())
+		if errState == nil {
+			applyEmploymentState(data, state)
+		}
+	}
 
 	p.mergereportingInfo(data)
 
@@ -140,22 +227,37 @@ func (p *staffBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	dataval, dataok := indata[hr_common.FLD_STAFF_ID]
-	if !dataok {
-		uid := utils.GenerateUniqueId("stf")
-		log.Println("Unique Account ID", uid)
-		indata[hr_common.FLD_STAFF_ID] = uid
-		dataval = indata[hr_common.FLD_STAFF_ID]
+	// Validate the payload fields
+	err := normalizePayload[Staff](indata, false)
+	if err != nil {
+		return indata, err
+	}
+
+	staffId, err := getPayloadId(indata, hr_common.FLD_STAFF_ID, ID_PREFIX_STAFF)
+	if err != nil {
+		return indata, err
 	}
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
-	log.Println("Provided Account ID:", dataval)
+	log.Println("Provided Account ID:", staffId)
 
-	_, err := p.daoStaff.Get(dataval.(string))
+	_, err = p.daoStaff.Get(staffId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
 	}
 
+	// Reporting staff shouldn't create a cycle in the hierarchy
+	err = p.validateReportingStaff(staffId, indata)
+	if err != nil {
+		return indata, err
+	}
+
+	// Employment History starts with the joining of the staff
+	err = p.seedEmploymentHistory(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoStaff.Create(indata)
 	if err != nil {
 		return indata, err
@@ -169,11 +271,44 @@ func (p *staffBaseService) Update(staff_id string, indata utils.Map) (utils.Map,
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[Staff](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoStaff.Get(staff_id)
 	if err != nil {
 		return data, err
 	}
 
+	// Reporting staff shouldn't create a cycle in the hierarchy
+	err = p.validateReportingStaff(staff_id, indata)
+	if err != nil {
+		return indata, err
+	}
+
+	// Employment History and the fields derived from it are changed only through the events
+	delete(indata, FLD_EMPLOYMENT_HISTORY)
+	delete(indata, FLD_EMPLOYMENT_NEXT_DATE)
+	events := getEmploymentEvents(data)
+	if len(events) > 0 {
+		state, _, err := replayEmploymentEvents(events, getToday())
+		if err != nil {
+			return indata, err
+		}
+
+		err = validateEmploymentFields(indata, state)
+		if err != nil {
+			return indata, err
+		}
+
+		// Keep the derived fields when the staff_data is replaced
+		if _, ok := indata[hr_common.FLD_STAFF_DATA]; ok {
+			applyEmploymentState(indata, state)
+		}
+	}
+
 	data, err = p.daoStaff.Update(staff_id, indata)
 	log.Println("AccountService::Update - End ")
 	return data, err
@@ -209,6 +344,352 @@ func (p *staffBaseService) Delete(staff_id string, delete_permanent bool) error
 	return nil
 }
 
+// ************************************************************************
+// GetReportingChain - Get the reporting staffs of the staff level by level
+// up to the top of the hierarchy
+//
+// ************************************************************************
+func (p *staffBaseService) GetReportingChain(staff_id string) (utils.Map, error) {
+
+	log.Println("StaffService::GetReportingChain - Begin", staff_id)
+
+	staffInfo, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []utils.Map{}
+	visited := map[string]bool{staff_id: true}
+	for level := 1; level <= MAX_REPORTING_CHAIN; level++ {
+		reportingStaffId, err := getStaffDataStr(staffInfo, hr_common.FLD_REPORTING_STAFF_ID)
+		if err != nil || reportingStaffId == "" {
+			// Reached the top of the hierarchy
+			break
+		}
+		if visited[reportingStaffId] {
+			log.Println("StaffService::GetReportingChain - Cycle at ", reportingStaffId)
+			break
+		}
+		visited[reportingStaffId] = true
+
+		staffInfo, err = p.daoStaff.Get(reportingStaffId)
+		if err != nil {
+			break
+		}
+		staffInfo[FLD_ORG_LEVEL] = level
+		p.mergeUserInfo(staffInfo)
+		chain = append(chain, staffInfo)
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staff_id,
+		db_common.LIST_RESULTSIZE: len(chain),
+		db_common.LIST_RESULT:     chain,
+	}
+
+	log.Println("StaffService::GetReportingChain - End", len(chain))
+	return response, nil
+}
+
+// ************************************************************************
+// GetDirectReports - Get the staffs reporting directly to the staff
+//
+// ************************************************************************
+func (p *staffBaseService) GetDirectReports(staff_id string) (utils.Map, error) {
+
+	log.Println("StaffService::GetDirectReports - Begin", staff_id)
+
+	_, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := p.listDirectReports(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, staffInfo := range reports {
+		staffInfo[FLD_ORG_LEVEL] = 1
+		p.mergeUserInfo(staffInfo)
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staff_id,
+		db_common.LIST_RESULTSIZE: len(reports),
+		db_common.LIST_RESULT:     reports,
+	}
+
+	log.Println("StaffService::GetDirectReports - End", len(reports))
+	return response, nil
+}
+
+// ************************************************************************
+// GetAllSubordinates - Get the staffs reporting directly or indirectly to
+// the staff level by level, up to the max depth (0 for all the levels)
+//
+// ************************************************************************
+func (p *staffBaseService) GetAllSubordinates(staff_id string, maxDepth int) (utils.Map, error) {
+
+	log.Println("StaffService::GetAllSubordinates - Begin", staff_id, maxDepth)
+
+	_, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	subordinates := []utils.Map{}
+	visited := map[string]bool{staff_id: true}
+	managerIds := []string{staff_id}
+	for level := 1; len(managerIds) > 0 && (maxDepth <= 0 || level <= maxDepth); level++ {
+		nextManagerIds := []string{}
+		for _, managerId := range managerIds {
+			reports, err := p.listDirectReports(managerId)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, staffInfo := range reports {
+				staffId, _ := utils.GetMemberDataStr(staffInfo, hr_common.FLD_STAFF_ID)
+				if visited[staffId] {
+					continue
+				}
+				visited[staffId] = true
+
+				staffInfo[FLD_ORG_LEVEL] = level
+				p.mergeUserInfo(staffInfo)
+				subordinates = append(subordinates, staffInfo)
+				nextManagerIds = append(nextManagerIds, staffId)
+			}
+		}
+		managerIds = nextManagerIds
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staff_id,
+		FLD_ORG_MAX_DEPTH:         maxDepth,
+		db_common.LIST_RESULTSIZE: len(subordinates),
+		db_common.LIST_RESULT:     subordinates,
+	}
+
+	log.Println("StaffService::GetAllSubordinates - End", len(subordinates))
+	return response, nil
+}
+
+// ************************************************************************
+// AddEmploymentEvent - Record the join, confirm, transfer, promote, resign,
+// terminate or rehire event of the staff and derive the current employment
+// fields from the Employment History
+//
+// ************************************************************************
+func (p *staffBaseService) AddEmploymentEvent(staff_id string, indata utils.Map) (utils.Map, error) {
+
+	log.Println("StaffService::AddEmploymentEvent - Begin", staff_id)
+
+	// Validate the payload fields
+	err := normalizePayload[EmploymentEvent](indata, false)
+	if err != nil {
+		return nil, err
+	}
+
+	staffInfo, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType, err := utils.GetMemberDataStr(indata, FLD_EMPLOYMENT_EVENT_TYPE)
+	if err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case EMPLOYMENT_EVENT_JOIN, EMPLOYMENT_EVENT_CONFIRM, EMPLOYMENT_EVENT_TRANSFER, EMPLOYMENT_EVENT_PROMOTE,
+		EMPLOYMENT_EVENT_RESIGN, EMPLOYMENT_EVENT_TERMINATE, EMPLOYMENT_EVENT_REHIRE:
+	default:
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+			ErrorMsg:    "Invalid Employment Event",
+			ErrorDetail: "Given event type " + eventType + " is not supported"}
+		return nil, err
+	}
+
+	// Event takes effect from today unless the effective date is given
+	effectiveDate := getToday()
+	dateStr, err := utils.GetMemberDataStr(indata, FLD_EMPLOYMENT_EFFECTIVE_DATE)
+	if err == nil {
+		dateVal, err := parseDateValue(dateStr)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+				ErrorMsg:    "Invalid Effective Date",
+				ErrorDetail: "Effective date should be in YYYY-MM-DD format"}
+			return nil, err
+		}
+		effectiveDate = truncateToDate(dateVal)
+	}
+
+	changes := utils.Map{}
+	if _, ok := indata[FLD_EMPLOYMENT_CHANGES]; ok {
+		changes, err = getEmploymentChanges(indata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(changes) == 0 && (eventType == EMPLOYMENT_EVENT_TRANSFER || eventType == EMPLOYMENT_EVENT_PROMOTE) {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+			ErrorMsg:    "Invalid Employment Event",
+			ErrorDetail: "Changes are required for the " + eventType + " event"}
+		return nil, err
+	}
+
+	// Reporting staff shouldn't create a cycle in the hierarchy
+	err = p.validateReportingStaff(staff_id, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	remarks, _ := utils.GetMemberDataStr(indata, FLD_EMPLOYMENT_REMARKS)
+	event := newEmploymentEvent(eventType, effectiveDate, changes, remarks)
+
+	history := []interface{}{}
+	dataVal, err := utils.GetMemberData(staffInfo, FLD_EMPLOYMENT_HISTORY)
+	if err == nil {
+		history, _ = toSlice(dataVal)
+	}
+	history = append(history, event)
+	staffInfo[FLD_EMPLOYMENT_HISTORY] = history
+
+	// Whole history should still be a valid sequence with the back dated events
+	events := getEmploymentEvents(staffInfo)
+	_, _, err = replayEmploymentEvents(events, events[len(events)-1].effectiveDate)
+	if err != nil {
+		return nil, err
+	}
+
+	updateData, err := getEmploymentUpdate(staffInfo)
+	if err != nil {
+		return nil, err
+	}
+	updateData[FLD_EMPLOYMENT_HISTORY] = history
+
+	_, err = p.daoStaff.Update(staff_id, updateData)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("StaffService::AddEmploymentEvent - End", event)
+	return event, nil
+}
+
+// ************************************************************************
+// ApplyDueEmploymentEvents - Derive the employment fields again for the
+// staff whose future dated events became effective, the records read before
+// the run have the fields derived in memory. Meant to be run daily
+//
+// ************************************************************************
+func (p *staffBaseService) ApplyDueEmploymentEvents() (utils.Map, error) {
+
+	log.Println("StaffService::ApplyDueEmploymentEvents - Begin")
+
+	staffIds, err := applyDueEmploymentEvents(p.daoStaff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		db_common.LIST_RESULTSIZE: len(staffIds),
+		db_common.LIST_RESULT:     staffIds,
+	}
+
+	log.Println("StaffService::ApplyDueEmploymentEvents - End", len(staffIds))
+	return response, nil
+}
+
+// ************************************************************************
+// GetEmploymentHistory - Get the employment events of the staff in the
+// order of effective date
+//
+// ************************************************************************
+func (p *staffBaseService) GetEmploymentHistory(staff_id string) (utils.Map, error) {
+
+	log.Println("StaffService::GetEmploymentHistory - Begin", staff_id)
+
+	staffInfo, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []utils.Map{}
+	for _, event := range getEmploymentEvents(staffInfo) {
+		history = append(history, event.data)
+	}
+
+	response := utils.Map{
+		hr_common.FLD_STAFF_ID:    staff_id,
+		db_common.LIST_RESULTSIZE: len(history),
+		db_common.LIST_RESULT:     history,
+	}
+
+	log.Println("StaffService::GetEmploymentHistory - End", len(history))
+	return response, nil
+}
+
+// ************************************************************************
+// GetAsOf - Get the staff record with the employment fields as they were
+// on the given date
+//
+// ************************************************************************
+func (p *staffBaseService) GetAsOf(staff_id string, asOfDate string) (utils.Map, error) {
+
+	log.Println("StaffService::GetAsOf - Begin", staff_id, asOfDate)
+
+	dateVal, err := parseDateValue(asOfDate)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+			ErrorMsg:    "Invalid Date",
+			ErrorDetail: "As of date should be in YYYY-MM-DD format"}
+		return nil, err
+	}
+	dateVal = truncateToDate(dateVal)
+
+	staffInfo, err := p.daoStaff.Get(staff_id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := getEmploymentEvents(staffInfo)
+	state, applied, err := replayEmploymentEvents(events, dateVal)
+	if err != nil {
+		return nil, err
+	}
+
+	if applied == 0 {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_NOT_EMPLOYED,
+			ErrorMsg:    "Not Employed",
+			ErrorDetail: "Staff " + staff_id + " has no employment history on " + dateVal.Format(time.DateOnly)}
+		return nil, err
+	}
+
+	applyEmploymentState(staffInfo, state)
+
+	history := []utils.Map{}
+	for _, event := range events[:applied] {
+		history = append(history, event.data)
+	}
+	staffInfo[FLD_EMPLOYMENT_HISTORY] = history
+	staffInfo[FLD_EMPLOYMENT_AS_OF] = dateVal.Format(time.DateOnly)
+
+	p.mergeUserInfo(staffInfo)
+	p.mergereportingInfo(staffInfo)
+
+	log.Println("StaffService::GetAsOf - End", applied)
+	return staffInfo, nil
+}
+
 func (p *staffBaseService) errorReturn(err error) (StaffService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -274,3 +755,537 @@ func (p *staffBaseService) mergereportingInfo(reportingstaffInfo utils.Map) {
 		reportingstaffInfo[hr_common.FLD_REPORTING_STAFF_INFO] = []utils.Map{staffData}
 	}
 }
+
+// listDirectReports - List the staffs whose reporting staff is the given staff
+func (p *staffBaseService) listDirectReports(staffId string) ([]utils.Map, error) {
+
+	filter := fmt.Sprintf(`{"$or":[{"%s":"%s"},{"%s.%s":"%s"}],"%s":false}`,
+		hr_common.FLD_REPORTING_STAFF_ID, staffId,
+		hr_common.FLD_STAFF_DATA, hr_common.FLD_REPORTING_STAFF_ID, staffId,
+		db_common.FLD_IS_DELETED)
+
+	response, err := p.daoStaff.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return []utils.Map{}, nil
+	}
+	return dataList.([]utils.Map), nil
+}
+
+// validateReportingStaff - Verify the reporting staff given in the data exists and the staff
+// doesn't end up reporting to self directly or through the reporting chain
+func (p *staffBaseService) validateReportingStaff(staffId string, indata utils.Map) error {
+
+	reportingStaffId, ok := getReportingStaffId(indata)
+	if !ok || reportingStaffId == "" {
+		return nil
+	}
+
+	reportingCycle := &utils.AppError{
+		ErrorCode:   ERRCODE_REPORTING_CYCLE,
+		ErrorMsg:    "Reporting Cycle",
+		ErrorDetail: "Staff " + staffId + " can't report to " + reportingStaffId + " who reports to the staff"}
+
+	if reportingStaffId == staffId {
+		return reportingCycle
+	}
+
+	_, err := p.daoStaff.Get(reportingStaffId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_REPORTING,
+			ErrorMsg:    "Invalid Reporting Staff",
+			ErrorDetail: "Given reporting staff " + reportingStaffId + " is not exist"}
+		return err
+	}
+
+	// Walk up the chain of the new reporting staff
+	visited := map[string]bool{}
+	for managerId := reportingStaffId; managerId != "" && !visited[managerId]; {
+		if managerId == staffId {
+			return reportingCycle
+		}
+		visited[managerId] = true
+
+		managerInfo, err := p.daoStaff.Get(managerId)
+		if err != nil {
+			break
+		}
+		managerId, _ = getStaffDataStr(managerInfo, hr_common.FLD_REPORTING_STAFF_ID)
+	}
+	return nil
+}
+
+// getReportingStaffId - Get the reporting staff id given in root, staff_data or as dotted field
+func getReportingStaffId(indata utils.Map) (string, bool) {
+	return getStaffInputStr(indata, hr_common.FLD_REPORTING_STAFF_ID)
+}
+
+// getStaffInput - Get the member given in root, staff_data or as dotted field of the Staff input
+func getStaffInput(indata utils.Map, memberName string) (interface{}, bool) {
+
+	dottedField := hr_common.FLD_STAFF_DATA + "." + memberName
+	for _, field := range []string{memberName, dottedField} {
+		if dataVal, ok := indata[field]; ok {
+			return dataVal, true
+		}
+	}
+
+	staffData, err := getMemberDataMap(indata, hr_common.FLD_STAFF_DATA)
+	if err != nil {
+		return nil, false
+	}
+
+	dataVal, ok := staffData[memberName]
+	return dataVal, ok
+}
+
+// getStaffInputStr - Get the string member given in root, staff_data or as dotted field of the Staff input
+func getStaffInputStr(indata utils.Map, memberName string) (string, bool) {
+	dataVal, ok := getStaffInput(indata, memberName)
+	strVal, isStr := dataVal.(string)
+	return strVal, ok && isStr
+}
+
+// seedEmploymentHistory - Record the join event with the employment fields of the new staff
+func (p *staffBaseService) seedEmploymentHistory(indata utils.Map) error {
+
+	if _, ok := indata[FLD_EMPLOYMENT_HISTORY]; ok {
+		return nil
+	}
+
+	joinDate := getToday()
+	joinDateStr, ok := getStaffInputStr(indata, FLD_STAFF_DATE_OF_JOIN)
+	if ok && joinDateStr != "" {
+		dateVal, err := parseDateValue(joinDateStr)
+		if err != nil {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+				ErrorMsg:    "Invalid date_of_join",
+				ErrorDetail: "Staff date_of_join should be in YYYY-MM-DD format"}
+			return err
+		}
+		joinDate = truncateToDate(dateVal)
+	}
+
+	changes := utils.Map{}
+	for _, field := range employmentFields {
+		if strVal, ok := getStaffInputStr(indata, field); ok && strVal != "" {
+			changes[field] = strVal
+		}
+	}
+
+	event := newEmploymentEvent(EMPLOYMENT_EVENT_JOIN, joinDate, changes, "")
+	indata[FLD_EMPLOYMENT_HISTORY] = []interface{}{event}
+
+	state, _, err := replayEmploymentEvents(getEmploymentEvents(indata), joinDate)
+	if err != nil {
+		return err
+	}
+	applyEmploymentState(indata, state)
+	return nil
+}
+
+// getEmploymentChanges - Get the employment fields changed by the event
+func getEmploymentChanges(indata utils.Map) (utils.Map, error) {
+
+	changesData, err := getMemberDataMap(indata, FLD_EMPLOYMENT_CHANGES)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := utils.Map{}
+	for field, dataVal := range changesData {
+		if !isEmploymentField(field) {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+				ErrorMsg:    "Invalid Employment Change",
+				ErrorDetail: "Field " + field + " can't be changed through the employment events"}
+			return nil, err
+		}
+
+		strVal, ok := dataVal.(string)
+		if !ok {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+				ErrorMsg:    "Invalid Datatype",
+				ErrorDetail: field + " value should be a string"}
+			return nil, err
+		}
+		changes[field] = strVal
+	}
+	return changes, nil
+}
+
+// isEmploymentField - Check the field is one of the fields derived from Employment History
+func isEmploymentField(field string) bool {
+	for _, employmentField := range employmentFields {
+		if field == employmentField {
+			return true
+		}
+	}
+	return false
+}
+
+// newEmploymentEvent - Create the Employment History event to be stored in the Staff record
+func newEmploymentEvent(eventType string, effectiveDate time.Time, changes utils.Map, remarks string) utils.Map {
+	return utils.Map{
+		FLD_EMPLOYMENT_EVENT_ID:       utils.GenerateUniqueId(ID_PREFIX_EMPLOYMENT_EVENT),
+		FLD_EMPLOYMENT_EVENT_TYPE:     eventType,
+		FLD_EMPLOYMENT_EFFECTIVE_DATE: effectiveDate.Format(time.DateOnly),
+		FLD_EMPLOYMENT_CHANGES:        changes,
+		FLD_EMPLOYMENT_REMARKS:        remarks,
+		db_common.FLD_CREATED_AT:      time.Now().UTC(),
+	}
+}
+
+// getTransferUpdate - Append the transfer event effective today with the changes to the Employment
+// History of the Staff record, returns the update of the record. Staff without the history or not in
+// service today isn't transferred
+func getTransferUpdate(staffInfo utils.Map, changes utils.Map, remarks string) (utils.Map, bool, error) {
+
+	events := getEmploymentEvents(staffInfo)
+	state, _, err := replayEmploymentEvents(events, getToday())
+	if err != nil || len(events) == 0 {
+		return nil, false, err
+	}
+
+	status, _ := state[FLD_EMPLOYMENT_STATUS].(string)
+	if status != EMPLOYMENT_STATUS_PROBATION && status != EMPLOYMENT_STATUS_CONFIRMED {
+		return nil, false, nil
+	}
+
+	history, _ := toSlice(staffInfo[FLD_EMPLOYMENT_HISTORY])
+	history = append(history, newEmploymentEvent(EMPLOYMENT_EVENT_TRANSFER, getToday(), changes, remarks))
+	staffInfo[FLD_EMPLOYMENT_HISTORY] = history
+
+	updateData, err := getEmploymentUpdate(staffInfo)
+	if err != nil {
+		return nil, false, err
+	}
+	updateData[FLD_EMPLOYMENT_HISTORY] = history
+	return updateData, true, nil
+}
+
+// getEmploymentEvents - Get the Employment History events of the Staff record in the order
+// of effective date, events on the same date are kept in the recorded order
+func getEmploymentEvents(staffInfo utils.Map) []employmentEvent {
+
+	events := []employmentEvent{}
+	dataVal, err := utils.GetMemberData(staffInfo, FLD_EMPLOYMENT_HISTORY)
+	if err != nil {
+		return events
+	}
+
+	history, _ := toSlice(dataVal)
+	for _, item := range history {
+		eventData, ok := toMap(item)
+		if !ok {
+			continue
+		}
+
+		eventType, _ := utils.GetMemberDataStr(eventData, FLD_EMPLOYMENT_EVENT_TYPE)
+		dateStr, _ := utils.GetMemberDataStr(eventData, FLD_EMPLOYMENT_EFFECTIVE_DATE)
+		effectiveDate, err := parseDateValue(dateStr)
+		if err != nil {
+			log.Println("getEmploymentEvents - Invalid effective date ", eventData)
+			continue
+		}
+
+		changes, err := getMemberDataMap(eventData, FLD_EMPLOYMENT_CHANGES)
+		if err != nil {
+			changes = utils.Map{}
+		}
+
+		events = append(events, employmentEvent{
+			eventType:     eventType,
+			effectiveDate: truncateToDate(effectiveDate),
+			changes:       changes,
+			data:          eventData,
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].effectiveDate.Before(events[j].effectiveDate)
+	})
+	return events
+}
+
+// replayEmploymentEvents - Derive the employment state by applying the events effective on
+// or before the given date, returns the state and the number of events applied
+func replayEmploymentEvents(events []employmentEvent, asOf time.Time) (utils.Map, int, error) {
+
+	state := utils.Map{}
+	applied := 0
+	for _, event := range events {
+		if event.effectiveDate.After(asOf) {
+			break
+		}
+
+		err := applyEmploymentEvent(state, event)
+		if err != nil {
+			return nil, 0, err
+		}
+		applied++
+	}
+	return state, applied, nil
+}
+
+// applyEmploymentEvent - Apply the event on the employment state, the event should be valid
+// for the employment status at that time
+func applyEmploymentEvent(state utils.Map, event employmentEvent) error {
+
+	status, _ := state[FLD_EMPLOYMENT_STATUS].(string)
+	isActive := status == EMPLOYMENT_STATUS_PROBATION || status == EMPLOYMENT_STATUS_CONFIRMED
+	effectiveDate := event.effectiveDate.Format(time.DateOnly)
+
+	newStatus := status
+	isValid := false
+	switch event.eventType {
+	case EMPLOYMENT_EVENT_JOIN:
+		isValid = status == ""
+		newStatus = EMPLOYMENT_STATUS_PROBATION
+		state[FLD_STAFF_DATE_OF_JOIN] = effectiveDate
+
+	case EMPLOYMENT_EVENT_CONFIRM:
+		isValid = status == EMPLOYMENT_STATUS_PROBATION
+		newStatus = EMPLOYMENT_STATUS_CONFIRMED
+		state[FLD_STAFF_DATE_OF_CONFIRMATION] = effectiveDate
+
+	case EMPLOYMENT_EVENT_TRANSFER, EMPLOYMENT_EVENT_PROMOTE:
+		isValid = isActive
+
+	case EMPLOYMENT_EVENT_RESIGN, EMPLOYMENT_EVENT_TERMINATE:
+		isValid = isActive
+		newStatus = EMPLOYMENT_STATUS_RESIGNED
+		if event.eventType == EMPLOYMENT_EVENT_TERMINATE {
+			newStatus = EMPLOYMENT_STATUS_TERMINATED
+		}
+		state[FLD_STAFF_DATE_OF_EXIT] = effectiveDate
+		state[FLD_STAFF_EXIT_TYPE] = event.eventType
+
+	case EMPLOYMENT_EVENT_REHIRE:
+		isValid = status == EMPLOYMENT_STATUS_RESIGNED || status == EMPLOYMENT_STATUS_TERMINATED
+		newStatus = EMPLOYMENT_STATUS_PROBATION
+		state[FLD_STAFF_DATE_OF_JOIN] = effectiveDate
+		delete(state, FLD_STAFF_DATE_OF_CONFIRMATION)
+		delete(state, FLD_STAFF_DATE_OF_EXIT)
+		delete(state, FLD_STAFF_EXIT_TYPE)
+	}
+
+	if !isValid {
+		if status == "" {
+			status = "not joined"
+		}
+		err := &utils.AppError{
+			ErrorCode:   ERRCODE_INVALID_EMPLOYMENT_EVENT,
+			ErrorMsg:    "Invalid Employment Event",
+			ErrorDetail: fmt.Sprintf("Event %s on %s is not allowed when the staff is %s", event.eventType, effectiveDate, status)}
+		return err
+	}
+
+	state[FLD_EMPLOYMENT_STATUS] = newStatus
+	for field, dataVal := range event.changes {
+		state[field] = dataVal
+	}
+	return nil
+}
+
+// applyEmploymentState - Overlay the employment state on the staff_data of the Staff record,
+// fields kept in the root of older records are overlaid as well
+func applyEmploymentState(staffInfo utils.Map, state utils.Map) {
+
+	staffData, err := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if err != nil {
+		staffData = utils.Map{}
+	}
+
+	// Confirmation & exit details are cleared on rehire
+	delete(staffData, FLD_STAFF_DATE_OF_CONFIRMATION)
+	delete(staffData, FLD_STAFF_DATE_OF_EXIT)
+	delete(staffData, FLD_STAFF_EXIT_TYPE)
+
+	for field, dataVal := range state {
+		staffData[field] = dataVal
+		if _, ok := staffInfo[field]; ok {
+			staffInfo[field] = dataVal
+		}
+	}
+	staffInfo[hr_common.FLD_STAFF_DATA] = staffData
+}
+
+// validateEmploymentFields - Verify the update doesn't change the fields derived from Employment History,
+// including setting the fields the history doesn't have
+func validateEmploymentFields(indata utils.Map, state utils.Map) error {
+
+	fields := append(append([]string{}, employmentFields...), employmentStatusFields...)
+	for _, field := range fields {
+		dataVal, ok := getStaffInput(indata, field)
+		if !ok {
+			continue
+		}
+
+		strVal, isStr := dataVal.(string)
+		if dataVal != nil && !isStr {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_EMPLOYMENT_FIELD_CHANGE,
+				ErrorMsg:    "Invalid Datatype",
+				ErrorDetail: field + " value should be a string"}
+			return err
+		}
+
+		stateVal, _ := state[field].(string)
+		if strVal != stateVal {
+			err := &utils.AppError{
+				ErrorCode:   ERRCODE_EMPLOYMENT_FIELD_CHANGE,
+				ErrorMsg:    "Employment Field Changed",
+				ErrorDetail: "Field " + field + " should be changed through the employment events"}
+			return err
+		}
+	}
+	return nil
+}
+
+// getEmploymentUpdate - Derive the employment fields of the Staff record as of today, the update
+// also has the effective date of the next future dated event to derive the fields again
+func getEmploymentUpdate(staffInfo utils.Map) (utils.Map, error) {
+
+	events := getEmploymentEvents(staffInfo)
+	state, applied, err := replayEmploymentEvents(events, getToday())
+	if err != nil {
+		return nil, err
+	}
+	applyEmploymentState(staffInfo, state)
+
+	updateData := utils.Map{
+		hr_common.FLD_STAFF_DATA: staffInfo[hr_common.FLD_STAFF_DATA],
+		FLD_EMPLOYMENT_NEXT_DATE: nil,
+	}
+	for field := range state {
+		if dataVal, ok := staffInfo[field]; ok {
+			updateData[field] = dataVal
+		}
+	}
+	if applied < len(events) {
+		updateData[FLD_EMPLOYMENT_NEXT_DATE] = events[applied].effectiveDate.Format(time.DateOnly)
+	}
+	return updateData, nil
+}
+
+// isEmploymentDue - Check the Staff record has future dated events that became effective
+func isEmploymentDue(staffInfo utils.Map) bool {
+	nextDate, err := utils.GetMemberDataStr(staffInfo, FLD_EMPLOYMENT_NEXT_DATE)
+	return err == nil && nextDate != "" && nextDate <= getToday().Format(time.DateOnly)
+}
+
+// applyDueEmploymentEvents - Derive the employment fields again for the Staff records whose future
+// dated events became effective, returns the ids of the staff updated
+func applyDueEmploymentEvents(daoStaff hr_repository.StaffDao) ([]string, error) {
+
+	// Records are read as they are stored
+	if dao, ok := daoStaff.(*employmentStaffDao); ok {
+		daoStaff = dao.StaffDao
+	}
+
+	filter := fmt.Sprintf(`{"%s":{"$lte":"%s"},"%s":false}`,
+		FLD_EMPLOYMENT_NEXT_DATE, getToday().Format(time.DateOnly),
+		db_common.FLD_IS_DELETED)
+
+	response, err := daoStaff.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	staffIds := []string{}
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return staffIds, nil
+	}
+
+	for _, staffInfo := range dataList.([]utils.Map) {
+		staffId, _ := utils.GetMemberDataStr(staffInfo, hr_common.FLD_STAFF_ID)
+		updateData, err := getEmploymentUpdate(staffInfo)
+		if err != nil {
+			log.Println("applyDueEmploymentEvents - Invalid employment history ", staffId, err)
+			continue
+		}
+
+		_, err = daoStaff.Update(staffId, updateData)
+		if err != nil {
+			return nil, err
+		}
+		staffIds = append(staffIds, staffId)
+	}
+	return staffIds, nil
+}
+
+// applyDueEmploymentState - Overlay the employment state as of today on the Staff record whose
+// future dated events became effective, the record is updated by ApplyDueEmploymentEvents
+func applyDueEmploymentState(staffInfo utils.Map) {
+
+	if !isEmploymentDue(staffInfo) {
+		return
+	}
+
+	state, _, err := replayEmploymentEvents(getEmploymentEvents(staffInfo), getToday())
+	if err != nil {
+		log.Println("applyDueEmploymentState - Invalid employment history ", staffInfo[hr_common.FLD_STAFF_ID], err)
+		return
+	}
+	applyEmploymentState(staffInfo, state)
+}
+
+// employmentStaffDao - Staff DAO deriving the employment fields of the records read with the future
+// dated events that became effective, the records aren't written on read
+type employmentStaffDao struct {
+	hr_repository.StaffDao
+}
+
+// newEmploymentStaffDao - Staff DAO of the DaoProvider, reads see the employment fields as of today
+func newEmploymentStaffDao(daoStaff hr_repository.StaffDao) hr_repository.StaffDao {
+	return &employmentStaffDao{StaffDao: daoStaff}
+}
+
+func (t *employmentStaffDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	response, err := t.StaffDao.List(filter, sort, skip, limit)
+	if err != nil {
+		return response, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err == nil {
+		items, _ := toSlice(dataList)
+		for _, item := range items {
+			if staffInfo, ok := toMap(item); ok {
+				applyDueEmploymentState(staffInfo)
+			}
+		}
+	}
+	return response, nil
+}
+
+func (t *employmentStaffDao) Find(filter string) (utils.Map, error) {
+	data, err := t.StaffDao.Find(filter)
+	if err == nil {
+		applyDueEmploymentState(data)
+	}
+	return data, err
+}
+
+func (t *employmentStaffDao) Get(staffId string) (utils.Map, error) {
+	data, err := t.StaffDao.Get(staffId)
+	if err == nil {
+		applyDueEmploymentState(data)
+	}
+	return data, err
+}
+
+// getToday - Get today's date, dates in Employment History are stored without timezone
+func getToday() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
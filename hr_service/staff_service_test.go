@@ -0,0 +1,251 @@
+package hr_service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func newTestStaffService(t *testing.T) (*MemoryDaoProvider, StaffService) {
+	t.Helper()
+
+	provider, props := newTestProvider()
+	staffService, err := NewStaffService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(staffService.EndService)
+	return provider, staffService
+}
+
+func createTestStaff(t *testing.T, staffService StaffService, staffId string, staffData utils.Map) {
+	t.Helper()
+
+	_, err := staffService.Create(utils.Map{hr_common.FLD_STAFF_ID: staffId, hr_common.FLD_STAFF_DATA: staffData})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaffReportingCycle(t *testing.T) {
+
+	_, staffService := newTestStaffService(t)
+
+	// staff_a <- staff_b <- staff_c
+	createTestStaff(t, staffService, "staff_a", utils.Map{})
+	createTestStaff(t, staffService, "staff_b", utils.Map{hr_common.FLD_REPORTING_STAFF_ID: "staff_a"})
+	createTestStaff(t, staffService, "staff_c", utils.Map{hr_common.FLD_REPORTING_STAFF_ID: "staff_b"})
+
+	tests := []struct {
+		name             string
+		staffId          string
+		reportingStaffId string
+		errorCode        string
+	}{
+		{"self", "staff_a", "staff_a", ERRCODE_REPORTING_CYCLE},
+		{"to own report", "staff_a", "staff_b", ERRCODE_REPORTING_CYCLE},
+		{"through the chain", "staff_a", "staff_c", ERRCODE_REPORTING_CYCLE},
+		{"unknown staff", "staff_a", "staff_unknown", ERRCODE_INVALID_REPORTING},
+		{"to manager of manager", "staff_c", "staff_a", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := utils.Map{hr_common.FLD_REPORTING_STAFF_ID: test.reportingStaffId}
+			_, err := staffService.AddEmploymentEvent(test.staffId, utils.Map{
+				FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_TRANSFER,
+				FLD_EMPLOYMENT_CHANGES:    changes})
+			if test.errorCode != "" {
+				assertErrorCode(t, err, test.errorCode)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Cycle is checked before the employment fields on update
+	_, err := staffService.Update("staff_a", utils.Map{
+		hr_common.FLD_STAFF_DATA + "." + hr_common.FLD_REPORTING_STAFF_ID: "staff_b"})
+	assertErrorCode(t, err, ERRCODE_REPORTING_CYCLE)
+
+	response, err := staffService.GetReportingChain("staff_c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := getResultIds(t, response, hr_common.FLD_STAFF_ID); len(ids) != 1 || ids[0] != "staff_a" {
+		t.Errorf("Expected staff_c reporting to staff_a, got %v", ids)
+	}
+}
+
+func TestEmploymentReplay(t *testing.T) {
+
+	_, staffService := newTestStaffService(t)
+	createTestStaff(t, staffService, "staff_e", utils.Map{
+		FLD_STAFF_DATE_OF_JOIN:      "2020-01-06",
+		hr_common.FLD_DEPARTMENT_ID: "dept_1"})
+
+	for _, event := range []utils.Map{
+		{FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_RESIGN, FLD_EMPLOYMENT_EFFECTIVE_DATE: "2022-01-01"},
+		{FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_TRANSFER, FLD_EMPLOYMENT_EFFECTIVE_DATE: "2021-01-01",
+			FLD_EMPLOYMENT_CHANGES: utils.Map{hr_common.FLD_DEPARTMENT_ID: "dept_2"}},
+		// Back dated events are replayed in the order of effective date
+		{FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_CONFIRM, FLD_EMPLOYMENT_EFFECTIVE_DATE: "2020-07-01"},
+		{FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_REHIRE, FLD_EMPLOYMENT_EFFECTIVE_DATE: "2023-01-01"},
+	} {
+		_, err := staffService.AddEmploymentEvent("staff_e", event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		asOf          string
+		status        string
+		departmentId  string
+		confirmedDate string
+		exitDate      string
+	}{
+		{"2020-03-01", EMPLOYMENT_STATUS_PROBATION, "dept_1", "", ""},
+		{"2021-06-01", EMPLOYMENT_STATUS_CONFIRMED, "dept_2", "2020-07-01", ""},
+		{"2022-06-01", EMPLOYMENT_STATUS_RESIGNED, "dept_2", "2020-07-01", "2022-01-01"},
+		{"2023-06-01", EMPLOYMENT_STATUS_PROBATION, "dept_2", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.asOf, func(t *testing.T) {
+			staffInfo, err := staffService.GetAsOf("staff_e", test.asOf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			staffData, _ := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+			confirmedDate, _ := staffData[FLD_STAFF_DATE_OF_CONFIRMATION].(string)
+			exitDate, _ := staffData[FLD_STAFF_DATE_OF_EXIT].(string)
+			if staffData[FLD_EMPLOYMENT_STATUS] != test.status || staffData[hr_common.FLD_DEPARTMENT_ID] != test.departmentId ||
+				confirmedDate != test.confirmedDate || exitDate != test.exitDate {
+				t.Errorf("Unexpected employment state %v", staffData)
+			}
+		})
+	}
+
+	_, err := staffService.GetAsOf("staff_e", "2019-12-31")
+	assertErrorCode(t, err, ERRCODE_NOT_EMPLOYED)
+
+	// Confirmation while resigned breaks the history
+	_, err = staffService.AddEmploymentEvent("staff_e", utils.Map{
+		FLD_EMPLOYMENT_EVENT_TYPE: EMPLOYMENT_EVENT_CONFIRM, FLD_EMPLOYMENT_EFFECTIVE_DATE: "2022-06-01"})
+	assertErrorCode(t, err, ERRCODE_INVALID_EMPLOYMENT_EVENT)
+
+	_, err = staffService.Update("staff_e", utils.Map{
+		hr_common.FLD_STAFF_DATA: utils.Map{hr_common.FLD_DEPARTMENT_ID: "dept_3"}})
+	assertErrorCode(t, err, ERRCODE_EMPLOYMENT_FIELD_CHANGE)
+
+	staffInfo, err := staffService.Get("staff_e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staffData, _ := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if staffData[FLD_EMPLOYMENT_STATUS] != EMPLOYMENT_STATUS_PROBATION || staffData[FLD_STAFF_DATE_OF_JOIN] != "2023-01-01" {
+		t.Errorf("Expected the staff rehired on 2023-01-01, got %v", staffData)
+	}
+}
+
+func TestFutureDatedEmploymentEvent(t *testing.T) {
+
+	provider, staffService := newTestStaffService(t)
+	createTestStaff(t, staffService, "staff_f", utils.Map{
+		FLD_STAFF_DATE_OF_JOIN:      "2020-01-06",
+		hr_common.FLD_DEPARTMENT_ID: "dept_1"})
+	createTestStaff(t, staffService, "staff_g", utils.Map{
+		FLD_STAFF_DATE_OF_JOIN:      "2020-01-06",
+		hr_common.FLD_DEPARTMENT_ID: "dept_1"})
+
+	// Records as they are stored, without the sync of the Staff DAO
+	daoStaff := provider.NewStaffDao(testBusinessId).(*employmentStaffDao).StaffDao
+	getStoredDepartment := func(staffId string) (string, interface{}) {
+		staffInfo, err := daoStaff.Get(staffId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		staffData, _ := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+		departmentId, _ := staffData[hr_common.FLD_DEPARTMENT_ID].(string)
+		return departmentId, staffInfo[FLD_EMPLOYMENT_NEXT_DATE]
+	}
+
+	tomorrow := getToday().AddDate(0, 0, 1).Format(time.DateOnly)
+	yesterday := getToday().AddDate(0, 0, -1).Format(time.DateOnly)
+
+	for _, staffId := range []string{"staff_f", "staff_g"} {
+		_, err := staffService.AddEmploymentEvent(staffId, utils.Map{
+			FLD_EMPLOYMENT_EVENT_TYPE:     EMPLOYMENT_EVENT_TRANSFER,
+			FLD_EMPLOYMENT_EFFECTIVE_DATE: tomorrow,
+			FLD_EMPLOYMENT_CHANGES:        utils.Map{hr_common.FLD_DEPARTMENT_ID: "dept_2"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		departmentId, nextDate := getStoredDepartment(staffId)
+		if departmentId != "dept_1" || nextDate != tomorrow {
+			t.Fatalf("Transfer should take effect tomorrow, got %v %v", departmentId, nextDate)
+		}
+
+		// Let the day of the transfer pass
+		_, err = daoStaff.Update(staffId, utils.Map{
+			FLD_EMPLOYMENT_HISTORY + ".1." + FLD_EMPLOYMENT_EFFECTIVE_DATE: yesterday,
+			FLD_EMPLOYMENT_NEXT_DATE: yesterday})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Records read have the transfer, the stored records are left to the daily run
+	staffInfo, err := staffService.Get("staff_f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staffData, _ := getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if staffData[hr_common.FLD_DEPARTMENT_ID] != "dept_2" {
+		t.Errorf("Expected staff_f transferred to dept_2, got %v", staffData)
+	}
+
+	response, err := staffService.List(`{"staff_id":"staff_g"}`, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ := toSlice(response[db_common.LIST_RESULT])
+	if len(items) != 1 {
+		t.Fatalf("Expected staff_g listed, got %v", response)
+	}
+	staffInfo, _ = toMap(items[0])
+	staffData, _ = getMemberDataMap(staffInfo, hr_common.FLD_STAFF_DATA)
+	if staffData[hr_common.FLD_DEPARTMENT_ID] != "dept_2" {
+		t.Errorf("Expected staff_g transferred to dept_2, got %v", staffData)
+	}
+
+	for _, staffId := range []string{"staff_f", "staff_g"} {
+		if departmentId, nextDate := getStoredDepartment(staffId); departmentId != "dept_1" || nextDate != yesterday {
+			t.Errorf("Reads should not update %s, got %v %v", staffId, departmentId, nextDate)
+		}
+	}
+
+	// Daily run brings the stored records up to date
+	response, err = staffService.ApplyDueEmploymentEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	staffIds, _ := response[db_common.LIST_RESULT].([]string)
+	if !reflect.DeepEqual(staffIds, []string{"staff_f", "staff_g"}) {
+		t.Errorf("Expected staff_f & staff_g to be updated, got %v", response)
+	}
+	for _, staffId := range []string{"staff_f", "staff_g"} {
+		if departmentId, nextDate := getStoredDepartment(staffId); departmentId != "dept_2" || nextDate != nil {
+			t.Errorf("Expected %s stored in dept_2, got %v %v", staffId, departmentId, nextDate)
+		}
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"log"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -20,6 +18,7 @@ type StaffTypeService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(staffTypeId string, indata utils.Map) (utils.Map, error)
 	Delete(staffTypeId string, delete_permanent bool) error
+	DeleteAndReassign(staffTypeId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -30,9 +29,9 @@ type StaffTypeService interface {
 
 // staffTypeBaseService - Accounts Service structure
 type staffTypeBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoStaffType        hr_repository.StaffTypeDao
+	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               StaffTypeService
 	businessID          string
@@ -54,25 +53,19 @@ func NewStaffTypeService(props utils.Map) (StaffTypeService, error) {
 
 	p := staffTypeBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoStaffType = hr_repository.NewStaffTypeDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoStaffType = p.NewStaffTypeDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -89,8 +82,7 @@ func NewStaffTypeService(props utils.Map) (StaffTypeService, error) {
 }
 
 func (p *staffTypeBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -129,17 +121,20 @@ func (p *staffTypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	dataval, dataok := indata[hr_common.FLD_STAFFTYPE_ID]
-	if !dataok {
-		uid := utils.GenerateUniqueId("stftyp")
-		log.Println("Unique Account ID", uid)
-		indata[hr_common.FLD_STAFFTYPE_ID] = uid
-		dataval = indata[hr_common.FLD_STAFFTYPE_ID]
+	// Validate the payload fields
+	err := normalizePayload[StaffType](indata, false)
+	if err != nil {
+		return indata, err
+	}
+
+	staffTypeId, err := getPayloadId(indata, hr_common.FLD_STAFFTYPE_ID, ID_PREFIX_STAFF_TYPE)
+	if err != nil {
+		return indata, err
 	}
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
-	log.Println("Provided Account ID:", dataval)
+	log.Println("Provided Account ID:", staffTypeId)
 
-	_, err := p.daoStaffType.Get(dataval.(string))
+	_, err = p.daoStaffType.Get(staffTypeId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
@@ -158,6 +153,12 @@ func (p *staffTypeBaseService) Update(staffTypeId string, indata utils.Map) (uti
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[StaffType](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoStaffType.Get(staffTypeId)
 	if err != nil {
 		return data, err
@@ -179,6 +180,12 @@ func (p *staffTypeBaseService) Delete(staffTypeId string, delete_permanent bool)
 		return err
 	}
 
+	// Records still referring the staff type can't be deleted
+	err = checkReferences(p.getReferences(), "Staff Type", staffTypeId)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoStaffType.Delete(staffTypeId)
 		if err != nil {
@@ -198,6 +205,29 @@ func (p *staffTypeBaseService) Delete(staffTypeId string, delete_permanent bool)
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the staff type to another staff type
+// and delete the staff type
+//
+// ************************************************************************
+func (p *staffTypeBaseService) DeleteAndReassign(staffTypeId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("StaffTypeService::DeleteAndReassign - Begin", staffTypeId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Staff Type", p.daoStaffType, p.getReferences(), staffTypeId, reassign_id, func() error {
+		return p.Delete(staffTypeId, delete_permanent)
+	})
+	log.Println("StaffTypeService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the staff type
+func (p *staffTypeBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_STAFFTYPE_ID),
+	}
+}
+
 func (p *staffTypeBaseService) errorReturn(err error) (StaffTypeService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -0,0 +1,532 @@
+package hr_service
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-hr-repository/hr_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+const (
+	// Timesheet Fields
+	FLD_TIMESHEET_MONTH   = "month"
+	FLD_TIMESHEET_DAYS    = "days"
+	FLD_TIMESHEET_DATE    = "date"
+	FLD_TIMESHEET_STATUS  = "status"
+	FLD_TIMESHEET_SUMMARY = "summary"
+	FLD_STAFF_NAME        = "staff_name"
+
+	// Timesheet Day Status
+	TIMESHEET_STATUS_PRESENT  = "present"
+	TIMESHEET_STATUS_ABSENT   = "absent"
+	TIMESHEET_STATUS_LEAVE    = "leave"
+	TIMESHEET_STATUS_HOLIDAY  = "holiday"
+	TIMESHEET_STATUS_WEEK_OFF = "week_off"
+
+	// Month format of the timesheet
+	TIMESHEET_MONTH_FORMAT = "2006-01"
+)
+
+// Short codes of day status in the exported sheet
+var timesheetStatusCodes = map[string]string{
+	TIMESHEET_STATUS_PRESENT:  "P",
+	TIMESHEET_STATUS_ABSENT:   "A",
+	TIMESHEET_STATUS_LEAVE:    "L",
+	TIMESHEET_STATUS_HOLIDAY:  "H",
+	TIMESHEET_STATUS_WEEK_OFF: "WO",
+}
+
+// TimesheetService - Monthly Timesheet Service structure
+type TimesheetService interface {
+	GetTimesheet(month string) (utils.Map, error)
+	ExportCSV(month string, writer io.Writer) error
+	ExportXLSX(month string, writer io.Writer) error
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// timesheetBaseService - Monthly Timesheet Service structure
+type timesheetBaseService struct {
+	DaoProvider
+	daoStaff            hr_repository.StaffDao
+	daoAttendance       hr_repository.AttendanceDao
+	daoLeave            hr_repository.LeaveDao
+	daoHoliday          hr_repository.HolidayDao
+	daoShiftProfile     hr_repository.ShiftProfileDao
+	daoHrsFactor        hr_repository.OvertimeDao
+	daoPlatformBusiness platform_repository.BusinessDao
+	daoPlatformAppUser  platform_repository.AppUserDao
+
+	child           TimesheetService
+	businessId      string
+	dailyThreshold  float64
+	weeklyThreshold float64
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewTimesheetService(props utils.Map) (TimesheetService, error) {
+	funcode := hr_common.GetServiceModuleCode() + "M" + "01"
+
+	log.Printf("TimesheetService::Start")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, hr_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := timesheetBaseService{}
+
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessId = businessId
+
+	// Overtime thresholds same as OvertimeService
+	p.dailyThreshold, _ = getMemberDataFloat(props, FLD_OT_DAILY_THRESHOLD)
+	p.weeklyThreshold, _ = getMemberDataFloat(props, FLD_OT_WEEKLY_THRESHOLD)
+
+	// Instantiate other services, timesheet covers all the staffs
+	p.daoPlatformBusiness = p.NewBusinessDao()
+	p.daoPlatformAppUser = p.NewAppUserDao()
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoAttendance = p.NewAttendanceDao(p.businessId, "")
+	p.daoLeave = p.NewLeaveDao(p.businessId, "")
+	p.daoHoliday = p.NewHolidayDao(p.businessId)
+	p.daoShiftProfile = p.NewShiftProfileDao(p.businessId)
+	p.daoHrsFactor = p.NewOvertimeDao(p.businessId)
+
+	_, err = p.daoPlatformBusiness.Get(p.businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business id",
+			ErrorDetail: "Given business id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, nil
+}
+
+func (p *timesheetBaseService) EndService() {
+	p.Close()
+}
+
+// ************************************************************************
+// GetTimesheet - Get the per staff, per day grid of the month (yyyy-mm)
+//
+// ************************************************************************
+func (p *timesheetBaseService) GetTimesheet(month string) (utils.Map, error) {
+
+	log.Println("TimesheetService::GetTimesheet - Begin", month)
+
+	monthStart, err := time.Parse(TIMESHEET_MONTH_FORMAT, month)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   "S30102",
+			ErrorMsg:    "Invalid month",
+			ErrorDetail: "month should be in yyyy-mm format"}
+		return nil, err
+	}
+	monthEnd := monthStart.AddDate(0, 1, -1)
+
+	staffs, err := p.listRecords(p.daoStaff, fmt.Sprintf(`{"%s":false}`, db_common.FLD_IS_DELETED))
+	if err != nil {
+		return nil, err
+	}
+
+	// Weekly overtime threshold needs the hours from the start of the week
+	weekStart := getWeekStart(monthStart)
+
+	holidays, err := expandHolidays(p.daoHoliday, weekStart, monthEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := getOvertimeFactors(p.daoHrsFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Punches after midnight of the month end are attributed to the month end shift
+	attendances, err := p.getStaffAttendance(weekStart, monthEnd.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, err := p.getMonthLeaves(monthStart, monthEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	staffSheets := []utils.Map{}
+	for _, staffInfo := range staffs {
+		staffId, _ := utils.GetMemberDataStr(staffInfo, hr_common.FLD_STAFF_ID)
+		weekOffs := getStaffWeekOffs(p.daoShiftProfile, staffInfo)
+		holidayDates := getStaffHolidayDates(holidays, staffInfo)
+
+		otEntries := map[string]utils.Map{}
+		for _, entry := range computeOvertimeEntries(attendances[staffId], holidayDates, weekOffs, factors, p.dailyThreshold, p.weeklyThreshold) {
+			otEntries[entry[FLD_OT_DATE].(string)] = entry
+		}
+
+		summary := utils.Map{
+			TIMESHEET_STATUS_PRESENT:  0,
+			TIMESHEET_STATUS_ABSENT:   0,
+			TIMESHEET_STATUS_LEAVE:    0,
+			TIMESHEET_STATUS_HOLIDAY:  0,
+			TIMESHEET_STATUS_WEEK_OFF: 0,
+			FLD_OT_HOURS:              0.0,
+			FLD_OT_PAYABLE_HOURS:      0.0,
+		}
+
+		days := []utils.Map{}
+		for day := monthStart; !day.After(monthEnd); day = day.AddDate(0, 0, 1) {
+			dateStr := day.Format(time.DateOnly)
+			dayKey := staffId + "/" + dateStr
+			dayType := OT_DAY_TYPE_WEEKDAY
+			if holidayDates[dateStr] {
+				dayType = OT_DAY_TYPE_HOLIDAY
+			} else if weekOffs[day.Weekday()] {
+				dayType = OT_DAY_TYPE_WEEKEND
+			}
+
+			dayInfo := utils.Map{FLD_TIMESHEET_DATE: dateStr}
+			if entry, ok := otEntries[dateStr]; ok {
+				dayInfo[FLD_TIMESHEET_STATUS] = TIMESHEET_STATUS_PRESENT
+				dayInfo[FLD_NET_HOURS] = entry[FLD_NET_HOURS]
+
+				if otHours := entry[FLD_OT_HOURS].(float64); otHours > 0 {
+					dayInfo[FLD_OT_HOURS] = otHours
+					dayInfo[FLD_OT_PAYABLE_HOURS] = entry[FLD_OT_PAYABLE_HOURS]
+					summary[FLD_OT_HOURS] = roundTo2Decimals(summary[FLD_OT_HOURS].(float64) + otHours)
+					summary[FLD_OT_PAYABLE_HOURS] = roundTo2Decimals(summary[FLD_OT_PAYABLE_HOURS].(float64) + entry[FLD_OT_PAYABLE_HOURS].(float64))
+				}
+			} else if dayType == OT_DAY_TYPE_HOLIDAY {
+				dayInfo[FLD_TIMESHEET_STATUS] = TIMESHEET_STATUS_HOLIDAY
+			} else if dayType == OT_DAY_TYPE_WEEKEND {
+				dayInfo[FLD_TIMESHEET_STATUS] = TIMESHEET_STATUS_WEEK_OFF
+			} else if leaveTypeId, ok := leaves[dayKey]; ok {
+				dayInfo[FLD_TIMESHEET_STATUS] = TIMESHEET_STATUS_LEAVE
+				dayInfo[hr_common.FLD_LEAVETYPE_ID] = leaveTypeId
+			} else if day.After(today) {
+				// Yet to come
+				days = append(days, dayInfo)
+				continue
+			} else {
+				dayInfo[FLD_TIMESHEET_STATUS] = TIMESHEET_STATUS_ABSENT
+			}
+
+			status := dayInfo[FLD_TIMESHEET_STATUS].(string)
+			summary[status] = summary[status].(int) + 1
+			days = append(days, dayInfo)
+		}
+
+		staffSheets = append(staffSheets, utils.Map{
+			hr_common.FLD_STAFF_ID: staffId,
+			FLD_STAFF_NAME:         p.getStaffName(staffId),
+			FLD_TIMESHEET_DAYS:     days,
+			FLD_TIMESHEET_SUMMARY:  summary,
+		})
+	}
+
+	response := utils.Map{
+		FLD_TIMESHEET_MONTH:       month,
+		db_common.LIST_RESULTSIZE: len(staffSheets),
+		db_common.LIST_RESULT:     staffSheets,
+	}
+
+	log.Println("TimesheetService::GetTimesheet - End", len(staffSheets))
+	return response, nil
+}
+
+// ***********************************************
+// ExportCSV - Export the monthly timesheet as CSV
+//
+// ***********************************************
+func (p *timesheetBaseService) ExportCSV(month string, writer io.Writer) error {
+
+	log.Println("TimesheetService::ExportCSV - Begin", month)
+
+	rows, err := p.getTimesheetRows(month)
+	if err != nil {
+		return err
+	}
+
+	csvWriter := csv.NewWriter(writer)
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = fmt.Sprint(cell)
+		}
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+
+	log.Println("TimesheetService::ExportCSV - End", csvWriter.Error())
+	return csvWriter.Error()
+}
+
+// *************************************************
+// ExportXLSX - Export the monthly timesheet as XLSX
+//
+// *************************************************
+func (p *timesheetBaseService) ExportXLSX(month string, writer io.Writer) error {
+
+	log.Println("TimesheetService::ExportXLSX - Begin", month)
+
+	rows, err := p.getTimesheetRows(month)
+	if err != nil {
+		return err
+	}
+
+	err = writeXLSX(writer, "Timesheet "+month, rows)
+
+	log.Println("TimesheetService::ExportXLSX - End", err)
+	return err
+}
+
+func (p *timesheetBaseService) errorReturn(err error) (TimesheetService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
+
+// getTimesheetRows - Flatten the timesheet into rows for export
+func (p *timesheetBaseService) getTimesheetRows(month string) ([][]interface{}, error) {
+
+	timesheet, err := p.GetTimesheet(month)
+	if err != nil {
+		return nil, err
+	}
+
+	monthStart, _ := time.Parse(TIMESHEET_MONTH_FORMAT, month)
+	monthEnd := monthStart.AddDate(0, 1, -1)
+
+	header := []interface{}{"Staff ID", "Staff Name"}
+	for day := monthStart; !day.After(monthEnd); day = day.AddDate(0, 0, 1) {
+		header = append(header, day.Format("02 Mon"))
+	}
+	header = append(header, "Present", "Absent", "Leave", "Holiday", "Week Off", "OT Hours", "Payable OT Hours")
+
+	rows := [][]interface{}{header}
+	for _, staffSheet := range timesheet[db_common.LIST_RESULT].([]utils.Map) {
+		row := []interface{}{staffSheet[hr_common.FLD_STAFF_ID], staffSheet[FLD_STAFF_NAME]}
+
+		for _, dayInfo := range staffSheet[FLD_TIMESHEET_DAYS].([]utils.Map) {
+			status, _ := utils.GetMemberDataStr(dayInfo, FLD_TIMESHEET_STATUS)
+			cell := timesheetStatusCodes[status]
+			if leaveTypeId, err := utils.GetMemberDataStr(dayInfo, hr_common.FLD_LEAVETYPE_ID); err == nil {
+				cell += "-" + leaveTypeId
+			}
+			if otHours, ok := dayInfo[FLD_OT_HOURS]; ok {
+				cell += fmt.Sprintf(" +%vh", otHours)
+			}
+			row = append(row, cell)
+		}
+
+		summary := staffSheet[FLD_TIMESHEET_SUMMARY].(utils.Map)
+		row = append(row,
+			summary[TIMESHEET_STATUS_PRESENT], summary[TIMESHEET_STATUS_ABSENT], summary[TIMESHEET_STATUS_LEAVE],
+			summary[TIMESHEET_STATUS_HOLIDAY], summary[TIMESHEET_STATUS_WEEK_OFF],
+			summary[FLD_OT_HOURS], summary[FLD_OT_PAYABLE_HOURS])
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// getStaffAttendance - Get the attendance sessions of each staff sorted by clock-in
+func (p *timesheetBaseService) getStaffAttendance(fromDate time.Time, toDate time.Time) (map[string][]utils.Map, error) {
+
+	filter := fmt.Sprintf(`{"%s.%s":{"$gte":"%s","$lte":"%s"},"%s":false}`,
+		hr_common.FLD_CLOCK_IN, hr_common.FLD_DATETIME,
+		fromDate.Format(time.DateTime), toDate.Add(24*time.Hour-time.Second).Format(time.DateTime),
+		db_common.FLD_IS_DELETED)
+
+	attendances, err := p.listRecords(p.daoAttendance, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(attendances, func(i, j int) bool {
+		return getAttendanceDateTime(attendances[i]) < getAttendanceDateTime(attendances[j])
+	})
+
+	staffAttendance := map[string][]utils.Map{}
+	for _, attendance := range attendances {
+		staffId, _ := utils.GetMemberDataStr(attendance, hr_common.FLD_STAFF_ID)
+		staffAttendance[staffId] = append(staffAttendance[staffId], attendance)
+	}
+
+	return staffAttendance, nil
+}
+
+// getMonthLeaves - Get the approved leave types keyed by staff_id/date
+func (p *timesheetBaseService) getMonthLeaves(monthStart time.Time, monthEnd time.Time) (map[string]string, error) {
+
+	// Leaves without leave_to are of the leave_from day
+	filter := fmt.Sprintf(`{"%s":{"$lte":"%s"},"$or":[{"%s":{"$gte":"%s"}},{"%s":{"$in":[null,""]},"%s":{"$gte":"%s"}}],"%s":{"$nin":["%s","%s","%s","%s"]},"%s":false}`,
+		hr_common.FLD_LEAVE_FROM, monthEnd.Add(24*time.Hour-time.Second).Format(time.DateTime),
+		hr_common.FLD_LEAVE_TO, monthStart.Format(time.DateTime),
+		hr_common.FLD_LEAVE_TO, hr_common.FLD_LEAVE_FROM, monthStart.Format(time.DateTime),
+		FLD_LEAVE_STATUS, LEAVE_STATUS_DRAFT, LEAVE_STATUS_SUBMITTED, LEAVE_STATUS_REJECTED, LEAVE_STATUS_CANCELLED,
+		db_common.FLD_IS_DELETED)
+
+	leaves, err := p.listRecords(p.daoLeave, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	leaveDays := map[string]string{}
+	for _, leaveInfo := range leaves {
+		// Permissions are not a day off
+		isPermission, _ := utils.GetMemberDataBool(leaveInfo, FLD_LEAVE_IS_PERMISSION)
+		if isPermission {
+			continue
+		}
+
+		staffId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_STAFF_ID)
+		leaveTypeId, _ := utils.GetMemberDataStr(leaveInfo, hr_common.FLD_LEAVETYPE_ID)
+
+		leaveFrom, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_FROM)
+		if err != nil {
+			continue
+		}
+		leaveTo, err := getLeaveDate(leaveInfo, hr_common.FLD_LEAVE_TO)
+		if err != nil {
+			leaveTo = leaveFrom
+		}
+
+		for day := leaveFrom; !day.After(leaveTo); day = day.AddDate(0, 0, 1) {
+			leaveDays[staffId+"/"+day.Format(time.DateOnly)] = leaveTypeId
+		}
+	}
+
+	return leaveDays, nil
+}
+
+// listRecords - List all the records matching the filter
+func (p *timesheetBaseService) listRecords(dao interface {
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+}, filter string) ([]utils.Map, error) {
+
+	response, err := dao.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList, err := utils.GetMemberData(response, db_common.LIST_RESULT)
+	if err != nil {
+		return []utils.Map{}, nil
+	}
+	return dataList.([]utils.Map), nil
+}
+
+// getStaffName - Get the staff name from the app user
+func (p *timesheetBaseService) getStaffName(staffId string) string {
+
+	userInfo, err := p.daoPlatformAppUser.Get(staffId)
+	if err != nil {
+		return ""
+	}
+
+	firstName, _ := utils.GetMemberDataStr(userInfo, platform_common.FLD_APP_USER_FNAME)
+	lastName, _ := utils.GetMemberDataStr(userInfo, platform_common.FLD_APP_USER_LNAME)
+	return strings.TrimSpace(firstName + " " + lastName)
+}
+
+// writeXLSX - Write the rows as a single sheet SpreadsheetML workbook
+func writeXLSX(writer io.Writer, sheetName string, rows [][]interface{}) error {
+
+	escape := func(text string) string {
+		var sb strings.Builder
+		_ = xml.EscapeText(&sb, []byte(text))
+		return sb.String()
+	}
+
+	var sheet strings.Builder
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for rowIdx, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, rowIdx+1)
+		for _, cell := range row {
+			switch val := cell.(type) {
+			case int, int32, int64, float32, float64:
+				fmt.Fprintf(&sheet, `<c><v>%v</v></c>`, val)
+			default:
+				fmt.Fprintf(&sheet, `<c t="inlineStr"><is><t>%s</t></is></c>`, escape(fmt.Sprint(val)))
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	// Sheet names are limited to 31 characters
+	sheetName = escape(utils.Left(sheetName, 31))
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + sheetName + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	zipWriter := zip.NewWriter(writer)
+	for _, part := range parts {
+		partWriter, err := zipWriter.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(partWriter, part.content)
+		if err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
@@ -0,0 +1,268 @@
+package hr_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-hr-repository/hr_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func newTestTimesheetService(t *testing.T, props utils.Map) *timesheetBaseService {
+	t.Helper()
+
+	timesheetService, err := NewTimesheetService(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(timesheetService.EndService)
+	return timesheetService.(*timesheetBaseService)
+}
+
+func TestMonthLeaves(t *testing.T) {
+
+	provider, props := newTestProvider()
+	leave := func(leaveId string, staffId string, leaveFrom string, leaveTo interface{}, status interface{}) utils.Map {
+		leaveInfo := utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVE_ID: leaveId, hr_common.FLD_STAFF_ID: staffId,
+			hr_common.FLD_LEAVETYPE_ID: leaveId, hr_common.FLD_LEAVE_FROM: leaveFrom}
+		if leaveTo != nil {
+			leaveInfo[hr_common.FLD_LEAVE_TO] = leaveTo
+		}
+		if status != nil {
+			leaveInfo[FLD_LEAVE_STATUS] = status
+		}
+		return leaveInfo
+	}
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		leave("across_months", "staff_1", "2030-03-30 09:00:00", "2030-04-02 18:00:00", LEAVE_STATUS_APPROVED),
+		leave("legacy_single_day", "staff_1", "2030-04-10 09:00:00", nil, nil),
+		leave("empty_leave_to", "staff_2", "2030-04-11 09:00:00", "", LEAVE_STATUS_APPROVED),
+		leave("draft", "staff_2", "2030-04-12 09:00:00", nil, LEAVE_STATUS_DRAFT),
+		leave("previous_month", "staff_2", "2030-03-15 09:00:00", nil, LEAVE_STATUS_APPROVED),
+		utils.MergeMap(leave("permission", "staff_2", "2030-04-15 10:00:00", "2030-04-15 11:00:00", LEAVE_STATUS_APPROVED),
+			utils.Map{FLD_LEAVE_IS_PERMISSION: true}, false),
+	)
+	p := newTestTimesheetService(t, props)
+
+	monthStart := time.Date(2030, 4, 1, 0, 0, 0, 0, time.UTC)
+	leaveDays, err := p.getMonthLeaves(monthStart, monthStart.AddDate(0, 1, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"staff_1/2030-03-30": "across_months",
+		"staff_1/2030-03-31": "across_months",
+		"staff_1/2030-04-01": "across_months",
+		"staff_1/2030-04-02": "across_months",
+		"staff_1/2030-04-10": "legacy_single_day",
+		"staff_2/2030-04-11": "empty_leave_to",
+	}
+	if !reflect.DeepEqual(leaveDays, expected) {
+		t.Errorf("Expected leave days %v, got %v", expected, leaveDays)
+	}
+}
+
+func TestGetTimesheet(t *testing.T) {
+
+	provider, props := newTestProvider()
+	provider.Seed(MEMORY_COLLECTION_STAFFS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_1"},
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_STAFF_ID: "staff_2"})
+	provider.Seed(MEMORY_COLLECTION_APP_USERS,
+		utils.Map{platform_common.FLD_APP_USER_ID: "staff_1", platform_common.FLD_APP_USER_FNAME: "Anu", platform_common.FLD_APP_USER_LNAME: "Raj"})
+	provider.Seed(MEMORY_COLLECTION_HOLIDAYS,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_HOLIDAY_ID: "holiday_1", FLD_HOLIDAY_DATE: "2024-02-14"})
+	provider.Seed(MEMORY_COLLECTION_OVERTIMES,
+		utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_OVERTIME_ID: "factor_weekday",
+			FLD_OT_DAY_TYPE: OT_DAY_TYPE_WEEKDAY, FLD_OT_HOURS_FACTOR: 1.5})
+	attendance := func(attendanceId string, clockIn string, clockOut string, netHours float64) utils.Map {
+		return utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_ATTENDANCE_ID: attendanceId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_CLOCK_IN:  utils.Map{hr_common.FLD_DATETIME: clockIn},
+			hr_common.FLD_CLOCK_OUT: utils.Map{hr_common.FLD_DATETIME: clockOut},
+			FLD_NET_HOURS:           netHours, FLD_SCHEDULED_HOURS: 8.0}
+	}
+	provider.Seed(MEMORY_COLLECTION_ATTENDANCES,
+		attendance("overtime", "2024-02-01 09:00:00", "2024-02-01 19:00:00", 10),
+		attendance("regular", "2024-02-02 09:00:00", "2024-02-02 17:00:00", 8),
+		attendance("week_off", "2024-02-04 10:00:00", "2024-02-04 12:00:00", 2),
+		utils.MergeMap(attendance("deleted", "2024-02-05 09:00:00", "2024-02-05 17:00:00", 8),
+			utils.Map{db_common.FLD_IS_DELETED: true}, false),
+	)
+	leave := func(leaveId string, leaveFrom string, leaveTo string) utils.Map {
+		return utils.Map{hr_common.FLD_BUSINESS_ID: testBusinessId, hr_common.FLD_LEAVE_ID: leaveId, hr_common.FLD_STAFF_ID: "staff_1",
+			hr_common.FLD_LEAVETYPE_ID: "casual", hr_common.FLD_LEAVE_FROM: leaveFrom, hr_common.FLD_LEAVE_TO: leaveTo, FLD_LEAVE_STATUS: LEAVE_STATUS_APPROVED}
+	}
+	provider.Seed(MEMORY_COLLECTION_LEAVES,
+		leave("leave_1", "2024-02-06 09:00:00", "2024-02-07 18:00:00"),
+		leave("leave_holiday", "2024-02-14 09:00:00", "2024-02-14 18:00:00"),
+	)
+
+	props[FLD_OT_DAILY_THRESHOLD] = 8
+	p := newTestTimesheetService(t, props)
+
+	_, err := p.GetTimesheet("2024/02")
+	assertErrorCode(t, err, "S30102")
+
+	timesheet, err := p.GetTimesheet("2024-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staffSheets := map[string]utils.Map{}
+	for _, staffSheet := range timesheet[db_common.LIST_RESULT].([]utils.Map) {
+		staffSheets[staffSheet[hr_common.FLD_STAFF_ID].(string)] = staffSheet
+	}
+	if len(staffSheets) != 2 || staffSheets["staff_1"][FLD_STAFF_NAME] != "Anu Raj" || staffSheets["staff_2"][FLD_STAFF_NAME] != "" {
+		t.Fatalf("Expected timesheet of staff_1 & staff_2, got %v", timesheet)
+	}
+
+	tests := []struct {
+		name    string
+		staffId string
+		date    string
+		status  string
+		otHours interface{}
+	}{
+		{"present with overtime", "staff_1", "2024-02-01", TIMESHEET_STATUS_PRESENT, 2.0},
+		{"present", "staff_1", "2024-02-02", TIMESHEET_STATUS_PRESENT, nil},
+		{"saturday without week-off", "staff_1", "2024-02-03", TIMESHEET_STATUS_ABSENT, nil},
+		{"present on week-off", "staff_1", "2024-02-04", TIMESHEET_STATUS_PRESENT, 2.0},
+		{"deleted attendance", "staff_1", "2024-02-05", TIMESHEET_STATUS_ABSENT, nil},
+		{"leave", "staff_1", "2024-02-07", TIMESHEET_STATUS_LEAVE, nil},
+		{"leave on holiday", "staff_1", "2024-02-14", TIMESHEET_STATUS_HOLIDAY, nil},
+		{"sunday", "staff_1", "2024-02-11", TIMESHEET_STATUS_WEEK_OFF, nil},
+		{"absent", "staff_2", "2024-02-01", TIMESHEET_STATUS_ABSENT, nil},
+		{"holiday", "staff_2", "2024-02-14", TIMESHEET_STATUS_HOLIDAY, nil},
+		{"leap day", "staff_2", "2024-02-29", TIMESHEET_STATUS_ABSENT, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			days := staffSheets[test.staffId][FLD_TIMESHEET_DAYS].([]utils.Map)
+			if len(days) != 29 {
+				t.Fatalf("Expected 29 days, got %d", len(days))
+			}
+
+			dayIdx, _ := time.Parse(time.DateOnly, test.date)
+			dayInfo := days[dayIdx.Day()-1]
+			if dayInfo[FLD_TIMESHEET_DATE] != test.date || dayInfo[FLD_TIMESHEET_STATUS] != test.status || dayInfo[FLD_OT_HOURS] != test.otHours {
+				t.Errorf("Expected %s %s with overtime %v, got %v", test.date, test.status, test.otHours, dayInfo)
+			}
+		})
+	}
+
+	expectedSummary := map[string]utils.Map{
+		"staff_1": {TIMESHEET_STATUS_PRESENT: 3, TIMESHEET_STATUS_ABSENT: 20, TIMESHEET_STATUS_LEAVE: 2, TIMESHEET_STATUS_HOLIDAY: 1,
+			TIMESHEET_STATUS_WEEK_OFF: 3, FLD_OT_HOURS: 4.0, FLD_OT_PAYABLE_HOURS: 5.0},
+		"staff_2": {TIMESHEET_STATUS_PRESENT: 0, TIMESHEET_STATUS_ABSENT: 24, TIMESHEET_STATUS_LEAVE: 0, TIMESHEET_STATUS_HOLIDAY: 1,
+			TIMESHEET_STATUS_WEEK_OFF: 4, FLD_OT_HOURS: 0.0, FLD_OT_PAYABLE_HOURS: 0.0},
+	}
+	for staffId, expected := range expectedSummary {
+		if summary := staffSheets[staffId][FLD_TIMESHEET_SUMMARY]; !reflect.DeepEqual(summary, expected) {
+			t.Errorf("Expected summary %v of %s, got %v", expected, staffId, summary)
+		}
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+
+	type xlsxCell struct {
+		Type  string `xml:"t,attr"`
+		Value string `xml:"v"`
+		Text  string `xml:"is>t"`
+	}
+	type xlsxSheet struct {
+		Rows []struct {
+			Index int        `xml:"r,attr"`
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	type xlsxWorkbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+
+	tests := []struct {
+		name      string
+		sheetName string
+		rows      [][]interface{}
+		expected  [][]xlsxCell
+		sheet     string
+	}{
+		{"numbers and text", "Timesheet 2024-02",
+			[][]interface{}{{"Staff ID", "Present", "OT Hours"}, {"staff_1", 3, 4.5}},
+			[][]xlsxCell{
+				{{"inlineStr", "", "Staff ID"}, {"inlineStr", "", "Present"}, {"inlineStr", "", "OT Hours"}},
+				{{"inlineStr", "", "staff_1"}, {"", "3", ""}, {"", "4.5", ""}}},
+			"Timesheet 2024-02"},
+		{"escaped text", "Tom & Jerry <Sheet>",
+			[][]interface{}{{"A & B", "<P +2h>", nil}},
+			[][]xlsxCell{{{"inlineStr", "", "A & B"}, {"inlineStr", "", "<P +2h>"}, {"inlineStr", "", "<nil>"}}},
+			"Tom & Jerry <Sheet>"},
+		{"long sheet name", strings.Repeat("x", 40), [][]interface{}{}, nil, strings.Repeat("x", 31)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeXLSX(&buf, test.sheetName, test.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := map[string][]byte{}
+			for _, file := range zipReader.File {
+				reader, err := file.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				parts[file.Name], err = io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+				if _, ok := parts[name]; !ok {
+					t.Errorf("Expected part %s in workbook", name)
+				}
+			}
+
+			var workbook xlsxWorkbook
+			err = xml.Unmarshal(parts["xl/workbook.xml"], &workbook)
+			if err != nil || len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != test.sheet {
+				t.Errorf("Expected sheet %q, got %v %v", test.sheet, workbook, err)
+			}
+
+			var sheet xlsxSheet
+			err = xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cells := [][]xlsxCell{}
+			for rowIdx, row := range sheet.Rows {
+				if row.Index != rowIdx+1 {
+					t.Errorf("Expected row %d, got %d", rowIdx+1, row.Index)
+				}
+				cells = append(cells, row.Cells)
+			}
+			if len(cells) != len(test.expected) || (len(cells) > 0 && !reflect.DeepEqual(cells, test.expected)) {
+				t.Errorf("Expected cells %v, got %v", test.expected, cells)
+			}
+		})
+	}
+}
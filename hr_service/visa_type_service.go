@@ -2,14 +2,11 @@ package hr_service
 
 import (
 	"log"
-	"strings"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
@@ -21,6 +18,7 @@ type VisaTypeService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(visatype_Id string, indata utils.Map) (utils.Map, error)
 	Delete(visatype_Id string, delete_permanent bool) error
+	DeleteAndReassign(visatype_Id string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +29,9 @@ type VisaTypeService interface {
 
 // visatypeBaseService - Accounts Service structure
 type visatypeBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoVisaType         hr_repository.VisaTypeDao
+	daoStaff            hr_repository.StaffDao
 	daoPlatformBusiness platform_repository.BusinessDao
 
 	child      VisaTypeService
@@ -57,25 +55,19 @@ func NewVisaTypeService(props utils.Map) (VisaTypeService, error) {
 
 	p := visatypeBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId & StaffId
 	p.businessId = businessId
 
 	// Instantiate other services
-	p.daoVisaType = hr_repository.NewVisaTypeDao(p.dbRegion.GetClient(), p.businessId)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoVisaType = p.NewVisaTypeDao(p.businessId)
+	p.daoStaff = p.NewStaffDao(p.businessId)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessId)
 	if err != nil {
@@ -92,8 +84,7 @@ func NewVisaTypeService(props utils.Map) (VisaTypeService, error) {
 }
 
 func (p *visatypeBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -132,20 +123,20 @@ func (p *visatypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var visatype_Id string
+	// Validate the payload fields
+	err := normalizePayload[VisaType](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_VISA_TYPE_ID]
-	if dataok {
-		visatype_Id = strings.ToLower(dataval.(string))
-	} else {
-		visatype_Id = utils.GenerateUniqueId("vity")
-		log.Println("Unique Account ID", visatype_Id)
+	visatype_Id, err := getPayloadId(indata, hr_common.FLD_VISA_TYPE_ID, ID_PREFIX_VISA_TYPE)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_VISA_TYPE_ID] = visatype_Id
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessId
 	log.Println("Provided Account ID:", visatype_Id)
 
-	_, err := p.daoVisaType.Get(visatype_Id)
+	_, err = p.daoVisaType.Get(visatype_Id)
 	if err == nil {
 		err := &utils.AppError{
 			ErrorCode:   "S30102",
@@ -167,6 +158,12 @@ func (p *visatypeBaseService) Update(visatype_Id string, indata utils.Map) (util
 
 	log.Println("VisaTypeService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[VisaType](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoVisaType.Get(visatype_Id)
 	if err != nil {
 		return data, err
@@ -186,6 +183,12 @@ func (p *visatypeBaseService) Delete(visatype_Id string, delete_permanent bool)
 
 	log.Println("VisaTypeService::Delete - Begin", visatype_Id)
 
+	// Records still referring the visa type can't be deleted
+	err := checkReferences(p.getReferences(), "Visa Type", visatype_Id)
+	if err != nil {
+		return err
+	}
+
 	daoVisaType := p.daoVisaType
 	if delete_permanent {
 		result, err := daoVisaType.Delete(visatype_Id)
@@ -206,6 +209,29 @@ func (p *visatypeBaseService) Delete(visatype_Id string, delete_permanent bool)
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the visa type to another visa type
+// and delete the visa type
+//
+// ************************************************************************
+func (p *visatypeBaseService) DeleteAndReassign(visatype_Id string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("VisaTypeService::DeleteAndReassign - Begin", visatype_Id, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Visa Type", p.daoVisaType, p.getReferences(), visatype_Id, reassign_id, func() error {
+		return p.Delete(visatype_Id, delete_permanent)
+	})
+	log.Println("VisaTypeService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the visa type
+func (p *visatypeBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_VISA_TYPE_ID),
+	}
+}
+
 func (p *visatypeBaseService) errorReturn(err error) (VisaTypeService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -2,17 +2,29 @@ package hr_service
 
 import (
 	"log"
-	"strings"
+	"math"
 
 	"github.com/zapscloud/golib-dbutils/db_common"
-	"github.com/zapscloud/golib-dbutils/db_utils"
 	"github.com/zapscloud/golib-hr-repository/hr_common"
 	"github.com/zapscloud/golib-hr-repository/hr_repository"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
-	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
 )
 
+const (
+	// WorkLocation Geofence Fields
+	FLD_LATITUDE         = "latitude"
+	FLD_LONGITUDE        = "longitude"
+	FLD_GEOFENCE_RADIUS  = "geofence_radius"
+	FLD_GEOFENCE_POLYGON = "geofence_polygon"
+
+	// Mean Earth radius in meters
+	EARTH_RADIUS_METERS = 6371000
+
+	// WorkLocation Error Codes
+	ERRCODE_INVALID_GEOFENCE = "S30115"
+)
+
 // WorkLocationService - Accounts Service structure
 type WorkLocationService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
@@ -21,6 +33,7 @@ type WorkLocationService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(workLocId string, indata utils.Map) (utils.Map, error)
 	Delete(workLocId string, delete_permanent bool) error
+	DeleteAndReassign(workLocId string, reassign_id string, delete_permanent bool) error
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,9 +44,10 @@ type WorkLocationService interface {
 
 // workLocationBaseService - Accounts Service structure
 type workLocationBaseService struct {
-	db_utils.DatabaseService
-	dbRegion            db_utils.DatabaseService
+	DaoProvider
 	daoWorkLocation     hr_repository.WorkLocationDao
+	daoStaff            hr_repository.StaffDao
+	daoHoliday          hr_repository.HolidayDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               WorkLocationService
 	businessID          string
@@ -56,25 +70,20 @@ func NewWorkLocationService(props utils.Map) (WorkLocationService, error) {
 
 	p := workLocationBaseService{}
 
-	// Open Database Service
-	err = p.OpenDatabaseService(props)
+	// Open Database Services, unless the DaoProvider is given
+	p.DaoProvider, err = openDaoProvider(props)
 	if err != nil {
 		return nil, err
 	}
 
-	// Open RegionDB Service
-	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
-	if err != nil {
-		p.CloseDatabaseService()
-		return nil, err
-	}
-
 	// Assign the BusinessId
 	p.businessID = businessId
 
 	// Instantiate other services
-	p.daoWorkLocation = hr_repository.NewWorkLocationDao(p.dbRegion.GetClient(), p.businessID)
-	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoWorkLocation = p.NewWorkLocationDao(p.businessID)
+	p.daoStaff = p.NewStaffDao(p.businessID)
+	p.daoHoliday = p.NewHolidayDao(p.businessID)
+	p.daoPlatformBusiness = p.NewBusinessDao()
 
 	_, err = p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
@@ -91,8 +100,7 @@ func NewWorkLocationService(props utils.Map) (WorkLocationService, error) {
 }
 
 func (p *workLocationBaseService) EndService() {
-	p.CloseDatabaseService()
-	p.dbRegion.CloseDatabaseService()
+	p.Close()
 }
 
 // List - List All records
@@ -131,25 +139,31 @@ func (p *workLocationBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
-	var holidayId string
+	// Validate the payload fields
+	err := normalizePayload[WorkLocation](indata, false)
+	if err != nil {
+		return indata, err
+	}
 
-	dataval, dataok := indata[hr_common.FLD_WORKLOCATION_ID]
-	if dataok {
-		holidayId = strings.ToLower(dataval.(string))
-	} else {
-		holidayId = utils.GenerateUniqueId("wrkloc")
-		log.Println("Unique Account ID", holidayId)
+	holidayId, err := getPayloadId(indata, hr_common.FLD_WORKLOCATION_ID, ID_PREFIX_WORK_LOCATION)
+	if err != nil {
+		return indata, err
 	}
-	indata[hr_common.FLD_WORKLOCATION_ID] = holidayId
 	indata[hr_common.FLD_BUSINESS_ID] = p.businessID
 	log.Println("Provided Account ID:", holidayId)
 
-	_, err := p.daoWorkLocation.Get(holidayId)
+	_, err = p.daoWorkLocation.Get(holidayId)
 	if err == nil {
 		err := &utils.AppError{ErrorCode: "S30102", ErrorMsg: "Existing Account ID !", ErrorDetail: "Given Account ID already exist"}
 		return indata, err
 	}
 
+	// Validate the coordinates & the geofence
+	err = validateWorkLocation(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoWorkLocation.Create(indata)
 	if err != nil {
 		return indata, err
@@ -163,6 +177,12 @@ func (p *workLocationBaseService) Update(workLocId string, indata utils.Map) (ut
 
 	log.Println("AccountService::Update - Begin")
 
+	// Validate the payload fields being updated
+	err := normalizePayload[WorkLocation](indata, true)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err := p.daoWorkLocation.Get(workLocId)
 	if err != nil {
 		return data, err
@@ -172,6 +192,15 @@ func (p *workLocationBaseService) Update(workLocId string, indata utils.Map) (ut
 	delete(indata, hr_common.FLD_WORKLOCATION_ID)
 	delete(indata, hr_common.FLD_BUSINESS_ID)
 
+	// Validate the coordinates & the geofence as they will be after the update
+	for key, value := range indata {
+		data[key] = value
+	}
+	err = validateWorkLocation(data)
+	if err != nil {
+		return indata, err
+	}
+
 	data, err = p.daoWorkLocation.Update(workLocId, indata)
 	log.Println("AccountService::Update - End ")
 	return data, err
@@ -188,6 +217,12 @@ func (p *workLocationBaseService) Delete(workLocId string, delete_permanent bool
 		return err
 	}
 
+	// Records still referring the work location can't be deleted
+	err = checkReferences(p.getReferences(), "Work Location", workLocId)
+	if err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := daoWorkLocation.Delete(workLocId)
 		if err != nil {
@@ -207,8 +242,197 @@ func (p *workLocationBaseService) Delete(workLocId string, delete_permanent bool
 	return nil
 }
 
+// ************************************************************************
+// DeleteAndReassign - Refer the records using the work location to another work location
+// and delete the work location
+//
+// ************************************************************************
+func (p *workLocationBaseService) DeleteAndReassign(workLocId string, reassign_id string, delete_permanent bool) error {
+
+	log.Println("WorkLocationService::DeleteAndReassign - Begin", workLocId, reassign_id)
+
+	err := deleteAndReassign(p.DaoProvider, "Work Location", p.daoWorkLocation, p.getReferences(), workLocId, reassign_id, func() error {
+		return p.Delete(workLocId, delete_permanent)
+	})
+	log.Println("WorkLocationService::DeleteAndReassign - End", err)
+	return err
+}
+
+// getReferences - Records referring the work location
+func (p *workLocationBaseService) getReferences() []recordReference {
+	return []recordReference{
+		staffReference(p.daoStaff, hr_common.FLD_WORKLOCATION_ID),
+		{
+			referenceType: REFERENCE_TYPE_HOLIDAY,
+			idField:       hr_common.FLD_HOLIDAY_ID,
+			fields:        []string{FLD_HOLIDAY_WORKLOCATION_IDS},
+			dao:           p.daoHoliday,
+		},
+	}
+}
+
 func (p *workLocationBaseService) errorReturn(err error) (WorkLocationService, error) {
 	// Close the Database Connection
 	p.EndService()
 	return nil, err
 }
+
+// validateWorkLocation - Validate the coordinates of the work location and its geofence, the geofence
+// radius & polygon need the coordinates of the work location
+func validateWorkLocation(data utils.Map) error {
+
+	invalidGeofence := func(detail string) error {
+		return &utils.AppError{ErrorCode: ERRCODE_INVALID_GEOFENCE, ErrorMsg: "Invalid Geofence", ErrorDetail: detail}
+	}
+
+	hasValue := func(field string) bool {
+		return data[field] != nil && data[field] != ""
+	}
+
+	if hasValue(FLD_LATITUDE) != hasValue(FLD_LONGITUDE) {
+		return invalidGeofence(FLD_LATITUDE + " and " + FLD_LONGITUDE + " should be sent together")
+	}
+
+	if hasValue(FLD_LATITUDE) {
+		latitude, err := getMemberDataFloat(data, FLD_LATITUDE)
+		if err != nil || latitude < -90 || latitude > 90 {
+			return invalidGeofence(FLD_LATITUDE + " should be a number between -90 and 90")
+		}
+		longitude, err := getMemberDataFloat(data, FLD_LONGITUDE)
+		if err != nil || longitude < -180 || longitude > 180 {
+			return invalidGeofence(FLD_LONGITUDE + " should be a number between -180 and 180")
+		}
+	} else if hasValue(FLD_GEOFENCE_RADIUS) || hasValue(FLD_GEOFENCE_POLYGON) {
+		return invalidGeofence("Geofence needs the " + FLD_LATITUDE + " and " + FLD_LONGITUDE + " of the work location")
+	}
+
+	if hasValue(FLD_GEOFENCE_RADIUS) {
+		radius, err := getMemberDataFloat(data, FLD_GEOFENCE_RADIUS)
+		if err != nil || radius <= 0 {
+			return invalidGeofence(FLD_GEOFENCE_RADIUS + " should be a number greater than 0")
+		}
+	}
+
+	if hasValue(FLD_GEOFENCE_POLYGON) {
+		polygon, err := getGeofencePolygon(data)
+		if err != nil {
+			return invalidGeofence(FLD_GEOFENCE_POLYGON + " should have minimum 3 points of latitude and longitude")
+		}
+		for _, point := range polygon {
+			if point[0] < -90 || point[0] > 90 || point[1] < -180 || point[1] > 180 {
+				return invalidGeofence(FLD_GEOFENCE_POLYGON + " has a point out of the latitude and longitude range")
+			}
+		}
+	}
+	return nil
+}
+
+// getGeofenceDistance - Get the distance in meters of the given point from the work location and
+// whether the point lies inside the work location's geofence polygon or radius
+func getGeofenceDistance(workLocInfo utils.Map, latitude float64, longitude float64, defaultRadius float64) (float64, bool, error) {
+
+	locLatitude, err := getMemberDataFloat(workLocInfo, FLD_LATITUDE)
+	if err != nil {
+		return 0, false, err
+	}
+
+	locLongitude, err := getMemberDataFloat(workLocInfo, FLD_LONGITUDE)
+	if err != nil {
+		return 0, false, err
+	}
+
+	distance := getHaversineDistance(locLatitude, locLongitude, latitude, longitude)
+
+	// Polygon takes the precedence over the radius
+	polygon, err := getGeofencePolygon(workLocInfo)
+	if err == nil {
+		return distance, isPointInPolygon(polygon, latitude, longitude), nil
+	}
+
+	radius, err := getMemberDataFloat(workLocInfo, FLD_GEOFENCE_RADIUS)
+	if err != nil || radius <= 0 {
+		radius = defaultRadius
+	}
+
+	return distance, distance <= radius, nil
+}
+
+// hasGeofence - Check the work location has the coordinates the geofence is centered on
+func hasGeofence(workLocInfo utils.Map) bool {
+	_, errLat := getMemberDataFloat(workLocInfo, FLD_LATITUDE)
+	_, errLon := getMemberDataFloat(workLocInfo, FLD_LONGITUDE)
+	return errLat == nil && errLon == nil
+}
+
+// getGeofencePolygon - Get the polygon vertices as [latitude, longitude] pairs
+func getGeofencePolygon(workLocInfo utils.Map) ([][2]float64, error) {
+
+	dataVal, err := utils.GetMemberData(workLocInfo, FLD_GEOFENCE_POLYGON)
+	if err != nil {
+		return nil, err
+	}
+
+	points, ok := toSlice(dataVal)
+	if !ok || len(points) < 3 {
+		err := &utils.AppError{ErrorStatus: 400, ErrorMsg: "Invalid Geofence", ErrorDetail: FLD_GEOFENCE_POLYGON + " should have minimum 3 points"}
+		return nil, err
+	}
+
+	polygon := make([][2]float64, 0, len(points))
+	for _, point := range points {
+		var latitude, longitude float64
+
+		if pointMap, ok := toMap(point); ok {
+			// Point sent as {"latitude":.., "longitude":..}
+			latitude, err = getMemberDataFloat(pointMap, FLD_LATITUDE)
+			if err == nil {
+				longitude, err = getMemberDataFloat(pointMap, FLD_LONGITUDE)
+			}
+		} else if pointArr, ok := toSlice(point); ok && len(pointArr) == 2 {
+			// Point sent as [latitude, longitude]
+			pointMap := utils.Map{FLD_LATITUDE: pointArr[0], FLD_LONGITUDE: pointArr[1]}
+			latitude, err = getMemberDataFloat(pointMap, FLD_LATITUDE)
+			if err == nil {
+				longitude, err = getMemberDataFloat(pointMap, FLD_LONGITUDE)
+			}
+		} else {
+			err = &utils.AppError{ErrorStatus: 400, ErrorMsg: "Invalid Geofence", ErrorDetail: FLD_GEOFENCE_POLYGON + " has invalid point"}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		polygon = append(polygon, [2]float64{latitude, longitude})
+	}
+
+	return polygon, nil
+}
+
+// getHaversineDistance - Get the great-circle distance in meters between two points
+func getHaversineDistance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return EARTH_RADIUS_METERS * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// isPointInPolygon - Ray casting check whether the point lies inside the polygon
+func isPointInPolygon(polygon [][2]float64, latitude float64, longitude float64) bool {
+	inside := false
+
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		latI, lonI := polygon[i][0], polygon[i][1]
+		latJ, lonJ := polygon[j][0], polygon[j][1]
+
+		if (lonI > longitude) != (lonJ > longitude) &&
+			latitude < (latJ-latI)*(longitude-lonI)/(lonJ-lonI)+latI {
+			inside = !inside
+		}
+	}
+	return inside
+}